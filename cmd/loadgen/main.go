@@ -0,0 +1,247 @@
+// Command loadgen replays a word list as keystroke-by-keystroke prefix
+// queries against an autocomplete server at a fixed rate and reports latency
+// percentiles and error rates.
+//
+// Usage:
+//
+//	loadgen -target http://localhost:8080 -words words.txt -qps 500 -duration 1m
+//
+// Requests are rate limited per user, so assign the load test user a tier
+// with enough headroom first (PUT /api/v1/admin/users/{username}/tier) or
+// most responses will be 429s.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+func main() {
+	target := flag.String("target", "http://localhost:8080", "base URL of the server")
+	wordsFile := flag.String("words", "", "file with one word per line (required)")
+	qps := flag.Int("qps", 100, "queries per second")
+	duration := flag.Duration("duration", 30*time.Second, "how long to run")
+	workers := flag.Int("workers", 64, "maximum concurrent requests")
+	dict := flag.String("dict", "", "dictionary to query")
+	token := flag.String("token", "", "bearer token; obtained by logging in when empty")
+	username := flag.String("username", "user1", "username to log in with")
+	password := flag.String("password", "password123", "password to log in with")
+	minPrefix := flag.Int("min-prefix", 1, "shortest prefix sent per word")
+	flag.Parse()
+
+	if *wordsFile == "" || *qps <= 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	words, err := readWords(*wordsFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *token == "" {
+		if *token, err = login(*target, *username, *password); err != nil {
+			log.Fatalf("logging in: %v", err)
+		}
+	}
+
+	queries := make(chan string, *workers)
+	go keystrokes(words, *minPrefix, queries)
+
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			MaxIdleConns:        *workers,
+			MaxIdleConnsPerHost: *workers,
+		},
+	}
+	var rec recorder
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, *workers)
+	ticker := time.NewTicker(time.Second / time.Duration(*qps))
+	defer ticker.Stop()
+	deadline := time.After(*duration)
+	start := time.Now()
+
+loop:
+	for {
+		select {
+		case <-deadline:
+			break loop
+		case <-ticker.C:
+		}
+		select {
+		case sem <- struct{}{}:
+		default:
+			// Every worker is busy: the server is not keeping up.
+			rec.dropped++
+			continue
+		}
+		prefix := <-queries
+		wg.Add(1)
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			rec.add(query(client, *target, *token, *dict, prefix))
+		}()
+	}
+	wg.Wait()
+	rec.report(os.Stdout, time.Since(start))
+}
+
+// readWords reads the non-empty lines of path.
+func readWords(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var words []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if word := strings.TrimSpace(scanner.Text()); word != "" {
+			words = append(words, word)
+		}
+	}
+	if len(words) == 0 && scanner.Err() == nil {
+		return nil, fmt.Errorf("%s contains no words", path)
+	}
+	return words, scanner.Err()
+}
+
+// keystrokes sends every prefix of randomly chosen words in typing order, the
+// way an interactive client queries as the user types.
+func keystrokes(words []string, minPrefix int, out chan<- string) {
+	for {
+		word := []rune(words[rand.Intn(len(words))])
+		for n := minPrefix; n <= len(word); n++ {
+			out <- string(word[:n])
+		}
+	}
+}
+
+func login(target, username, password string) (string, error) {
+	body, _ := json.Marshal(map[string]string{"username": username, "password": password})
+	resp, err := http.Post(target+"/api/login", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("status %s", resp.Status)
+	}
+	var result struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	return result.Token, nil
+}
+
+type result struct {
+	latency time.Duration
+	status  int
+	err     error
+}
+
+func query(client *http.Client, target, token, dict, prefix string) result {
+	params := url.Values{"prefix": {prefix}}
+	if dict != "" {
+		params.Set("dict", dict)
+	}
+	req, err := http.NewRequest(http.MethodGet, target+"/api/v1/words?"+params.Encode(), nil)
+	if err != nil {
+		return result{err: err}
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return result{latency: time.Since(start), err: err}
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return result{latency: time.Since(start), status: resp.StatusCode}
+}
+
+// recorder collects results for the final report.
+type recorder struct {
+	mu        sync.Mutex
+	latencies []time.Duration
+	statuses  map[int]int
+	errors    map[string]int
+	dropped   int
+}
+
+func (r *recorder) add(res result) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.statuses == nil {
+		r.statuses = make(map[int]int)
+		r.errors = make(map[string]int)
+	}
+	if res.err != nil {
+		r.errors[res.err.Error()]++
+		return
+	}
+	r.statuses[res.status]++
+	r.latencies = append(r.latencies, res.latency)
+}
+
+func (r *recorder) report(w io.Writer, elapsed time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sort.Slice(r.latencies, func(i, j int) bool { return r.latencies[i] < r.latencies[j] })
+
+	total, failed := len(r.latencies), 0
+	for _, n := range r.errors {
+		total += n
+		failed += n
+	}
+	for status, n := range r.statuses {
+		if status >= 400 {
+			failed += n
+		}
+	}
+
+	fmt.Fprintf(w, "requests:  %d in %s (%.1f/s)\n", total, elapsed.Round(time.Millisecond), float64(total)/elapsed.Seconds())
+	fmt.Fprintf(w, "dropped:   %d (all workers busy)\n", r.dropped)
+	if total > 0 {
+		fmt.Fprintf(w, "errors:    %d (%.2f%%)\n", failed, 100*float64(failed)/float64(total))
+	}
+	if len(r.latencies) > 0 {
+		fmt.Fprintf(w, "latency:   p50 %s  p90 %s  p99 %s  p99.9 %s  max %s\n",
+			percentile(r.latencies, 0.50), percentile(r.latencies, 0.90),
+			percentile(r.latencies, 0.99), percentile(r.latencies, 0.999),
+			r.latencies[len(r.latencies)-1])
+	}
+
+	statuses := make([]int, 0, len(r.statuses))
+	for status := range r.statuses {
+		statuses = append(statuses, status)
+	}
+	sort.Ints(statuses)
+	for _, status := range statuses {
+		fmt.Fprintf(w, "status %d: %d\n", status, r.statuses[status])
+	}
+	for msg, n := range r.errors {
+		fmt.Fprintf(w, "error %q: %d\n", msg, n)
+	}
+}
+
+// percentile returns the p-th percentile of sorted latencies.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	return sorted[int(p*float64(len(sorted)-1))]
+}
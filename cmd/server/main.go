@@ -2,39 +2,101 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"log"
-	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
-	"github.com/cg011235/autocomplete/internal/handlers"
-	"github.com/cg011235/autocomplete/internal/middleware"
-	"github.com/gorilla/mux"
+	"github.com/cg011235/autocomplete/internal/upgrade"
+	"github.com/cg011235/autocomplete/pkg/server"
 )
 
 func main() {
-	secretKey := os.Getenv("SECRET_KEY")
-	if secretKey == "" {
-		log.Fatal("SECRET_KEY environment variable is required")
-	}
-	middleware.SetSecretKey([]byte(secretKey))
-	handlers.SetSecretKey([]byte(secretKey))
+	repair := flag.Bool("repair", false, "Recover from corrupt snapshots and write-ahead logs on startup, dropping the damaged data")
+	load := flag.String("load", "", "Store the comma-separated word files, - for standard input, as a new version of -load-dict in DATA_DIR and exit without serving")
+	loadDict := flag.String("load-dict", "", "Dictionary built by -load (default DEFAULT_DICTIONARY)")
+	loadFormat := flag.String("load-format", "words", "Format of the -load files: words, hunspell or frequency")
+	flag.Parse()
 
-	r := mux.NewRouter()
+	cfg, err := server.LoadConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *load != "" {
+		if cfg.DataDir == "" {
+			log.Fatal("-load requires DATA_DIR")
+		}
+		name := *loadDict
+		if name == "" {
+			name = cfg.DefaultDictionary
+		}
+		version, words, err := server.BuildSnapshot(cfg, name, strings.Split(*load, ","), *loadFormat)
+		if err != nil {
+			log.Fatalf("building snapshot: %v", err)
+		}
+		log.Printf("stored %d words as version %d of %q", words, version, name)
+		return
+	}
+	cfg.Repair = *repair
 
-	r.Use(middleware.LoggingMiddleware)
-	r.Use(middleware.RateLimitMiddleware)
+	srv, err := server.New(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := serve(cfg, srv); err != nil {
+		log.Fatal(err)
+	}
+}
 
-	// Login route does not require JWT middleware
-	r.HandleFunc("/api/login", handlers.LoginHandler).Methods("POST")
+// serve serves srv until SIGINT or SIGTERM, then drains in-flight requests
+// for up to cfg.ShutdownTimeout. On SIGHUP a new copy of the binary is
+// started on the same listeners and this process drains and exits once it is
+// ready, so upgrades never refuse connections.
+func serve(cfg *server.Config, srv *server.Server) error {
+	upg, err := upgrade.New()
+	if err != nil {
+		return err
+	}
+	srv.Listen = upg.Listen
+	if err := srv.Start(); err != nil {
+		return err
+	}
+	if err := upg.Ready(); err != nil {
+		log.Printf("signalling parent process: %v", err)
+	}
 
-	// Version 1 routes
-	v1 := r.PathPrefix("/api/v1").Subrouter()
-	v1.Use(middleware.JwtMiddleware)
-	v1.HandleFunc("/", handlers.RootHandler).Methods("GET")
-	v1.HandleFunc("/words", handlers.AddWordsHandlerV1).Methods("POST")
-	v1.HandleFunc("/words", handlers.ListWordsHandlerV1).Methods("GET")
-	v1.HandleFunc("/words", handlers.DeleteWordsHandlerV1).Methods("DELETE")
-	v1.HandleFunc("/words/exists", handlers.WordsExistsHandlerV1).Methods("GET")
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
+wait:
+	for {
+		select {
+		case err := <-srv.Errors():
+			return err
+		case sig := <-signals:
+			if sig != syscall.SIGHUP {
+				break wait
+			}
+			log.Print("Upgrading: starting new process")
+			// The new process replays the write-ahead logs, so stop writing
+			// to them before it starts
+			resume := srv.Handoff()
+			if err := upg.Upgrade(); err != nil {
+				if rerr := resume(); rerr != nil {
+					log.Printf("upgrade failed, still serving read-only as the write-ahead logs cannot be reopened: %v, %v", err, rerr)
+					continue
+				}
+				log.Printf("upgrade failed, still serving: %v", err)
+				continue
+			}
+			log.Print("Upgrade complete, draining")
+			break wait
+		}
+	}
 
-	log.Fatal(http.ListenAndServe(":8080", r))
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	return srv.Shutdown(ctx)
 }
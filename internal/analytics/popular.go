@@ -0,0 +1,138 @@
+// Package analytics records how the suggest API is used.
+package analytics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Query is a dictionary prefix and how often it was requested.
+type Query struct {
+	Dict   string `json:"dict"`
+	Prefix string `json:"prefix"`
+	Count  int    `json:"count"`
+}
+
+type queryKey struct {
+	dict, prefix string
+}
+
+// Popular counts suggest queries per dictionary and prefix. To bound memory,
+// once it tracks more than max prefixes the less popular half is dropped.
+type Popular struct {
+	mu     sync.Mutex
+	counts map[queryKey]int
+	max    int
+}
+
+// NewPopular creates a Popular tracking at most max distinct queries.
+func NewPopular(max int) *Popular {
+	return &Popular{counts: make(map[queryKey]int), max: max}
+}
+
+// Record counts one query for prefix in dict.
+func (p *Popular) Record(dict, prefix string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.counts[queryKey{dict, prefix}]++
+	if len(p.counts) > p.max {
+		p.prune()
+	}
+}
+
+// prune keeps the more popular half of the tracked queries.
+func (p *Popular) prune() {
+	top := p.top(p.max / 2)
+	p.counts = make(map[queryKey]int, p.max)
+	for _, q := range top {
+		p.counts[queryKey{q.Dict, q.Prefix}] = q.Count
+	}
+}
+
+// Top returns the n most requested queries, most popular first.
+func (p *Popular) Top(n int) []Query {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.top(n)
+}
+
+func (p *Popular) top(n int) []Query {
+	all := make([]Query, 0, len(p.counts))
+	for k, c := range p.counts {
+		all = append(all, Query{Dict: k.dict, Prefix: k.prefix, Count: c})
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Count != all[j].Count {
+			return all[i].Count > all[j].Count
+		}
+		if all[i].Dict != all[j].Dict {
+			return all[i].Dict < all[j].Dict
+		}
+		return all[i].Prefix < all[j].Prefix
+	})
+	if len(all) > n {
+		all = all[:n]
+	}
+	return all
+}
+
+// Save writes the tracked queries to path.
+func (p *Popular) Save(path string) error {
+	queries := p.Top(p.max)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	data, err := json.Marshal(queries)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Load merges the queries saved at path into the counts. A missing file is not an error.
+func (p *Popular) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var queries []Query
+	if err := json.Unmarshal(data, &queries); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, q := range queries {
+		p.counts[queryKey{q.Dict, q.Prefix}] += q.Count
+	}
+	return nil
+}
+
+// RunSaver saves the queries to path every interval until ctx is cancelled.
+func (p *Popular) RunSaver(ctx context.Context, path string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := p.Save(path); err != nil {
+				log.Printf("analytics: saving popular queries: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,58 @@
+// Package bloom implements a lock-free Bloom filter for string membership tests.
+package bloom
+
+import (
+	"hash/fnv"
+	"sync/atomic"
+)
+
+// Filter is a Bloom filter safe for concurrent use: Add and MayContain
+// use atomic operations, so readers never block on writers.
+type Filter struct {
+	words []uint64
+	m     uint64 // number of bits
+	k     uint64 // number of hash functions
+}
+
+// New creates a Filter with m bits (rounded up to a multiple of 64) and k hash functions.
+func New(m, k int) *Filter {
+	words := (m + 63) / 64
+	return &Filter{words: make([]uint64, words), m: uint64(words * 64), k: uint64(k)}
+}
+
+// Add inserts s into the filter.
+func (f *Filter) Add(s string) {
+	h1, h2 := hash(s)
+	for i := uint64(0); i < f.k; i++ {
+		bit := (h1 + i*h2) % f.m
+		addr := &f.words[bit/64]
+		mask := uint64(1) << (bit % 64)
+		for {
+			old := atomic.LoadUint64(addr)
+			if old&mask != 0 || atomic.CompareAndSwapUint64(addr, old, old|mask) {
+				break
+			}
+		}
+	}
+}
+
+// MayContain reports whether s may have been added. A false result is
+// definite; a true result may be a false positive.
+func (f *Filter) MayContain(s string) bool {
+	h1, h2 := hash(s)
+	for i := uint64(0); i < f.k; i++ {
+		bit := (h1 + i*h2) % f.m
+		if atomic.LoadUint64(&f.words[bit/64])&(uint64(1)<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// hash derives the two base hashes used for double hashing.
+func hash(s string) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	sum := h.Sum64()
+	return sum, sum>>32 | 1
+}
@@ -0,0 +1,23 @@
+package bloom
+
+import "testing"
+
+func TestPrefixSet(t *testing.T) {
+	s := NewPrefixSet(3, 1<<12)
+	for _, word := range []string{"magic", "magnet", "mé"} {
+		s.AddWord(word)
+	}
+
+	for _, prefix := range []string{"", "m", "ma", "mag", "magi", "magnet", "mé"} {
+		if !s.MayHavePrefix(prefix) {
+			t.Fatalf("expected prefix %q to be reported", prefix)
+		}
+	}
+
+	// With no false positives at this load, absent prefixes are rejected.
+	for _, prefix := range []string{"x", "mb", "mex", "zzzz"} {
+		if s.MayHavePrefix(prefix) {
+			t.Fatalf("expected prefix %q to be rejected", prefix)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package bloom
+
+// PrefixSet records every prefix of inserted words in one Filter per prefix
+// length, so lookups for prefixes no word starts with can be rejected
+// without touching the Trie. Prefixes longer than MaxLen runes are checked
+// by their first MaxLen runes.
+type PrefixSet struct {
+	filters []*Filter
+}
+
+// NewPrefixSet creates a PrefixSet tracking prefix lengths 1..maxLen, each in
+// a Filter of the given number of bits.
+func NewPrefixSet(maxLen, bits int) *PrefixSet {
+	s := &PrefixSet{filters: make([]*Filter, maxLen)}
+	for i := range s.filters {
+		s.filters[i] = New(bits, 4)
+	}
+	return s
+}
+
+// AddWord records all prefixes of word.
+func (s *PrefixSet) AddWord(word string) {
+	n := 0
+	for i := range word {
+		if n > 0 {
+			s.filters[n-1].Add(word[:i])
+		}
+		if n++; n > len(s.filters) {
+			return
+		}
+	}
+	if n > 0 {
+		s.filters[n-1].Add(word)
+	}
+}
+
+// MayHavePrefix reports whether some recorded word may start with prefix.
+// The empty prefix always matches.
+func (s *PrefixSet) MayHavePrefix(prefix string) bool {
+	n := 0
+	for i := range prefix {
+		if n == len(s.filters) {
+			return s.filters[n-1].MayContain(prefix[:i])
+		}
+		n++
+	}
+	if n == 0 {
+		return true
+	}
+	return s.filters[n-1].MayContain(prefix)
+}
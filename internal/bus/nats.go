@@ -0,0 +1,48 @@
+// Package bus publishes dictionary mutation events to a message bus.
+package bus
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/cg011235/autocomplete/internal/events"
+	"github.com/nats-io/nats.go"
+)
+
+// NATSPublisher publishes every mutation event as JSON to a NATS subject.
+type NATSPublisher struct {
+	conn    *nats.Conn
+	subject string
+}
+
+// NewNATSPublisher connects to the NATS server at url. The connection
+// reconnects indefinitely, buffering events while the server is unreachable.
+func NewNATSPublisher(url, subject string) (*NATSPublisher, error) {
+	conn, err := nats.Connect(url,
+		nats.Name("autocomplete"),
+		nats.MaxReconnects(-1),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &NATSPublisher{conn: conn, subject: subject}, nil
+}
+
+// Publish sends the event to the configured subject.
+func (p *NATSPublisher) Publish(e events.Event) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("bus: encoding event %d: %v", e.Seq, err)
+		return
+	}
+	if err := p.conn.Publish(p.subject, data); err != nil {
+		log.Printf("bus: publishing event %d: %v", e.Seq, err)
+	}
+}
+
+// Close flushes pending events and closes the connection.
+func (p *NATSPublisher) Close() error {
+	err := p.conn.Flush()
+	p.conn.Close()
+	return err
+}
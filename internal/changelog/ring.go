@@ -0,0 +1,80 @@
+// Package changelog retains recent mutation events so clients can poll for changes.
+package changelog
+
+import (
+	"sync"
+
+	"github.com/cg011235/autocomplete/internal/events"
+)
+
+// Ring is a bounded buffer of the most recent mutation events.
+// It implements events.Sink.
+type Ring struct {
+	mu     sync.RWMutex
+	buf    []events.Event
+	next   int // index the next event is written to
+	filled bool
+}
+
+// NewRing creates a Ring retaining up to size events.
+func NewRing(size int) *Ring {
+	return &Ring{buf: make([]events.Event, size)}
+}
+
+// Publish appends an event, overwriting the oldest one when full.
+func (r *Ring) Publish(e events.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.buf) == 0 {
+		return
+	}
+	r.buf[r.next] = e
+	r.next = (r.next + 1) % len(r.buf)
+	if r.next == 0 {
+		r.filled = true
+	}
+}
+
+// Since returns up to limit events with a sequence number greater than seq,
+// in order. It also returns the latest sequence number retained. ok is false
+// if events after seq have already been evicted, or seq is ahead of the log
+// (e.g. after a restart), in which case the client must resynchronize from a
+// full listing.
+func (r *Ring) Since(seq uint64, limit int) (changes []events.Event, last uint64, ok bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ordered := r.ordered()
+	if len(ordered) == 0 {
+		return nil, 0, seq == 0
+	}
+	last = ordered[len(ordered)-1].Seq
+	if oldest := ordered[0].Seq; seq+1 < oldest || seq > last {
+		return nil, last, false
+	}
+	for _, e := range ordered {
+		if e.Seq <= seq {
+			continue
+		}
+		if len(changes) == limit {
+			break
+		}
+		changes = append(changes, e)
+	}
+	return changes, last, true
+}
+
+// Retained returns a copy of the retained events from oldest to newest.
+func (r *Ring) Retained() []events.Event {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]events.Event(nil), r.ordered()...)
+}
+
+// ordered returns the retained events from oldest to newest.
+func (r *Ring) ordered() []events.Event {
+	if !r.filled {
+		return r.buf[:r.next]
+	}
+	return append(append([]events.Event(nil), r.buf[r.next:]...), r.buf[:r.next]...)
+}
@@ -0,0 +1,927 @@
+// Package config loads the service configuration from environment variables.
+package config
+
+import (
+	"errors"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cg011235/autocomplete/internal/oidc"
+)
+
+// Config holds the runtime configuration of the autocomplete service.
+type Config struct {
+	// ListenAddr is the address the public API is served on: host:port,
+	// unix:/path/to.sock or systemd[:N] for a socket-activated listener.
+	ListenAddr string
+	// AdminAddr is the address admin and debug routes are served on, in the
+	// same forms as ListenAddr. It
+	// defaults to localhost so operational endpoints are never reachable from
+	// the public port; empty serves admin routes on ListenAddr instead.
+	AdminAddr string
+
+	// HTTP2 serves HTTP/2 over cleartext (h2c) alongside HTTP/1.1.
+	HTTP2 bool
+	// HTTP2MaxConcurrentStreams caps the in-flight requests multiplexed on one
+	// HTTP/2 connection.
+	HTTP2MaxConcurrentStreams int
+	// GRPCImport serves the streaming gRPC Importer service on the admin
+	// listener. It requires HTTP2.
+	GRPCImport bool
+	// GRPCMaxMessageBytes caps the size of one streamed gRPC message.
+	GRPCMaxMessageBytes int
+	// GRPCMaxImportBytes caps the words and metadata of one streamed gRPC
+	// import, summed over its messages.
+	GRPCMaxImportBytes int
+	// KeepAlive enables HTTP/1.1 keep-alive connections.
+	KeepAlive bool
+	// IdleTimeout closes keep-alive and HTTP/2 connections idle for longer.
+	IdleTimeout time.Duration
+	// ReadHeaderTimeout bounds how long a client may take to send request headers.
+	ReadHeaderTimeout time.Duration
+	// MaxHeaderBytes caps the size of request headers.
+	MaxHeaderBytes int
+
+	// ShutdownTimeout bounds how long in-flight requests are drained on
+	// shutdown or after handing the listeners to an upgraded process.
+	ShutdownTimeout time.Duration
+
+	SecretKey string
+	// JWTKeys are the HMAC keys accepted for tokens with a "kid" header. The
+	// first key signs new tokens; the rest are previous keys kept valid during
+	// rotation. When empty, SecretKey signs tokens without a key ID.
+	JWTKeys []Key
+	// JWTUnkeyedUntil keeps tokens without a key ID, signed with SecretKey
+	// before JWTKeys were configured, valid until then; once it passes, or
+	// when zero, JWTKeys being set rejects them.
+	JWTUnkeyedUntil time.Time
+	// JWKSURL enables RS256 tokens issued by an external identity provider.
+	JWKSURL string
+	// JWKSRefresh is how often the key set is refetched.
+	JWKSRefresh time.Duration
+	// JWKSIssuer and JWKSAudience are the "iss" and "aud" claims required of
+	// RS256 tokens; both must be set with JWKSURL.
+	JWKSIssuer   string
+	JWKSAudience string
+	// JWKSRoleClaim names the RS256 token claim (string or list) checked
+	// against JWKSAdminValues; tokens with none of them get the user role.
+	JWKSRoleClaim   string
+	JWKSAdminValues []string
+	// JWTIssuers and JWTAudiences are the accepted "iss" and "aud" claims of
+	// tokens; empty accepts any. Tokens issued by the login endpoint carry the
+	// first of each.
+	JWTIssuers   []string
+	JWTAudiences []string
+	// JWTClockSkew is how far token expiry, not-before and issued-at times
+	// may be off to tolerate clock differences between services.
+	JWTClockSkew time.Duration
+
+	// OIDC enables login through an OpenID Connect provider instead of passwords
+	// when OIDC.Issuer is set.
+	OIDC oidc.Config
+
+	// LoginMaxFailures is how many failed logins a username or client IP may
+	// make before being locked out for LoginLockout, doubling with each
+	// further failure up to LoginMaxLockout. Failures are forgotten after
+	// LoginFailureWindow. Zero disables lockouts.
+	LoginMaxFailures   int
+	LoginLockout       time.Duration
+	LoginMaxLockout    time.Duration
+	LoginFailureWindow time.Duration
+
+	// IPAllow and IPDeny restrict which client addresses may use the API.
+	IPAllow []string
+	IPDeny  []string
+	// TrustedProxies are the ranges of reverse proxies, e.g. the ingress
+	// controller, whose X-Forwarded-For header names the client address used
+	// for IP rules, rate limits and login lockouts.
+	TrustedProxies []string
+	// PublicRoutes ("METHOD /path") may be called without a token on
+	// PublicDictionaries, at the stricter public rate limit tier. Only GET
+	// and HEAD routes can be public; no dictionaries disables public access.
+	PublicRoutes       []string
+	PublicDictionaries []string
+	// WidgetDictionaries are served without authentication at /widget/suggest
+	// to browser pages from WidgetOrigins ("*" for any); none disables the
+	// endpoint. Widgets get WidgetLimit suggestions, or up to WidgetMaxLimit.
+	WidgetDictionaries    []string
+	WidgetOrigins         []string
+	WidgetLimit           int
+	WidgetMaxLimit        int
+	WidgetPreflightMaxAge time.Duration
+	// AdminIPAllow restricts admin routes to the given ranges, e.g. internal networks.
+	AdminIPAllow []string
+	// AdminUsers are the usernames issued tokens with the admin role.
+	AdminUsers []string
+
+	// CacheTTL is how long suggest results are kept in the server-side cache.
+	CacheTTL time.Duration
+	// CacheMaxAge is the max-age advertised to browsers and CDNs on suggest responses.
+	CacheMaxAge time.Duration
+	// CachePublic marks suggest responses as cacheable by shared caches.
+	CachePublic bool
+	// NegativeCacheTTL is how long empty suggest results are cached server-side.
+	NegativeCacheTTL time.Duration
+
+	// DecayHalfLife is the time after which a word's accumulated weight halves.
+	// Zero disables decay.
+	DecayHalfLife time.Duration
+	// DecayInterval is how often the decay job runs.
+	DecayInterval time.Duration
+
+	// ContextBoost is added to the score of words matching the request context.
+	ContextBoost float64
+	// ShadowRanking names a ranker (frequency, alphabetical, shortest or
+	// recency) run alongside the normal one on ShadowRankingPercent percent
+	// of suggest requests, logging both result sets. Empty disables it.
+	ShadowRanking        string
+	ShadowRankingPercent float64
+
+	// FuzzyMaxEdits caps the edit distance of fuzzy suggestions.
+	FuzzyMaxEdits int
+	// KeyboardLayout prices fuzzy substitutions by key adjacency: qwerty,
+	// azerty or qwertz. Empty treats every substitution as a full edit.
+	KeyboardLayout string
+	// AdjacentKeyCost is the cost of substituting a neighbouring key.
+	AdjacentKeyCost float64
+
+	// Personalization enables blending each user's accepted suggestions into rankings.
+	Personalization bool
+	// PersonalBoost is added to a word's score per recorded selection by the user.
+	PersonalBoost float64
+	// PersonalHistorySize caps how many words are remembered per user.
+	PersonalHistorySize int
+
+	// WebhookURLs receive signed JSON payloads on every dictionary mutation.
+	WebhookURLs []string
+	// WebhookSecret signs webhook payloads; it defaults to SecretKey.
+	WebhookSecret string
+	// WebhookMaxRetries is how many times a failed delivery is retried.
+	WebhookMaxRetries int
+	// WebhookBackoff is the delay before the first retry; it doubles on each attempt.
+	WebhookBackoff time.Duration
+
+	// RateLimitRedisURL is the Redis server rate limit buckets are shared
+	// through, so limits hold across replicas; empty limits each process
+	// on its own.
+	RateLimitRedisURL string
+	// RateLimitRedisPrefix prefixes the Redis keys of the buckets.
+	RateLimitRedisPrefix string
+
+	// EventBusURL is the NATS server mutation events are published to; empty disables publishing.
+	EventBusURL string
+	// EventBusSubject is the subject mutation events are published on.
+	EventBusSubject string
+
+	// ChangeLogSize is how many recent mutations are retained for polling; zero disables it.
+	ChangeLogSize int
+
+	// Shards ("id=url") are the servers of a sharded deployment, advertised
+	// to clients with the placement parameters below; empty means unsharded.
+	Shards []string
+	// ShardID is which of Shards this server is.
+	ShardID string
+	// ShardKeyLength is how many leading characters of a word place it.
+	ShardKeyLength int
+	// ShardPoints is how many ring points each shard has.
+	ShardPoints int
+
+	// DefaultDictionary is the dictionary of requests that do not name one.
+	DefaultDictionary string
+	// AutoCreateDictionaries lets requests naming an unknown dictionary
+	// create it; otherwise they get 404 and only admins create dictionaries.
+	AutoCreateDictionaries bool
+
+	// QuotaMaxWords and QuotaMaxMetadataBytes are the default quota of new
+	// dictionaries; zero means unlimited.
+	QuotaMaxWords         int
+	QuotaMaxMetadataBytes int
+
+	// BloomMaxLen and BloomBits size the per-length prefix Bloom filters of
+	// each dictionary, which grow with its word count up to BloomBits bits;
+	// BloomBits of zero disables them.
+	BloomMaxLen int
+	BloomBits   int
+	// NodeSlabSize is how many trie nodes are allocated at a time; zero
+	// allocates nodes one by one.
+	NodeSlabSize int
+	// InternStrings shares one copy of each word and context tag per dictionary.
+	InternStrings bool
+	// SortedChildren keeps trie children in rune order so alphabetical
+	// suggestions need no sorting, at some cost to inserts.
+	SortedChildren bool
+	// ParallelSearchWorkers goroutines collect the suggestions of prefixes
+	// of at most two characters in dictionaries of at least
+	// ParallelSearchMinWords words; below 2 disables parallel collection.
+	ParallelSearchWorkers  int
+	ParallelSearchMinWords int
+
+	// DataDir is where dictionary versions are stored; empty disables persistence.
+	DataDir string
+	// VersionsKeep is how many versions of each dictionary are kept on disk,
+	// and separately how many compaction snapshots.
+	VersionsKeep int
+	// WAL logs every mutation to DataDir before applying it so dictionaries
+	// survive restarts; WALSync fsyncs after every record.
+	WAL     bool
+	WALSync bool
+	// Repair recovers from corrupt snapshots and write-ahead logs on startup,
+	// dropping the damaged data. It is set by the -repair flag, not the
+	// environment.
+	Repair bool
+	// SnapshotInterval is how often dictionaries whose log exceeds
+	// SnapshotLogBytes are snapshotted as a new version, truncating the log.
+	SnapshotInterval time.Duration
+	SnapshotLogBytes int
+	// SnapshotCompression is the codec of new version snapshots: none, gzip or zstd.
+	SnapshotCompression string
+
+	// RefreshSources ("dict=url") are fetched every RefreshInterval and, when
+	// changed, installed as new versions of their dictionaries. Sources
+	// shrinking a dictionary by more than RefreshMaxShrink or growing it by
+	// more than RefreshMaxGrowth (fractions; zero disables) are rejected.
+	RefreshSources   []string
+	RefreshInterval  time.Duration
+	RefreshMaxShrink float64
+	RefreshMaxGrowth float64
+
+	// PopularQueriesMax bounds how many distinct suggest queries are counted.
+	PopularQueriesMax int
+	// CacheWarmTop is how many popular queries are replayed into the cache at startup.
+	CacheWarmTop int
+	// HotPrefixes is how many of the most popular prefixes keep precomputed
+	// suggestions; 0 disables.
+	HotPrefixes int
+	// HotPrefixRefresh is how often the hot prefixes are reselected.
+	HotPrefixRefresh time.Duration
+	// MaxResponseBytes caps the estimated size of the results in a suggest
+	// response; the rest are returned through a continuation cursor. Zero
+	// disables the guard.
+	MaxResponseBytes int
+
+	// QueryLogSampleRate is the fraction (0 to 1) of suggest queries logged
+	// with their dictionary, latency, result count and hashed user; zero
+	// disables query logging.
+	QueryLogSampleRate float64
+	// QueryLogDir receives sampled queries as NDJSON, rotated once a file
+	// exceeds QueryLogMaxBytes and keeping QueryLogMaxFiles rotated files.
+	QueryLogDir      string
+	QueryLogMaxBytes int
+	QueryLogMaxFiles int
+	// QueryLogURL receives sampled queries as NDJSON POSTs of up to
+	// QueryLogBatch entries, sent at least every QueryLogFlushInterval.
+	QueryLogURL           string
+	QueryLogBatch         int
+	QueryLogFlushInterval time.Duration
+	// QueryLogSalt keys the hash of usernames; it defaults to SecretKey.
+	QueryLogSalt string
+
+	// MaxWordLength caps the length in characters of words and prefixes; zero
+	// means unlimited.
+	MaxWordLength int
+	// GraphemeMatching treats multi-rune emoji and combining sequences as
+	// single characters: prefixes only match words in whole grapheme clusters
+	// and MaxWordLength counts clusters.
+	GraphemeMatching bool
+	// WordCharacters are the character classes words and prefixes may contain:
+	// letter, digit, mark, punct, symbol and space. Empty allows every
+	// printable character; control characters are always rejected.
+	WordCharacters []string
+	// SnippetMaxDescription and SnippetMaxIconURL cap the bytes of the
+	// description and icon URL stored with a word; zero means unlimited.
+	SnippetMaxDescription int
+	SnippetMaxIconURL     int
+	// Normalizers are applied in order to words and prefixes: lowercase,
+	// nfc, diacritics (strip accents) and whitespace (collapse runs).
+	// Variants normalizing alike are stored as one word. "none" applies none.
+	Normalizers []string
+	// Tokenizer splits inserted text into words, with queries completing
+	// their last word: none keeps text whole, whitespace splits on spaces.
+	Tokenizer string
+	// DisplayPolicy chooses the spelling shown for folded variants: first
+	// (first added) or weight (highest imported weight). Empty shows the
+	// folded word.
+	DisplayPolicy string
+
+	// V1DeprecatedAt and V1SunsetAt schedule the deprecation and removal of
+	// the v1 API and are advertised on its responses; zero leaves them unset.
+	V1DeprecatedAt time.Time
+	V1SunsetAt     time.Time
+	// V1Successor is the path linked as the successor of v1, e.g. /api/v2/.
+	V1Successor string
+	// V1Disabled answers every v1 request except admin routes with 410 Gone.
+	V1Disabled bool
+
+	// AccessLog is the file requests are logged to in AccessLogFormat
+	// (combined or json) instead of the application log, rotated once it
+	// exceeds AccessLogMaxBytes or is older than AccessLogMaxAge and keeping
+	// AccessLogMaxFiles rotated files. "-" writes to standard output.
+	AccessLog         string
+	AccessLogFormat   string
+	AccessLogMaxBytes int
+	AccessLogMaxAge   time.Duration
+	AccessLogMaxFiles int
+
+	// SlowRequestThreshold is the latency above which requests are logged;
+	// zero disables slow request logging.
+	SlowRequestThreshold time.Duration
+	// DebugToken lets any caller sending it in X-Debug-Token receive query
+	// traces, which admins get with debug=true; empty disables the token.
+	DebugToken string
+
+	// MaxInFlight caps the requests served concurrently; further requests
+	// get 503 with a Retry-After of OverloadRetryAfter. Zero disables it.
+	MaxInFlight        int
+	OverloadRetryAfter time.Duration
+
+	// RequestTimeout is the default deadline for handling a read; zero
+	// disables it. Writes are not timed out.
+	RequestTimeout time.Duration
+	// RouteTimeouts overrides RequestTimeout per "METHOD /path/template",
+	// or per "METHOD /path/template?param" for requests with a non-empty
+	// query parameter.
+	RouteTimeouts map[string]time.Duration
+}
+
+// Key is a JWT signing secret identified by a key ID.
+type Key struct {
+	ID     string
+	Secret string
+}
+
+// Load reads the configuration from the environment, applying defaults where unset.
+func Load() (*Config, error) {
+	cfg := &Config{
+		ListenAddr: getString("LISTEN_ADDR", ":8080"),
+		AdminAddr:  "127.0.0.1:9090",
+
+		PublicRoutes: []string{"GET /api/v1/words"},
+
+		WidgetLimit:           8,
+		WidgetMaxLimit:        20,
+		WidgetPreflightMaxAge: 10 * time.Minute,
+
+		HTTP2:                     true,
+		HTTP2MaxConcurrentStreams: 250,
+		GRPCImport:                true,
+		GRPCMaxMessageBytes:       4 << 20,
+		GRPCMaxImportBytes:        256 << 20,
+		KeepAlive:                 true,
+		IdleTimeout:               2 * time.Minute,
+		ReadHeaderTimeout:         5 * time.Second,
+		MaxHeaderBytes:            1 << 20,
+
+		ShutdownTimeout: 30 * time.Second,
+
+		SecretKey:   os.Getenv("SECRET_KEY"),
+		JWKSURL:     os.Getenv("JWKS_URL"),
+		JWKSRefresh: time.Hour,
+
+		JWKSIssuer:      os.Getenv("JWKS_ISSUER"),
+		JWKSAudience:    os.Getenv("JWKS_AUDIENCE"),
+		JWKSRoleClaim:   getString("JWKS_ROLE_CLAIM", "groups"),
+		JWKSAdminValues: getList("JWKS_ADMIN_VALUES"),
+
+		JWTIssuers:   getList("JWT_ISSUERS"),
+		JWTAudiences: getList("JWT_AUDIENCES"),
+
+		LoginMaxFailures:   5,
+		LoginLockout:       time.Minute,
+		LoginMaxLockout:    time.Hour,
+		LoginFailureWindow: 15 * time.Minute,
+
+		OIDC: oidc.Config{
+			Issuer:       os.Getenv("OIDC_ISSUER"),
+			ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+			ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+			RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+			RoleClaim:    getString("OIDC_ROLE_CLAIM", "groups"),
+			AdminValues:  getList("OIDC_ADMIN_VALUES"),
+		},
+		CacheTTL:    5 * time.Minute,
+		CacheMaxAge: 60 * time.Second,
+
+		NegativeCacheTTL: 10 * time.Second,
+
+		DecayHalfLife: 7 * 24 * time.Hour,
+		DecayInterval: time.Hour,
+
+		ContextBoost: 10,
+
+		ShadowRanking:        os.Getenv("SHADOW_RANKING"),
+		ShadowRankingPercent: 10,
+
+		FuzzyMaxEdits:   2,
+		KeyboardLayout:  getString("KEYBOARD_LAYOUT", "qwerty"),
+		AdjacentKeyCost: 0.5,
+
+		PersonalBoost:       5,
+		PersonalHistorySize: 100,
+
+		WebhookMaxRetries: 5,
+		WebhookBackoff:    time.Second,
+
+		RateLimitRedisURL:    os.Getenv("RATE_LIMIT_REDIS_URL"),
+		RateLimitRedisPrefix: getString("RATE_LIMIT_REDIS_PREFIX", "autocomplete:ratelimit:"),
+
+		EventBusURL:     os.Getenv("EVENT_BUS_URL"),
+		EventBusSubject: getString("EVENT_BUS_SUBJECT", "autocomplete.mutations"),
+
+		ChangeLogSize: 10000,
+
+		BloomMaxLen:   16,
+		BloomBits:     1 << 20,
+		NodeSlabSize:  1024,
+		InternStrings: true,
+
+		ParallelSearchWorkers:  runtime.GOMAXPROCS(0),
+		ParallelSearchMinWords: 50000,
+
+		DataDir:      os.Getenv("DATA_DIR"),
+		VersionsKeep: 5,
+
+		WAL:                 true,
+		SnapshotInterval:    time.Minute,
+		SnapshotLogBytes:    16 << 20,
+		SnapshotCompression: getString("SNAPSHOT_COMPRESSION", "gzip"),
+
+		RefreshSources:   getList("REFRESH_SOURCES"),
+		RefreshInterval:  time.Hour,
+		RefreshMaxShrink: 0.5,
+		RefreshMaxGrowth: 1,
+
+		Shards:         getList("SHARDS"),
+		ShardID:        getString("SHARD_ID", ""),
+		ShardKeyLength: 2,
+		ShardPoints:    128,
+
+		DefaultDictionary:      "default",
+		AutoCreateDictionaries: true,
+		PopularQueriesMax:      100000,
+		CacheWarmTop:           1000,
+		HotPrefixes:            100,
+		HotPrefixRefresh:       5 * time.Minute,
+		MaxResponseBytes:       1 << 20,
+
+		QueryLogDir:           os.Getenv("QUERY_LOG_DIR"),
+		QueryLogMaxBytes:      64 << 20,
+		QueryLogMaxFiles:      10,
+		QueryLogURL:           os.Getenv("QUERY_LOG_URL"),
+		QueryLogBatch:         500,
+		QueryLogFlushInterval: 5 * time.Second,
+
+		MaxWordLength:         100,
+		WordCharacters:        []string{"letter", "digit", "mark", "punct", "space"},
+		SnippetMaxDescription: 200,
+		SnippetMaxIconURL:     512,
+		Normalizers:           []string{"lowercase"},
+		Tokenizer:             getString("TOKENIZER", "none"),
+		DisplayPolicy:         os.Getenv("DISPLAY_POLICY"),
+
+		V1Successor: os.Getenv("V1_SUCCESSOR"),
+
+		AccessLog:         os.Getenv("ACCESS_LOG"),
+		AccessLogFormat:   getString("ACCESS_LOG_FORMAT", "combined"),
+		AccessLogMaxBytes: 100 << 20,
+		AccessLogMaxAge:   24 * time.Hour,
+		AccessLogMaxFiles: 7,
+
+		SlowRequestThreshold: 100 * time.Millisecond,
+
+		OverloadRetryAfter: time.Second,
+
+		RequestTimeout: 10 * time.Second,
+		RouteTimeouts: map[string]time.Duration{
+			// Listings without a prefix are unbounded and get RequestTimeout.
+			"GET /api/v1/words?prefix": 200 * time.Millisecond,
+		},
+	}
+	if cfg.SecretKey == "" {
+		return nil, errors.New("SECRET_KEY environment variable is required")
+	}
+	if v, ok := os.LookupEnv("ADMIN_ADDR"); ok {
+		cfg.AdminAddr = v
+	}
+	cfg.AdminUsers = getList("ADMIN_USERS")
+	cfg.IPAllow = getList("IP_ALLOW")
+	cfg.IPDeny = getList("IP_DENY")
+	cfg.TrustedProxies = getList("TRUSTED_PROXIES")
+	cfg.AdminIPAllow = getList("ADMIN_IP_ALLOW")
+	if _, ok := os.LookupEnv("PUBLIC_ROUTES"); ok {
+		cfg.PublicRoutes = getList("PUBLIC_ROUTES")
+	}
+	for _, route := range cfg.PublicRoutes {
+		if !strings.HasPrefix(route, "GET /") && !strings.HasPrefix(route, "HEAD /") {
+			return nil, errors.New("PUBLIC_ROUTES: only GET and HEAD routes can be public, got " + route)
+		}
+	}
+	cfg.PublicDictionaries = getList("PUBLIC_DICTIONARIES")
+	cfg.WidgetDictionaries = getList("WIDGET_DICTIONARIES")
+	cfg.WidgetOrigins = getList("WIDGET_ORIGINS")
+	for _, item := range getList("JWT_KEYS") {
+		id, secret, ok := strings.Cut(item, "=")
+		if !ok || id == "" || secret == "" {
+			return nil, errors.New("JWT_KEYS: expected kid=secret, got " + item)
+		}
+		cfg.JWTKeys = append(cfg.JWTKeys, Key{ID: id, Secret: secret})
+	}
+	if cfg.JWKSURL != "" && (cfg.JWKSIssuer == "" || cfg.JWKSAudience == "") {
+		return nil, errors.New("JWKS_URL: requires JWKS_ISSUER and JWKS_AUDIENCE")
+	}
+
+	var err error
+	if cfg.HTTP2, err = getBool("HTTP2", cfg.HTTP2); err != nil {
+		return nil, err
+	}
+	if cfg.HTTP2MaxConcurrentStreams, err = getInt("HTTP2_MAX_CONCURRENT_STREAMS", cfg.HTTP2MaxConcurrentStreams); err != nil {
+		return nil, err
+	}
+	if cfg.GRPCImport, err = getBool("GRPC_IMPORT", cfg.GRPCImport); err != nil {
+		return nil, err
+	}
+	if cfg.GRPCImport && !cfg.HTTP2 {
+		return nil, errors.New("GRPC_IMPORT: requires HTTP2")
+	}
+	if cfg.GRPCMaxMessageBytes, err = getInt("GRPC_MAX_MESSAGE_BYTES", cfg.GRPCMaxMessageBytes); err != nil {
+		return nil, err
+	}
+	if cfg.GRPCMaxImportBytes, err = getInt("GRPC_MAX_IMPORT_BYTES", cfg.GRPCMaxImportBytes); err != nil {
+		return nil, err
+	}
+	if cfg.KeepAlive, err = getBool("KEEP_ALIVE", cfg.KeepAlive); err != nil {
+		return nil, err
+	}
+	if cfg.IdleTimeout, err = getDuration("IDLE_TIMEOUT", cfg.IdleTimeout); err != nil {
+		return nil, err
+	}
+	if cfg.ReadHeaderTimeout, err = getDuration("READ_HEADER_TIMEOUT", cfg.ReadHeaderTimeout); err != nil {
+		return nil, err
+	}
+	if cfg.MaxHeaderBytes, err = getInt("MAX_HEADER_BYTES", cfg.MaxHeaderBytes); err != nil {
+		return nil, err
+	}
+	if cfg.ShutdownTimeout, err = getDuration("SHUTDOWN_TIMEOUT", cfg.ShutdownTimeout); err != nil {
+		return nil, err
+	}
+	if cfg.JWKSRefresh, err = getDuration("JWKS_REFRESH", cfg.JWKSRefresh); err != nil {
+		return nil, err
+	}
+	if cfg.JWTUnkeyedUntil, err = getTime("JWT_UNKEYED_UNTIL"); err != nil {
+		return nil, err
+	}
+	if cfg.JWTClockSkew, err = getDuration("JWT_CLOCK_SKEW", cfg.JWTClockSkew); err != nil {
+		return nil, err
+	}
+	if cfg.JWTClockSkew < 0 {
+		return nil, errors.New("JWT_CLOCK_SKEW: must not be negative")
+	}
+	if cfg.WidgetLimit, err = getInt("WIDGET_LIMIT", cfg.WidgetLimit); err != nil {
+		return nil, err
+	}
+	if cfg.WidgetMaxLimit, err = getInt("WIDGET_MAX_LIMIT", cfg.WidgetMaxLimit); err != nil {
+		return nil, err
+	}
+	if cfg.WidgetPreflightMaxAge, err = getDuration("WIDGET_PREFLIGHT_MAX_AGE", cfg.WidgetPreflightMaxAge); err != nil {
+		return nil, err
+	}
+	if cfg.LoginMaxFailures, err = getInt("LOGIN_MAX_FAILURES", cfg.LoginMaxFailures); err != nil {
+		return nil, err
+	}
+	if cfg.LoginLockout, err = getDuration("LOGIN_LOCKOUT", cfg.LoginLockout); err != nil {
+		return nil, err
+	}
+	if cfg.LoginMaxLockout, err = getDuration("LOGIN_MAX_LOCKOUT", cfg.LoginMaxLockout); err != nil {
+		return nil, err
+	}
+	if cfg.LoginFailureWindow, err = getDuration("LOGIN_FAILURE_WINDOW", cfg.LoginFailureWindow); err != nil {
+		return nil, err
+	}
+	if cfg.CacheTTL, err = getDuration("CACHE_TTL", cfg.CacheTTL); err != nil {
+		return nil, err
+	}
+	if cfg.CacheMaxAge, err = getDuration("CACHE_MAX_AGE", cfg.CacheMaxAge); err != nil {
+		return nil, err
+	}
+	if cfg.NegativeCacheTTL, err = getDuration("NEGATIVE_CACHE_TTL", cfg.NegativeCacheTTL); err != nil {
+		return nil, err
+	}
+	if cfg.CachePublic, err = getBool("CACHE_PUBLIC", cfg.CachePublic); err != nil {
+		return nil, err
+	}
+	if cfg.DecayHalfLife, err = getDuration("DECAY_HALF_LIFE", cfg.DecayHalfLife); err != nil {
+		return nil, err
+	}
+	if cfg.DecayInterval, err = getDuration("DECAY_INTERVAL", cfg.DecayInterval); err != nil {
+		return nil, err
+	}
+	if cfg.ContextBoost, err = getFloat("CONTEXT_BOOST", cfg.ContextBoost); err != nil {
+		return nil, err
+	}
+	if cfg.ShadowRankingPercent, err = getFloat("SHADOW_RANKING_PERCENT", cfg.ShadowRankingPercent); err != nil {
+		return nil, err
+	}
+	if cfg.FuzzyMaxEdits, err = getInt("FUZZY_MAX_EDITS", cfg.FuzzyMaxEdits); err != nil {
+		return nil, err
+	}
+	if v, ok := os.LookupEnv("KEYBOARD_LAYOUT"); ok {
+		cfg.KeyboardLayout = v
+	}
+	if cfg.AdjacentKeyCost, err = getFloat("ADJACENT_KEY_COST", cfg.AdjacentKeyCost); err != nil {
+		return nil, err
+	}
+	if cfg.Personalization, err = getBool("PERSONALIZATION", cfg.Personalization); err != nil {
+		return nil, err
+	}
+	if cfg.PersonalBoost, err = getFloat("PERSONAL_BOOST", cfg.PersonalBoost); err != nil {
+		return nil, err
+	}
+	if cfg.PersonalHistorySize, err = getInt("PERSONAL_HISTORY_SIZE", cfg.PersonalHistorySize); err != nil {
+		return nil, err
+	}
+	cfg.WebhookURLs = getList("WEBHOOK_URLS")
+	cfg.WebhookSecret = os.Getenv("WEBHOOK_SECRET")
+	if cfg.WebhookSecret == "" {
+		cfg.WebhookSecret = cfg.SecretKey
+	}
+	if cfg.WebhookMaxRetries, err = getInt("WEBHOOK_MAX_RETRIES", cfg.WebhookMaxRetries); err != nil {
+		return nil, err
+	}
+	if cfg.WebhookBackoff, err = getDuration("WEBHOOK_BACKOFF", cfg.WebhookBackoff); err != nil {
+		return nil, err
+	}
+	if cfg.ChangeLogSize, err = getInt("CHANGELOG_SIZE", cfg.ChangeLogSize); err != nil {
+		return nil, err
+	}
+	if cfg.ShardKeyLength, err = getInt("SHARD_KEY_LENGTH", cfg.ShardKeyLength); err != nil {
+		return nil, err
+	}
+	if cfg.ShardPoints, err = getInt("SHARD_POINTS", cfg.ShardPoints); err != nil {
+		return nil, err
+	}
+	cfg.DefaultDictionary = getString("DEFAULT_DICTIONARY", cfg.DefaultDictionary)
+	if cfg.AutoCreateDictionaries, err = getBool("AUTO_CREATE_DICTIONARIES", cfg.AutoCreateDictionaries); err != nil {
+		return nil, err
+	}
+	if cfg.QuotaMaxWords, err = getInt("QUOTA_MAX_WORDS", cfg.QuotaMaxWords); err != nil {
+		return nil, err
+	}
+	if cfg.QuotaMaxMetadataBytes, err = getInt("QUOTA_MAX_METADATA_BYTES", cfg.QuotaMaxMetadataBytes); err != nil {
+		return nil, err
+	}
+	if cfg.PopularQueriesMax, err = getInt("POPULAR_QUERIES_MAX", cfg.PopularQueriesMax); err != nil {
+		return nil, err
+	}
+	if cfg.CacheWarmTop, err = getInt("CACHE_WARM_TOP", cfg.CacheWarmTop); err != nil {
+		return nil, err
+	}
+	if cfg.HotPrefixes, err = getInt("HOT_PREFIXES", cfg.HotPrefixes); err != nil {
+		return nil, err
+	}
+	if cfg.HotPrefixRefresh, err = getDuration("HOT_PREFIX_REFRESH", cfg.HotPrefixRefresh); err != nil {
+		return nil, err
+	}
+	if cfg.MaxResponseBytes, err = getInt("MAX_RESPONSE_BYTES", cfg.MaxResponseBytes); err != nil {
+		return nil, err
+	}
+	if cfg.QueryLogSampleRate, err = getFloat("QUERY_LOG_SAMPLE_RATE", cfg.QueryLogSampleRate); err != nil {
+		return nil, err
+	}
+	if cfg.QueryLogSampleRate < 0 || cfg.QueryLogSampleRate > 1 {
+		return nil, errors.New("QUERY_LOG_SAMPLE_RATE: must be between 0 and 1")
+	}
+	if cfg.QueryLogSampleRate > 0 && cfg.QueryLogDir == "" && cfg.QueryLogURL == "" {
+		return nil, errors.New("QUERY_LOG_SAMPLE_RATE: requires QUERY_LOG_DIR or QUERY_LOG_URL")
+	}
+	if cfg.QueryLogMaxBytes, err = getInt("QUERY_LOG_MAX_BYTES", cfg.QueryLogMaxBytes); err != nil {
+		return nil, err
+	}
+	if cfg.QueryLogMaxFiles, err = getInt("QUERY_LOG_MAX_FILES", cfg.QueryLogMaxFiles); err != nil {
+		return nil, err
+	}
+	if cfg.QueryLogBatch, err = getInt("QUERY_LOG_BATCH", cfg.QueryLogBatch); err != nil {
+		return nil, err
+	}
+	if cfg.QueryLogFlushInterval, err = getDuration("QUERY_LOG_FLUSH_INTERVAL", cfg.QueryLogFlushInterval); err != nil {
+		return nil, err
+	}
+	if cfg.QueryLogFlushInterval <= 0 {
+		return nil, errors.New("QUERY_LOG_FLUSH_INTERVAL: must be positive")
+	}
+	cfg.QueryLogSalt = os.Getenv("QUERY_LOG_SALT")
+	if cfg.QueryLogSalt == "" {
+		cfg.QueryLogSalt = cfg.SecretKey
+	}
+	if cfg.BloomMaxLen, err = getInt("BLOOM_MAX_LEN", cfg.BloomMaxLen); err != nil {
+		return nil, err
+	}
+	if cfg.BloomBits, err = getInt("BLOOM_BITS", cfg.BloomBits); err != nil {
+		return nil, err
+	}
+	if cfg.NodeSlabSize, err = getInt("NODE_SLAB_SIZE", cfg.NodeSlabSize); err != nil {
+		return nil, err
+	}
+	if cfg.InternStrings, err = getBool("INTERN_STRINGS", cfg.InternStrings); err != nil {
+		return nil, err
+	}
+	if cfg.SortedChildren, err = getBool("SORTED_CHILDREN", cfg.SortedChildren); err != nil {
+		return nil, err
+	}
+	if cfg.ParallelSearchWorkers, err = getInt("PARALLEL_SEARCH_WORKERS", cfg.ParallelSearchWorkers); err != nil {
+		return nil, err
+	}
+	if cfg.ParallelSearchMinWords, err = getInt("PARALLEL_SEARCH_MIN_WORDS", cfg.ParallelSearchMinWords); err != nil {
+		return nil, err
+	}
+	if cfg.VersionsKeep, err = getInt("VERSIONS_KEEP", cfg.VersionsKeep); err != nil {
+		return nil, err
+	}
+	if cfg.WAL, err = getBool("WAL", cfg.WAL); err != nil {
+		return nil, err
+	}
+	if cfg.WALSync, err = getBool("WAL_SYNC", cfg.WALSync); err != nil {
+		return nil, err
+	}
+	if cfg.SnapshotInterval, err = getDuration("SNAPSHOT_INTERVAL", cfg.SnapshotInterval); err != nil {
+		return nil, err
+	}
+	if cfg.SnapshotLogBytes, err = getInt("SNAPSHOT_LOG_BYTES", cfg.SnapshotLogBytes); err != nil {
+		return nil, err
+	}
+	if cfg.RefreshInterval, err = getDuration("REFRESH_INTERVAL", cfg.RefreshInterval); err != nil {
+		return nil, err
+	}
+	if cfg.RefreshMaxShrink, err = getFloat("REFRESH_MAX_SHRINK", cfg.RefreshMaxShrink); err != nil {
+		return nil, err
+	}
+	if cfg.RefreshMaxGrowth, err = getFloat("REFRESH_MAX_GROWTH", cfg.RefreshMaxGrowth); err != nil {
+		return nil, err
+	}
+	if cfg.MaxWordLength, err = getInt("MAX_WORD_LENGTH", cfg.MaxWordLength); err != nil {
+		return nil, err
+	}
+	if cfg.GraphemeMatching, err = getBool("GRAPHEME_MATCHING", cfg.GraphemeMatching); err != nil {
+		return nil, err
+	}
+	if cfg.SnippetMaxDescription, err = getInt("SNIPPET_MAX_DESCRIPTION", cfg.SnippetMaxDescription); err != nil {
+		return nil, err
+	}
+	if cfg.SnippetMaxIconURL, err = getInt("SNIPPET_MAX_ICON_URL", cfg.SnippetMaxIconURL); err != nil {
+		return nil, err
+	}
+	if _, ok := os.LookupEnv("WORD_CHARACTERS"); ok {
+		cfg.WordCharacters = getList("WORD_CHARACTERS")
+	}
+	if _, ok := os.LookupEnv("NORMALIZERS"); ok {
+		cfg.Normalizers = getList("NORMALIZERS")
+	}
+	switch cfg.DisplayPolicy {
+	case "", "first", "weight":
+	default:
+		return nil, errors.New("DISPLAY_POLICY: expected first or weight, got " + cfg.DisplayPolicy)
+	}
+	if cfg.V1DeprecatedAt, err = getTime("V1_DEPRECATED_AT"); err != nil {
+		return nil, err
+	}
+	if cfg.V1SunsetAt, err = getTime("V1_SUNSET_AT"); err != nil {
+		return nil, err
+	}
+	if cfg.V1Disabled, err = getBool("V1_DISABLED", cfg.V1Disabled); err != nil {
+		return nil, err
+	}
+	if cfg.AccessLogFormat != "combined" && cfg.AccessLogFormat != "json" {
+		return nil, errors.New("ACCESS_LOG_FORMAT: must be combined or json")
+	}
+	if cfg.AccessLogMaxBytes, err = getInt("ACCESS_LOG_MAX_BYTES", cfg.AccessLogMaxBytes); err != nil {
+		return nil, err
+	}
+	if cfg.AccessLogMaxAge, err = getDuration("ACCESS_LOG_MAX_AGE", cfg.AccessLogMaxAge); err != nil {
+		return nil, err
+	}
+	if cfg.AccessLogMaxFiles, err = getInt("ACCESS_LOG_MAX_FILES", cfg.AccessLogMaxFiles); err != nil {
+		return nil, err
+	}
+	if cfg.SlowRequestThreshold, err = getDuration("SLOW_REQUEST_THRESHOLD", cfg.SlowRequestThreshold); err != nil {
+		return nil, err
+	}
+	cfg.DebugToken = getString("DEBUG_TOKEN", cfg.DebugToken)
+	if cfg.MaxInFlight, err = getInt("MAX_IN_FLIGHT", cfg.MaxInFlight); err != nil {
+		return nil, err
+	}
+	if cfg.OverloadRetryAfter, err = getDuration("OVERLOAD_RETRY_AFTER", cfg.OverloadRetryAfter); err != nil {
+		return nil, err
+	}
+	if cfg.RequestTimeout, err = getDuration("REQUEST_TIMEOUT", cfg.RequestTimeout); err != nil {
+		return nil, err
+	}
+	if err = getDurationMap("ROUTE_TIMEOUTS", cfg.RouteTimeouts); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// getString returns the named variable, or def if unset.
+func getString(name, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
+
+// getList splits the named comma-separated variable, dropping empty items.
+func getList(name string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(name), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// getDuration parses a time.Duration from the named variable, returning def if unset.
+func getDuration(name string, def time.Duration) (time.Duration, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, errors.New(name + ": " + err.Error())
+	}
+	return d, nil
+}
+
+// getTime parses an RFC 3339 timestamp or a 2006-01-02 date from the named
+// variable, returning the zero time if unset.
+func getTime(name string) (time.Time, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		if t, err = time.Parse(time.DateOnly, v); err != nil {
+			return time.Time{}, errors.New(name + ": expected RFC 3339 time or YYYY-MM-DD date, got " + v)
+		}
+	}
+	return t, nil
+}
+
+// getInt parses an int from the named variable, returning def if unset.
+func getInt(name string, def int) (int, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, errors.New(name + ": " + err.Error())
+	}
+	return i, nil
+}
+
+// getDurationMap parses comma-separated "key=duration" pairs from the named
+// variable into m, e.g. "GET /api/v1/words=200ms,POST /api/v1/words=30s".
+func getDurationMap(name string, m map[string]time.Duration) error {
+	for _, item := range getList(name) {
+		key, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return errors.New(name + ": expected key=duration, got " + item)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			return errors.New(name + ": " + err.Error())
+		}
+		m[strings.TrimSpace(key)] = d
+	}
+	return nil
+}
+
+// getFloat parses a float64 from the named variable, returning def if unset.
+func getFloat(name string, def float64) (float64, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, errors.New(name + ": " + err.Error())
+	}
+	return f, nil
+}
+
+// getBool parses a boolean from the named variable, returning def if unset.
+func getBool(name string, def bool) (bool, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, errors.New(name + ": " + err.Error())
+	}
+	return b, nil
+}
@@ -0,0 +1,262 @@
+// Package dictionary manages the named dictionaries (tenants) served by the API.
+package dictionary
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/cg011235/autocomplete/internal/trie"
+)
+
+// Default is the dictionary used when a request does not name one. It is
+// set from configuration before requests are served.
+var Default = "default"
+
+// Quota limits the size of a dictionary. Zero values mean unlimited.
+type Quota struct {
+	MaxWords         int
+	MaxMetadataBytes int
+}
+
+// QuotaError reports an insert rejected because it would exceed a quota.
+type QuotaError struct {
+	Dictionary string
+	Limit      string
+	Max        int
+	Requested  int
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("quota exceeded: dictionary %q is limited to %d %s, request needs %d",
+		e.Dictionary, e.Max, e.Limit, e.Requested)
+}
+
+// Dictionary is a named Trie with its own quota. The Trie can be replaced
+// atomically, e.g. by an import or a rollback, without blocking readers.
+type Dictionary struct {
+	Name string
+
+	trie atomic.Pointer[trie.Trie]
+
+	mu       sync.RWMutex
+	quota    Quota
+	settings Settings
+	version  int
+	// applied counts the mutations applied on top of version.
+	applied uint64
+	// aliases maps alias prefixes to the canonical prefix searched instead.
+	aliases map[string]string
+	// entities holds multi-field entities by ID, entityTerms the IDs of the
+	// entities indexed under each term and ownedTerms the terms entities
+	// added to the Trie that no plain word shares.
+	entities    map[string]*Entity
+	entityTerms map[string]map[string]bool
+	ownedTerms  map[string]bool
+}
+
+func newDictionary(name string, quota Quota) *Dictionary {
+	d := &Dictionary{Name: name, quota: quota}
+	d.trie.Store(trie.NewTrie())
+	return d
+}
+
+// Trie returns the dictionary's current Trie.
+func (d *Dictionary) Trie() *trie.Trie {
+	return d.trie.Load()
+}
+
+// Swap atomically replaces the dictionary's Trie and records the version it
+// was loaded from, restarting the count of mutations applied on top of it if
+// the version changed. It returns the previous Trie.
+func (d *Dictionary) Swap(t *trie.Trie, version int) *trie.Trie {
+	d.mu.Lock()
+	if version != d.version {
+		d.applied = 0
+	}
+	d.version = version
+	d.mu.Unlock()
+	return d.trie.Swap(t)
+}
+
+// Applied records n more mutations applied on top of the current version.
+func (d *Dictionary) Applied(n uint64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.applied += n
+}
+
+// Revision returns the stored version currently served and the number of
+// mutations applied on top of it.
+func (d *Dictionary) Revision() (int, uint64) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.version, d.applied
+}
+
+// Version returns the stored version currently served, or 0 if the
+// dictionary has not been loaded from a version.
+func (d *Dictionary) Version() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.version
+}
+
+// Quota returns the dictionary's quota.
+func (d *Dictionary) Quota() Quota {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.quota
+}
+
+// SetQuota replaces the dictionary's quota. Words already stored are kept
+// even if they exceed the new limits; only further inserts are rejected.
+func (d *Dictionary) SetQuota(q Quota) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.quota = q
+}
+
+// CheckQuota returns a *QuotaError if adding the given number of words and
+// metadata bytes would exceed the dictionary's quota.
+func (d *Dictionary) CheckQuota(words, metadataBytes int) error {
+	t := d.Trie()
+	return d.CheckSize(t.Len()+words, t.MetadataBytes()+metadataBytes)
+}
+
+// CheckSize returns a *QuotaError if a dictionary of the given total size
+// would exceed the quota, e.g. before swapping in an imported Trie.
+func (d *Dictionary) CheckSize(words, metadataBytes int) error {
+	q := d.Quota()
+	if q.MaxWords > 0 && words > q.MaxWords {
+		return &QuotaError{Dictionary: d.Name, Limit: "words", Max: q.MaxWords, Requested: words}
+	}
+	if q.MaxMetadataBytes > 0 && metadataBytes > q.MaxMetadataBytes {
+		return &QuotaError{Dictionary: d.Name, Limit: "metadata bytes", Max: q.MaxMetadataBytes, Requested: metadataBytes}
+	}
+	return nil
+}
+
+// SetAlias makes queries starting with alias search target instead, e.g.
+// "colour" → "color" so "colourf" finds "colorful".
+func (d *Dictionary) SetAlias(alias, target string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.aliases == nil {
+		d.aliases = make(map[string]string)
+	}
+	d.aliases[alias] = target
+}
+
+// RemoveAlias deletes an alias, reporting whether it existed.
+func (d *Dictionary) RemoveAlias(alias string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, ok := d.aliases[alias]
+	delete(d.aliases, alias)
+	return ok
+}
+
+// Aliases returns a copy of the dictionary's aliases.
+func (d *Dictionary) Aliases() map[string]string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	aliases := make(map[string]string, len(d.aliases))
+	for alias, target := range d.aliases {
+		aliases[alias] = target
+	}
+	return aliases
+}
+
+// Resolve rewrites a query prefix starting with an alias to start with its
+// target instead, using the longest matching alias.
+func (d *Dictionary) Resolve(prefix string) string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	best := ""
+	for alias := range d.aliases {
+		if len(alias) > len(best) && strings.HasPrefix(prefix, alias) {
+			best = alias
+		}
+	}
+	if best == "" {
+		return prefix
+	}
+	return d.aliases[best] + prefix[len(best):]
+}
+
+// Registry holds the dictionaries by name.
+type Registry struct {
+	mu           sync.RWMutex
+	dicts        map[string]*Dictionary
+	defaultQuota Quota
+}
+
+// NewRegistry creates an empty Registry whose new dictionaries start with defaultQuota.
+func NewRegistry(defaultQuota Quota) *Registry {
+	return &Registry{dicts: make(map[string]*Dictionary), defaultQuota: defaultQuota}
+}
+
+// SetDefaultQuota sets the quota given to dictionaries created from now on.
+func (r *Registry) SetDefaultQuota(q Quota) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.defaultQuota = q
+}
+
+// Get returns the named dictionary, creating it empty on first use.
+func (r *Registry) Get(name string) *Dictionary {
+	r.mu.RLock()
+	d, ok := r.dicts[name]
+	r.mu.RUnlock()
+	if ok {
+		return d
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if d, ok = r.dicts[name]; !ok {
+		d = newDictionary(name, r.defaultQuota)
+		r.dicts[name] = d
+	}
+	return d
+}
+
+// Lookup returns the named dictionary if it exists, without creating it.
+func (r *Registry) Lookup(name string) (*Dictionary, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	d, ok := r.dicts[name]
+	return d, ok
+}
+
+// Remove drops the named dictionary; it is recreated empty on the next Get.
+func (r *Registry) Remove(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.dicts, name)
+}
+
+// List returns all dictionaries sorted by name.
+func (r *Registry) List() []*Dictionary {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	list := make([]*Dictionary, 0, len(r.dicts))
+	for _, d := range r.dicts {
+		list = append(list, d)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Tries returns the Trie of every dictionary.
+func (r *Registry) Tries() []*trie.Trie {
+	list := r.List()
+	tries := make([]*trie.Trie, len(list))
+	for i, d := range list {
+		tries[i] = d.Trie()
+	}
+	return tries
+}
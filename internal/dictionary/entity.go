@@ -0,0 +1,195 @@
+package dictionary
+
+import (
+	"sort"
+)
+
+// Entity is a thing suggested by any of several searchable fields, e.g. a
+// product found by its name, SKU or aliases. Terms are the words it is
+// indexed under: its name and fields as the dictionary's normalizers folded
+// them when the entity was stored.
+type Entity struct {
+	ID       string            `json:"id"`
+	Name     string            `json:"name"`
+	Fields   []string          `json:"fields,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Terms    []string          `json:"terms"`
+}
+
+// EntityState is what is stored of a dictionary's entities: the entities
+// and the terms they added to the Trie that no plain word shares.
+type EntityState struct {
+	Entities []Entity `json:"entities"`
+	Owned    []string `json:"owned,omitempty"`
+}
+
+// PutEntity creates or replaces an entity. It returns the terms to add to
+// the Trie, those no entity was indexed under before and no plain word
+// shares, and the terms to remove from it, those entities added that no
+// entity is indexed under anymore.
+func (d *Dictionary) PutEntity(e Entity) (added, removed []string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.entities == nil {
+		d.entities = make(map[string]*Entity)
+		d.entityTerms = make(map[string]map[string]bool)
+		d.ownedTerms = make(map[string]bool)
+	}
+	var old []string
+	if prev, ok := d.entities[e.ID]; ok {
+		old = prev.Terms
+	}
+	for _, term := range old {
+		d.unindex(term, e.ID)
+	}
+	t := d.Trie()
+	for _, term := range e.Terms {
+		if len(d.entityTerms[term]) == 0 && !d.ownedTerms[term] && !t.Exists(term) {
+			d.ownedTerms[term] = true
+			added = append(added, term)
+		}
+		if d.entityTerms[term] == nil {
+			d.entityTerms[term] = make(map[string]bool)
+		}
+		d.entityTerms[term][e.ID] = true
+	}
+	for _, term := range old {
+		if d.drop(term) {
+			removed = append(removed, term)
+		}
+	}
+	d.entities[e.ID] = &e
+	return added, removed
+}
+
+// DeleteEntity removes an entity, returning the terms it added to the Trie
+// that no entity is indexed under anymore. It reports false if the entity
+// did not exist.
+func (d *Dictionary) DeleteEntity(id string) (removed []string, ok bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	e, ok := d.entities[id]
+	if !ok {
+		return nil, false
+	}
+	delete(d.entities, id)
+	for _, term := range e.Terms {
+		d.unindex(term, id)
+		if d.drop(term) {
+			removed = append(removed, term)
+		}
+	}
+	return removed, true
+}
+
+// unindex drops id from the entities indexed under term. The caller must
+// hold the lock.
+func (d *Dictionary) unindex(term, id string) {
+	delete(d.entityTerms[term], id)
+}
+
+// drop forgets term if no entity is indexed under it anymore, reporting
+// whether it was added to the Trie by entities alone and should be removed
+// from it. The caller must hold the lock.
+func (d *Dictionary) drop(term string) bool {
+	if len(d.entityTerms[term]) > 0 {
+		return false
+	}
+	delete(d.entityTerms, term)
+	owned := d.ownedTerms[term]
+	delete(d.ownedTerms, term)
+	return owned
+}
+
+// Disown records that words were added or imported as plain words, so they
+// stay in the Trie when the entities indexed under them are deleted. It
+// reports whether any of them had been added by entities alone.
+func (d *Dictionary) Disown(words []string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	changed := false
+	for _, word := range words {
+		if d.ownedTerms[word] {
+			delete(d.ownedTerms, word)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// Entity returns the entity with the given ID.
+func (d *Dictionary) Entity(id string) (Entity, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	e, ok := d.entities[id]
+	if !ok {
+		return Entity{}, false
+	}
+	return *e, true
+}
+
+// EntitiesFor returns the entities indexed under term, sorted by ID.
+func (d *Dictionary) EntitiesFor(term string) []Entity {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	ids := make([]string, 0, len(d.entityTerms[term]))
+	for id := range d.entityTerms[term] {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	entities := make([]Entity, len(ids))
+	for i, id := range ids {
+		entities[i] = *d.entities[id]
+	}
+	return entities
+}
+
+// EntityTerms returns every term an entity is indexed under, sorted.
+func (d *Dictionary) EntityTerms() []string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	terms := make([]string, 0, len(d.entityTerms))
+	for term := range d.entityTerms {
+		terms = append(terms, term)
+	}
+	sort.Strings(terms)
+	return terms
+}
+
+// Entities returns the dictionary's entities, sorted by ID, and the terms
+// they added to the Trie, for storing.
+func (d *Dictionary) Entities() EntityState {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	s := EntityState{Entities: make([]Entity, 0, len(d.entities))}
+	for _, e := range d.entities {
+		s.Entities = append(s.Entities, *e)
+	}
+	sort.Slice(s.Entities, func(i, j int) bool { return s.Entities[i].ID < s.Entities[j].ID })
+	for term := range d.ownedTerms {
+		s.Owned = append(s.Owned, term)
+	}
+	sort.Strings(s.Owned)
+	return s
+}
+
+// SetEntities replaces the dictionary's entities with stored ones.
+func (d *Dictionary) SetEntities(s EntityState) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.entities = make(map[string]*Entity, len(s.Entities))
+	d.entityTerms = make(map[string]map[string]bool)
+	d.ownedTerms = make(map[string]bool, len(s.Owned))
+	for _, e := range s.Entities {
+		d.entities[e.ID] = &e
+		for _, term := range e.Terms {
+			if d.entityTerms[term] == nil {
+				d.entityTerms[term] = make(map[string]bool)
+			}
+			d.entityTerms[term][e.ID] = true
+		}
+	}
+	for _, term := range s.Owned {
+		d.ownedTerms[term] = true
+	}
+}
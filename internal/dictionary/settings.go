@@ -0,0 +1,60 @@
+package dictionary
+
+import (
+	"fmt"
+
+	"github.com/cg011235/autocomplete/internal/normalize"
+)
+
+// Settings override the server-wide behaviour for one dictionary. Zero
+// values fall back to the server defaults.
+type Settings struct {
+	// Normalizers name the normalize pipeline applied to words and
+	// prefixes, e.g. nfc, diacritics, lowercase; "none" applies none.
+	Normalizers []string `json:"normalizers,omitempty"`
+	// Tokenizer names the tokenizer splitting inserted text into words,
+	// e.g. whitespace; "none" keeps text whole.
+	Tokenizer string `json:"tokenizer,omitempty"`
+	// CaseSensitive, if set, removes or adds lowercase to the normalizers.
+	CaseSensitive *bool `json:"case_sensitive,omitempty"`
+	// MinPrefixLength is the shortest prefix, in characters, that gets
+	// suggestions.
+	MinPrefixLength int `json:"min_prefix_length,omitempty"`
+	// MaxResults caps the number of suggestions returned.
+	MaxResults int `json:"max_results,omitempty"`
+	// Fuzzy is the edit distance used when a request does not give one.
+	Fuzzy int `json:"fuzzy,omitempty"`
+	// Ranker names the registered ranking.Ranker ordering suggestions.
+	Ranker string `json:"ranker,omitempty"`
+}
+
+// Validate reports the first invalid setting.
+func (s Settings) Validate() error {
+	if len(s.Normalizers) > 0 {
+		if _, err := normalize.Parse(s.Normalizers); err != nil {
+			return err
+		}
+	}
+	if _, err := normalize.LookupTokenizer(s.Tokenizer); err != nil {
+		return err
+	}
+	if s.MinPrefixLength < 0 || s.MaxResults < 0 || s.Fuzzy < 0 {
+		return fmt.Errorf("limits must not be negative")
+	}
+	return nil
+}
+
+// Settings returns the dictionary's settings.
+func (d *Dictionary) Settings() Settings {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.settings
+}
+
+// SetSettings replaces the dictionary's settings. Words already stored keep
+// the form they were normalized to.
+func (d *Dictionary) SetSettings(s Settings) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.settings = s
+}
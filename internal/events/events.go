@@ -0,0 +1,34 @@
+// Package events defines the dictionary mutation events emitted by the service.
+package events
+
+import "time"
+
+// Event types.
+const (
+	Insert = "insert"
+	Delete = "delete"
+	Clear  = "clear"
+	// Swap replaces the whole dictionary, e.g. after an import or rollback.
+	Swap = "swap"
+)
+
+// Event describes a single mutation of the dictionary.
+// Seq increases by one with every event, letting consumers detect gaps.
+// Numbering starts over whenever the service restarts, except after a clean
+// shutdown with the write-ahead log enabled; Epoch names the numbering Seq
+// belongs to, so a consumer seeing a different epoch must resynchronize
+// rather than resume from its last sequence number.
+type Event struct {
+	Epoch string    `json:"epoch"`
+	Seq   uint64    `json:"seq"`
+	Dict  string    `json:"dict"`
+	Type  string    `json:"type"`
+	Word  string    `json:"word,omitempty"`
+	Time  time.Time `json:"time"`
+}
+
+// Sink receives mutation events. Publish must not block the caller for long;
+// slow deliveries should be queued and performed asynchronously.
+type Sink interface {
+	Publish(e Event)
+}
@@ -0,0 +1,39 @@
+// Package grapheme matches strings by user-perceived characters (extended
+// grapheme clusters) rather than by code point, so multi-rune emoji and
+// combining sequences are never split.
+package grapheme
+
+import (
+	"strings"
+
+	"github.com/rivo/uniseg"
+)
+
+// HasPrefix reports whether s begins with prefix and prefix ends on a
+// grapheme cluster boundary of s. For example "👩" is a code point prefix of
+// "👩‍💻" (woman, zero width joiner, laptop) but not a grapheme prefix, and
+// "e" is not a grapheme prefix of "é" (e with a combining acute).
+func HasPrefix(s, prefix string) bool {
+	if !strings.HasPrefix(s, prefix) {
+		return false
+	}
+	if len(prefix) == 0 || len(prefix) == len(s) {
+		return true
+	}
+	offset, state := 0, -1
+	rest := s
+	for len(rest) > 0 {
+		var cluster string
+		cluster, rest, _, state = uniseg.FirstGraphemeClusterInString(rest, state)
+		offset += len(cluster)
+		if offset >= len(prefix) {
+			return offset == len(prefix)
+		}
+	}
+	return false
+}
+
+// Count returns the number of grapheme clusters in s.
+func Count(s string) int {
+	return uniseg.GraphemeClusterCount(s)
+}
@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/cg011235/autocomplete/internal/dictionary"
+	"github.com/cg011235/autocomplete/internal/middleware"
+	"github.com/cg011235/autocomplete/internal/response"
+	"github.com/cg011235/autocomplete/pkg/models"
+	"github.com/gorilla/mux"
+)
+
+const defaultRetryAfter = 60
+
+// GetModeHandler returns the current server mode.
+// @Summary Get server mode
+// @Description Returns whether the server is in normal, read-only or maintenance mode
+// @Tags admin
+// @Produce json
+// @Success 200 {object} models.ModeResponse
+// @Failure 403 {object} map[string]string
+// @Router /api/v1/admin/mode [get]
+func GetModeHandler(w http.ResponseWriter, r *http.Request) {
+	writeMode(w)
+}
+
+// SetModeHandler switches the server between normal, read-only and maintenance mode.
+// @Summary Set server mode
+// @Description In read-only mode writes are rejected with 503; in maintenance mode all non-admin routes are
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param mode body models.ModeRequest true "Target mode"
+// @Success 200 {object} models.ModeResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Router /api/v1/admin/mode [post]
+func SetModeHandler(w http.ResponseWriter, r *http.Request) {
+	var request models.ModeRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || !middleware.ValidMode(request.Mode) {
+		response.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if request.RetryAfter <= 0 {
+		request.RetryAfter = defaultRetryAfter
+	}
+
+	middleware.SetMode(request.Mode, request.RetryAfter)
+	writeMode(w)
+}
+
+func writeMode(w http.ResponseWriter) {
+	mode, retryAfter := middleware.Mode()
+	response := models.ModeResponse{
+		Status:     "success",
+		Mode:       mode,
+		RetryAfter: retryAfter,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// ListTiersHandler returns the rate limit tiers and per-user assignments.
+// @Summary List rate limit tiers
+// @Description Returns every tier's token bucket settings and the users explicitly assigned to tiers
+// @Tags admin
+// @Produce json
+// @Success 200 {object} models.TiersResponse
+// @Failure 403 {object} map[string]string
+// @Router /api/v1/admin/tiers [get]
+func ListTiersHandler(w http.ResponseWriter, r *http.Request) {
+	writeTiers(w)
+}
+
+// SetTierHandler creates or updates a rate limit tier.
+// @Summary Create or update a rate limit tier
+// @Description Sets the requests per second and burst size of a tier; existing buckets are reset
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param name path string true "Tier name"
+// @Param tier body models.Tier true "Tier limits"
+// @Success 200 {object} models.TiersResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Router /api/v1/admin/tiers/{name} [put]
+func SetTierHandler(w http.ResponseWriter, r *http.Request) {
+	var request models.Tier
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Rate <= 0 || request.Burst <= 0 {
+		response.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	middleware.SetTier(mux.Vars(r)["name"], middleware.Tier{Rate: request.Rate, Burst: request.Burst})
+	writeSavedTiers(w)
+}
+
+// DeleteTierHandler removes a rate limit tier.
+// @Summary Delete a rate limit tier
+// @Description Built-in tiers and tiers still assigned to a user or consumer cannot be deleted
+// @Tags admin
+// @Produce json
+// @Param name path string true "Tier name"
+// @Success 200 {object} models.TiersResponse
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/admin/tiers/{name} [delete]
+func DeleteTierHandler(w http.ResponseWriter, r *http.Request) {
+	if err := middleware.DeleteTier(mux.Vars(r)["name"]); errors.Is(err, middleware.ErrUnknownTier) {
+		response.Error(w, http.StatusNotFound, "Tier not found")
+		return
+	} else if err != nil {
+		response.Error(w, http.StatusConflict, err.Error())
+		return
+	}
+	writeSavedTiers(w)
+}
+
+// AssignTierHandler assigns a user to a rate limit tier.
+// @Summary Assign a user's rate limit tier
+// @Description Overrides the tier derived from the user's role; an empty tier removes the override
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param username path string true "Username"
+// @Param tier body models.AssignTierRequest true "Tier name"
+// @Success 200 {object} models.TiersResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Router /api/v1/admin/users/{username}/tier [put]
+func AssignTierHandler(w http.ResponseWriter, r *http.Request) {
+	var request models.AssignTierRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if !middleware.AssignTier(mux.Vars(r)["username"], request.Tier) {
+		response.Error(w, http.StatusBadRequest, "Unknown tier: "+request.Tier)
+		return
+	}
+	writeSavedTiers(w)
+}
+
+// writeSavedTiers stores the changed tiers before writing them.
+func writeSavedTiers(w http.ResponseWriter) {
+	if err := saveAccess(); err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to save tiers: "+err.Error())
+		return
+	}
+	writeTiers(w)
+}
+
+func writeTiers(w http.ResponseWriter) {
+	resp := models.TiersResponse{
+		Status:      "success",
+		Tiers:       map[string]models.Tier{},
+		Assignments: middleware.TierAssignments(),
+	}
+	for name, t := range middleware.Tiers() {
+		resp.Tiers[name] = models.Tier{Rate: t.Rate, Burst: t.Burst}
+	}
+	response.JSON(w, http.StatusOK, resp)
+}
+
+// ListQuotasHandler returns the quota and usage of every dictionary.
+// @Summary List dictionary quotas
+// @Description Returns each dictionary's word and metadata limits along with current usage
+// @Tags admin
+// @Produce json
+// @Success 200 {object} models.QuotasResponse
+// @Failure 403 {object} map[string]string
+// @Router /api/v1/admin/quotas [get]
+func ListQuotasHandler(w http.ResponseWriter, r *http.Request) {
+	resp := models.QuotasResponse{Status: "success", Quotas: []models.DictionaryQuota{}}
+	for _, d := range dicts.List() {
+		resp.Quotas = append(resp.Quotas, quotaOf(d))
+	}
+	response.JSON(w, http.StatusOK, resp)
+}
+
+// SetQuotaHandler sets the quota of a dictionary.
+// @Summary Set a dictionary quota
+// @Description Limits the number of words and total metadata bytes of a dictionary; zero means unlimited
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param dict path string true "Dictionary name"
+// @Param quota body models.QuotaRequest true "Quota limits"
+// @Success 200 {object} models.QuotasResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Router /api/v1/admin/quotas/{dict} [put]
+func SetQuotaHandler(w http.ResponseWriter, r *http.Request) {
+	var request models.QuotaRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.MaxWords < 0 || request.MaxMetadataBytes < 0 {
+		response.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	d := dicts.Get(mux.Vars(r)["dict"])
+	d.SetQuota(dictionary.Quota{MaxWords: request.MaxWords, MaxMetadataBytes: request.MaxMetadataBytes})
+	response.JSON(w, http.StatusOK, models.QuotasResponse{
+		Status: "success",
+		Quotas: []models.DictionaryQuota{quotaOf(d)},
+	})
+}
+
+func quotaOf(d *dictionary.Dictionary) models.DictionaryQuota {
+	q := d.Quota()
+	return models.DictionaryQuota{
+		Dict:             d.Name,
+		MaxWords:         q.MaxWords,
+		MaxMetadataBytes: q.MaxMetadataBytes,
+		Words:            d.Trie().Len(),
+		MetadataBytes:    d.Trie().MetadataBytes(),
+	}
+}
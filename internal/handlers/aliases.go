@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/cg011235/autocomplete/internal/dictionary"
+	"github.com/cg011235/autocomplete/internal/response"
+	"github.com/cg011235/autocomplete/pkg/models"
+	"github.com/gorilla/mux"
+)
+
+// ListAliasesHandler lists the prefix aliases of a dictionary.
+// @Summary List prefix aliases
+// @Description Returns the aliases whose queries search a canonical prefix instead
+// @Tags admin
+// @Produce json
+// @Param dict query string false "Dictionary name"
+// @Success 200 {object} models.AliasesResponse
+// @Failure 403 {object} map[string]string
+// @Router /api/v1/admin/aliases [get]
+func ListAliasesHandler(w http.ResponseWriter, r *http.Request) {
+	writeAliases(w, dictionaryFor(r))
+}
+
+// SetAliasHandler creates or replaces a prefix alias.
+// @Summary Set a prefix alias
+// @Description Queries starting with the alias search the target prefix instead, e.g. colour → color
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param dict query string false "Dictionary name"
+// @Param alias path string true "Alias prefix"
+// @Param target body models.AliasRequest true "Canonical prefix"
+// @Success 200 {object} models.AliasesResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Router /api/v1/admin/aliases/{alias} [put]
+func SetAliasHandler(w http.ResponseWriter, r *http.Request) {
+	var request models.AliasRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Target == "" {
+		response.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if !validField(w, "alias", mux.Vars(r)["alias"]) || !validField(w, "target", request.Target) {
+		return
+	}
+	// Aliases match query prefixes, which are folded like words
+	dict := dictionaryFor(r)
+	alias := canonical(dict, mux.Vars(r)["alias"])
+	target := canonical(dict, request.Target)
+	if alias == "" || target == "" {
+		response.Error(w, http.StatusBadRequest, "Alias and target must not fold to nothing")
+		return
+	}
+	if alias == target {
+		response.Error(w, http.StatusBadRequest, "Alias and target must differ")
+		return
+	}
+
+	writeMu.Lock()
+	defer writeMu.Unlock()
+	dict.SetAlias(alias, target)
+	if err := saveAliases(dict); err != nil {
+		response.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	invalidate() // Responses for the alias may be cached by clients
+	writeAliases(w, dict)
+}
+
+// DeleteAliasHandler removes a prefix alias.
+// @Summary Delete a prefix alias
+// @Tags admin
+// @Produce json
+// @Param dict query string false "Dictionary name"
+// @Param alias path string true "Alias prefix"
+// @Success 200 {object} models.AliasesResponse
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/admin/aliases/{alias} [delete]
+func DeleteAliasHandler(w http.ResponseWriter, r *http.Request) {
+	dict := dictionaryFor(r)
+	writeMu.Lock()
+	defer writeMu.Unlock()
+	if !dict.RemoveAlias(canonical(dict, mux.Vars(r)["alias"])) {
+		response.Error(w, http.StatusNotFound, "Alias not found")
+		return
+	}
+	if err := saveAliases(dict); err != nil {
+		response.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	invalidate()
+	writeAliases(w, dict)
+}
+
+// aliasesState names the stored aliases of a dictionary.
+const aliasesState = "aliases"
+
+// saveAliases stores the aliases of dict, if there is a version store. The
+// caller must hold writeMu.
+func saveAliases(dict *dictionary.Dictionary) error {
+	if versions == nil {
+		return nil
+	}
+	if err := versions.SaveDictState(dict.Name, aliasesState, dict.Aliases()); err != nil {
+		return fmt.Errorf("storing aliases: %w", err)
+	}
+	return nil
+}
+
+func writeAliases(w http.ResponseWriter, dict *dictionary.Dictionary) {
+	response.JSON(w, http.StatusOK, models.AliasesResponse{
+		Status:  "success",
+		Dict:    dict.Name,
+		Aliases: dict.Aliases(),
+	})
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cg011235/autocomplete/internal/dictionary"
+	"github.com/cg011235/autocomplete/internal/response"
+	"github.com/cg011235/autocomplete/internal/store"
+	"github.com/cg011235/autocomplete/internal/trie"
+	"github.com/cg011235/autocomplete/pkg/models"
+	"github.com/patrickmn/go-cache"
+)
+
+// maxPastTries bounds the Tries kept in pastTries; each holds a whole
+// dictionary.
+const maxPastTries = 2
+
+var (
+	// pastTries holds Tries rebuilt from stored versions for asOf queries,
+	// so a support session replaying queries against one version loads it
+	// once. Hits extend the expiry, so evicting the entry expiring first
+	// drops the least recently used.
+	pastTries = cache.New(5*time.Minute, 10*time.Minute)
+	// pastMu serializes loading versions into pastTries, so concurrent
+	// queries load a version once and the bound holds.
+	pastMu sync.Mutex
+)
+
+// resolveAsOf returns the stored version of dict that asOf refers to: a
+// version number, or an RFC 3339 timestamp selecting the newest version
+// stored at or before it.
+func resolveAsOf(dict *dictionary.Dictionary, asOf string) (int, error) {
+	if versions == nil {
+		return 0, store.ErrVersionNotFound
+	}
+	if n, err := strconv.Atoi(asOf); err == nil {
+		if n <= 0 {
+			return 0, errInvalidVersion
+		}
+		return n, nil
+	}
+	at, err := time.Parse(time.RFC3339, asOf)
+	if err != nil {
+		return 0, errInvalidVersion
+	}
+	list, err := versions.List(dict.Name)
+	if err != nil {
+		return 0, err
+	}
+	version := 0
+	for _, v := range list {
+		if !v.Created.After(at) {
+			version = v.Version
+		}
+	}
+	if version == 0 {
+		return 0, store.ErrVersionNotFound
+	}
+	return version, nil
+}
+
+// pastTrie returns the Trie of a stored version of dict.
+func pastTrie(dict *dictionary.Dictionary, version int) (*trie.Trie, error) {
+	key := dict.Name + "\x00" + strconv.Itoa(version)
+	pastMu.Lock()
+	defer pastMu.Unlock()
+	if t, found := pastTries.Get(key); found {
+		pastTries.Set(key, t, cache.DefaultExpiration)
+		return t.(*trie.Trie), nil
+	}
+	entries, err := versions.Load(dict.Name, version)
+	if err != nil {
+		return nil, err
+	}
+	t := trie.ScratchFromEntries(entries)
+	evictPastTries()
+	pastTries.Set(key, t, cache.DefaultExpiration)
+	return t, nil
+}
+
+// evictPastTries makes room in pastTries for one more Trie, dropping the
+// least recently used. The caller must hold pastMu.
+func evictPastTries() {
+	pastTries.DeleteExpired()
+	items := pastTries.Items()
+	for len(items) >= maxPastTries {
+		oldest := ""
+		for k, item := range items {
+			if oldest == "" || item.Expiration < items[oldest].Expiration {
+				oldest = k
+			}
+		}
+		pastTries.Delete(oldest)
+		delete(items, oldest)
+	}
+}
+
+// writePastWords answers a suggest query from the stored version of dict
+// that asOf refers to, with the dictionary's current settings and aliases.
+// Mutations logged after that version are not applied, and personal history
+// is not blended in. Nothing is cached or recorded as a query.
+func writePastWords(w http.ResponseWriter, r *http.Request, dict *dictionary.Dictionary, asOf, prefix, context string, explain bool, fields response.Fields) {
+	version, err := resolveAsOf(dict, asOf)
+	if err != nil {
+		writeVersionError(w, err)
+		return
+	}
+	t, err := pastTrie(dict, version)
+	if err != nil {
+		writeVersionError(w, err)
+		return
+	}
+	prefix = dict.Resolve(queryPrefix(dict, prefix))
+	var results []string
+	if !belowMinPrefix(dict, prefix) {
+		results = capResults(dict, rankIn(dict, t, prefix, context, nil))
+	}
+	results, cursor, ok := pageResults(w, r, results, uint64(version), explain || fields != nil)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	if fields != nil {
+		writeSelected(w, r, explainScores(rankerFor(dict), t, results, prefix, context, nil, 0), fields, cursor)
+		return
+	}
+	complete, next := nextChars(t, prefix)
+	resp := models.ListWordsResponse{
+		Status:    "success",
+		Count:     len(results),
+		Data:      displayForms(t, nonNil(results)),
+		Complete:  complete,
+		NextChars: next,
+		Truncated: cursor != "",
+		Cursor:    cursor,
+		Version:   version,
+	}
+	if explain {
+		resp.Explain = explainScores(rankerFor(dict), t, results, prefix, context, nil, 0)
+	}
+	response.Negotiated(w, r, http.StatusOK, resp)
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/cg011235/autocomplete/internal/dictionary"
+	"github.com/cg011235/autocomplete/internal/response"
+)
+
+// Estimated encoded bytes per suggestion beyond the word itself: quotes and a
+// separator, or a whole score breakdown when results are explained.
+const (
+	resultOverhead    = 4
+	explainedOverhead = 192
+)
+
+// responseBudget caps the estimated bytes of the results in one suggest
+// response; zero disables the guard.
+var responseBudget int
+
+// SetResponseBudget caps the estimated bytes of suggestion results in a
+// response. Results beyond the budget are left out and the response carries
+// a cursor continuing after the last one sent.
+func SetResponseBudget(bytes int) {
+	responseBudget = bytes
+}
+
+// cursorEpoch identifies the content the suggestions of dicts are ranked
+// from: each one's stored version, the mutations applied on top of it and the
+// settings ranking depends on. Replicas and restarts serving the same content
+// agree on it, so cursors stay valid across them. Mutations that are not
+// logged are lost on restart, so once there are any it also names the
+// process.
+func cursorEpoch(dicts ...*dictionary.Dictionary) uint64 {
+	h := xxhash.New()
+	for _, dict := range dicts {
+		version, applied := dict.Revision()
+		fmt.Fprintf(h, "%s\x00%d\x00%d\x00%s\x00", dict.Name, version, applied, cacheOptions(dict))
+		if applied > 0 && !walEnabled.Load() {
+			h.WriteString(eventEpoch())
+		}
+	}
+	return h.Sum64()
+}
+
+// pageResults applies the request's cursor and the response budget to the
+// ranked results of a query answered at the given epoch, a value that
+// changes whenever the ranking may: see cursorEpoch, or a stored version.
+// It returns the results to send and the cursor continuing after them, or
+// "" if none remain. On a bad cursor it writes the error and returns false.
+func pageResults(w http.ResponseWriter, r *http.Request, results []string, epoch uint64, explained bool) ([]string, string, bool) {
+	offset := 0
+	if c := r.URL.Query().Get("cursor"); c != "" {
+		var at uint64
+		if err := parseCursor(c, &at, &offset); err != nil || offset < 0 {
+			response.Error(w, http.StatusBadRequest, "Invalid 'cursor' query parameter")
+			return nil, "", false
+		}
+		if at != epoch {
+			response.Error(w, http.StatusGone, "Cursor expired; the dictionary changed since the first page")
+			return nil, "", false
+		}
+		results = results[min(offset, len(results)):]
+	}
+	if responseBudget <= 0 {
+		return results, "", true
+	}
+
+	overhead := resultOverhead
+	if explained {
+		overhead = explainedOverhead
+	}
+	size := 0
+	for i, word := range results {
+		size += len(word) + overhead
+		// Always send at least one result so a cursor makes progress.
+		if size > responseBudget && i > 0 {
+			return results[:i], formatCursor(epoch, offset+i), true
+		}
+	}
+	return results, "", true
+}
+
+func formatCursor(epoch uint64, offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%d", epoch, offset)))
+}
+
+func parseCursor(c string, epoch *uint64, offset *int) error {
+	raw, err := base64.RawURLEncoding.DecodeString(c)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Sscanf(string(raw), "%d:%d", epoch, offset)
+	return err
+}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/cg011235/autocomplete/internal/dictionary"
+	"github.com/patrickmn/go-cache"
+)
+
+// CachePolicy controls server-side caching of suggest results and the HTTP
+// caching headers sent to browsers and CDNs.
+type CachePolicy struct {
+	// TTL is how long results stay in the server-side cache.
+	TTL time.Duration
+	// MaxAge is the max-age sent in the Cache-Control header. Zero disables client caching.
+	MaxAge time.Duration
+	// Public allows shared caches (CDNs, proxies) to store responses.
+	Public bool
+	// NegativeTTL is how long empty results stay cached. It is kept short
+	// because misses are cheap to recompute and volatile under inserts.
+	NegativeTTL time.Duration
+}
+
+var (
+	cachePolicy = CachePolicy{TTL: 5 * time.Minute, MaxAge: 60 * time.Second, NegativeTTL: 10 * time.Second}
+
+	// negativeCache records dictionary/prefix pairs known to have no matches.
+	// Unlike positive results, entries are not keyed by context: a prefix
+	// without words is empty whatever the ranking.
+	negativeCache = cache.New(10*time.Second, time.Minute)
+
+	// generation is bumped on every dictionary mutation and keys the
+	// server-side caches, so results computed before a change are not served.
+	generation atomic.Uint64
+)
+
+// SetCachePolicy configures the response cache policy and resets the server-side cache.
+func SetCachePolicy(p CachePolicy) {
+	cachePolicy = p
+	cacheV1 = cache.New(p.TTL, 2*p.TTL)
+	negativeCache = cache.New(p.NegativeTTL, time.Minute)
+}
+
+// cacheKey identifies a cached suggest result. It holds every input the
+// result depends on, so results of different dictionaries, normalizations or
+// query modes never collide.
+type cacheKey struct {
+	Dict string
+	// Generation is the dictionary generation the result was computed at.
+	// A result computed while a mutation flushed the cache is stored under
+	// the old generation and never served.
+	Generation uint64
+	// Options fingerprints the normalization and ranking of the dictionary.
+	Options string
+	Prefix  string
+	Context string
+	// Fuzzy is the edit distance of fuzzy results, 0 for exact ones.
+	Fuzzy int
+	// Limit is the number of results kept, 0 for the full ranked list.
+	Limit int
+}
+
+// String encodes k as the key of the underlying cache.
+func (k cacheKey) String() string {
+	return strings.Join([]string{
+		k.Dict,
+		strconv.FormatUint(k.Generation, 10),
+		k.Options,
+		k.Prefix,
+		k.Context,
+		strconv.Itoa(k.Fuzzy),
+		strconv.Itoa(k.Limit),
+	}, "\x00")
+}
+
+// parseCacheKey decodes a key produced by cacheKey.String.
+func parseCacheKey(s string) cacheKey {
+	parts := strings.SplitN(s, "\x00", 7)
+	for len(parts) < 7 {
+		parts = append(parts, "")
+	}
+	k := cacheKey{Dict: parts[0], Options: parts[2], Prefix: parts[3], Context: parts[4]}
+	k.Generation, _ = strconv.ParseUint(parts[1], 10, 64)
+	k.Fuzzy, _ = strconv.Atoi(parts[5])
+	k.Limit, _ = strconv.Atoi(parts[6])
+	return k
+}
+
+// suggestKey returns the cache key of the suggestions for prefix in dict at
+// the current generation.
+func suggestKey(dict *dictionary.Dictionary, prefix, context string) cacheKey {
+	return cacheKey{
+		Dict:       dict.Name,
+		Generation: generation.Load(),
+		Options:    cacheOptions(dict),
+		Prefix:     prefix,
+		Context:    context,
+	}
+}
+
+// cacheOptions fingerprints the settings of dict that change what a prefix
+// matches or how the matches are ordered.
+func cacheOptions(dict *dictionary.Dictionary) string {
+	opts := strings.Join(pipelineFor(dict).Names(), ",")
+	if graphemeMatching {
+		opts += ";grapheme"
+	}
+	if ranker := dict.Settings().Ranker; ranker != "" {
+		opts += ";ranker=" + ranker
+	}
+	return opts
+}
+
+// negativeKey returns the negative cache key of prefix in the named
+// dictionary at generation gen. Like results, a miss found while a mutation
+// ran is stored under the old generation and never served. No matches do not
+// depend on the ranking, so negative keys carry no options.
+func negativeKey(dict, prefix string, gen uint64) string {
+	return cacheKey{Dict: dict, Generation: gen, Prefix: prefix}.String()
+}
+
+// invalidateNegative drops the current negative entries of every prefix of
+// a newly inserted word, the only ones the insert can turn into hits, until
+// the mutation advances the generation.
+func invalidateNegative(dict, word string) {
+	gen := generation.Load()
+	negativeCache.Delete(negativeKey(dict, "", gen))
+	for i := range word {
+		if i > 0 {
+			negativeCache.Delete(negativeKey(dict, word[:i], gen))
+		}
+	}
+	negativeCache.Delete(negativeKey(dict, word, gen))
+}
+
+// InvalidateCaches drops all cached results and advances the dictionary
+// generation after word weights were changed outside the handlers, e.g. by
+// decay.
+func InvalidateCaches() {
+	invalidate()
+}
+
+// invalidate drops all cached results and advances the dictionary generation.
+func invalidate() {
+	recordFlush(cacheV1.ItemCount())
+	cacheV1.Flush()
+	generation.Add(1)
+}
+
+// etag returns the entity tag of a suggest response answered from dicts with
+// at most limit bytes or results. Like cursorEpoch it is derived from the
+// content the results come from rather than from process state, so replicas
+// and restarts serving the same dictionaries agree on it; the settings, query
+// and negotiated format are added since they shape the response too.
+func etag(r *http.Request, limit int, dicts ...*dictionary.Dictionary) string {
+	h := xxhash.New()
+	fmt.Fprintf(h, "%d\x00%d\x00", cursorEpoch(dicts...), limit)
+	for _, dict := range dicts {
+		settings, _ := json.Marshal(dict.Settings())
+		h.Write(settings)
+		h.WriteString("\x00")
+	}
+	fmt.Fprintf(h, "%s\x00%s", r.URL.Query().Encode(), r.Header.Get("Accept"))
+	return `"` + strconv.FormatUint(h.Sum64(), 16) + `"`
+}
+
+// writeCacheHeaders sets Cache-Control, Vary and ETag on a suggest response
+// answered from dicts. It returns true if the client's copy is still fresh and
+// a 304 was written.
+func writeCacheHeaders(w http.ResponseWriter, r *http.Request, limit int, dicts ...*dictionary.Dictionary) bool {
+	tag := etag(r, limit, dicts...)
+	h := w.Header()
+	h.Set("ETag", tag)
+	h.Add("Vary", "Authorization, X-API-Key, Accept")
+
+	if cachePolicy.MaxAge <= 0 {
+		h.Set("Cache-Control", "no-cache")
+	} else {
+		scope := "private"
+		if cachePolicy.Public {
+			scope = "public"
+		}
+		h.Set("Cache-Control", scope+", max-age="+strconv.Itoa(int(cachePolicy.MaxAge.Seconds())))
+	}
+
+	if r.Header.Get("If-None-Match") == tag {
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+	return false
+}
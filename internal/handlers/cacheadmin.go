@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cg011235/autocomplete/internal/response"
+	"github.com/cg011235/autocomplete/pkg/models"
+	"github.com/patrickmn/go-cache"
+)
+
+// ListCacheHandler lists the cached suggest results.
+// @Summary Inspect the suggest cache
+// @Description Lists positive and negative cache entries with their result counts, sizes and ages
+// @Tags admin
+// @Produce json
+// @Param dict query string false "Only list entries of this dictionary"
+// @Success 200 {object} models.CacheResponse
+// @Failure 403 {object} map[string]string
+// @Router /api/v1/admin/cache [get]
+func ListCacheHandler(w http.ResponseWriter, r *http.Request) {
+	dict := r.URL.Query().Get("dict")
+	now := time.Now()
+	entries := []models.CacheEntry{}
+
+	for key, item := range cacheV1.Items() {
+		e := cacheEntry(key)
+		if dict != "" && e.Dict != dict {
+			continue
+		}
+		words := item.Object.([]string)
+		e.Results = len(words)
+		for _, word := range words {
+			e.Bytes += len(word)
+		}
+		e.AgeSeconds = age(item, cachePolicy.TTL, now)
+		entries = append(entries, e)
+	}
+	for key, item := range negativeCache.Items() {
+		e := cacheEntry(key)
+		if dict != "" && e.Dict != dict {
+			continue
+		}
+		e.Negative = true
+		e.AgeSeconds = age(item, cachePolicy.NegativeTTL, now)
+		entries = append(entries, e)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Dict != entries[j].Dict {
+			return entries[i].Dict < entries[j].Dict
+		}
+		if entries[i].Prefix != entries[j].Prefix {
+			return entries[i].Prefix < entries[j].Prefix
+		}
+		return entries[i].Context < entries[j].Context
+	})
+	response.JSON(w, http.StatusOK, models.CacheResponse{
+		Status:  "success",
+		Count:   len(entries),
+		Entries: entries,
+	})
+}
+
+// PurgeCacheHandler removes cached suggest results.
+// @Summary Purge suggest cache entries
+// @Description Removes positive and negative entries of a dictionary whose prefix starts with the given prefix; without a prefix all entries of the dictionary are removed
+// @Tags admin
+// @Produce json
+// @Param dict query string false "Dictionary name"
+// @Param prefix query string false "Purge entries whose prefix starts with this"
+// @Success 200 {object} models.CachePurgeResponse
+// @Failure 403 {object} map[string]string
+// @Router /api/v1/admin/cache [delete]
+func PurgeCacheHandler(w http.ResponseWriter, r *http.Request) {
+	dict := dictionaryFor(r).Name
+	prefix := r.URL.Query().Get("prefix")
+
+	purged := 0
+	for _, c := range []*cache.Cache{cacheV1, negativeCache} {
+		for key := range c.Items() {
+			e := cacheEntry(key)
+			if e.Dict == dict && strings.HasPrefix(e.Prefix, prefix) {
+				c.Delete(key)
+				purged++
+			}
+		}
+	}
+	recordFlush(purged)
+	// Clients may hold copies of the purged results.
+	generation.Add(1)
+
+	response.JSON(w, http.StatusOK, models.CachePurgeResponse{Status: "success", Purged: purged})
+}
+
+// cacheEntry describes the cache entry stored under key.
+func cacheEntry(key string) models.CacheEntry {
+	k := parseCacheKey(key)
+	return models.CacheEntry{
+		Dict:       k.Dict,
+		Generation: k.Generation,
+		Options:    k.Options,
+		Prefix:     k.Prefix,
+		Context:    k.Context,
+		Fuzzy:      k.Fuzzy,
+		Limit:      k.Limit,
+	}
+}
+
+// age derives how long ago an item was cached from its expiration and TTL.
+func age(item cache.Item, ttl time.Duration, now time.Time) float64 {
+	if item.Expiration == 0 {
+		return 0
+	}
+	cached := time.Unix(0, item.Expiration).Add(-ttl)
+	return now.Sub(cached).Seconds()
+}
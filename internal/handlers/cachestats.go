@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/cg011235/autocomplete/pkg/models"
+)
+
+// postFlushWindow is how long after an invalidation cache misses are
+// attributed to it.
+const postFlushWindow = time.Second
+
+// cacheMetrics counts suggest cache invalidations and their cost: the
+// entries they drop and the latency of the misses that follow.
+var cacheMetrics struct {
+	flushes     atomic.Int64
+	entriesLost atomic.Int64
+	lastFlush   atomic.Int64 // Unix nanoseconds
+
+	hits       atomic.Int64
+	misses     atomic.Int64
+	missNanos  atomic.Int64
+	postMisses atomic.Int64
+	postNanos  atomic.Int64
+}
+
+// recordFlush counts an invalidation that dropped lost cached entries.
+func recordFlush(lost int) {
+	cacheMetrics.flushes.Add(1)
+	cacheMetrics.entriesLost.Add(int64(lost))
+	cacheMetrics.lastFlush.Store(time.Now().UnixNano())
+}
+
+// recordHit counts a suggest cache hit.
+func recordHit() {
+	cacheMetrics.hits.Add(1)
+}
+
+// recordMiss counts a suggest cache miss whose results took since start to
+// compute.
+func recordMiss(start time.Time) {
+	now := time.Now()
+	elapsed := int64(now.Sub(start))
+	cacheMetrics.misses.Add(1)
+	cacheMetrics.missNanos.Add(elapsed)
+	if now.UnixNano()-cacheMetrics.lastFlush.Load() < int64(postFlushWindow) {
+		cacheMetrics.postMisses.Add(1)
+		cacheMetrics.postNanos.Add(elapsed)
+	}
+}
+
+// cacheStats reports the cache metrics for the stats endpoint.
+func cacheStats() models.CacheStats {
+	s := models.CacheStats{
+		Entries:         cacheV1.ItemCount(),
+		Flushes:         cacheMetrics.flushes.Load(),
+		EntriesLost:     cacheMetrics.entriesLost.Load(),
+		Hits:            cacheMetrics.hits.Load(),
+		Misses:          cacheMetrics.misses.Load(),
+		PostFlushMisses: cacheMetrics.postMisses.Load(),
+	}
+	if s.Flushes > 0 {
+		s.AvgEntriesLost = float64(s.EntriesLost) / float64(s.Flushes)
+	}
+	if s.Misses > 0 {
+		s.MissLatency = ms(time.Duration(cacheMetrics.missNanos.Load() / s.Misses))
+	}
+	if s.PostFlushMisses > 0 {
+		s.PostFlushMissLatency = ms(time.Duration(cacheMetrics.postNanos.Load() / s.PostFlushMisses))
+	}
+	return s
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"slices"
+
+	"github.com/cg011235/autocomplete/internal/dictionary"
+	"github.com/cg011235/autocomplete/internal/normalize"
+	"github.com/cg011235/autocomplete/internal/trie"
+)
+
+// Display policies choosing which spelling of a word is shown when variants
+// fold to the same stored word.
+const (
+	// DisplayNone shows the stored (folded) word.
+	DisplayNone = ""
+	// DisplayFirst shows the first spelling added.
+	DisplayFirst = "first"
+	// DisplayWeight shows the spelling imported with the highest weight,
+	// or the first one added.
+	DisplayWeight = "weight"
+)
+
+var (
+	// normalizers map words and prefixes to the form they are stored and
+	// looked up under, unless a dictionary overrides them.
+	normalizers, _ = normalize.Parse([]string{"lowercase"})
+	// tokenizer splits inserted text into words and queries into the
+	// prefix completed, unless a dictionary overrides it.
+	tokenizer, _ = normalize.LookupTokenizer(normalize.None)
+	// displayPolicy chooses the display form kept for folded variants.
+	displayPolicy = DisplayNone
+)
+
+// SetCanonicalization configures how spelling variants are folded into one
+// word, how text is split into words and which variant is displayed.
+func SetCanonicalization(p normalize.Pipeline, t normalize.Tokenizer, policy string) {
+	normalizers = p
+	tokenizer = t
+	displayPolicy = policy
+}
+
+// canonical returns the form a word is stored under in dict.
+func canonical(dict *dictionary.Dictionary, s string) string {
+	return pipelineFor(dict).Normalize(s)
+}
+
+// queryPrefix returns the prefix completed for a query on dict: its last
+// token in the form it is stored under.
+func queryPrefix(dict *dictionary.Dictionary, s string) string {
+	tokens := tokenizerFor(dict).Tokenize(s)
+	if len(tokens) == 0 {
+		return ""
+	}
+	return canonical(dict, tokens[len(tokens)-1])
+}
+
+// pipelineFor returns the normalizers of dict: the server's unless the
+// dictionary sets its own, with lowercasing removed or added by its case
+// sensitivity setting.
+func pipelineFor(dict *dictionary.Dictionary) normalize.Pipeline {
+	p := normalizers
+	s := dict.Settings()
+	if len(s.Normalizers) > 0 {
+		if own, err := normalize.Parse(s.Normalizers); err == nil {
+			p = own
+		}
+	}
+	if s.CaseSensitive != nil {
+		if *s.CaseSensitive {
+			p = p.Without("lowercase")
+		} else if lower, err := p.With("lowercase"); err == nil {
+			p = lower
+		}
+	}
+	return p
+}
+
+// tokenizerFor returns the tokenizer of dict, the server's unless the
+// dictionary sets its own.
+func tokenizerFor(dict *dictionary.Dictionary) normalize.Tokenizer {
+	if name := dict.Settings().Tokenizer; name != "" {
+		if t, err := normalize.LookupTokenizer(name); err == nil {
+			return t
+		}
+	}
+	return tokenizer
+}
+
+// displayOf returns the display form to record for a word as uploaded, or
+// "" if display forms are not kept.
+func displayOf(original string) string {
+	if displayPolicy == DisplayNone {
+		return ""
+	}
+	return original
+}
+
+// displayForms returns words as they are displayed, without modifying words,
+// which may be shared with the cache.
+func displayForms(t *trie.Trie, words []string) []string {
+	if displayPolicy == DisplayNone {
+		return words
+	}
+	shown := make([]string, len(words))
+	for i, word := range words {
+		shown[i] = t.Display(word)
+	}
+	return shown
+}
+
+// canonicalEntries splits the entries uploaded to dict into words and folds
+// them, recording their spelling as display form, and merges variants of
+// the same word.
+func canonicalEntries(dict *dictionary.Dictionary, entries []trie.Entry) []trie.Entry {
+	p, t := pipelineFor(dict), tokenizerFor(dict)
+	words := make([]trie.Entry, 0, len(entries))
+	for _, e := range entries {
+		for _, token := range t.Tokenize(e.Word) {
+			e.Display = displayOf(token)
+			e.Word = p.Normalize(token)
+			words = append(words, e)
+		}
+	}
+	return dedupEntries(words)
+}
+
+// dedupEntries merges entries folding to the same word, keeping their
+// highest weight, all of their contexts and the first snippet given, in
+// upload order of first occurrence. The display form follows the display
+// policy.
+func dedupEntries(entries []trie.Entry) []trie.Entry {
+	index := make(map[string]int, len(entries))
+	merged := entries[:0:0]
+	for _, e := range entries {
+		i, ok := index[e.Word]
+		if !ok {
+			index[e.Word] = len(merged)
+			// Entries may share their contexts; merging must not append to them.
+			e.Contexts = slices.Clip(e.Contexts)
+			merged = append(merged, e)
+			continue
+		}
+		m := &merged[i]
+		if displayPolicy == DisplayWeight && e.Weight > m.Weight {
+			m.Display = e.Display
+		}
+		m.Weight = max(m.Weight, e.Weight)
+		if m.Snippet == nil {
+			m.Snippet = e.Snippet
+		}
+		for _, c := range e.Contexts {
+			if !containsString(m.Contexts, c) {
+				m.Contexts = append(m.Contexts, c)
+			}
+		}
+	}
+	return merged
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cg011235/autocomplete/internal/changelog"
+	"github.com/cg011235/autocomplete/internal/response"
+	"github.com/cg011235/autocomplete/pkg/models"
+)
+
+const (
+	defaultChangesLimit = 100
+	maxChangesLimit     = 1000
+)
+
+// changes retains recent mutations for polling clients; nil disables the endpoint.
+var changes *changelog.Ring
+
+// SetChangeLog enables the change-log endpoint backed by the given ring buffer
+// and registers it as an event sink; nil disables it. The ring is seeded with
+// the changes of a continued event sequence.
+func SetChangeLog(r *changelog.Ring) {
+	changes = r
+	if r != nil {
+		seqMu.Lock()
+		for _, e := range restored {
+			r.Publish(e)
+		}
+		restored = nil
+		seqMu.Unlock()
+		AddEventSink(r)
+	}
+}
+
+// ChangesHandlerV1 returns dictionary mutations after a given sequence number.
+// @Summary Poll dictionary changes
+// @Description Returns ordered mutation events with a sequence number greater than since. With the write-ahead log enabled, the epoch, sequence numbers and retained changes carry over a clean restart or upgrade. Responds 410 if the requested range is no longer retained, or the epoch changed since the client last saw it, as after a crash or any restart without the write-ahead log, and the client must resync
+// @Tags words
+// @Produce json
+// @Param since query int false "Last sequence number seen by the client"
+// @Param epoch query string false "Epoch returned with since; required when since is set"
+// @Param limit query int false "Maximum number of changes to return"
+// @Success 200 {object} models.ChangesResponse
+// @Failure 400 {object} map[string]string
+// @Failure 410 {object} map[string]string
+// @Router /api/v1/changes [get]
+func ChangesHandlerV1(w http.ResponseWriter, r *http.Request) {
+	if changes == nil {
+		response.Error(w, http.StatusNotFound, "Change log is disabled")
+		return
+	}
+
+	query := r.URL.Query()
+	var since uint64
+	if v := query.Get("since"); v != "" {
+		var err error
+		if since, err = strconv.ParseUint(v, 10, 64); err != nil {
+			response.Error(w, http.StatusBadRequest, "Invalid 'since' query parameter")
+			return
+		}
+	}
+	limit := defaultChangesLimit
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			response.Error(w, http.StatusBadRequest, "Invalid 'limit' query parameter")
+			return
+		}
+		limit = min(n, maxChangesLimit)
+	}
+	current := eventEpoch()
+	if since != 0 {
+		switch query.Get("epoch") {
+		case "":
+			response.Error(w, http.StatusBadRequest, "Missing 'epoch' query parameter")
+			return
+		case current:
+		default:
+			response.Error(w, http.StatusGone, "Change sequence restarted; resync required")
+			return
+		}
+	}
+
+	list, last, ok := changes.Since(since, limit)
+	if !ok {
+		response.Error(w, http.StatusGone, "Requested changes are no longer retained; resync required")
+		return
+	}
+
+	response := models.ChangesResponse{
+		Status:  "success",
+		Epoch:   current,
+		LastSeq: last,
+		Changes: make([]models.Change, 0, len(list)),
+	}
+	for _, e := range list {
+		response.Changes = append(response.Changes, models.Change{
+			Seq:  e.Seq,
+			Dict: e.Dict,
+			Type: e.Type,
+			Word: e.Word,
+			Time: e.Time.Format(time.RFC3339Nano),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
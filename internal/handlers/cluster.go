@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/cg011235/autocomplete/internal/response"
+	"github.com/cg011235/autocomplete/pkg/models"
+	"github.com/cg011235/autocomplete/pkg/shard"
+)
+
+var (
+	// shards is the advertised shard map; nil when the server is not sharded.
+	shards *shard.Map
+	// shardID is the shard this server is.
+	shardID string
+)
+
+// SetShardMap advertises m, with this server being the shard named self.
+func SetShardMap(m *shard.Map, self string) {
+	shards, shardID = m, self
+}
+
+// ShardsHandler returns the shard map clients route requests by.
+// @Summary Get the shard map
+// @Description Returns the shards of a sharded deployment and how words are placed on them, so clients can send each request to the shard holding its prefix
+// @Tags cluster
+// @Produce json
+// @Success 200 {object} models.ShardsResponse
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/cluster/shards [get]
+func ShardsHandler(w http.ResponseWriter, r *http.Request) {
+	if shards == nil {
+		response.Error(w, http.StatusNotFound, "Server is not sharded")
+		return
+	}
+	resp := models.ShardsResponse{
+		Status:    "success",
+		Self:      shardID,
+		Hash:      shard.Hash,
+		KeyLength: shards.KeyLength,
+		Points:    shards.Points,
+		Shards:    make([]models.Shard, len(shards.Shards)),
+	}
+	for i, s := range shards.Shards {
+		resp.Shards[i] = models.Shard{ID: s.ID, URL: s.URL}
+	}
+	response.JSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cg011235/autocomplete/internal/dictionary"
+	"github.com/cg011235/autocomplete/internal/response"
+	"github.com/cg011235/autocomplete/internal/trie"
+	"github.com/cg011235/autocomplete/pkg/models"
+)
+
+var (
+	compactionsMu sync.Mutex
+	// compactions holds the latest trie compaction of each dictionary.
+	compactions = map[string]*models.Compaction{}
+)
+
+// CompactHandler starts rebuilding a dictionary's Trie in the background,
+// dropping the nodes left behind by deletes.
+// @Summary Compact a dictionary
+// @Description Rebuilds the dictionary's trie in the background and swaps it in; poll GET for the result
+// @Tags admin
+// @Produce json
+// @Param dict query string false "Dictionary name"
+// @Success 202 {object} models.CompactResponse
+// @Failure 403 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/admin/compact [post]
+func CompactHandler(w http.ResponseWriter, r *http.Request) {
+	dict := dictionaryFor(r)
+	compactionsMu.Lock()
+	if c, ok := compactions[dict.Name]; ok && c.State == models.CompactionRunning {
+		compactionsMu.Unlock()
+		response.Error(w, http.StatusConflict, "Compaction already running")
+		return
+	}
+	c := &models.Compaction{
+		Dict:      dict.Name,
+		State:     models.CompactionRunning,
+		StartedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+	compactions[dict.Name] = c
+	status := *c
+	compactionsMu.Unlock()
+
+	go compactTrie(dict, c)
+
+	response.JSON(w, http.StatusAccepted, models.CompactResponse{Status: "success", Compaction: status})
+}
+
+// CompactionHandler reports the latest compaction of a dictionary.
+// @Summary Get compaction status
+// @Description Returns the state of the latest compaction and the nodes and memory it reclaimed
+// @Tags admin
+// @Produce json
+// @Param dict query string false "Dictionary name"
+// @Success 200 {object} models.CompactResponse
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/admin/compact [get]
+func CompactionHandler(w http.ResponseWriter, r *http.Request) {
+	dict := dictionaryFor(r)
+	compactionsMu.Lock()
+	c, ok := compactions[dict.Name]
+	var status models.Compaction
+	if ok {
+		status = *c
+	}
+	compactionsMu.Unlock()
+	if !ok {
+		response.Error(w, http.StatusNotFound, "No compaction has run")
+		return
+	}
+	response.JSON(w, http.StatusOK, models.CompactResponse{Status: "success", Compaction: status})
+}
+
+// compactTrie rebuilds dict's Trie from its entries and swaps it in, then
+// records the outcome in c. Mutations wait during the rebuild; reads do not.
+// The words are unchanged, so neither the caches nor the log are reset.
+func compactTrie(dict *dictionary.Dictionary, c *models.Compaction) {
+	writeMu.Lock()
+	old := dict.Trie()
+	before := old.AllocStats()
+	t := trie.FromEntries(old.Entries())
+	after := t.AllocStats()
+	dict.Swap(t, dict.Version())
+	writeMu.Unlock()
+
+	compactionsMu.Lock()
+	defer compactionsMu.Unlock()
+	c.State = models.CompactionDone
+	c.FinishedAt = time.Now().UTC().Format(time.RFC3339)
+	c.NodesBefore = before.Nodes
+	c.NodesAfter = after.Nodes
+	c.ReclaimedNodes = before.Nodes - after.Nodes
+	c.ReclaimedBytes = before.Bytes - after.Bytes
+}
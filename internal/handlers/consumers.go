@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cg011235/autocomplete/internal/middleware"
+	"github.com/cg011235/autocomplete/internal/response"
+	"github.com/cg011235/autocomplete/pkg/models"
+	"github.com/gorilla/mux"
+)
+
+// accessStateName names the stored API consumers and rate limit tiers.
+const accessStateName = "access"
+
+// accessMu serializes writes of the stored access state.
+var accessMu sync.Mutex
+
+// accessState is the stored form of API consumers and rate limit tiers.
+type accessState struct {
+	Tiers       map[string]middleware.Tier `json:"tiers"`
+	Assignments map[string]string          `json:"assignments"`
+	Consumers   []middleware.Consumer      `json:"consumers"`
+}
+
+// LoadAccess restores the API consumers, rate limit tiers and tier
+// assignments saved in the version store, so they survive restarts.
+func LoadAccess() error {
+	if versions == nil {
+		return nil
+	}
+	var state accessState
+	if ok, err := versions.LoadState(accessStateName, &state); err != nil || !ok {
+		return err
+	}
+	for name, t := range state.Tiers {
+		middleware.SetTier(name, t)
+	}
+	for user, tier := range state.Assignments {
+		middleware.AssignTier(user, tier)
+	}
+	for _, c := range state.Consumers {
+		if err := middleware.SetConsumer(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveAccess stores the API consumers, rate limit tiers and tier
+// assignments in the version store, if there is one.
+func saveAccess() error {
+	if versions == nil {
+		return nil
+	}
+	accessMu.Lock()
+	defer accessMu.Unlock()
+	return versions.SaveState(accessStateName, accessState{
+		Tiers:       middleware.Tiers(),
+		Assignments: middleware.TierAssignments(),
+		Consumers:   middleware.Consumers(),
+	})
+}
+
+// ListConsumersHandler lists the API consumers.
+// @Summary List API consumers
+// @Description Returns every API consumer with its role, tier, allowed dictionaries and key IDs
+// @Tags admin
+// @Produce json
+// @Success 200 {object} models.ConsumersResponse
+// @Failure 403 {object} map[string]string
+// @Router /api/v1/admin/consumers [get]
+func ListConsumersHandler(w http.ResponseWriter, r *http.Request) {
+	resp := models.ConsumersResponse{Status: "success", Consumers: []models.Consumer{}}
+	for _, c := range middleware.Consumers() {
+		resp.Consumers = append(resp.Consumers, consumerModel(c))
+	}
+	response.JSON(w, http.StatusOK, resp)
+}
+
+// GetConsumerHandler returns an API consumer.
+// @Summary Get an API consumer
+// @Tags admin
+// @Produce json
+// @Param name path string true "Consumer name"
+// @Success 200 {object} models.ConsumerResponse
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/admin/consumers/{name} [get]
+func GetConsumerHandler(w http.ResponseWriter, r *http.Request) {
+	writeConsumer(w, http.StatusOK, mux.Vars(r)["name"])
+}
+
+// SetConsumerHandler creates or updates an API consumer.
+// @Summary Create or update an API consumer
+// @Description Sets the consumer's role, rate limit tier and allowed dictionaries; existing keys are kept
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param name path string true "Consumer name"
+// @Param consumer body models.ConsumerRequest true "Consumer settings"
+// @Success 200 {object} models.ConsumerResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Router /api/v1/admin/consumers/{name} [put]
+func SetConsumerHandler(w http.ResponseWriter, r *http.Request) {
+	var request models.ConsumerRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if request.Role == "" {
+		request.Role = middleware.RoleUser
+	}
+
+	name := mux.Vars(r)["name"]
+	err := middleware.SetConsumer(middleware.Consumer{
+		Name:         name,
+		Role:         request.Role,
+		Tier:         request.Tier,
+		Dictionaries: request.Dictionaries,
+	})
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid consumer: "+err.Error())
+		return
+	}
+	if err := saveAccess(); err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to save consumers: "+err.Error())
+		return
+	}
+	writeConsumer(w, http.StatusOK, name)
+}
+
+// DeleteConsumerHandler removes an API consumer and revokes its keys.
+// @Summary Delete an API consumer
+// @Tags admin
+// @Produce json
+// @Param name path string true "Consumer name"
+// @Success 200 {object} models.ConsumersResponse
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/admin/consumers/{name} [delete]
+func DeleteConsumerHandler(w http.ResponseWriter, r *http.Request) {
+	if !middleware.DeleteConsumer(mux.Vars(r)["name"]) {
+		response.Error(w, http.StatusNotFound, "Consumer not found")
+		return
+	}
+	if err := saveAccess(); err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to save consumers: "+err.Error())
+		return
+	}
+	ListConsumersHandler(w, r)
+}
+
+// IssueKeyHandler issues a new API key to a consumer.
+// @Summary Issue an API key
+// @Description Generates a key for the consumer to send in the X-API-Key header. Only its hash is stored, so the key is returned once.
+// @Tags admin
+// @Produce json
+// @Param name path string true "Consumer name"
+// @Success 201 {object} models.APIKeyResponse
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/admin/consumers/{name}/keys [post]
+func IssueKeyHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	if _, ok := middleware.LookupConsumer(name); !ok {
+		response.Error(w, http.StatusNotFound, "Consumer not found")
+		return
+	}
+	key, id, err := middleware.IssueKey(name)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to issue key: "+err.Error())
+		return
+	}
+	if err := saveAccess(); err != nil {
+		middleware.RevokeKey(name, id)
+		response.Error(w, http.StatusInternalServerError, "Failed to save consumers: "+err.Error())
+		return
+	}
+	response.JSON(w, http.StatusCreated, models.APIKeyResponse{
+		Status:   "success",
+		Consumer: name,
+		ID:       id,
+		Key:      key,
+	})
+}
+
+// RevokeKeyHandler revokes an API key of a consumer.
+// @Summary Revoke an API key
+// @Tags admin
+// @Produce json
+// @Param name path string true "Consumer name"
+// @Param id path string true "Key ID"
+// @Success 200 {object} models.ConsumerResponse
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/admin/consumers/{name}/keys/{id} [delete]
+func RevokeKeyHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if !middleware.RevokeKey(vars["name"], vars["id"]) {
+		response.Error(w, http.StatusNotFound, "Key not found")
+		return
+	}
+	if err := saveAccess(); err != nil {
+		response.Error(w, http.StatusInternalServerError, "Failed to save consumers: "+err.Error())
+		return
+	}
+	writeConsumer(w, http.StatusOK, vars["name"])
+}
+
+func writeConsumer(w http.ResponseWriter, status int, name string) {
+	c, ok := middleware.LookupConsumer(name)
+	if !ok {
+		response.Error(w, http.StatusNotFound, "Consumer not found")
+		return
+	}
+	response.JSON(w, status, models.ConsumerResponse{Status: "success", Consumer: consumerModel(c)})
+}
+
+// consumerModel describes c with its effective tier and without key hashes.
+func consumerModel(c middleware.Consumer) models.Consumer {
+	m := models.Consumer{
+		Name:         c.Name,
+		Role:         c.Role,
+		Tier:         middleware.TierOf(c.Name, c.Role),
+		Dictionaries: c.Dictionaries,
+		Keys:         []models.APIKeyInfo{},
+	}
+	for _, key := range c.Keys {
+		m.Keys = append(m.Keys, models.APIKeyInfo{ID: key.ID, Created: key.Created.Format(time.RFC3339)})
+	}
+	return m
+}
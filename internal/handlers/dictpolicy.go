@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/cg011235/autocomplete/internal/dictionary"
+	"github.com/cg011235/autocomplete/internal/middleware"
+	"github.com/cg011235/autocomplete/internal/response"
+)
+
+// autoCreate lets requests naming an unknown dictionary create it empty.
+var autoCreate = true
+
+// SetDictionaryPolicy sets the dictionary of requests that do not name one,
+// creating it if needed, and whether requests naming an unknown dictionary
+// create it. Without auto-creation only admins create dictionaries, e.g. by
+// importing into them.
+func SetDictionaryPolicy(defaultName string, create bool) {
+	dictionary.Default = defaultName
+	autoCreate = create
+	dicts.Get(defaultName)
+}
+
+// KnownDictionaryMiddleware rejects with 404 requests from non-admins that
+// name, in the dict or dicts query parameter, a dictionary that does not
+// exist, unless dictionaries are created on first use.
+func KnownDictionaryMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if autoCreate || middleware.Role(r.Context()) == middleware.RoleAdmin {
+			next.ServeHTTP(w, r)
+			return
+		}
+		query := r.URL.Query()
+		names := []string{query.Get("dict")}
+		if list := query.Get("dicts"); list != "" {
+			for _, item := range strings.Split(list, ",") {
+				name, _, _ := strings.Cut(strings.TrimSpace(item), ":")
+				names = append(names, name)
+			}
+		}
+		for _, name := range names {
+			if name == "" {
+				continue
+			}
+			if _, ok := dicts.Lookup(name); !ok {
+				response.Error(w, http.StatusNotFound, "Unknown dictionary '"+name+"'")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
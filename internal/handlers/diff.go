@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/cg011235/autocomplete/internal/dictionary"
+	"github.com/cg011235/autocomplete/internal/response"
+	"github.com/cg011235/autocomplete/internal/store"
+	"github.com/cg011235/autocomplete/internal/trie"
+	"github.com/cg011235/autocomplete/pkg/models"
+)
+
+// currentVersion names the live dictionary in diff requests.
+const currentVersion = "current"
+
+// DiffHandler compares two versions of a dictionary.
+// @Summary Diff dictionary versions
+// @Description Returns the words added and removed between two stored versions; either side may be "current" for the live dictionary. With POST, the uploaded words (same format as import) are the "to" side
+// @Tags admin
+// @Accept json
+// @Accept plain
+// @Produce json
+// @Param dict query string false "Dictionary name"
+// @Param from query string false "Version to compare from (default current)"
+// @Param to query string false "Version to compare to (default current); ignored for POST"
+// @Success 200 {object} models.DiffResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/admin/diff [get]
+// @Router /api/v1/admin/diff [post]
+func DiffHandler(w http.ResponseWriter, r *http.Request) {
+	dict := dictionaryFor(r)
+	query := r.URL.Query()
+	fromName := versionParam(query.Get("from"))
+	toName := versionParam(query.Get("to"))
+
+	from, err := entriesAt(dict, fromName)
+	if err != nil {
+		writeVersionError(w, err)
+		return
+	}
+
+	var to []trie.Entry
+	if r.Method == http.MethodPost {
+		request, err := decodeImport(r)
+		if err != nil {
+			response.Error(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+			return
+		}
+		to, toName = trie.ScratchFromEntries(importEntries(dict, request)).Entries(), "upload"
+	} else if to, err = entriesAt(dict, toName); err != nil {
+		writeVersionError(w, err)
+		return
+	}
+
+	added, removed := trie.Diff(from, to)
+	response.JSON(w, http.StatusOK, models.DiffResponse{
+		Status:  "success",
+		Dict:    dict.Name,
+		From:    fromName,
+		To:      toName,
+		Added:   nonNil(added),
+		Removed: nonNil(removed),
+	})
+}
+
+func versionParam(v string) string {
+	if v == "" {
+		return currentVersion
+	}
+	return v
+}
+
+// errInvalidVersion is returned for version parameters that are neither a number nor "current".
+var errInvalidVersion = errors.New("invalid version")
+
+// entriesAt returns the entries of the live dictionary or a stored version.
+func entriesAt(dict *dictionary.Dictionary, version string) ([]trie.Entry, error) {
+	if version == currentVersion {
+		return dict.Trie().Entries(), nil
+	}
+	n, err := strconv.Atoi(version)
+	if err != nil || n <= 0 {
+		return nil, errInvalidVersion
+	}
+	if versions == nil {
+		return nil, store.ErrVersionNotFound
+	}
+	return versions.Load(dict.Name, n)
+}
+
+func writeVersionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errInvalidVersion):
+		response.Error(w, http.StatusBadRequest, "Invalid version")
+	case errors.Is(err, store.ErrVersionNotFound):
+		response.Error(w, http.StatusNotFound, "Version not found")
+	default:
+		response.Error(w, http.StatusInternalServerError, "Error loading version: "+err.Error())
+	}
+}
+
+// nonNil returns an empty slice for nil so it encodes as [] rather than null.
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
@@ -0,0 +1,291 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/cg011235/autocomplete/internal/dictionary"
+	"github.com/cg011235/autocomplete/internal/events"
+	"github.com/cg011235/autocomplete/internal/response"
+	"github.com/cg011235/autocomplete/internal/store"
+	"github.com/cg011235/autocomplete/internal/trie"
+	"github.com/cg011235/autocomplete/pkg/models"
+	"github.com/gorilla/mux"
+)
+
+// entitiesState names the stored entities of a dictionary.
+const entitiesState = "entities"
+
+// PutEntityHandlerV1 creates or replaces an entity searchable by its name and fields.
+// @Summary Create or replace an entity
+// @Description Indexes the entity's name and fields into the dictionary, folded with its normalizers; matching any of them suggests the entity
+// @Tags entities
+// @Accept json
+// @Produce json
+// @Param dict query string false "Dictionary name"
+// @Param id path string true "Entity ID"
+// @Param entity body models.EntityRequest true "Entity"
+// @Success 200 {object} models.EntityResponse
+// @Failure 400 {object} map[string]string
+// @Failure 413 {object} map[string]string
+// @Router /api/v1/entities/{id} [put]
+func PutEntityHandlerV1(w http.ResponseWriter, r *http.Request) {
+	var request models.EntityRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Name == "" {
+		response.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if !validField(w, "name", request.Name) || !validWords(w, "fields", request.Fields) {
+		return
+	}
+	dict := dictionaryFor(r)
+	e := dictionary.Entity{
+		ID:       mux.Vars(r)["id"],
+		Name:     request.Name,
+		Fields:   request.Fields,
+		Metadata: request.Metadata,
+		Terms:    entityTerms(dict, append([]string{request.Name}, request.Fields...)),
+	}
+
+	writeMu.Lock()
+	defer writeMu.Unlock()
+	newWords := 0
+	for _, term := range e.Terms {
+		if !dict.Trie().Exists(term) {
+			newWords++
+		}
+	}
+	if err := dict.CheckQuota(newWords, 0); err != nil {
+		response.Error(w, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	}
+
+	added, removed := dict.PutEntity(e)
+	if err := indexTerms(dict, added, removed); err != nil {
+		response.Error(w, http.StatusInternalServerError, "Error logging entity terms: "+err.Error())
+		return
+	}
+	response.JSON(w, http.StatusOK, models.EntityResponse{
+		Status: "success",
+		Entity: models.Entity{ID: e.ID, Name: e.Name, Fields: e.Fields, Metadata: e.Metadata},
+	})
+}
+
+// DeleteEntityHandlerV1 deletes an entity.
+// @Summary Delete an entity
+// @Description Removes the entity and the terms it added that no other entity is indexed under; terms also added as words are kept
+// @Tags entities
+// @Produce json
+// @Param dict query string false "Dictionary name"
+// @Param id path string true "Entity ID"
+// @Success 200 {object} models.DeleteWordsResponse
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/entities/{id} [delete]
+func DeleteEntityHandlerV1(w http.ResponseWriter, r *http.Request) {
+	dict := dictionaryFor(r)
+	writeMu.Lock()
+	defer writeMu.Unlock()
+	removed, ok := dict.DeleteEntity(mux.Vars(r)["id"])
+	if !ok {
+		response.Error(w, http.StatusNotFound, "Entity not found")
+		return
+	}
+	if err := indexTerms(dict, nil, removed); err != nil {
+		response.Error(w, http.StatusInternalServerError, "Error logging entity terms: "+err.Error())
+		return
+	}
+	response.JSON(w, http.StatusOK, models.DeleteWordsResponse{Status: "success", Message: "Entity deleted successfully."})
+}
+
+// entityTerms folds the name and fields of an entity into the deduplicated
+// terms it is indexed under.
+func entityTerms(dict *dictionary.Dictionary, fields []string) []string {
+	seen := make(map[string]bool, len(fields))
+	var terms []string
+	for _, field := range fields {
+		term := canonical(dict, field)
+		if term != "" && !seen[term] {
+			seen[term] = true
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+// indexTerms adds and removes entity terms from the Trie of dict and stores
+// its entities. The caller must hold writeMu.
+func indexTerms(dict *dictionary.Dictionary, added, removed []string) error {
+	if len(added) > 0 {
+		err := loggedLocked(dict, store.Record{Op: store.OpInsert, Words: added}, func() {
+			for _, term := range dict.Trie().InsertWords(added, nil, nil) {
+				invalidateNegative(dict.Name, term)
+				emit(dict.Name, events.Insert, term)
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if len(removed) > 0 {
+		err := loggedLocked(dict, store.Record{Op: store.OpDelete, Words: removed}, func() {
+			for _, term := range removed {
+				if dict.Trie().Delete(term) {
+					emit(dict.Name, events.Delete, term)
+				}
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	invalidate() // Suggestions map terms to the entities just changed
+	return saveEntities(dict)
+}
+
+// saveEntities stores the entities of dict, if there is a version store.
+func saveEntities(dict *dictionary.Dictionary) error {
+	if versions == nil {
+		return nil
+	}
+	if err := versions.SaveDictState(dict.Name, entitiesState, dict.Entities()); err != nil {
+		return fmt.Errorf("storing entities: %w", err)
+	}
+	return nil
+}
+
+// disown keeps words added or imported as plain words in the Trie of dict
+// when the entities indexed under them are deleted. The caller must hold
+// writeMu.
+func disown(dict *dictionary.Dictionary, words []string) error {
+	if !dict.Disown(words) {
+		return nil
+	}
+	return saveEntities(dict)
+}
+
+// withEntityTerms adds the terms entities of dict are indexed under to
+// entries, sorted by word, that lack them, so installing entries keeps the
+// entities suggestable.
+func withEntityTerms(dict *dictionary.Dictionary, entries []trie.Entry) []trie.Entry {
+	terms := dict.EntityTerms()
+	if len(terms) == 0 {
+		return entries
+	}
+	present := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		present[e.Word] = true
+	}
+	n := len(entries)
+	for _, term := range terms {
+		if !present[term] {
+			entries = append(entries, trie.Entry{Word: term})
+		}
+	}
+	if len(entries) > n {
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Word < entries[j].Word })
+	}
+	return entries
+}
+
+// groupEntities groups ranked suggestions by their value of the metadata
+// field, keeping at most perGroup of each (perGroup <= 0 keeps all). Groups
+// are ordered by their best ranked suggestion, with entities lacking the
+// field last.
+func groupEntities(suggestions []models.EntitySuggestion, field string, perGroup int) []models.EntityGroup {
+	groups := []models.EntityGroup{}
+	index := make(map[string]int)
+	for _, s := range suggestions {
+		value := s.Metadata[field]
+		i, ok := index[value]
+		if !ok {
+			i = len(groups)
+			index[value] = i
+			groups = append(groups, models.EntityGroup{Value: value, Data: []models.EntitySuggestion{}})
+		}
+		g := &groups[i]
+		g.Total++
+		if perGroup <= 0 || len(g.Data) < perGroup {
+			g.Data = append(g.Data, s)
+		}
+	}
+	if i, ok := index[""]; ok {
+		other := groups[i]
+		groups = append(groups[:i], groups[i+1:]...)
+		groups = append(groups, other)
+	}
+	return groups
+}
+
+// SuggestEntitiesHandlerV1 suggests the entities with a field starting with a prefix.
+// @Summary Suggest entities
+// @Description Returns the entities whose name or fields start with the prefix, each once, ranked by its best matching term
+// @Tags entities
+// @Produce json
+// @Param dict query string false "Dictionary name"
+// @Param prefix query string false "Prefix to search for"
+// @Param context query string false "Context (category, user segment) whose terms are boosted"
+// @Param groupBy query string false "Group suggestions by this metadata field, e.g. category"
+// @Param perGroup query int false "With groupBy, the most suggestions returned per group"
+// @Success 200 {object} models.EntitySuggestionsResponse
+// @Success 200 {object} models.GroupedEntitySuggestionsResponse "With groupBy"
+// @Failure 400 {object} map[string]string
+// @Router /api/v1/entities [get]
+func SuggestEntitiesHandlerV1(w http.ResponseWriter, r *http.Request) {
+	prefix := r.URL.Query().Get("prefix")
+	context := r.URL.Query().Get("context")
+	if !validField(w, "prefix", prefix) {
+		return
+	}
+	groupBy := r.URL.Query().Get("groupBy")
+	perGroup := 0
+	if v := r.URL.Query().Get("perGroup"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			response.Error(w, http.StatusBadRequest, "Invalid 'perGroup' query parameter")
+			return
+		}
+		perGroup = n
+	}
+	dict := dictionaryFor(r)
+	// Terms are whole fields, folded like words
+	prefix = dict.Resolve(canonical(dict, prefix))
+
+	suggestions := []models.EntitySuggestion{}
+	seen := make(map[string]bool)
+	for _, term := range suggest(dict, prefix, context) {
+		for _, e := range dict.EntitiesFor(term) {
+			if seen[e.ID] {
+				continue
+			}
+			seen[e.ID] = true
+			suggestions = append(suggestions, models.EntitySuggestion{
+				ID:       e.ID,
+				Name:     e.Name,
+				Matched:  term,
+				Metadata: e.Metadata,
+			})
+		}
+	}
+	if groupBy != "" {
+		groups := groupEntities(suggestions, groupBy, perGroup)
+		count := 0
+		for _, g := range groups {
+			count += len(g.Data)
+		}
+		response.JSON(w, http.StatusOK, models.GroupedEntitySuggestionsResponse{
+			Status:  "success",
+			Count:   count,
+			GroupBy: groupBy,
+			Groups:  groups,
+		})
+		return
+	}
+	response.JSON(w, http.StatusOK, models.EntitySuggestionsResponse{
+		Status: "success",
+		Count:  len(suggestions),
+		Data:   suggestions,
+	})
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cg011235/autocomplete/internal/events"
+)
+
+var (
+	// sinks receive every dictionary mutation performed through the handlers.
+	sinks []events.Sink
+
+	// seqMu serializes sequence assignment and publishing so sinks observe
+	// events in sequence order. Sequence numbers are only persisted by
+	// SaveEventSequence; epoch changes whenever they start over.
+	seqMu sync.Mutex
+	seq   uint64
+	epoch = newEpoch()
+
+	// restored holds the changes loaded by LoadEventSequence until a change
+	// log is set.
+	restored []events.Event
+)
+
+// eventsState names the stored event sequence.
+const eventsState = "events"
+
+// eventSequence is the event sequence stored across a restart.
+type eventSequence struct {
+	Epoch   string         `json:"epoch,omitempty"`
+	Seq     uint64         `json:"seq,omitempty"`
+	Changes []events.Event `json:"changes,omitempty"`
+}
+
+// newEpoch returns a name for a new event sequence.
+func newEpoch() string {
+	return strconv.FormatInt(time.Now().UnixNano(), 36)
+}
+
+// AddEventSink registers a sink for dictionary mutation events.
+func AddEventSink(s events.Sink) {
+	sinks = append(sinks, s)
+}
+
+// ResetEventSinks unregisters every sink and starts a new event sequence.
+func ResetEventSinks() {
+	sinks = nil
+	seqMu.Lock()
+	defer seqMu.Unlock()
+	seq, epoch, restored = 0, newEpoch(), nil
+}
+
+// SaveEventSequence stores the event sequence and the changes retained for
+// polling clients, so the next process started on the data continues the
+// sequence rather than starting a new epoch. Only mutations that survive a
+// restart may be numbered in a continued sequence, so it is meant for the
+// write-ahead log, and this process numbers any further events in a new
+// epoch.
+func SaveEventSequence() error {
+	if versions == nil {
+		return nil
+	}
+	seqMu.Lock()
+	defer seqMu.Unlock()
+	state := eventSequence{Epoch: epoch, Seq: seq}
+	if changes != nil {
+		state.Changes = changes.Retained()
+	}
+	if err := versions.SaveState(eventsState, state); err != nil {
+		return err
+	}
+	seq, epoch = 0, newEpoch()
+	return nil
+}
+
+// LoadEventSequence continues the event sequence stored by
+// SaveEventSequence, if any, and discards it so a process that stops without
+// saving, e.g. on a crash, is followed by a new epoch.
+func LoadEventSequence() error {
+	if versions == nil {
+		return nil
+	}
+	var state eventSequence
+	if ok, err := versions.LoadState(eventsState, &state); err != nil || !ok || state.Epoch == "" {
+		return err
+	}
+	if err := DiscardEventSequence(); err != nil {
+		return err
+	}
+	seqMu.Lock()
+	defer seqMu.Unlock()
+	seq, epoch, restored = state.Seq, state.Epoch, state.Changes
+	return nil
+}
+
+// DiscardEventSequence drops the stored event sequence, e.g. when the
+// process it was saved for does not take over.
+func DiscardEventSequence() error {
+	if versions == nil {
+		return nil
+	}
+	return versions.SaveState(eventsState, eventSequence{})
+}
+
+// eventEpoch returns the epoch of the current event sequence.
+func eventEpoch() string {
+	seqMu.Lock()
+	defer seqMu.Unlock()
+	return epoch
+}
+
+// emit assigns the next sequence number to a mutation event of the named
+// dictionary and publishes it to all registered sinks, after bringing the hot
+// prefix lists up to date.
+func emit(dict, eventType, word string) {
+	updateHot(dict, eventType, word)
+	seqMu.Lock()
+	defer seqMu.Unlock()
+	seq++
+	e := events.Event{Epoch: epoch, Seq: seq, Dict: dict, Type: eventType, Word: word, Time: time.Now().UTC()}
+	for _, s := range sinks {
+		s.Publish(e)
+	}
+}
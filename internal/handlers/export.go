@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/cg011235/autocomplete/internal/response"
+	"github.com/cg011235/autocomplete/internal/store"
+)
+
+// Export formats.
+const (
+	exportSorted   = "sorted"
+	exportSnapshot = "snapshot"
+)
+
+// ExportHandler downloads the words of a dictionary as a file.
+// @Summary Export a dictionary
+// @Description Downloads the words of the live dictionary or a stored version. The sorted format holds length-prefixed records sorted by word followed by an index of their offsets, so client apps can memory-map it and binary search prefixes offline; the snapshot format is the version store's own.
+// @Tags admin
+// @Produce application/octet-stream
+// @Param dict query string false "Dictionary name"
+// @Param format query string false "sorted (default) or snapshot"
+// @Param version query string false "Stored version to export, or current (default)"
+// @Success 200 {file} file
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/admin/export [get]
+func ExportHandler(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = exportSorted
+	}
+	if format != exportSorted && format != exportSnapshot {
+		response.Error(w, http.StatusBadRequest, "Invalid 'format' query parameter")
+		return
+	}
+	dict := dictionaryFor(r)
+	version := versionParam(r.URL.Query().Get("version"))
+	entries, err := entriesAt(dict, version)
+	if err != nil {
+		writeVersionError(w, err)
+		return
+	}
+
+	var buf bytes.Buffer
+	if format == exportSorted {
+		err = store.WriteSorted(&buf, entries)
+	} else {
+		err = store.WriteSnapshot(&buf, entries, store.CompressionGzip)
+	}
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Error exporting dictionary: "+err.Error())
+		return
+	}
+	h := w.Header()
+	h.Set("Content-Type", "application/octet-stream")
+	h.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", dict.Name+"-"+version+"."+format))
+	h.Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.Write(buf.Bytes())
+}
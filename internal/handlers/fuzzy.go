@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/cg011235/autocomplete/internal/dictionary"
+	"github.com/cg011235/autocomplete/internal/keyboard"
+	"github.com/cg011235/autocomplete/internal/ranking"
+	"github.com/patrickmn/go-cache"
+)
+
+var (
+	// maxFuzzyEdits caps the edit distance clients may request.
+	maxFuzzyEdits = 2
+	// substitutionCost prices replacing the typed character a with b.
+	substitutionCost = keyboard.UniformCost
+)
+
+// SetFuzzyMatching configures fuzzy suggestions: clients may request up to
+// maxEdits edits, and substitutions are priced by cost, e.g. a keyboard
+// layout's SubstitutionCost.
+func SetFuzzyMatching(maxEdits int, cost func(a, b rune) float64) {
+	maxFuzzyEdits = maxEdits
+	substitutionCost = cost
+}
+
+// fuzzyEdits parses the fuzzy query parameter, clamped to maxFuzzyEdits.
+func fuzzyEdits(v string) (int, bool) {
+	if v == "" {
+		return 0, true
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return min(n, maxFuzzyEdits), true
+}
+
+// fuzzySuggest returns the words of dict with a prefix within edits of
+// prefix, closest first and then by score. How the query was served is
+// recorded in tr, if not nil; fuzzy searches do not count visited nodes.
+func fuzzySuggest(dict *dictionary.Dictionary, prefix, context string, edits int, tr *queryTrace) []string {
+	if belowMinPrefix(dict, prefix) {
+		tr.cache(traceShort)
+		return []string{}
+	}
+	k := suggestKey(dict, prefix, context)
+	k.Fuzzy = edits
+	key := k.String()
+	if cachedResult, found := cacheV1.Get(key); found {
+		tr.cache(traceHit)
+		recordHit()
+		return cachedResult.([]string)
+	}
+	defer recordMiss(time.Now())
+
+	tr.cache(traceMiss)
+	searched := time.Now()
+	results := fuzzyRank(dict, prefix, context, edits)
+	if tr != nil {
+		tr.Traversal = time.Since(searched)
+	}
+	cacheV1.Set(key, results, cache.DefaultExpiration)
+	return results
+}
+
+// fuzzyRank searches the Trie of dict for prefixes within edits of prefix
+// and returns the matches closest first and then by score, bypassing the
+// cache.
+func fuzzyRank(dict *dictionary.Dictionary, prefix, context string, edits int) []string {
+	t := dict.Trie()
+	matches := t.FuzzyPrefix(prefix, float64(edits), substitutionCost)
+	distance := make(map[string]float64, len(matches))
+	results := make([]string, 0, len(matches))
+	for _, m := range matches {
+		distance[m.Word] = m.Distance
+		results = append(results, m.Word)
+	}
+	ranking.Order(rankerFor(dict), t, results, ranking.Query{Prefix: prefix, Context: context})
+	sort.SliceStable(results, func(i, j int) bool {
+		return distance[results[i]] < distance[results[j]]
+	})
+	return results
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cg011235/autocomplete/internal/events"
+	"github.com/cg011235/autocomplete/internal/grapheme"
+)
+
+// hot holds precomputed, ranked suggestions for the most popular prefixes of
+// each dictionary, keyed by dictionary and then prefix. Lists are replaced,
+// never modified, so readers may keep the slice they were handed. A nil map
+// disables hot prefixes.
+var hot struct {
+	mu    sync.RWMutex
+	lists map[string]map[string][]string
+}
+
+// hotLookup returns the precomputed suggestions for prefix in the named
+// dictionary, if prefix is hot.
+func hotLookup(dict, prefix string) ([]string, bool) {
+	hot.mu.RLock()
+	defer hot.mu.RUnlock()
+	results, ok := hot.lists[dict][prefix]
+	return results, ok
+}
+
+// RunHotPrefixes precomputes suggestions for the n most popular prefixes and
+// reselects them every interval until ctx is done. Between refreshes the
+// lists are kept current as words are inserted, deleted and selected.
+func RunHotPrefixes(ctx context.Context, n int, interval time.Duration) {
+	if queries == nil || n <= 0 {
+		return
+	}
+	refreshHot(n)
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			refreshHot(n)
+		}
+	}
+}
+
+// refreshHot recomputes the hot lists from the n most popular queries.
+// Mutations wait while it runs so that none is missed between computing the
+// lists and installing them.
+func refreshHot(n int) {
+	start := time.Now()
+	writeMu.Lock()
+	defer writeMu.Unlock()
+	lists := make(map[string]map[string][]string)
+	count := 0
+	for _, q := range queries.Top(n) {
+		dict, ok := dicts.Lookup(q.Dict)
+		if !ok || belowMinPrefix(dict, q.Prefix) {
+			continue
+		}
+		if lists[dict.Name] == nil {
+			lists[dict.Name] = make(map[string][]string)
+		}
+		lists[dict.Name][q.Prefix] = rank(dict, q.Prefix, "", nil)
+		count++
+	}
+	hot.mu.Lock()
+	hot.lists = lists
+	hot.mu.Unlock()
+	log.Printf("precomputed %d hot prefixes in %s", count, time.Since(start))
+}
+
+// updateHot applies a mutation event of the named dictionary to its hot
+// lists. It is called for every emitted event, with writeMu held.
+func updateHot(name, eventType, word string) {
+	switch eventType {
+	case events.Insert:
+		touchHot(name, word)
+	case events.Delete:
+		removeHot(name, word)
+	case events.Clear, events.Swap:
+		rebuildHot(name)
+	}
+}
+
+// touchHot adds word to, or reorders it within, every hot list of the named
+// dictionary whose prefix it matches.
+func touchHot(name, word string) {
+	hot.mu.Lock()
+	defer hot.mu.Unlock()
+	dict, ok := dicts.Lookup(name)
+	if !ok {
+		return
+	}
+	for prefix, results := range hot.lists[name] {
+		if !hotMatch(word, prefix) {
+			continue
+		}
+		next := make([]string, 0, len(results)+1)
+		for _, w := range results {
+			if w != word {
+				next = append(next, w)
+			}
+		}
+		next = append(next, word)
+		order(dict, next, prefix, "")
+		hot.lists[name][prefix] = next
+	}
+}
+
+// removeHot drops word from every hot list of the named dictionary.
+func removeHot(name, word string) {
+	hot.mu.Lock()
+	defer hot.mu.Unlock()
+	for prefix, results := range hot.lists[name] {
+		if !strings.HasPrefix(word, prefix) {
+			continue
+		}
+		next := make([]string, 0, len(results))
+		for _, w := range results {
+			if w != word {
+				next = append(next, w)
+			}
+		}
+		hot.lists[name][prefix] = next
+	}
+}
+
+// removeHotPrefix stops precomputing suggestions for prefix in the named
+// dictionary until the hot prefixes are next reselected.
+func removeHotPrefix(name, prefix string) {
+	hot.mu.Lock()
+	defer hot.mu.Unlock()
+	delete(hot.lists[name], prefix)
+}
+
+// rebuildHot recomputes every hot list of the named dictionary, after its
+// Trie or settings were replaced wholesale. Lists of a removed dictionary are
+// dropped.
+func rebuildHot(name string) {
+	hot.mu.Lock()
+	defer hot.mu.Unlock()
+	lists, ok := hot.lists[name]
+	if !ok {
+		return
+	}
+	dict, ok := dicts.Lookup(name)
+	if !ok {
+		delete(hot.lists, name)
+		return
+	}
+	next := make(map[string][]string, len(lists))
+	for prefix := range lists {
+		if !belowMinPrefix(dict, prefix) {
+			next[prefix] = rank(dict, prefix, "", nil)
+		}
+	}
+	hot.lists[name] = next
+}
+
+// hotMatch reports whether word belongs in the suggestions for prefix.
+func hotMatch(word, prefix string) bool {
+	if graphemeMatching && prefix != "" {
+		return grapheme.HasPrefix(word, prefix)
+	}
+	return strings.HasPrefix(word, prefix)
+}
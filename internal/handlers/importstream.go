@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/cg011235/autocomplete/internal/dictionary"
+	"github.com/cg011235/autocomplete/internal/importer"
+	"github.com/cg011235/autocomplete/internal/middleware"
+	"github.com/cg011235/autocomplete/internal/response"
+	"github.com/cg011235/autocomplete/internal/trie"
+	"github.com/cg011235/autocomplete/pkg/models"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// NewGRPCServer returns a gRPC server for the Importer service of
+// api/proto/autocomplete.proto, accepting messages of up to maxMessageBytes
+// and imports of up to maxImportBytes of words and metadata in total.
+// It is an http.Handler for HTTP/2 requests; authentication is left to the
+// handlers wrapping it.
+func NewGRPCServer(maxMessageBytes, maxImportBytes int) *grpc.Server {
+	s := grpc.NewServer(grpc.ForceServerCodec(protoCodec{}), grpc.MaxRecvMsgSize(maxMessageBytes))
+	s.RegisterService(&importerService, importServer{maxBytes: maxImportBytes})
+	return s
+}
+
+// protoCodec encodes gRPC messages with the hand-written protobuf encodings
+// of pkg/models.
+type protoCodec struct{}
+
+func (protoCodec) Marshal(v any) ([]byte, error) {
+	m, ok := v.(response.ProtoMarshaler)
+	if !ok {
+		return nil, fmt.Errorf("%T has no protobuf encoding", v)
+	}
+	return m.MarshalProto(), nil
+}
+
+func (protoCodec) Unmarshal(data []byte, v any) error {
+	u, ok := v.(interface{ UnmarshalProto([]byte) error })
+	if !ok {
+		return fmt.Errorf("%T has no protobuf decoding", v)
+	}
+	return u.UnmarshalProto(data)
+}
+
+func (protoCodec) Name() string {
+	return "proto"
+}
+
+// importerServer is the server side of the Importer service.
+type importerServer interface {
+	Import(stream grpc.ServerStream) error
+}
+
+var importerService = grpc.ServiceDesc{
+	ServiceName: "autocomplete.Importer",
+	HandlerType: (*importerServer)(nil),
+	Streams: []grpc.StreamDesc{{
+		StreamName: "Import",
+		Handler: func(srv any, stream grpc.ServerStream) error {
+			return srv.(importerServer).Import(stream)
+		},
+		ClientStreams: true,
+	}},
+	Metadata: "api/proto/autocomplete.proto",
+}
+
+type importServer struct {
+	maxBytes int
+}
+
+// Import is the streaming counterpart of ImportHandler. Each batch is
+// folded and validated as it arrives, before the next one is read, so a bad
+// word fails the stream early and a slow server paces the client through
+// HTTP/2 flow control. Batches are merged into one entry per word as they
+// arrive, and the stream fails once its words and metadata exceed the
+// import size cap. The dictionary is only changed once the client closes
+// the stream.
+func (s importServer) Import(stream grpc.ServerStream) error {
+	var (
+		dict     *dictionary.Dictionary
+		mode     string
+		policy   importer.Policy
+		incoming *importer.Merger
+		size     int
+		summary  models.ImportSummary
+	)
+	for {
+		var batch models.ImportBatch
+		err := stream.RecvMsg(&batch)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if dict == nil {
+			if batch.Mode != "" && batch.Mode != "replace" && batch.Mode != "merge" {
+				return status.Errorf(codes.InvalidArgument, "invalid mode %q", batch.Mode)
+			}
+			if policy, err = importer.ParsePolicy(batch.Conflict); err != nil {
+				return status.Error(codes.InvalidArgument, err.Error())
+			}
+			name := batch.Dict
+			if name == "" {
+				name = dictionary.Default
+			}
+			if !middleware.AllowsDictionary(stream.Context(), name) {
+				return status.Errorf(codes.PermissionDenied, "dictionary %q not allowed", name)
+			}
+			dict, mode = dicts.Get(name), batch.Mode
+			incoming = importer.NewMerger(nil, policy)
+		} else if batch.Dict != "" && batch.Dict != dict.Name {
+			// Later batches may repeat the dictionary but not switch to another
+			return status.Errorf(codes.InvalidArgument, "batch %d: dictionary %q differs from %q of the stream", summary.Batches, batch.Dict, dict.Name)
+		}
+		entries := importEntries(dict, &batch.ImportRequest)
+		if errs := invalidEntries(entries); len(errs) > 0 {
+			return status.Errorf(codes.InvalidArgument, "batch %d: invalid word %q: %s", summary.Batches, errs[0].Value, errs[0].Reason)
+		}
+		for _, e := range entries {
+			size += entryBytes(e)
+		}
+		if s.maxBytes > 0 && size > s.maxBytes {
+			return status.Errorf(codes.ResourceExhausted, "import exceeds %d bytes", s.maxBytes)
+		}
+		incoming.Add(entries)
+		if policy == importer.Error && incoming.Conflicts() > 0 {
+			conflicts := incoming.Result().Conflicts
+			return status.Errorf(codes.AlreadyExists, "import repeats %q", conflicts[0].Word)
+		}
+		summary.Batches++
+		summary.Received += len(batch.Words) + len(batch.Entries)
+	}
+	if dict == nil {
+		return status.Error(codes.InvalidArgument, "no batches received")
+	}
+
+	merged := incoming.Result()
+	imported := entryWords(merged.Entries)
+	incoming = nil
+	writeMu.Lock()
+	defer writeMu.Unlock()
+	if mode == "merge" {
+		// Words repeated within the import were resolved as they arrived,
+		// so merging onto the dictionary only adds its own conflicts.
+		repeated := merged.Conflicts
+		merged = importer.Merge(dict.Trie().Entries(), merged.Entries, policy)
+		merged.Conflicts = append(repeated, merged.Conflicts...)
+	}
+	if policy == importer.Error && len(merged.Conflicts) > 0 {
+		return status.Errorf(codes.AlreadyExists, "import conflicts with %d existing words, first %q", len(merged.Conflicts), merged.Conflicts[0].Word)
+	}
+	t, version, err := install(dict, merged.Entries)
+	var quotaErr *dictionary.QuotaError
+	if errors.As(err, &quotaErr) {
+		return status.Error(codes.ResourceExhausted, err.Error())
+	}
+	if err == nil {
+		err = disown(dict, imported)
+	}
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	summary.Dict = dict.Name
+	summary.Version = version
+	summary.Words = t.Len()
+	summary.Added = merged.Added
+	summary.Conflicts = len(merged.Conflicts)
+	return stream.SendMsg(summary)
+}
+
+// entryBytes returns the bytes of word and metadata e holds, counted
+// against the import size cap.
+func entryBytes(e trie.Entry) int {
+	n := len(e.Word) + len(e.Display)
+	for _, c := range e.Contexts {
+		n += len(c)
+	}
+	if e.Snippet != nil {
+		n += len(e.Snippet.Description) + len(e.Snippet.Icon)
+	}
+	return n
+}
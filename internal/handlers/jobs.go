@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cg011235/autocomplete/internal/response"
+	"github.com/cg011235/autocomplete/pkg/models"
+	"github.com/gorilla/mux"
+)
+
+// maxJobs bounds how many jobs are remembered; the oldest finished ones are
+// forgotten first.
+const maxJobs = 100
+
+// Job states.
+const (
+	jobPending   = "pending"
+	jobRunning   = "running"
+	jobSucceeded = "succeeded"
+	jobFailed    = "failed"
+)
+
+var (
+	jobsMu sync.Mutex
+	jobSeq int
+	// jobs are the remembered jobs, oldest first.
+	jobs []*models.Job
+)
+
+// startJob runs fn in the background as a job of the given type moving dict
+// to target and returns it as queued. fn reports the target's version and
+// word count.
+func startJob(jobType, dict, target string, fn func() (version, words int, err error)) models.Job {
+	return queueJob(jobType, dict, target, func() (func(*models.Job), error) {
+		version, words, err := fn()
+		return func(job *models.Job) { job.Version, job.Words = version, words }, err
+	})
+}
+
+// queueJob runs fn in the background as a job and returns it as queued. The
+// function fn returns, if not nil, records its result on the job.
+func queueJob(jobType, dict, target string, fn func() (func(*models.Job), error)) models.Job {
+	jobsMu.Lock()
+	jobSeq++
+	job := &models.Job{
+		ID:      strconv.Itoa(jobSeq),
+		Type:    jobType,
+		Dict:    dict,
+		Target:  target,
+		State:   jobPending,
+		Created: time.Now().UTC().Format(time.RFC3339),
+	}
+	jobs = append(jobs, job)
+	forgetJobs()
+	queued := *job
+	jobsMu.Unlock()
+
+	go func() {
+		setJob(job, func() { job.State = jobRunning })
+		result, err := fn()
+		setJob(job, func() {
+			job.State = jobSucceeded
+			if result != nil {
+				result(job)
+			}
+			if err != nil {
+				job.State = jobFailed
+				job.Error = err.Error()
+			}
+			job.Finished = time.Now().UTC().Format(time.RFC3339)
+		})
+	}()
+	return queued
+}
+
+func setJob(job *models.Job, update func()) {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	update()
+}
+
+// forgetJobs drops the oldest finished jobs beyond maxJobs. The caller must
+// hold jobsMu.
+func forgetJobs() {
+	for i := 0; len(jobs) > maxJobs && i < len(jobs); {
+		if s := jobs[i].State; s == jobSucceeded || s == jobFailed {
+			jobs = append(jobs[:i], jobs[i+1:]...)
+			continue
+		}
+		i++
+	}
+}
+
+// ListJobsHandler lists the recent background jobs.
+// @Summary List jobs
+// @Description Returns the most recent background jobs, such as dictionary copies and renames, newest first
+// @Tags admin
+// @Produce json
+// @Success 200 {object} models.JobsResponse
+// @Failure 403 {object} map[string]string
+// @Router /api/v1/admin/jobs [get]
+func ListJobsHandler(w http.ResponseWriter, r *http.Request) {
+	jobsMu.Lock()
+	resp := models.JobsResponse{Status: "success", Jobs: make([]models.Job, 0, len(jobs))}
+	for i := len(jobs) - 1; i >= 0; i-- {
+		resp.Jobs = append(resp.Jobs, *jobs[i])
+	}
+	jobsMu.Unlock()
+	response.JSON(w, http.StatusOK, resp)
+}
+
+// GetJobHandler reports the state of a background job.
+// @Summary Get a job
+// @Description Returns the state of a background job and, once it finished, its result or error
+// @Tags admin
+// @Produce json
+// @Param id path string true "Job ID"
+// @Success 200 {object} models.JobResponse
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/admin/jobs/{id} [get]
+func GetJobHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	for _, job := range jobs {
+		if job.ID == id {
+			response.JSON(w, http.StatusOK, models.JobResponse{Status: "success", Job: *job})
+			return
+		}
+	}
+	response.Error(w, http.StatusNotFound, "Job not found")
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/cg011235/autocomplete/internal/dictionary"
+	"github.com/cg011235/autocomplete/internal/importer"
+	"github.com/cg011235/autocomplete/internal/store"
+	"github.com/cg011235/autocomplete/internal/trie"
+)
+
+// BuildSnapshot stores the words read from the files at paths, "-" being
+// standard input, as a new version of the named dictionary without serving
+// it. The words are folded with the dictionary's stored settings exactly as
+// an import would, so the version store can be shipped to servers that load
+// it at startup. Each file is parsed in format.
+func BuildSnapshot(name string, paths []string, format string) (version, words int, err error) {
+	if versions == nil {
+		return 0, 0, errors.New("no version store")
+	}
+	dict := dicts.Get(name)
+	var settings dictionary.Settings
+	if found, err := versions.LoadSettings(name, &settings); err != nil {
+		return 0, 0, fmt.Errorf("loading settings: %w", err)
+	} else if found {
+		dict.SetSettings(settings)
+	}
+
+	var entries []trie.Entry
+	for _, path := range paths {
+		parsed, err := parseFile(path, format)
+		if err != nil {
+			return 0, 0, fmt.Errorf("%s: %w", path, err)
+		}
+		entries = append(entries, parsed...)
+	}
+	entries = canonicalEntries(dict, entries)
+	if errs := invalidEntries(entries); len(errs) > 0 {
+		return 0, 0, fmt.Errorf("%d invalid words, first %q: %s", len(errs), errs[0].Value, errs[0].Reason)
+	}
+	if version, err = versions.Save(name, entries); err != nil {
+		return 0, 0, fmt.Errorf("storing version: %w", err)
+	}
+	// Rebase an existing log so the server loads the new version rather
+	// than replaying the old one's mutations.
+	if _, err := versions.LogBase(name); err == nil {
+		l, err := versions.ResetLog(name, version, true)
+		if err != nil {
+			return 0, 0, fmt.Errorf("resetting log: %w", err)
+		}
+		l.Close()
+	} else if !errors.Is(err, store.ErrNoLog) {
+		return 0, 0, err
+	}
+	return version, len(entries), nil
+}
+
+// parseFile parses the entries of the file at path, or of standard input
+// for "-".
+func parseFile(path, format string) ([]trie.Entry, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	return importer.Parse(r, format)
+}
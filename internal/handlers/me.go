@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/cg011235/autocomplete/internal/middleware"
+	"github.com/cg011235/autocomplete/internal/response"
+	"github.com/cg011235/autocomplete/pkg/models"
+)
+
+// MeHandlerV1 describes the caller as authenticated by its token.
+// @Summary Get the authenticated principal
+// @Description Returns the caller's username, role and rate limit tier and the expiry of its token
+// @Tags auth
+// @Produce json
+// @Success 200 {object} models.MeResponse
+// @Failure 401 {object} map[string]string
+// @Router /api/v1/me [get]
+func MeHandlerV1(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.Claims(r.Context())
+	if claims == nil {
+		response.Error(w, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+	username := middleware.Username(r.Context())
+	role := middleware.Role(r.Context())
+	resp := models.MeResponse{
+		Status:   "success",
+		Username: username,
+		Role:     role,
+		Tier:     middleware.TierOf(username, role),
+	}
+	resp.Issuer, _ = claims["iss"].(string)
+	resp.Subject, _ = claims["sub"].(string)
+	// Numeric claims are decoded from JSON as float64.
+	if iat, ok := claims["iat"].(float64); ok {
+		resp.IssuedAt = time.Unix(int64(iat), 0).UTC().Format(time.RFC3339)
+	}
+	if exp, ok := claims["exp"].(float64); ok {
+		expires := time.Unix(int64(exp), 0)
+		resp.ExpiresAt = expires.UTC().Format(time.RFC3339)
+		resp.ExpiresIn = int64(time.Until(expires).Seconds())
+	}
+	response.JSON(w, http.StatusOK, resp)
+}
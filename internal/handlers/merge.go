@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cg011235/autocomplete/internal/dictionary"
+	"github.com/cg011235/autocomplete/internal/ranking"
+	"github.com/cg011235/autocomplete/pkg/models"
+)
+
+// maxMergedDictionaries bounds how many dictionaries one query may merge.
+const maxMergedDictionaries = 10
+
+// weightedDictionary is a dictionary named in a merged query with the boost
+// added to the scores of its words.
+type weightedDictionary struct {
+	dict  *dictionary.Dictionary
+	boost float64
+}
+
+// parseDictionaries parses a "name[:boost],..." list such as "products,brands:5".
+func parseDictionaries(v string) ([]weightedDictionary, error) {
+	var list []weightedDictionary
+	for _, item := range strings.Split(v, ",") {
+		name, boostStr, hasBoost := strings.Cut(strings.TrimSpace(item), ":")
+		if name == "" {
+			return nil, errors.New("empty dictionary name")
+		}
+		wd := weightedDictionary{dict: dicts.Get(name)}
+		if hasBoost {
+			boost, err := strconv.ParseFloat(boostStr, 64)
+			if err != nil {
+				return nil, errors.New("invalid boost for dictionary " + name)
+			}
+			wd.boost = boost
+		}
+		list = append(list, wd)
+	}
+	if len(list) > maxMergedDictionaries {
+		return nil, errors.New("too many dictionaries")
+	}
+	return list, nil
+}
+
+// mergedNext is nextChars across several dictionaries.
+func mergedNext(list []weightedDictionary, prefix string) (bool, []string) {
+	complete := false
+	seen := make(map[string]bool)
+	next := []string{}
+	for _, wd := range list {
+		c, chars := nextChars(wd.dict.Trie(), wd.dict.Resolve(queryPrefix(wd.dict, prefix)))
+		complete = complete || c
+		for _, char := range chars {
+			if !seen[char] {
+				seen[char] = true
+				next = append(next, char)
+			}
+		}
+	}
+	sort.Strings(next)
+	return complete, next
+}
+
+// mergedSuggest suggests from several dictionaries at once. Each word scores
+// its usual score in its dictionary plus the dictionary's boost; words found
+// in several dictionaries keep their best score, explained in the returned map.
+// The words are ordered by the ranker of the first dictionary, with the boost
+// added to their weights.
+func mergedSuggest(list []weightedDictionary, prefix, context string) ([]string, map[string]models.ScoreExplanation) {
+	q := ranking.Query{Prefix: prefix, Context: context}
+	ranker := rankerFor(list[0].dict)
+	scores := make(map[string]models.ScoreExplanation)
+	candidates := make(map[string]ranking.Candidate)
+	for _, wd := range list {
+		t := wd.dict.Trie()
+		resolved := wd.dict.Resolve(queryPrefix(wd.dict, prefix))
+		if queries != nil {
+			queries.Record(wd.dict.Name, resolved)
+		}
+		for _, word := range capResults(wd.dict, suggest(wd.dict, resolved, context)) {
+			c := ranking.Explain(ranker, t, word, q)
+			score := c.Score() + wd.boost
+			if best, ok := scores[word]; !ok || score > best.Score {
+				snippet := t.Snippet(word)
+				scores[word] = models.ScoreExplanation{
+					Word:            word,
+					Display:         t.Display(word),
+					Description:     snippet.Description,
+					Icon:            snippet.Icon,
+					Score:           score,
+					Weight:          c.Weight,
+					ContextBoost:    c.Context,
+					RecencyBoost:    c.Recency,
+					Dict:            wd.dict.Name,
+					DictionaryBoost: wd.boost,
+				}
+				candidate := ranking.NewCandidate(t, word, q)
+				candidate.Weight += wd.boost
+				candidates[word] = candidate
+			}
+		}
+	}
+
+	ranked := make([]ranking.Candidate, 0, len(candidates))
+	for _, c := range candidates {
+		ranked = append(ranked, c)
+	}
+	results := make([]string, 0, len(ranked))
+	for _, c := range ranking.OrderCandidates(ranker, ranked, q) {
+		results = append(results, c.Word)
+	}
+	return results, scores
+}
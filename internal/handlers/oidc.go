@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"time"
+
+	"github.com/cg011235/autocomplete/internal/middleware"
+	"github.com/cg011235/autocomplete/internal/oidc"
+	"github.com/cg011235/autocomplete/internal/response"
+)
+
+// stateCookie carries the OAuth2 state between the login redirect and the callback.
+const stateCookie = "oidc_state"
+
+// provider performs OIDC logins; nil means password login is used instead.
+var provider *oidc.Provider
+
+// SetOIDCProvider enables OIDC login through the given provider.
+func SetOIDCProvider(p *oidc.Provider) {
+	provider = p
+}
+
+// OIDCLoginHandler redirects the user to the identity provider.
+// @Summary Start OIDC login
+// @Description Redirects to the configured OpenID Connect provider; replaces password login when OIDC is enabled
+// @Tags auth
+// @Success 302
+// @Router /api/login [get]
+func OIDCLoginHandler(w http.ResponseWriter, r *http.Request) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		response.Error(w, http.StatusInternalServerError, "Error generating state")
+		return
+	}
+	state := base64.RawURLEncoding.EncodeToString(buf)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     stateCookie,
+		Value:    state,
+		Path:     "/api/login",
+		MaxAge:   int((10 * time.Minute).Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, provider.AuthCodeURL(state), http.StatusFound)
+}
+
+// OIDCCallbackHandler exchanges the authorization code and issues a service token.
+// @Summary Complete OIDC login
+// @Description Exchanges the authorization code with the provider, maps its claims to a role and issues a JWT token
+// @Tags auth
+// @Produce json
+// @Param code query string true "Authorization code"
+// @Param state query string true "State from the login redirect"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Router /api/login/callback [get]
+func OIDCCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie(stateCookie)
+	if err != nil || cookie.Value == "" || cookie.Value != r.URL.Query().Get("state") {
+		response.Error(w, http.StatusBadRequest, "Invalid login state")
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: stateCookie, Path: "/api/login", MaxAge: -1})
+
+	identity, err := provider.Exchange(r.Context(), r.URL.Query().Get("code"))
+	if err != nil {
+		response.Error(w, http.StatusUnauthorized, "Login failed: "+err.Error())
+		return
+	}
+
+	role := middleware.RoleUser
+	if identity.Admin {
+		role = middleware.RoleAdmin
+	}
+	issueToken(w, identity.Username, role)
+}
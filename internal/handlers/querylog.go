@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/cg011235/autocomplete/internal/middleware"
+	"github.com/cg011235/autocomplete/internal/querylog"
+)
+
+// queryLog samples raw suggest queries for export; nil disables it.
+var queryLog *querylog.Logger
+
+// SetQueryLog enables sampling of suggest queries into l.
+func SetQueryLog(l *querylog.Logger) {
+	queryLog = l
+}
+
+// logQuery samples a suggest query for prefix in dict that returned results
+// since start.
+func logQuery(r *http.Request, dict, prefix string, start time.Time, results int) {
+	if queryLog != nil {
+		queryLog.Record(dict, prefix, middleware.Username(r.Context()), time.Since(start), results)
+	}
+}
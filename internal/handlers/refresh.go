@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/cg011235/autocomplete/internal/refresh"
+	"github.com/cg011235/autocomplete/internal/validate"
+)
+
+// RefreshLimits guard scheduled refreshes against broken sources: a source
+// that would shrink a dictionary by more than MaxShrink, or grow it by more
+// than MaxGrowth, both fractions of its current size, is not installed. Zero
+// disables a check.
+type RefreshLimits struct {
+	MaxShrink float64
+	MaxGrowth float64
+}
+
+// RunRefresher rebuilds the dictionary of every source from its URL every
+// interval until ctx is done. Unchanged sources are skipped, and candidates
+// that fail validation or the limits are logged and discarded.
+func RunRefresher(ctx context.Context, sources []*refresh.Source, interval time.Duration, limits RefreshLimits) {
+	if len(sources) == 0 || interval <= 0 {
+		return
+	}
+	client := &http.Client{Timeout: interval}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		for _, s := range sources {
+			start := time.Now()
+			version, words, err := refreshSource(ctx, client, s, limits)
+			switch {
+			case err != nil:
+				log.Printf("refreshing dictionary %q from %s: %v", s.Dict, s.URL, err)
+			case version >= 0:
+				log.Printf("refreshed dictionary %q from %s as version %d with %d words in %s", s.Dict, s.URL, version, words, time.Since(start))
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// refreshSource fetches s and installs it as a new version of its
+// dictionary, returning the version and its word count, or a version of -1
+// if the source is unchanged.
+func refreshSource(ctx context.Context, client *http.Client, s *refresh.Source, limits RefreshLimits) (int, int, error) {
+	result, err := s.Fetch(ctx, client)
+	if err != nil {
+		return 0, 0, err
+	}
+	if result.NotModified {
+		return -1, 0, nil
+	}
+	dict := dicts.Get(s.Dict)
+	entries := canonicalEntries(dict, result.Entries)
+	for _, e := range entries {
+		if reason := validate.Word(e.Word); reason != "" {
+			return 0, 0, fmt.Errorf("invalid word %q: %s", e.Word, reason)
+		}
+	}
+
+	writeMu.Lock()
+	defer writeMu.Unlock()
+	current, next := dict.Trie().Len(), len(entries)
+	if current > 0 {
+		if limits.MaxShrink > 0 && float64(current-next) > limits.MaxShrink*float64(current) {
+			return 0, 0, fmt.Errorf("source has %d words, shrinking the dictionary from %d by more than %.0f%%", next, current, limits.MaxShrink*100)
+		}
+		if limits.MaxGrowth > 0 && float64(next-current) > limits.MaxGrowth*float64(current) {
+			return 0, 0, fmt.Errorf("source has %d words, growing the dictionary from %d by more than %.0f%%", next, current, limits.MaxGrowth*100)
+		}
+	}
+	t, version, err := install(dict, entries)
+	if err == nil {
+		err = disown(dict, entryWords(entries))
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	s.ETag, s.LastModified = result.ETag, result.LastModified
+	return version, t.Len(), nil
+}
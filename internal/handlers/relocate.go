@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/cg011235/autocomplete/internal/dictionary"
+	"github.com/cg011235/autocomplete/internal/events"
+	"github.com/cg011235/autocomplete/internal/response"
+	"github.com/cg011235/autocomplete/pkg/models"
+	"github.com/gorilla/mux"
+)
+
+// errTargetExists is returned when copying or renaming onto a dictionary
+// that has words without overwrite.
+var errTargetExists = errors.New("target dictionary is not empty")
+
+// CopyDictionaryHandler copies a dictionary in the background.
+// @Summary Copy a dictionary
+// @Description Starts a job copying every word of a dictionary with its weights, contexts and display forms, along with its settings, quota and aliases, into the target dictionary, which is stored as a new version and swapped in atomically. A target that has words is only replaced with overwrite=true. Poll the returned job for the result.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param name path string true "Dictionary name"
+// @Param target body models.DictionaryJobRequest true "Target dictionary"
+// @Success 202 {object} models.JobResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/admin/dicts/{name}/copy [post]
+func CopyDictionaryHandler(w http.ResponseWriter, r *http.Request) {
+	startRelocation(w, r, "copy")
+}
+
+// RenameDictionaryHandler renames a dictionary in the background.
+// @Summary Rename a dictionary
+// @Description Starts a job copying a dictionary to the target as CopyDictionaryHandler does, then removing the source with its stored versions, log and settings. Poll the returned job for the result.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param name path string true "Dictionary name"
+// @Param target body models.DictionaryJobRequest true "New dictionary name"
+// @Success 202 {object} models.JobResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/admin/dicts/{name}/rename [post]
+func RenameDictionaryHandler(w http.ResponseWriter, r *http.Request) {
+	startRelocation(w, r, "rename")
+}
+
+// startRelocation validates a copy or rename request and starts its job.
+func startRelocation(w http.ResponseWriter, r *http.Request, jobType string) {
+	var request models.DictionaryJobRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	name := mux.Vars(r)["name"]
+	if request.To == "" || request.To == name {
+		response.Error(w, http.StatusBadRequest, "'to' must name another dictionary")
+		return
+	}
+	src, ok := dicts.Lookup(name)
+	if !ok {
+		response.Error(w, http.StatusNotFound, "Unknown dictionary")
+		return
+	}
+	if dst, ok := dicts.Lookup(request.To); ok && dst.Trie().Len() > 0 && !request.Overwrite {
+		response.Error(w, http.StatusConflict, "Target dictionary is not empty; set 'overwrite' to replace it")
+		return
+	}
+
+	job := startJob(jobType, name, request.To, func() (int, int, error) {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		version, words, err := copyDictionary(src, dicts.Get(request.To), request.Overwrite)
+		if err == nil && jobType == "rename" {
+			err = removeDictionary(src)
+		}
+		return version, words, err
+	})
+	w.Header().Set("Location", "/api/v1/admin/jobs/"+job.ID)
+	response.JSON(w, http.StatusAccepted, models.JobResponse{Status: "success", Job: job})
+}
+
+// copyDictionary replaces dst with the words, settings, quota, aliases and
+// entities of src and returns its new version and size. The caller must hold
+// writeMu.
+func copyDictionary(src, dst *dictionary.Dictionary, overwrite bool) (int, int, error) {
+	if dst.Trie().Len() > 0 && !overwrite {
+		return 0, 0, errTargetExists
+	}
+	settings := src.Settings()
+	if versions != nil {
+		if err := versions.SaveSettings(dst.Name, settings); err != nil {
+			return 0, 0, fmt.Errorf("storing settings: %w", err)
+		}
+	}
+	dst.SetSettings(settings)
+	dst.SetQuota(src.Quota())
+	for alias := range dst.Aliases() {
+		dst.RemoveAlias(alias)
+	}
+	for alias, target := range src.Aliases() {
+		dst.SetAlias(alias, target)
+	}
+	if err := saveAliases(dst); err != nil {
+		return 0, 0, err
+	}
+	dst.SetEntities(src.Entities())
+	if err := saveEntities(dst); err != nil {
+		return 0, 0, err
+	}
+	t, version, err := install(dst, src.Trie().Entries())
+	if err != nil {
+		return 0, 0, err
+	}
+	return version, t.Len(), nil
+}
+
+// removeDictionary drops dict along with its stored versions, log and
+// settings. The caller must hold writeMu.
+func removeDictionary(dict *dictionary.Dictionary) error {
+	if l, ok := logs[dict.Name]; ok {
+		l.Close()
+		delete(logs, dict.Name)
+	}
+	if versions != nil {
+		if err := versions.Remove(dict.Name); err != nil {
+			return fmt.Errorf("removing stored versions: %w", err)
+		}
+	}
+	dicts.Remove(dict.Name)
+	emit(dict.Name, events.Clear, "")
+	invalidate()
+	negativeCache.Flush()
+	return nil
+}
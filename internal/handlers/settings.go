@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"unicode/utf8"
+
+	"github.com/cg011235/autocomplete/internal/dictionary"
+	"github.com/cg011235/autocomplete/internal/ranking"
+	"github.com/cg011235/autocomplete/internal/response"
+	"github.com/cg011235/autocomplete/pkg/models"
+	"github.com/gorilla/mux"
+)
+
+// ListSettingsHandler returns the settings of every dictionary.
+// @Summary List dictionary settings
+// @Description Returns the settings each dictionary overrides the server defaults with
+// @Tags admin
+// @Produce json
+// @Success 200 {object} models.SettingsResponse
+// @Failure 403 {object} map[string]string
+// @Router /api/v1/admin/settings [get]
+func ListSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	resp := models.SettingsResponse{Status: "success", Settings: []models.DictionarySettings{}}
+	for _, d := range dicts.List() {
+		resp.Settings = append(resp.Settings, settingsOf(d))
+	}
+	response.JSON(w, http.StatusOK, resp)
+}
+
+// SetSettingsHandler replaces the settings of a dictionary.
+// @Summary Set dictionary settings
+// @Description Overrides the normalizers (a pipeline of lowercase, nfc, diacritics and whitespace, or none), tokenizer (none or whitespace), case sensitivity, minimum prefix length, maximum number of results, default fuzziness and ranker (frequency, alphabetical, shortest, recency or a custom registered one) of a dictionary; omitted or zero settings use the server defaults. Normalization changes apply to words added from then on. With a data directory the settings are stored alongside the dictionary's versions.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param dict path string true "Dictionary name"
+// @Param settings body models.SettingsRequest true "Dictionary settings"
+// @Success 200 {object} models.SettingsResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/admin/settings/{dict} [put]
+func SetSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	var request models.SettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	settings := dictionary.Settings{
+		Normalizers:     request.Normalizers,
+		Tokenizer:       request.Tokenizer,
+		CaseSensitive:   request.CaseSensitive,
+		MinPrefixLength: request.MinPrefixLength,
+		MaxResults:      request.MaxResults,
+		Fuzzy:           request.Fuzzy,
+		Ranker:          request.Ranker,
+	}
+	err := settings.Validate()
+	if err == nil && settings.Ranker != "" {
+		_, err = ranking.Lookup(settings.Ranker)
+	}
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid settings: "+err.Error())
+		return
+	}
+
+	d := dicts.Get(mux.Vars(r)["dict"])
+	if versions != nil {
+		if err := versions.SaveSettings(d.Name, settings); err != nil {
+			response.Error(w, http.StatusInternalServerError, "Error storing settings: "+err.Error())
+			return
+		}
+	}
+	d.SetSettings(settings)
+	rebuildHot(d.Name)
+	invalidate()
+	negativeCache.Flush()
+	response.JSON(w, http.StatusOK, models.SettingsResponse{
+		Status:   "success",
+		Settings: []models.DictionarySettings{settingsOf(d)},
+	})
+}
+
+func settingsOf(d *dictionary.Dictionary) models.DictionarySettings {
+	s := d.Settings()
+	return models.DictionarySettings{
+		Dict:            d.Name,
+		Normalizers:     s.Normalizers,
+		Tokenizer:       s.Tokenizer,
+		CaseSensitive:   s.CaseSensitive,
+		MinPrefixLength: s.MinPrefixLength,
+		MaxResults:      s.MaxResults,
+		Fuzzy:           s.Fuzzy,
+		Ranker:          s.Ranker,
+	}
+}
+
+// rankerFor returns the ranker ordering the suggestions of dict, falling
+// back to the default if its ranker is no longer registered.
+func rankerFor(dict *dictionary.Dictionary) ranking.Ranker {
+	if name := dict.Settings().Ranker; name != "" {
+		if r, err := ranking.Lookup(name); err == nil {
+			return r
+		}
+	}
+	r, _ := ranking.Lookup(ranking.DefaultRanker)
+	return r
+}
+
+// belowMinPrefix reports whether prefix is too short to get suggestions
+// from dict.
+func belowMinPrefix(dict *dictionary.Dictionary, prefix string) bool {
+	n := dict.Settings().MinPrefixLength
+	return n > 0 && utf8.RuneCountInString(prefix) < n
+}
+
+// capResults truncates results to the maximum number dict returns.
+func capResults(dict *dictionary.Dictionary, results []string) []string {
+	if n := dict.Settings().MaxResults; n > 0 && len(results) > n {
+		return results[:n]
+	}
+	return results
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"slices"
+
+	"github.com/cg011235/autocomplete/internal/ranking"
+	"github.com/cg011235/autocomplete/internal/trie"
+)
+
+// shadowLogResults is how many results of each ranking a shadow experiment logs.
+const shadowLogResults = 10
+
+var (
+	// shadowName and shadowRanker are the ranker evaluated in shadow mode
+	// on shadowPercent percent of suggest requests, or nil.
+	shadowName    string
+	shadowRanker  ranking.Ranker
+	shadowPercent float64
+)
+
+// SetShadowRanking runs the named ranker alongside the normal
+// ranking on percent percent of suggest requests, logging both result sets
+// while only the normal ranking is returned. An empty name disables it.
+func SetShadowRanking(name string, percent float64) error {
+	if name == "" {
+		shadowName, shadowRanker = "", nil
+		return nil
+	}
+	ranker, err := ranking.Lookup(name)
+	if err != nil {
+		return err
+	}
+	if percent < 0 || percent > 100 {
+		return fmt.Errorf("percentage %v out of range 0-100", percent)
+	}
+	shadowName, shadowRanker, shadowPercent = name, ranker, percent
+	return nil
+}
+
+// shadowRank samples a request for the shadow ranking experiment. If
+// sampled, it ranks candidates with the shadow ranker in the background
+// and logs the result next to control, the results returned to the client.
+func shadowRank(dict string, t *trie.Trie, prefix, context string, candidates, control []string) {
+	if shadowRanker == nil || rand.Float64()*100 >= shadowPercent {
+		return
+	}
+	// Copy both: candidates may be shared with the cache.
+	shadow := slices.Clone(candidates)
+	control = slices.Clone(control[:min(len(control), shadowLogResults)])
+	go func() {
+		ranking.Order(shadowRanker, t, shadow, ranking.Query{Prefix: prefix, Context: context})
+		shadow = shadow[:min(len(shadow), len(control))]
+		log.Printf("shadow ranking: dict=%s prefix=%q context=%q ranking=%s same=%t control=%q shadow=%q",
+			dict, prefix, context, shadowName, slices.Equal(control, shadow), control, shadow)
+	}()
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/cg011235/autocomplete/internal/middleware"
+	"github.com/cg011235/autocomplete/internal/response"
+	"github.com/cg011235/autocomplete/pkg/models"
+)
+
+// StatsHandler reports per-route latency percentiles, overall and per
+// listener, API version and dictionary, along with dictionary sizes, trie
+// node allocation, string interning and suggest cache invalidations.
+// @Summary Get server stats
+// @Description Returns latency percentiles over the most recent requests of each route, overall and broken down by listener, API version and dictionary to spot a noisy tenant, along with the size of every dictionary and how often the suggest cache is invalidated, how many entries that drops and the latency of the misses that follow
+// @Tags admin
+// @Produce json
+// @Param dict query string false "Only report the labeled latencies of this dictionary"
+// @Success 200 {object} models.StatsResponse
+// @Failure 403 {object} map[string]string
+// @Router /api/v1/admin/stats [get]
+func StatsHandler(w http.ResponseWriter, r *http.Request) {
+	resp := models.StatsResponse{
+		Status:       "success",
+		Routes:       []models.RouteLatency{},
+		Labeled:      []models.LabeledRouteLatency{},
+		Dictionaries: []models.DictionaryStats{},
+		Cache:        cacheStats(),
+	}
+	for _, l := range middleware.Latencies() {
+		resp.Routes = append(resp.Routes, models.RouteLatency{
+			Route: l.Route,
+			Count: l.Count,
+			Slow:  l.Slow,
+			P50:   ms(l.P50),
+			P90:   ms(l.P90),
+			P99:   ms(l.P99),
+			Max:   ms(l.Max),
+		})
+	}
+	for _, l := range middleware.LabeledLatencies(r.URL.Query().Get("dict")) {
+		resp.Labeled = append(resp.Labeled, models.LabeledRouteLatency{
+			Listener: l.Listener,
+			Version:  l.Version,
+			Dict:     l.Dict,
+			Route:    l.Route,
+			Count:    l.Count,
+			Slow:     l.Slow,
+			P50:      ms(l.P50),
+			P90:      ms(l.P90),
+			P99:      ms(l.P99),
+			Max:      ms(l.Max),
+		})
+	}
+	for _, d := range dicts.List() {
+		t := d.Trie()
+		alloc, interned := t.AllocStats(), t.InternStats()
+		resp.Dictionaries = append(resp.Dictionaries, models.DictionaryStats{
+			Dict:          d.Name,
+			Version:       d.Version(),
+			Words:         t.Len(),
+			MetadataBytes: t.MetadataBytes(),
+			Allocator: models.AllocatorStats{
+				Slabs:     alloc.Slabs,
+				Nodes:     alloc.Nodes,
+				LiveNodes: alloc.LiveNodes,
+				Bytes:     alloc.Bytes,
+			},
+			Interning: models.InterningStats{
+				Strings:    interned.Strings,
+				Bytes:      interned.Bytes,
+				Hits:       interned.Hits,
+				SavedBytes: interned.SavedBytes,
+			},
+		})
+	}
+	response.JSON(w, http.StatusOK, resp)
+}
+
+// HistogramHandler reports how a dictionary's words are distributed by
+// length and first character.
+// @Summary Get word distributions
+// @Description Returns the number of words of each length (in characters) and starting with each character, e.g. to spot an import that injected thousands of single-character tokens. The counts are kept up to date on every insert and delete.
+// @Tags admin
+// @Produce json
+// @Param dict query string false "Dictionary name"
+// @Success 200 {object} models.HistogramResponse
+// @Failure 403 {object} map[string]string
+// @Router /api/v1/admin/histogram [get]
+func HistogramHandler(w http.ResponseWriter, r *http.Request) {
+	d := dictionaryFor(r)
+	t := d.Trie()
+	h := t.Histogram()
+	resp := models.HistogramResponse{
+		Status:     "success",
+		Dict:       d.Name,
+		Words:      t.Len(),
+		Lengths:    make([]models.LengthBucket, 0, len(h.Lengths)),
+		FirstChars: make([]models.CharBucket, 0, len(h.FirstChars)),
+	}
+	for _, b := range h.Lengths {
+		resp.Lengths = append(resp.Lengths, models.LengthBucket{Length: b.Key, Words: b.Words})
+	}
+	for _, b := range h.FirstChars {
+		resp.FirstChars = append(resp.FirstChars, models.CharBucket{Char: string(b.Key), Words: b.Words})
+	}
+	response.JSON(w, http.StatusOK, resp)
+}
+
+// SlowRequestInfo describes the dictionary a slow request ran against.
+func SlowRequestInfo(r *http.Request) string {
+	d := dictionaryFor(r)
+	return fmt.Sprintf("dict=%s version=%d words=%d", d.Name, d.Version(), d.Trie().Len())
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+
+	"github.com/cg011235/autocomplete/internal/middleware"
+	"github.com/cg011235/autocomplete/internal/trie"
+)
+
+// debugToken, if set, enables query traces for any caller sending it in the
+// X-Debug-Token header.
+var debugToken string
+
+// SetDebugToken sets the token that enables query traces without an admin
+// role; empty leaves traces to admins.
+func SetDebugToken(token string) {
+	debugToken = token
+}
+
+// Cache outcomes of a traced query.
+const (
+	traceHit      = "hit"
+	traceHot      = "hot"
+	traceNegative = "negative"
+	traceFiltered = "filtered"
+	traceShort    = "below_min_prefix"
+	traceMiss     = "miss"
+)
+
+// queryTrace records how a suggest query was served. It is returned in
+// X-Debug-* headers so a slow query can be diagnosed in production.
+type queryTrace struct {
+	// Cache is how the query was answered without searching, or miss.
+	Cache string
+	trie.Trace
+}
+
+// traceFor returns a trace for r if its caller asked for one, as an admin
+// with debug=true or with the debug token, or nil.
+func traceFor(r *http.Request) *queryTrace {
+	if token := r.Header.Get("X-Debug-Token"); token != "" && debugToken != "" &&
+		subtle.ConstantTimeCompare([]byte(token), []byte(debugToken)) == 1 {
+		return &queryTrace{}
+	}
+	if on, _ := strconv.ParseBool(r.URL.Query().Get("debug")); on && middleware.Role(r.Context()) == middleware.RoleAdmin {
+		return &queryTrace{}
+	}
+	return nil
+}
+
+// cache records the cache outcome of the query.
+func (tr *queryTrace) cache(outcome string) {
+	if tr != nil {
+		tr.Cache = outcome
+	}
+}
+
+// search returns the trace to record the Trie search in, or nil.
+func (tr *queryTrace) search() *trie.Trace {
+	if tr == nil {
+		return nil
+	}
+	return &tr.Trace
+}
+
+// writeHeaders sets the debug headers of a traced response. Traced
+// responses are not stored by shared caches.
+func (tr *queryTrace) writeHeaders(w http.ResponseWriter) {
+	if tr == nil {
+		return
+	}
+	h := w.Header()
+	h.Set("Cache-Control", "no-store")
+	h.Set("X-Debug-Cache", tr.Cache)
+	h.Set("X-Debug-Nodes-Visited", strconv.Itoa(tr.Nodes))
+	h.Set("X-Debug-Lock-Wait", tr.LockWait.String())
+	h.Set("X-Debug-Traversal", tr.Traversal.String())
+}
@@ -2,18 +2,31 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
+	"log"
 	"net/http"
-	"strings"
+	"strconv"
 	"time"
+	"unicode/utf8"
 
+	"github.com/cg011235/autocomplete/internal/dictionary"
+	"github.com/cg011235/autocomplete/internal/events"
+	"github.com/cg011235/autocomplete/internal/grapheme"
+	"github.com/cg011235/autocomplete/internal/lockout"
+	"github.com/cg011235/autocomplete/internal/middleware"
+	"github.com/cg011235/autocomplete/internal/personal"
+	"github.com/cg011235/autocomplete/internal/ranking"
+	"github.com/cg011235/autocomplete/internal/response"
+	"github.com/cg011235/autocomplete/internal/store"
 	"github.com/cg011235/autocomplete/internal/trie"
+	"github.com/cg011235/autocomplete/internal/validate"
 	"github.com/cg011235/autocomplete/pkg/models"
 	"github.com/golang-jwt/jwt"
 	"github.com/patrickmn/go-cache"
 )
 
 var (
-	trieV1  = trie.NewTrie()
+	dicts   = dictionary.NewRegistry(dictionary.Quota{})
 	cacheV1 = cache.New(5*time.Minute, 10*time.Minute)
 )
 
@@ -21,13 +34,77 @@ var validCredentials = map[string]string{
 	"user1": "password123",
 }
 
-var secretKey []byte
+var (
+	secretKey []byte
+	// signingKeyID is sent as the "kid" header of issued tokens; empty omits it.
+	signingKeyID string
+	// tokenIssuer and tokenAudience are sent as the "iss" and "aud" claims of
+	// issued tokens; empty omits them.
+	tokenIssuer   string
+	tokenAudience string
+)
+
+// logins locks out usernames and client IPs after repeated failed logins;
+// nil disables lockouts.
+var logins *lockout.Tracker
+
+// SetLoginLockout enables locking out usernames and client IPs that keep
+// failing to log in.
+func SetLoginLockout(t *lockout.Tracker) {
+	logins = t
+}
+
+// adminUsers lists the usernames issued tokens with the admin role.
+var adminUsers = map[string]bool{}
+
+// SetAdminUsers grants the admin role to the given usernames at login.
+func SetAdminUsers(names []string) {
+	adminUsers = make(map[string]bool, len(names))
+	for _, name := range names {
+		adminUsers[name] = true
+	}
+}
+
+var (
+	// history holds per-user accepted suggestions; nil disables personalization.
+	history       *personal.History
+	personalBoost = 5.0
+)
+
+// SetPersonalization enables blending of per-user history into suggestions.
+// Passing a nil history disables it.
+func SetPersonalization(h *personal.History, boost float64) {
+	history = h
+	personalBoost = boost
+}
+
+// Dictionaries returns the dictionaries served by the handlers.
+func Dictionaries() *dictionary.Registry {
+	return dicts
+}
+
+// dictionaryFor returns the dictionary named by the request's "dict" query
+// parameter, or the default dictionary.
+func dictionaryFor(r *http.Request) *dictionary.Dictionary {
+	name := r.URL.Query().Get("dict")
+	if name == "" {
+		name = dictionary.Default
+	}
+	return dicts.Get(name)
+}
 
-// SetSecretKey sets the JWT secret key.
-func SetSecretKey(key []byte) {
+// SetSigningKey sets the JWT secret key and its key ID used to sign new tokens.
+func SetSigningKey(kid string, key []byte) {
+	signingKeyID = kid
 	secretKey = key
 }
 
+// SetTokenClaims sets the issuer and audience claims of issued tokens.
+func SetTokenClaims(issuer, audience string) {
+	tokenIssuer = issuer
+	tokenAudience = audience
+}
+
 // LoginHandler handles user login and issues a JWT token.
 // @Summary Issue JWT token
 // @Description Authenticates the user and issues a JWT token
@@ -38,28 +115,79 @@ func SetSecretKey(key []byte) {
 // @Success 200 {object} map[string]string
 // @Failure 400 {object} map[string]string
 // @Failure 401 {object} map[string]string
+// @Failure 429 {object} map[string]string
 // @Router /api/login [post]
 func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	var creds models.Credentials
 	err := json.NewDecoder(r.Body).Decode(&creds)
 	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		response.Error(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
+	ip := middleware.ClientIP(r)
+	keys := []string{"user:" + creds.Username, "ip:" + ip}
+	if logins != nil {
+		now := time.Now()
+		var wait time.Duration
+		for _, key := range keys {
+			wait = max(wait, logins.Locked(key, now))
+		}
+		if wait > 0 {
+			log.Printf("audit: rejected login of %q from %s while locked out for %s", creds.Username, ip, wait.Round(time.Second))
+			response.Throttled(w, http.StatusTooManyRequests, response.ReasonLockedOut, wait, "Too many failed login attempts")
+			return
+		}
+	}
+
 	if password, ok := validCredentials[creds.Username]; !ok || password != creds.Password {
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		log.Printf("audit: failed login of %q from %s", creds.Username, ip)
+		if logins != nil {
+			now := time.Now()
+			for _, key := range keys {
+				if lockout := logins.Fail(key, now); lockout > 0 {
+					log.Printf("audit: locked out %s for %s after failed logins", key, lockout)
+				}
+			}
+		}
+		response.Error(w, http.StatusUnauthorized, "Invalid credentials")
 		return
 	}
+	// Only the username is cleared: an attacker must not be able to reset
+	// their IP's failures by logging into an account of their own.
+	if logins != nil {
+		logins.Succeed(keys[0])
+	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"username": creds.Username,
+	role := middleware.RoleUser
+	if adminUsers[creds.Username] {
+		role = middleware.RoleAdmin
+	}
+	issueToken(w, creds.Username, role)
+}
+
+// issueToken signs a service token for the given user and role and writes it as the response.
+func issueToken(w http.ResponseWriter, username, role string) {
+	claims := jwt.MapClaims{
+		"username": username,
+		"role":     role,
 		"exp":      time.Now().Add(time.Hour * 24).Unix(),
-	})
+	}
+	if tokenIssuer != "" {
+		claims["iss"] = tokenIssuer
+	}
+	if tokenAudience != "" {
+		claims["aud"] = tokenAudience
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+
+	if signingKeyID != "" {
+		token.Header["kid"] = signingKeyID
+	}
 
 	tokenString, err := token.SignedString(secretKey)
 	if err != nil {
-		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		response.Error(w, http.StatusInternalServerError, "Error generating token")
 		return
 	}
 
@@ -85,10 +213,57 @@ func RootHandler(w http.ResponseWriter, r *http.Request) {
 		"message": "Welcome to the Trie-based Autocomplete API",
 		"endpoints": []map[string]string{
 			{"method": "POST", "endpoint": "/api/login", "description": "Authenticate, generate token"},
+			{"method": "GET", "endpoint": "/widget/suggest", "description": "Public suggestions for browser widgets, when enabled"},
 			{"method": "POST", "endpoint": "/api/v1/words", "description": "Add words to the Trie"},
 			{"method": "GET", "endpoint": "/api/v1/words", "description": "Lookup words that start with a given prefix or retrieve all words"},
 			{"method": "DELETE", "endpoint": "/api/v1/words", "description": "Delete a word from the Trie or clear all words"},
 			{"method": "GET", "endpoint": "/api/v1/words/exists", "description": "Check if a word exists in the Trie"},
+			{"method": "POST", "endpoint": "/api/v1/words/exists", "description": "Check if each of a list of words exists in the Trie"},
+			{"method": "GET", "endpoint": "/api/v1/words/longest-prefix", "description": "Find the longest word that is a prefix of a text"},
+			{"method": "POST", "endpoint": "/api/v1/words/select", "description": "Record a selected suggestion to boost its ranking"},
+			{"method": "GET", "endpoint": "/api/v1/entities", "description": "Suggest entities with a name or field starting with a prefix"},
+			{"method": "PUT", "endpoint": "/api/v1/entities/{id}", "description": "Create or replace an entity searchable by several fields"},
+			{"method": "DELETE", "endpoint": "/api/v1/entities/{id}", "description": "Delete an entity"},
+			{"method": "GET", "endpoint": "/api/v1/me", "description": "Describe the authenticated user, role, tier and token expiry"},
+			{"method": "DELETE", "endpoint": "/api/v1/me/history", "description": "Clear the caller's personal suggestion history"},
+			{"method": "GET", "endpoint": "/api/v1/changes", "description": "Poll dictionary mutations after a sequence number"},
+			{"method": "GET", "endpoint": "/api/v1/cluster/shards", "description": "Get the shard map of a sharded deployment"},
+			{"method": "GET", "endpoint": "/api/v1/admin/mode", "description": "Get the server mode (admin)"},
+			{"method": "POST", "endpoint": "/api/v1/admin/mode", "description": "Switch between normal, read-only and maintenance mode (admin)"},
+			{"method": "GET", "endpoint": "/api/v1/admin/tiers", "description": "List rate limit tiers and assignments (admin)"},
+			{"method": "PUT", "endpoint": "/api/v1/admin/tiers/{name}", "description": "Create or update a rate limit tier (admin)"},
+			{"method": "DELETE", "endpoint": "/api/v1/admin/tiers/{name}", "description": "Delete an unused rate limit tier (admin)"},
+			{"method": "GET", "endpoint": "/api/v1/admin/consumers", "description": "List API consumers (admin)"},
+			{"method": "GET", "endpoint": "/api/v1/admin/consumers/{name}", "description": "Get an API consumer (admin)"},
+			{"method": "PUT", "endpoint": "/api/v1/admin/consumers/{name}", "description": "Create or update an API consumer's role, tier and dictionaries (admin)"},
+			{"method": "DELETE", "endpoint": "/api/v1/admin/consumers/{name}", "description": "Delete an API consumer (admin)"},
+			{"method": "POST", "endpoint": "/api/v1/admin/consumers/{name}/keys", "description": "Issue an API key for the X-API-Key header (admin)"},
+			{"method": "DELETE", "endpoint": "/api/v1/admin/consumers/{name}/keys/{id}", "description": "Revoke an API key (admin)"},
+			{"method": "PUT", "endpoint": "/api/v1/admin/users/{username}/tier", "description": "Assign a user's rate limit tier (admin)"},
+			{"method": "GET", "endpoint": "/api/v1/admin/quotas", "description": "List dictionary quotas and usage (admin)"},
+			{"method": "PUT", "endpoint": "/api/v1/admin/quotas/{dict}", "description": "Set a dictionary's quota (admin)"},
+			{"method": "GET", "endpoint": "/api/v1/admin/settings", "description": "List dictionary settings (admin)"},
+			{"method": "PUT", "endpoint": "/api/v1/admin/settings/{dict}", "description": "Override a dictionary's normalization and suggestion limits (admin)"},
+			{"method": "POST", "endpoint": "/api/v1/admin/import", "description": "Replace a dictionary with, or merge into it, uploaded words as a new version (admin)"},
+			{"method": "POST", "endpoint": "/api/v1/admin/dicts/{name}/copy", "description": "Copy a dictionary with its metadata and settings in a background job (admin)"},
+			{"method": "POST", "endpoint": "/api/v1/admin/dicts/{name}/rename", "description": "Rename a dictionary in a background job (admin)"},
+			{"method": "GET", "endpoint": "/api/v1/admin/jobs", "description": "List recent background jobs (admin)"},
+			{"method": "GET", "endpoint": "/api/v1/admin/jobs/{id}", "description": "Get the state of a background job (admin)"},
+			{"method": "GET", "endpoint": "/api/v1/admin/versions", "description": "List stored dictionary versions (admin)"},
+			{"method": "POST", "endpoint": "/api/v1/admin/rollback", "description": "Revert a dictionary to a stored version (admin)"},
+			{"method": "GET", "endpoint": "/api/v1/admin/diff", "description": "Compare two dictionary versions (admin)"},
+			{"method": "POST", "endpoint": "/api/v1/admin/diff", "description": "Compare a dictionary version with uploaded words (admin)"},
+			{"method": "GET", "endpoint": "/api/v1/admin/export", "description": "Download a dictionary as a sorted, indexed file for offline clients or as a snapshot (admin)"},
+			{"method": "GET", "endpoint": "/api/v1/admin/cache", "description": "Inspect suggest cache entries (admin)"},
+			{"method": "DELETE", "endpoint": "/api/v1/admin/cache", "description": "Purge suggest cache entries by prefix (admin)"},
+			{"method": "POST", "endpoint": "/api/v1/admin/verify", "description": "Start a job checking cached suggestions against the Trie (admin)"},
+			{"method": "POST", "endpoint": "/api/v1/admin/compact", "description": "Rebuild a dictionary's trie in the background to reclaim deleted nodes (admin)"},
+			{"method": "GET", "endpoint": "/api/v1/admin/compact", "description": "Get the latest compaction result (admin)"},
+			{"method": "GET", "endpoint": "/api/v1/admin/aliases", "description": "List prefix aliases (admin)"},
+			{"method": "PUT", "endpoint": "/api/v1/admin/aliases/{alias}", "description": "Redirect queries under an alias prefix to a canonical prefix (admin)"},
+			{"method": "DELETE", "endpoint": "/api/v1/admin/aliases/{alias}", "description": "Remove a prefix alias (admin)"},
+			{"method": "GET", "endpoint": "/api/v1/admin/stats", "description": "Per-route latency percentiles and dictionary sizes (admin)"},
+			{"method": "GET", "endpoint": "/api/v1/admin/histogram", "description": "Word length and first character distributions (admin)"},
 		},
 	}
 
@@ -96,29 +271,140 @@ func RootHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// AddWords outcomes of a single word.
+const (
+	addInserted  = "inserted"
+	addDuplicate = "duplicate"
+	addRejected  = "rejected"
+)
+
 // AddWordsHandlerV1 adds words to the Trie.
 // @Summary Add words to the Trie
-// @Description Adds words to the Trie
+// @Description Adds words to the Trie and reports the outcome of each: inserted, duplicate (already stored or repeated in the request) or rejected with the validation or quota error. Valid words are added even if others are rejected; the request only fails if every word is rejected. Snippets (a description and icon URL) stored with words are returned by the description and icon fields of suggestions.
 // @Tags words
 // @Accept json
 // @Produce json
+// @Param dict query string false "Dictionary name"
 // @Param words body models.AddWordsRequest true "List of words"
 // @Success 200 {object} models.AddWordsResponse
-// @Failure 400 {object} map[string]string
+// @Failure 400 {object} models.AddWordsResponse
+// @Failure 413 {object} models.AddWordsResponse
 // @Router /api/v1/words [post]
 func AddWordsHandlerV1(w http.ResponseWriter, r *http.Request) {
 	var request models.AddWordsRequest
-	json.NewDecoder(r.Body).Decode(&request)
-	for _, word := range request.Words {
-		trieV1.Insert(strings.ToLower(word))
-		cacheV1.Flush() // Clear cache whenever new words are added
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
 	}
-	w.WriteHeader(http.StatusOK)
-	response := models.AddWordsResponse{
-		Status:  "success",
-		Message: "Words added successfully.",
+	dict := dictionaryFor(r)
+	p := pipelineFor(dict)
+
+	// Hold off other mutations from the quota check until the words are
+	// added, so concurrent requests cannot each fit the quota separately.
+	writeMu.Lock()
+	defer writeMu.Unlock()
+	t := dict.Trie()
+	contextBytes := 0
+	for _, c := range request.Contexts {
+		contextBytes += len(c)
 	}
-	json.NewEncoder(w).Encode(response)
+
+	resp := models.AddWordsResponse{Status: "success", Results: make([]models.AddWordResult, 0, len(request.Words))}
+	reject := func(i int, word, reason string) {
+		resp.Results = append(resp.Results, models.AddWordResult{Index: i, Word: word, Status: addRejected, Reason: reason})
+		resp.Rejected++
+	}
+	var words, displays []string
+	var snippets map[string]trie.Snippet
+	seen := make(map[string]bool)
+	newWords, snippetBytes, overQuota := 0, 0, false
+	for i, text := range request.Words {
+		if reason := validate.Word(text); reason != "" {
+			reject(i, text, reason)
+			continue
+		}
+		snippet, hasSnippet := request.Snippets[text]
+		if field, reason := validate.Snippet(snippet.Description, snippet.Icon); reason != "" {
+			reject(i, text, "snippet "+field+" "+reason)
+			continue
+		}
+		for _, original := range tokenizerFor(dict).Tokenize(text) {
+			word := p.Normalize(original)
+			isNew := !seen[word] && !t.Exists(word)
+			added := newWords
+			if isNew {
+				added++
+			}
+			size := snippetBytes
+			if hasSnippet {
+				size += len(snippet.Description) + len(snippet.Icon)
+			}
+			if err := dict.CheckQuota(added, contextBytes*(len(words)+1)+size); err != nil {
+				reject(i, word, err.Error())
+				overQuota = true
+				continue
+			}
+			newWords, snippetBytes = added, size
+			seen[word] = true
+			words = append(words, word)
+			if hasSnippet {
+				if snippets == nil {
+					snippets = make(map[string]trie.Snippet)
+				}
+				snippets[word] = trie.Snippet{Description: snippet.Description, Icon: snippet.Icon}
+			}
+			if display := displayOf(original); display != "" && display != word {
+				if displays == nil {
+					displays = make([]string, len(words)-1, len(request.Words))
+				}
+				displays = append(displays, display)
+			} else if displays != nil {
+				displays = append(displays, "")
+			}
+			result := models.AddWordResult{Index: i, Word: word, Status: addInserted}
+			if isNew {
+				resp.Inserted++
+			} else {
+				result.Status = addDuplicate
+				resp.Duplicates++
+			}
+			resp.Results = append(resp.Results, result)
+		}
+	}
+	if len(words) == 0 && resp.Rejected > 0 {
+		resp.Status = "error"
+		resp.Message = "All words were rejected."
+		code := http.StatusBadRequest
+		if overQuota {
+			code = http.StatusRequestEntityTooLarge
+		}
+		response.JSON(w, code, resp)
+		return
+	}
+
+	rec := store.Record{Op: store.OpInsert, Words: words, Contexts: request.Contexts, Display: displays, Snippets: snippets}
+	err := loggedLocked(dict, rec, func() {
+		for _, word := range t.InsertWords(words, request.Contexts, displays) {
+			invalidateNegative(dict.Name, word)
+			emit(dict.Name, events.Insert, word)
+		}
+		for word, s := range snippets {
+			t.SetSnippet(word, s)
+		}
+		invalidate() // Clear cache once for the whole batch
+	})
+	if err == nil {
+		err = disown(dict, words)
+	}
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Error logging words: "+err.Error())
+		return
+	}
+	resp.Message = "Words added successfully."
+	if resp.Rejected > 0 {
+		resp.Message = fmt.Sprintf("%d of %d words rejected.", resp.Rejected, len(resp.Results))
+	}
+	response.JSON(w, http.StatusOK, resp)
 }
 
 // ListWordsHandlerV1 retrieves words from the Trie based on the given prefix.
@@ -127,48 +413,333 @@ func AddWordsHandlerV1(w http.ResponseWriter, r *http.Request) {
 // @Tags words
 // @Accept json
 // @Produce json
+// @Produce application/msgpack
+// @Produce application/x-protobuf
+// @Param dict query string false "Dictionary name"
 // @Param prefix query string false "Prefix to search for"
+// @Param context query string false "Context (category, user segment) whose words are boosted"
+// @Param dicts query string false "Merge suggestions from several dictionaries, each with an optional score boost, e.g. products,brands:5"
+// @Param explain query bool false "Break down the score of each result"
+// @Param fields query string false "Return only these fields of each result, e.g. word,score (see models.ScoreExplanation)"
+// @Param fuzzy query int false "Also match prefixes within this many edits; typos between neighbouring keys count as partial edits. Defaults to the dictionary's fuzzy setting"
+// @Param cursor query string false "Continue after the results of a previous response truncated to the response size budget"
+// @Param asOf query string false "Answer from a stored version instead of the live dictionary: a version number, or an RFC 3339 timestamp selecting the newest version stored by then"
+// @Param debug query bool false "Admins only: report how the query was served in X-Debug-* headers"
+// @Param X-Debug-Token header string false "Reports how the query was served in X-Debug-* headers for any caller"
 // @Success 200 {object} models.ListWordsResponse
+// @Success 200 {object} models.SelectedWordsResponse "With fields"
+// @Success 304 {string} string "Not modified since the given ETag"
 // @Failure 400 {object} map[string]string
 // @Router /api/v1/words [get]
 func ListWordsHandlerV1(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
 	prefix := r.URL.Query().Get("prefix")
-	var results []string
-	var count int
-
-	if cachedResult, found := cacheV1.Get(prefix); found {
-		results = cachedResult.([]string)
-		count = len(results)
-	} else {
-		if prefix == "" {
-			results = trieV1.CollectWords(trieV1.Root, "")
-			count = trieV1.CountWords(trieV1.Root)
-		} else {
-			node := trieV1.Root
-			for _, char := range prefix {
-				if _, found := node.Children[char]; !found {
-					results = []string{}
-					count = 0
-					break
-				}
-				node = node.Children[char]
+	context := r.URL.Query().Get("context")
+	if !validField(w, "prefix", prefix) {
+		return
+	}
+	edits, ok := fuzzyEdits(r.URL.Query().Get("fuzzy"))
+	if !ok {
+		response.Error(w, http.StatusBadRequest, "Invalid 'fuzzy' query parameter")
+		return
+	}
+	explain := false
+	if v := r.URL.Query().Get("explain"); v != "" {
+		var err error
+		if explain, err = strconv.ParseBool(v); err != nil {
+			response.Error(w, http.StatusBadRequest, "Invalid 'explain' query parameter")
+			return
+		}
+	}
+	fields, err := response.ParseFields(r.URL.Query().Get("fields"), models.ScoreExplanation{})
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid 'fields' query parameter: "+err.Error())
+		return
+	}
+	if asOf := r.URL.Query().Get("asOf"); asOf != "" {
+		if edits > 0 || r.URL.Query().Get("dicts") != "" {
+			response.Error(w, http.StatusBadRequest, "'asOf' cannot be combined with 'fuzzy' or 'dicts'")
+			return
+		}
+		writePastWords(w, r, dictionaryFor(r), asOf, prefix, context, explain, fields)
+		return
+	}
+	if names := r.URL.Query().Get("dicts"); names != "" {
+		list, err := parseDictionaries(names)
+		if err != nil {
+			response.Error(w, http.StatusBadRequest, "Invalid 'dicts' query parameter: "+err.Error())
+			return
+		}
+		if edits > 0 {
+			response.Error(w, http.StatusBadRequest, "'fuzzy' cannot be combined with 'dicts'")
+			return
+		}
+		merged := make([]*dictionary.Dictionary, len(list))
+		for i, wd := range list {
+			merged[i] = wd.dict
+		}
+		if writeCacheHeaders(w, r, responseBudget, merged...) {
+			return
+		}
+		results, scores := mergedSuggest(list, prefix, context)
+		logQuery(r, names, prefix, start, len(results))
+		results, cursor, ok := pageResults(w, r, results, cursorEpoch(merged...), explain || fields != nil)
+		if !ok {
+			return
+		}
+		if fields != nil {
+			explained := make([]models.ScoreExplanation, len(results))
+			for i, word := range results {
+				explained[i] = scores[word]
 			}
-			if count == 0 {
-				results = trieV1.CollectWords(node, prefix)
-				count = len(results)
+			markTies(explained)
+			writeSelected(w, r, explained, fields, cursor)
+			return
+		}
+		complete, next := mergedNext(list, prefix)
+		shown := make([]string, len(results))
+		for i, word := range results {
+			shown[i] = scores[word].Display
+		}
+		resp := models.ListWordsResponse{
+			Status:    "success",
+			Count:     len(results),
+			Data:      shown,
+			Complete:  complete,
+			NextChars: next,
+			Truncated: cursor != "",
+			Cursor:    cursor,
+		}
+		if explain {
+			resp.Explain = make([]models.ScoreExplanation, len(results))
+			for i, word := range results {
+				resp.Explain[i] = scores[word]
 			}
+			markTies(resp.Explain)
 		}
-		cacheV1.Set(prefix, results, cache.DefaultExpiration)
+		response.Negotiated(w, r, http.StatusOK, resp)
+		return
+	}
+	dict := dictionaryFor(r)
+	if writeCacheHeaders(w, r, responseBudget, dict) {
+		return
+	}
+	t := dict.Trie()
+	prefix = dict.Resolve(queryPrefix(dict, prefix))
+	if r.URL.Query().Get("fuzzy") == "" {
+		edits = min(dict.Settings().Fuzzy, maxFuzzyEdits)
+	}
+	tr := traceFor(r)
+	var results []string
+	if edits > 0 {
+		results = fuzzySuggest(dict, prefix, context, edits, tr)
+	} else {
+		results = suggestTraced(dict, prefix, context, tr)
 	}
+	tr.writeHeaders(w)
+	candidates := results
+	results = capResults(dict, results)
+	count := len(results)
+	if queries != nil {
+		queries.Record(dict.Name, prefix)
+	}
+	logQuery(r, dict.Name, prefix, start, count)
 
-	response := models.ListWordsResponse{
-		Status: "success",
-		Count:  count,
-		Data:   results,
+	// Personal history would reorder fuzzy results regardless of distance.
+	var counts map[string]int
+	if history != nil && edits == 0 {
+		if counts = history.Counts(middleware.Username(r.Context())); counts != nil {
+			// Copy so the shared cached slice is not reordered.
+			results = append([]string(nil), results...)
+			ranking.Blend(rankerFor(dict), t, results, ranking.Query{Prefix: prefix, Context: context}, counts, personalBoost)
+		}
+	}
+	if edits == 0 {
+		shadowRank(dict.Name, t, prefix, context, candidates, results)
+	}
+	results, cursor, ok := pageResults(w, r, results, cursorEpoch(dict), explain || fields != nil)
+	if !ok {
+		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	if fields != nil {
+		writeSelected(w, r, explainScores(rankerFor(dict), t, results, prefix, context, counts, edits), fields, cursor)
+		return
+	}
+	complete, next := nextChars(t, prefix)
+	resp := models.ListWordsResponse{
+		Status:    "success",
+		Count:     len(results),
+		Data:      displayForms(t, results),
+		Complete:  complete,
+		NextChars: next,
+		Truncated: cursor != "",
+		Cursor:    cursor,
+	}
+	if explain {
+		resp.Explain = explainScores(rankerFor(dict), t, results, prefix, context, counts, edits)
+	}
+	response.Negotiated(w, r, http.StatusOK, resp)
+}
+
+// writeSelected writes the selected fields of each result, followed by the
+// cursor continuing after them, if any.
+func writeSelected(w http.ResponseWriter, r *http.Request, results []models.ScoreExplanation, fields response.Fields, cursor string) {
+	response.Negotiated(w, r, http.StatusOK, models.SelectedWordsResponse{
+		Status:    "success",
+		Count:     len(results),
+		Results:   response.Project(results, fields),
+		Truncated: cursor != "",
+		Cursor:    cursor,
+	})
+}
+
+// explainScores breaks down the scores of results as ranked by r for a query
+// on t.
+func explainScores(r ranking.Ranker, t *trie.Trie, results []string, prefix, context string, counts map[string]int, edits int) []models.ScoreExplanation {
+	var distance map[string]float64
+	if edits > 0 {
+		matches := t.FuzzyPrefix(prefix, float64(edits), substitutionCost)
+		distance = make(map[string]float64, len(matches))
+		for _, m := range matches {
+			distance[m.Word] = m.Distance
+		}
+	}
+	q := ranking.Query{Prefix: prefix, Context: context}
+	explained := make([]models.ScoreExplanation, len(results))
+	for i, word := range results {
+		c := ranking.Explain(r, t, word, q)
+		personal := float64(counts[word]) * personalBoost
+		snippet := t.Snippet(word)
+		explained[i] = models.ScoreExplanation{
+			Word:          word,
+			Display:       t.Display(word),
+			Description:   snippet.Description,
+			Icon:          snippet.Icon,
+			Score:         c.Score() + personal,
+			Weight:        c.Weight,
+			ContextBoost:  c.Context,
+			RecencyBoost:  c.Recency,
+			PersonalBoost: personal,
+			FuzzyDistance: distance[word],
+		}
+	}
+	markTies(explained)
+	return explained
+}
+
+// markTies flags the results that tie with the one ranked before them, which
+// ranking.Before then orders by word.
+func markTies(explained []models.ScoreExplanation) {
+	for i := 1; i < len(explained); i++ {
+		prev, e := explained[i-1], &explained[i]
+		e.Tie = e.Score == prev.Score && e.FuzzyDistance == prev.FuzzyDistance && prev.Word < e.Word
+	}
+}
+
+// nextChars reports whether prefix is a word of t and the characters that
+// can follow it, as strings for the response.
+func nextChars(t *trie.Trie, prefix string) (bool, []string) {
+	complete, runes := t.Next(prefix)
+	next := make([]string, len(runes))
+	for i, char := range runes {
+		next[i] = string(char)
+	}
+	return complete, next
+}
+
+// suggest returns the ranked words of dict starting with prefix, consulting
+// the prefix Bloom filters and the negative and positive caches before
+// walking the Trie. The result may be shared with the cache and must not be
+// modified by the caller.
+func suggest(dict *dictionary.Dictionary, prefix, context string) []string {
+	return suggestTraced(dict, prefix, context, nil)
+}
+
+// suggestTraced is suggest recording how the query was served in tr, if
+// not nil.
+func suggestTraced(dict *dictionary.Dictionary, prefix, context string, tr *queryTrace) []string {
+	t := dict.Trie()
+	if belowMinPrefix(dict, prefix) {
+		tr.cache(traceShort)
+		return []string{}
+	}
+	if context == "" {
+		if results, found := hotLookup(dict.Name, prefix); found {
+			tr.cache(traceHot)
+			recordHit()
+			return results
+		}
+	}
+	if !t.MayHavePrefix(prefix) {
+		// Definitely no matches: skip the cache and the Trie entirely.
+		tr.cache(traceFiltered)
+		return []string{}
+	}
+	gen := generation.Load()
+	if _, found := negativeCache.Get(negativeKey(dict.Name, prefix, gen)); found {
+		tr.cache(traceNegative)
+		return []string{}
+	}
+	key := suggestKey(dict, prefix, context).String()
+	if cachedResult, found := cacheV1.Get(key); found {
+		tr.cache(traceHit)
+		recordHit()
+		return cachedResult.([]string)
+	}
+	defer recordMiss(time.Now())
+
+	tr.cache(traceMiss)
+	results := rank(dict, prefix, context, tr.search())
+	if len(results) == 0 {
+		negativeCache.Set(negativeKey(dict.Name, prefix, gen), struct{}{}, cache.DefaultExpiration)
+		return []string{}
+	}
+	cacheV1.Set(key, results, cache.DefaultExpiration)
+	return results
+}
+
+// rank searches the Trie of dict for prefix and returns the matches in ranked
+// order, bypassing every cache. The search is recorded in tr, if not nil.
+func rank(dict *dictionary.Dictionary, prefix, context string, tr *trie.Trace) []string {
+	return rankIn(dict, dict.Trie(), prefix, context, tr)
+}
+
+// rankIn is rank searching t, which need not be the current Trie of dict,
+// with the ranker of dict.
+func rankIn(dict *dictionary.Dictionary, t *trie.Trie, prefix, context string, tr *trie.Trace) []string {
+	results := t.SearchTraced(prefix, 0, tr)
+	if graphemeMatching && prefix != "" {
+		results = graphemePrefixed(results, prefix)
+	}
+	ranking.Order(rankerFor(dict), t, results, ranking.Query{Prefix: prefix, Context: context})
+	return results
+}
+
+// order sorts words in place by the ranker of dict.
+func order(dict *dictionary.Dictionary, words []string, prefix, context string) {
+	ranking.Order(rankerFor(dict), dict.Trie(), words, ranking.Query{Prefix: prefix, Context: context})
+}
+
+// graphemeMatching restricts suggestions to words the prefix matches in whole
+// grapheme clusters.
+var graphemeMatching bool
+
+// SetGraphemeMatching enables or disables grapheme cluster aware matching.
+func SetGraphemeMatching(on bool) {
+	graphemeMatching = on
+}
+
+// graphemePrefixed filters words in place, keeping those that prefix does not
+// end in the middle of a grapheme cluster of.
+func graphemePrefixed(words []string, prefix string) []string {
+	kept := words[:0]
+	for _, word := range words {
+		if grapheme.HasPrefix(word, prefix) {
+			kept = append(kept, word)
+		}
+	}
+	return kept
 }
 
 // DeleteWordsHandlerV1 deletes words from the Trie based on the given request.
@@ -177,6 +748,7 @@ func ListWordsHandlerV1(w http.ResponseWriter, r *http.Request) {
 // @Tags words
 // @Accept json
 // @Produce json
+// @Param dict query string false "Dictionary name"
 // @Param word body models.DeleteWordsRequest true "Word to delete"
 // @Success 200 {object} models.DeleteWordsResponse
 // @Failure 400 {object} map[string]string
@@ -185,16 +757,30 @@ func DeleteWordsHandlerV1(w http.ResponseWriter, r *http.Request) {
 	var request models.DeleteWordsRequest
 	err := json.NewDecoder(r.Body).Decode(&request)
 	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		response.Error(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
-
-	if request.Word == "" {
-		trieV1 = trie.NewTrie() // Clear all words
-		cacheV1.Flush()         // Clear cache
-	} else {
-		trieV1.Delete(request.Word)
-		cacheV1.Delete(request.Word) // Remove from cache
+	if !validField(w, "word", request.Word) {
+		return
+	}
+	dict := dictionaryFor(r)
+	request.Word = canonical(dict, request.Word)
+	rec := store.Record{Op: store.OpClear}
+	if request.Word != "" {
+		rec = store.Record{Op: store.OpDelete, Words: []string{request.Word}}
+	}
+	err = logged(dict, rec, func() {
+		if request.Word == "" {
+			dict.Trie().Clear() // Clear all words
+			emit(dict.Name, events.Clear, "")
+		} else if dict.Trie().Delete(request.Word) {
+			emit(dict.Name, events.Delete, request.Word)
+		}
+		invalidate() // Cached prefixes may include the deleted word(s)
+	})
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Error logging deletion: "+err.Error())
+		return
 	}
 
 	w.WriteHeader(http.StatusOK)
@@ -211,6 +797,7 @@ func DeleteWordsHandlerV1(w http.ResponseWriter, r *http.Request) {
 // @Tags words
 // @Accept json
 // @Produce json
+// @Param dict query string false "Dictionary name"
 // @Param word query string true "Word to check"
 // @Success 200 {object} models.CheckWordExistsResponse
 // @Failure 400 {object} map[string]string
@@ -218,11 +805,15 @@ func DeleteWordsHandlerV1(w http.ResponseWriter, r *http.Request) {
 func WordsExistsHandlerV1(w http.ResponseWriter, r *http.Request) {
 	word := r.URL.Query().Get("word")
 	if word == "" {
-		http.Error(w, "Missing 'word' query parameter", http.StatusBadRequest)
+		response.Error(w, http.StatusBadRequest, "Missing 'word' query parameter")
+		return
+	}
+	if !validField(w, "word", word) {
 		return
 	}
 
-	exists := trieV1.Exists(word)
+	dict := dictionaryFor(r)
+	exists := dict.Trie().Exists(canonical(dict, word))
 
 	response := models.CheckWordExistsResponse{
 		Status: "success",
@@ -232,3 +823,150 @@ func WordsExistsHandlerV1(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
+
+// LongestPrefixHandlerV1 finds the longest word in the Trie that is a prefix of a text.
+// @Summary Find the longest word prefixing a text
+// @Description Returns the longest dictionary word the given text starts with, e.g. for tokenization
+// @Tags words
+// @Accept json
+// @Produce json
+// @Param dict query string false "Dictionary name"
+// @Param text query string true "Text to match"
+// @Success 200 {object} models.LongestPrefixResponse
+// @Failure 400 {object} map[string]string
+// @Router /api/v1/words/longest-prefix [get]
+func LongestPrefixHandlerV1(w http.ResponseWriter, r *http.Request) {
+	text := r.URL.Query().Get("text")
+	if text == "" {
+		response.Error(w, http.StatusBadRequest, "Missing 'text' query parameter")
+		return
+	}
+	if !validField(w, "text", text) {
+		return
+	}
+
+	// Words are stored folded, so the match is a prefix of the folded text
+	dict := dictionaryFor(r)
+	word, found := dict.Trie().LongestPrefix(canonical(dict, text))
+
+	response.JSON(w, http.StatusOK, models.LongestPrefixResponse{
+		Status: "success",
+		Found:  found,
+		Word:   word,
+		Length: utf8.RuneCountInString(word),
+	})
+}
+
+// maxExistsBatch bounds the number of words checked by one batch request.
+const maxExistsBatch = 1000
+
+// BatchExistsHandlerV1 checks whether each of a list of words exists in the Trie.
+// @Summary Check if several words exist in the Trie
+// @Description Checks a list of words in one request and returns whether each exists
+// @Tags words
+// @Accept json
+// @Produce json
+// @Param dict query string false "Dictionary name"
+// @Param words body models.BatchExistsRequest true "Words to check"
+// @Success 200 {object} models.BatchExistsResponse
+// @Failure 400 {object} map[string]string
+// @Router /api/v1/words/exists [post]
+func BatchExistsHandlerV1(w http.ResponseWriter, r *http.Request) {
+	var request models.BatchExistsRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || len(request.Words) == 0 {
+		response.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if len(request.Words) > maxExistsBatch {
+		response.Error(w, http.StatusBadRequest, "Too many words, the limit is "+strconv.Itoa(maxExistsBatch))
+		return
+	}
+	if !validWords(w, "words", request.Words) {
+		return
+	}
+
+	dict := dictionaryFor(r)
+	t, p := dict.Trie(), pipelineFor(dict)
+	exists := make(map[string]bool, len(request.Words))
+	for _, word := range request.Words {
+		exists[word] = t.Exists(p.Normalize(word))
+	}
+
+	response.JSON(w, http.StatusOK, models.BatchExistsResponse{
+		Status: "success",
+		Exists: exists,
+	})
+}
+
+// SelectWordHandlerV1 records that a suggestion was selected, boosting its weight.
+// @Summary Record a selected suggestion
+// @Description Boosts the weight of a word so it ranks higher in suggestions; boosts decay over time
+// @Tags words
+// @Accept json
+// @Produce json
+// @Param dict query string false "Dictionary name"
+// @Param word body models.SelectWordRequest true "Selected word"
+// @Success 200 {object} models.SelectWordResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/words/select [post]
+func SelectWordHandlerV1(w http.ResponseWriter, r *http.Request) {
+	var request models.SelectWordRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Word == "" {
+		response.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if !validField(w, "word", request.Word) {
+		return
+	}
+
+	dict := dictionaryFor(r)
+	word := canonical(dict, request.Word)
+	t := dict.Trie()
+	if !t.Exists(word) {
+		response.Error(w, http.StatusNotFound, "Word not found")
+		return
+	}
+	err := logged(dict, store.Record{Op: store.OpBoost, Words: []string{word}, Amount: 1}, func() {
+		dict.Trie().Boost(word, 1)
+		touchHot(dict.Name, word)
+	})
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Error logging selection: "+err.Error())
+		return
+	}
+	if history != nil {
+		history.Record(middleware.Username(r.Context()), word)
+	}
+	invalidate() // Ranking order may have changed
+
+	response := models.SelectWordResponse{
+		Status: "success",
+		Weight: t.Weight(word),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// ClearHistoryHandlerV1 deletes the authenticated user's personal suggestion history.
+// @Summary Clear personal history
+// @Description Deletes all accepted suggestions recorded for the calling user
+// @Tags personalization
+// @Produce json
+// @Success 200 {object} models.ClearHistoryResponse
+// @Router /api/v1/me/history [delete]
+func ClearHistoryHandlerV1(w http.ResponseWriter, r *http.Request) {
+	if history != nil {
+		history.Clear(middleware.Username(r.Context()))
+		invalidate() // Revalidate personalized responses held by clients
+	}
+
+	response := models.ClearHistoryResponse{
+		Status:  "success",
+		Message: "Personal history cleared.",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
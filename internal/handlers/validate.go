@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/cg011235/autocomplete/internal/response"
+	"github.com/cg011235/autocomplete/internal/trie"
+	"github.com/cg011235/autocomplete/internal/validate"
+	"github.com/cg011235/autocomplete/pkg/models"
+)
+
+// validField writes a 400 validation error and returns false if value is not
+// a valid word or prefix.
+func validField(w http.ResponseWriter, field, value string) bool {
+	if reason := validate.Word(value); reason != "" {
+		response.ValidationError(w, []models.FieldError{{Field: field, Value: value, Reason: reason}})
+		return false
+	}
+	return true
+}
+
+// validWords writes a 400 validation error listing every invalid word and
+// returns false if there is any.
+func validWords(w http.ResponseWriter, field string, words []string) bool {
+	if errs := invalidWords(field, words); len(errs) > 0 {
+		response.ValidationError(w, errs)
+		return false
+	}
+	return true
+}
+
+// invalidWords returns a validation error for every invalid word.
+func invalidWords(field string, words []string) []models.FieldError {
+	var errs []models.FieldError
+	for i, word := range words {
+		if reason := validate.Word(word); reason != "" {
+			errs = append(errs, models.FieldError{Field: field + "[" + strconv.Itoa(i) + "]", Value: word, Reason: reason})
+		}
+	}
+	return errs
+}
+
+// validEntries is validWords for import entries, also checking their snippets.
+func validEntries(w http.ResponseWriter, entries []trie.Entry) bool {
+	if errs := invalidEntries(entries); len(errs) > 0 {
+		response.ValidationError(w, errs)
+		return false
+	}
+	return true
+}
+
+// invalidEntries returns a validation error for every invalid word or
+// snippet of entries.
+func invalidEntries(entries []trie.Entry) []models.FieldError {
+	errs := invalidWords("words", entryWords(entries))
+	for i, e := range entries {
+		if e.Snippet == nil {
+			continue
+		}
+		if field, reason := validate.Snippet(e.Snippet.Description, e.Snippet.Icon); reason != "" {
+			name := "words[" + strconv.Itoa(i) + "].snippet." + field
+			errs = append(errs, models.FieldError{Field: name, Value: e.Word, Reason: reason})
+		}
+	}
+	return errs
+}
+
+// entryWords returns the words of entries.
+func entryWords(entries []trie.Entry) []string {
+	words := make([]string, len(entries))
+	for i, e := range entries {
+		words[i] = e.Word
+	}
+	return words
+}
@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"log"
+	"math/rand"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/cg011235/autocomplete/internal/response"
+	"github.com/cg011235/autocomplete/pkg/models"
+)
+
+const (
+	defaultVerifySample = 100
+	maxVerifySample     = 10000
+	// maxDivergenceResults truncates the result lists of reported divergences.
+	maxDivergenceResults = 20
+)
+
+// Kinds of verified cache entries.
+const (
+	verifyPositive = "positive"
+	verifyNegative = "negative"
+	verifyHot      = "hot"
+)
+
+// verifyTarget is a cached entry selected for verification.
+type verifyTarget struct {
+	kind string
+	// key is the cache key of positive and negative entries.
+	key string
+	k   cacheKey
+}
+
+// VerifyCacheHandler starts a job checking cached suggestions against the Trie.
+// @Summary Verify cached suggestions
+// @Description Starts a job that samples positive, negative and hot cache entries, recomputes each from the Trie and reports those whose results diverge, which points at an invalidation bug. Entries of an older generation or other settings are skipped since they can no longer be served. With purge=true divergent entries are dropped. Poll the returned job for the report.
+// @Tags admin
+// @Produce json
+// @Param dict query string false "Only verify entries of this dictionary"
+// @Param sample query int false "Number of entries to verify (default 100)"
+// @Param purge query bool false "Drop divergent entries"
+// @Success 202 {object} models.JobResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Router /api/v1/admin/verify [post]
+func VerifyCacheHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	sample := defaultVerifySample
+	if v := query.Get("sample"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			response.Error(w, http.StatusBadRequest, "Invalid 'sample' query parameter")
+			return
+		}
+		sample = min(n, maxVerifySample)
+	}
+	purge := false
+	if v := query.Get("purge"); v != "" {
+		var err error
+		if purge, err = strconv.ParseBool(v); err != nil {
+			response.Error(w, http.StatusBadRequest, "Invalid 'purge' query parameter")
+			return
+		}
+	}
+
+	dict := query.Get("dict")
+	job := queueJob("verify", dict, "", func() (func(*models.Job), error) {
+		report := verifyCache(dict, sample, purge)
+		return func(job *models.Job) { job.Verification = &report }, nil
+	})
+	w.Header().Set("Location", "/api/v1/admin/jobs/"+job.ID)
+	response.JSON(w, http.StatusAccepted, models.JobResponse{Status: "success", Job: job})
+}
+
+// verifyCache recomputes up to sample cache entries of the named dictionary,
+// or of all dictionaries if dict is empty, and reports the divergent ones,
+// dropping them if purge is set.
+func verifyCache(dict string, sample int, purge bool) models.VerificationReport {
+	targets := verifyTargets(dict)
+	rand.Shuffle(len(targets), func(i, j int) { targets[i], targets[j] = targets[j], targets[i] })
+	if len(targets) > sample {
+		targets = targets[:sample]
+	}
+
+	report := models.VerificationReport{Divergences: []models.CacheDivergence{}}
+	for _, target := range targets {
+		d, ok := verifyEntry(target, purge)
+		if !ok {
+			report.Skipped++
+			continue
+		}
+		report.Sampled++
+		if d == nil {
+			continue
+		}
+		report.Divergent++
+		if purge {
+			report.Purged++
+		}
+		log.Printf("cache verification: %s entry of %q for prefix %q diverges from the trie", d.Kind, d.Dict, d.Prefix)
+		report.Divergences = append(report.Divergences, *d)
+	}
+	return report
+}
+
+// verifyTargets lists the cached entries of the named dictionary, or of all
+// dictionaries if dict is empty.
+func verifyTargets(dict string) []verifyTarget {
+	var targets []verifyTarget
+	for key := range cacheV1.Items() {
+		if k := parseCacheKey(key); dict == "" || k.Dict == dict {
+			targets = append(targets, verifyTarget{kind: verifyPositive, key: key, k: k})
+		}
+	}
+	for key := range negativeCache.Items() {
+		if k := parseCacheKey(key); dict == "" || k.Dict == dict {
+			targets = append(targets, verifyTarget{kind: verifyNegative, key: key, k: k})
+		}
+	}
+	hot.mu.RLock()
+	for name, lists := range hot.lists {
+		if dict != "" && name != dict {
+			continue
+		}
+		for prefix := range lists {
+			targets = append(targets, verifyTarget{kind: verifyHot, k: cacheKey{Dict: name, Prefix: prefix}})
+		}
+	}
+	hot.mu.RUnlock()
+	return targets
+}
+
+// verifyEntry recomputes a cached entry from the Trie, holding off mutations
+// so the entry and the Trie are compared in the same state. It returns the
+// divergence, or nil if the entry is correct, and false if the entry could
+// not be verified because it is gone or can no longer be served.
+func verifyEntry(target verifyTarget, purge bool) (*models.CacheDivergence, bool) {
+	writeMu.Lock()
+	defer writeMu.Unlock()
+	dict, ok := dicts.Lookup(target.k.Dict)
+	if !ok {
+		return nil, false
+	}
+
+	var cached, expected []string
+	switch target.kind {
+	case verifyPositive:
+		item, found := cacheV1.Get(target.key)
+		if !found || target.k.Generation != generation.Load() || target.k.Options != cacheOptions(dict) {
+			return nil, false
+		}
+		cached = item.([]string)
+		if target.k.Fuzzy > 0 {
+			expected = fuzzyRank(dict, target.k.Prefix, target.k.Context, target.k.Fuzzy)
+		} else {
+			expected = rank(dict, target.k.Prefix, target.k.Context, nil)
+		}
+		if target.k.Limit > 0 && len(expected) > target.k.Limit {
+			expected = expected[:target.k.Limit]
+		}
+	case verifyNegative:
+		if _, found := negativeCache.Get(target.key); !found || target.k.Generation != generation.Load() {
+			return nil, false
+		}
+		cached = []string{}
+		expected = rank(dict, target.k.Prefix, "", nil)
+	case verifyHot:
+		var found bool
+		if cached, found = hotLookup(dict.Name, target.k.Prefix); !found {
+			return nil, false
+		}
+		expected = rank(dict, target.k.Prefix, "", nil)
+	}
+	if slices.Equal(cached, expected) {
+		return nil, true
+	}
+
+	if purge {
+		switch target.kind {
+		case verifyPositive:
+			cacheV1.Delete(target.key)
+		case verifyNegative:
+			negativeCache.Delete(target.key)
+		case verifyHot:
+			removeHotPrefix(dict.Name, target.k.Prefix)
+		}
+	}
+	return &models.CacheDivergence{
+		Kind:     target.kind,
+		Dict:     target.k.Dict,
+		Prefix:   target.k.Prefix,
+		Context:  target.k.Context,
+		Fuzzy:    target.k.Fuzzy,
+		Cached:   truncateResults(cached),
+		Expected: truncateResults(expected),
+	}, true
+}
+
+func truncateResults(results []string) []string {
+	if len(results) > maxDivergenceResults {
+		return results[:maxDivergenceResults]
+	}
+	return nonNil(results)
+}
@@ -0,0 +1,496 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cg011235/autocomplete/internal/dictionary"
+	"github.com/cg011235/autocomplete/internal/events"
+	"github.com/cg011235/autocomplete/internal/importer"
+	"github.com/cg011235/autocomplete/internal/response"
+	"github.com/cg011235/autocomplete/internal/store"
+	"github.com/cg011235/autocomplete/internal/trie"
+	"github.com/cg011235/autocomplete/pkg/models"
+)
+
+// versions persists dictionary versions; nil keeps imports in memory only.
+var versions *store.VersionStore
+
+// SetVersionStore enables on-disk versioning of imported dictionaries.
+func SetVersionStore(s *store.VersionStore) {
+	versions = s
+}
+
+// ResetDictionaries drops every dictionary held in memory along with its
+// precomputed hot prefixes and loaded past versions, and advances the cache
+// generation, so a service started again in the same process serves only
+// what LoadLatestVersions restores.
+func ResetDictionaries() {
+	writeMu.Lock()
+	defer writeMu.Unlock()
+	dicts = dictionary.NewRegistry(dictionary.Quota{})
+	hot.mu.Lock()
+	hot.lists = nil
+	hot.mu.Unlock()
+	pastTries.Flush()
+	invalidate()
+}
+
+// LoadLatestVersions restores every dictionary's settings and its words from
+// its newest stored version or, with the write-ahead log enabled, from the
+// version its log is based on followed by the logged mutations. The log is
+// authoritative whenever that version is still stored: every version the
+// server installs resets the log, so a newer version with an older log was
+// written by an install that did not complete and was never acknowledged.
+//
+// Snapshot checksums, the log's record sequence and the loaded Trie's
+// invariants are verified, failing on damage. With repair, a corrupt
+// snapshot is replaced by the newest intact older version (discarding its
+// log), a corrupt log is truncated before the first damaged record and a
+// damaged Trie is rebuilt; everything dropped is logged.
+func LoadLatestVersions(repair bool) error {
+	if versions == nil {
+		return nil
+	}
+	names, err := versions.Dictionaries()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		var settings dictionary.Settings
+		if found, err := versions.LoadSettings(name, &settings); err != nil {
+			return fmt.Errorf("loading settings of %q: %w", name, err)
+		} else if found {
+			dicts.Get(name).SetSettings(settings)
+		}
+		var aliases map[string]string
+		if _, err := versions.LoadDictState(name, aliasesState, &aliases); err != nil {
+			return fmt.Errorf("loading aliases of %q: %w", name, err)
+		}
+		for alias, target := range aliases {
+			dicts.Get(name).SetAlias(alias, target)
+		}
+		var entities dictionary.EntityState
+		if found, err := versions.LoadDictState(name, entitiesState, &entities); err != nil {
+			return fmt.Errorf("loading entities of %q: %w", name, err)
+		} else if found {
+			dicts.Get(name).SetEntities(entities)
+		}
+		list, err := versions.List(name)
+		if err != nil {
+			return err
+		}
+		base := 0
+		if len(list) > 0 {
+			base = list[len(list)-1].Version
+		}
+		hasLog, discardLog := false, false
+		if walEnabled.Load() {
+			switch logBase, err := versions.LogBase(name); {
+			case err == nil && (logBase == 0 || slices.ContainsFunc(list, func(v store.VersionInfo) bool { return v.Version == logBase })):
+				if logBase < base {
+					log.Printf("version %d of %q is newer than its log and was never served, loading version %d and the log", base, name, logBase)
+				}
+				base, hasLog = logBase, true
+			case err == nil:
+				log.Printf("version %d that the log of %q is based on is gone, discarding the log", logBase, name)
+				discardLog = true
+			case !errors.Is(err, store.ErrNoLog):
+				return err
+			}
+		}
+
+		t := trie.NewTrie()
+		if base > 0 {
+			entries, err := versions.Load(name, base)
+			if errors.Is(err, store.ErrSnapshotCorrupt) && repair {
+				corrupt := base
+				entries, base, err = loadIntact(name, list, base)
+				if err == nil {
+					log.Printf("repair: version %d of %q is corrupt, loaded version %d and discarded the mutations logged since", corrupt, name, base)
+					hasLog, discardLog = false, walEnabled.Load()
+				}
+			}
+			if err != nil {
+				return repairHint(err, store.ErrSnapshotCorrupt)
+			}
+			t = trie.FromEntries(entries)
+		}
+		replayed := 0
+		if hasLog {
+			l, cut, err := versions.ReplayLog(name, walSync, repair, func(rec store.Record) {
+				applyRecord(t, rec)
+				replayed++
+			})
+			if err != nil {
+				return repairHint(err, store.ErrLogCorrupt)
+			}
+			if cut != nil {
+				log.Printf("truncated log of %q at offset %d, dropping %d bytes: %s", name, cut.Offset, cut.Bytes, cut.Reason)
+			}
+			logs[name] = l
+		}
+		if problems := t.Check(); len(problems) > 0 {
+			if !repair {
+				return fmt.Errorf("dictionary %q fails its integrity check: %s (start with --repair to rebuild it)", name, strings.Join(problems, "; "))
+			}
+			t = trie.FromEntries(t.Entries())
+			log.Printf("repair: rebuilt dictionary %q: %s", name, strings.Join(problems, "; "))
+		}
+		dict := dicts.Get(name)
+		// Entity terms added since the version are lost without a log
+		var missing []string
+		for _, term := range dict.EntityTerms() {
+			if !t.Exists(term) {
+				missing = append(missing, term)
+			}
+		}
+		t.InsertWords(missing, nil, nil)
+		dict.Swap(t, base)
+		dict.Applied(uint64(replayed))
+		if discardLog {
+			if err := resetLog(dict, base); err != nil {
+				return err
+			}
+		}
+		log.Printf("loaded dictionary %q version %d with %d logged mutations (%d words)", name, base, replayed, t.Len())
+	}
+	return nil
+}
+
+// loadIntact loads the newest version of dict older than before that is not
+// corrupt, or no entries if there is none.
+func loadIntact(dict string, list []store.VersionInfo, before int) ([]trie.Entry, int, error) {
+	for i := len(list) - 1; i >= 0; i-- {
+		if list[i].Version >= before {
+			continue
+		}
+		entries, err := versions.Load(dict, list[i].Version)
+		if errors.Is(err, store.ErrSnapshotCorrupt) {
+			continue
+		}
+		return entries, list[i].Version, err
+	}
+	return nil, 0, nil
+}
+
+// repairHint suggests --repair for errors it can fix.
+func repairHint(err, repairable error) error {
+	if errors.Is(err, repairable) {
+		return fmt.Errorf("%w (start with --repair to recover)", err)
+	}
+	return err
+}
+
+// ImportHandler replaces a dictionary with the uploaded words in one atomic
+// swap, or merges them into it. With dryRun=true it only reports what the
+// import would do.
+// @Summary Import a dictionary
+// @Description Builds a new Trie from a JSON import request or a text body (one word per line, a hunspell .dic file or a word<TAB>count frequency list), stores it as a new version and swaps it in atomically. With mode=merge the words are added to the current dictionary instead of replacing it. Words that already exist, or repeat within the import, are resolved by the conflict policy and listed in the summary. With dryRun=true nothing is changed: every invalid word, conflict and the quota impact are reported with valid=false instead of failing the request.
+// @Tags admin
+// @Accept json
+// @Accept plain
+// @Produce json
+// @Param dict query string false "Dictionary name"
+// @Param mode query string false "replace (default) or merge"
+// @Param conflict query string false "skip (default), replace, sum or error"
+// @Param format query string false "Text body format: words (default), hunspell or frequency"
+// @Param dryRun query bool false "Validate the import and report its effect without changing the dictionary"
+// @Param words body models.ImportRequest true "Words to import"
+// @Success 200 {object} models.ImportResponse
+// @Failure 400 {object} map[string]string
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 413 {object} map[string]string
+// @Router /api/v1/admin/import [post]
+func ImportHandler(w http.ResponseWriter, r *http.Request) {
+	mode := r.URL.Query().Get("mode")
+	if mode != "" && mode != "replace" && mode != "merge" {
+		response.Error(w, http.StatusBadRequest, "Invalid 'mode' query parameter")
+		return
+	}
+	policy, err := importer.ParsePolicy(r.URL.Query().Get("conflict"))
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid 'conflict' query parameter")
+		return
+	}
+	dryRun := false
+	if raw := r.URL.Query().Get("dryRun"); raw != "" {
+		if dryRun, err = strconv.ParseBool(raw); err != nil {
+			response.Error(w, http.StatusBadRequest, "Invalid 'dryRun' query parameter")
+			return
+		}
+	}
+	request, err := decodeImport(r)
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	dict := dictionaryFor(r)
+	incoming := importEntries(dict, request)
+	if dryRun {
+		response.JSON(w, http.StatusOK, importReport(dict, mode, policy, incoming))
+		return
+	}
+	if !validEntries(w, incoming) {
+		return
+	}
+
+	writeMu.Lock()
+	defer writeMu.Unlock()
+	var base []trie.Entry
+	if mode == "merge" {
+		base = dict.Trie().Entries()
+	}
+	merged := importer.Merge(base, incoming, policy)
+	if policy == importer.Error && len(merged.Conflicts) > 0 {
+		errs := make([]models.FieldError, 0, len(merged.Conflicts))
+		for _, c := range merged.Conflicts {
+			errs = append(errs, models.FieldError{Field: "words", Value: c.Word, Reason: "already exists"})
+		}
+		response.JSON(w, http.StatusConflict, models.ErrorResponse{
+			Status:  "error",
+			Message: "Import conflicts with existing words",
+			Errors:  errs,
+		})
+		return
+	}
+
+	t, version, err := install(dict, merged.Entries)
+	var quotaErr *dictionary.QuotaError
+	if errors.As(err, &quotaErr) {
+		response.Error(w, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	}
+	if err == nil {
+		err = disown(dict, entryWords(incoming))
+	}
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Error "+err.Error())
+		return
+	}
+
+	resp := models.ImportResponse{
+		Status:    "success",
+		Dict:      dict.Name,
+		Version:   version,
+		Words:     t.Len(),
+		Added:     merged.Added,
+		Conflicts: make([]models.ImportConflict, 0, len(merged.Conflicts)),
+		Valid:     true,
+	}
+	for _, c := range merged.Conflicts {
+		resp.Conflicts = append(resp.Conflicts, models.ImportConflict{Word: c.Word, Action: string(c.Action)})
+	}
+	response.JSON(w, http.StatusOK, resp)
+}
+
+// importReport validates an import and computes its result against the
+// current dictionary without changing it, for ImportHandler's dry-run mode.
+func importReport(dict *dictionary.Dictionary, mode string, policy importer.Policy, incoming []trie.Entry) models.ImportResponse {
+	current := dict.Trie()
+	var base []trie.Entry
+	if mode == "merge" {
+		base = current.Entries()
+	}
+	merged := importer.Merge(base, incoming, policy)
+	t := trie.FromEntries(merged.Entries)
+	quota := dict.Quota()
+
+	resp := models.ImportResponse{
+		Status:    "success",
+		Dict:      dict.Name,
+		Version:   dict.Version(),
+		Words:     t.Len(),
+		Added:     merged.Added,
+		Conflicts: make([]models.ImportConflict, 0, len(merged.Conflicts)),
+		DryRun:    true,
+		Invalid:   invalidEntries(incoming),
+		Quota: &models.ImportQuota{
+			Words:            current.Len(),
+			MetadataBytes:    current.MetadataBytes(),
+			NewWords:         t.Len(),
+			NewMetadataBytes: t.MetadataBytes(),
+			MaxWords:         quota.MaxWords,
+			MaxMetadataBytes: quota.MaxMetadataBytes,
+		},
+	}
+	for _, c := range merged.Conflicts {
+		resp.Conflicts = append(resp.Conflicts, models.ImportConflict{Word: c.Word, Action: string(c.Action)})
+	}
+	if err := dict.CheckSize(t.Len(), t.MetadataBytes()); err != nil {
+		resp.Quota.Error = err.Error()
+	}
+	resp.Valid = len(resp.Invalid) == 0 && resp.Quota.Error == "" &&
+		(policy != importer.Error || len(merged.Conflicts) == 0)
+	return resp
+}
+
+// decodeImport reads an import body as JSON or, for text/plain, in the text
+// format named by the format query parameter: one word per line by default,
+// a hunspell .dic file or a frequency list.
+func decodeImport(r *http.Request) (*models.ImportRequest, error) {
+	var request models.ImportRequest
+	format := r.URL.Query().Get("format")
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "text/plain") || format != "" {
+		if format == "" {
+			format = importer.FormatWords
+		}
+		entries, err := importer.Parse(r.Body, format)
+		for _, e := range entries {
+			request.Entries = append(request.Entries, models.WordEntry{Word: e.Word, Weight: e.Weight})
+		}
+		return &request, err
+	}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	return &request, err
+}
+
+// importEntries returns the entries of an import request to dict, folded
+// and in upload order, with variants of the same word merged.
+func importEntries(dict *dictionary.Dictionary, request *models.ImportRequest) []trie.Entry {
+	entries := make([]trie.Entry, 0, len(request.Words)+len(request.Entries))
+	for _, word := range request.Words {
+		entries = append(entries, trie.Entry{Word: word, Contexts: request.Contexts})
+	}
+	for _, e := range request.Entries {
+		entry := trie.Entry{Word: e.Word, Weight: e.Weight, Contexts: e.Contexts}
+		if e.Snippet != nil {
+			entry.Snippet = &trie.Snippet{Description: e.Snippet.Description, Icon: e.Snippet.Icon}
+		}
+		entries = append(entries, entry)
+	}
+	return canonicalEntries(dict, entries)
+}
+
+// install builds a Trie from entries, along with the terms the dictionary's
+// entities are indexed under, stores it as a new version and swaps it in. It
+// returns a *dictionary.QuotaError if the Trie is too large. The caller must
+// hold writeMu.
+func install(dict *dictionary.Dictionary, entries []trie.Entry) (*trie.Trie, int, error) {
+	entries = withEntityTerms(dict, entries)
+	t := trie.FromEntries(entries)
+	if err := dict.CheckSize(t.Len(), t.MetadataBytes()); err != nil {
+		return nil, 0, err
+	}
+	version := 0
+	if versions != nil {
+		var err error
+		if version, err = versions.Save(dict.Name, entries); err != nil {
+			return nil, 0, fmt.Errorf("storing version: %w", err)
+		}
+	}
+	swap(dict, t, version)
+	if err := resetLog(dict, version); err != nil {
+		return t, version, fmt.Errorf("resetting log: %w", err)
+	}
+	return t, version, nil
+}
+
+// swap installs t as the dictionary's Trie and notifies caches and sinks.
+func swap(dict *dictionary.Dictionary, t *trie.Trie, version int) {
+	dict.Swap(t, version)
+	emit(dict.Name, events.Swap, "")
+	invalidate()
+	negativeCache.Flush() // The new Trie may match previously empty prefixes
+}
+
+// ListVersionsHandler lists the stored versions of a dictionary.
+// @Summary List dictionary versions
+// @Description Returns the versions kept on disk and the version currently served
+// @Tags admin
+// @Produce json
+// @Param dict query string false "Dictionary name"
+// @Success 200 {object} models.VersionsResponse
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/admin/versions [get]
+func ListVersionsHandler(w http.ResponseWriter, r *http.Request) {
+	if versions == nil {
+		response.Error(w, http.StatusNotFound, "Versioning is disabled")
+		return
+	}
+	dict := dictionaryFor(r)
+	list, err := versions.List(dict.Name)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Error listing versions: "+err.Error())
+		return
+	}
+
+	resp := models.VersionsResponse{
+		Status:   "success",
+		Dict:     dict.Name,
+		Current:  dict.Version(),
+		Versions: make([]models.VersionInfo, 0, len(list)),
+	}
+	for _, v := range list {
+		resp.Versions = append(resp.Versions, models.VersionInfo{
+			Version:    v.Version,
+			Created:    v.Created.UTC().Format(time.RFC3339),
+			Bytes:      v.Size,
+			Compaction: v.Compaction,
+		})
+	}
+	response.JSON(w, http.StatusOK, resp)
+}
+
+// RollbackHandler reverts a dictionary to a stored version.
+// @Summary Roll back a dictionary
+// @Description Loads a stored version, stores its words again as a new version so the rollback survives restarts and is what replicas load, and swaps it in atomically
+// @Tags admin
+// @Produce json
+// @Param dict query string false "Dictionary name"
+// @Param version query int true "Version to restore"
+// @Success 200 {object} models.DictionaryVersionResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 413 {object} map[string]string
+// @Router /api/v1/admin/rollback [post]
+func RollbackHandler(w http.ResponseWriter, r *http.Request) {
+	if versions == nil {
+		response.Error(w, http.StatusNotFound, "Versioning is disabled")
+		return
+	}
+	version, err := strconv.Atoi(r.URL.Query().Get("version"))
+	if err != nil || version <= 0 {
+		response.Error(w, http.StatusBadRequest, "Invalid 'version' query parameter")
+		return
+	}
+
+	dict := dictionaryFor(r)
+	entries, err := versions.Load(dict.Name, version)
+	if errors.Is(err, store.ErrVersionNotFound) {
+		response.Error(w, http.StatusNotFound, "Version not found")
+		return
+	}
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Error loading version: "+err.Error())
+		return
+	}
+
+	writeMu.Lock()
+	defer writeMu.Unlock()
+	t, current, err := install(dict, entries)
+	var quotaErr *dictionary.QuotaError
+	if errors.As(err, &quotaErr) {
+		response.Error(w, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	}
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "Error "+err.Error())
+		return
+	}
+
+	response.JSON(w, http.StatusOK, models.DictionaryVersionResponse{
+		Status:       "success",
+		Dict:         dict.Name,
+		Version:      current,
+		Words:        t.Len(),
+		RestoredFrom: version,
+	})
+}
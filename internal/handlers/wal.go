@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cg011235/autocomplete/internal/dictionary"
+	"github.com/cg011235/autocomplete/internal/store"
+	"github.com/cg011235/autocomplete/internal/trie"
+)
+
+var (
+	// writeMu serializes mutations so they are applied in the order they are
+	// logged, and keeps them out while a dictionary is snapshotted or replaced.
+	writeMu sync.Mutex
+
+	// walEnabled logs every mutation to the version store before applying
+	// it. It is switched under writeMu but also read by queries.
+	walEnabled atomic.Bool
+	walSync    bool
+	logs       = map[string]*store.Log{}
+)
+
+// SetWriteAheadLog enables logging mutations to a write-ahead log in the
+// version store, replayed on startup; sync fsyncs after every record. It must
+// be called after SetVersionStore and before LoadLatestVersions.
+func SetWriteAheadLog(sync bool) {
+	walEnabled.Store(versions != nil)
+	walSync = sync
+}
+
+// logged appends rec to the write-ahead log of dict, then applies it.
+func logged(dict *dictionary.Dictionary, rec store.Record, apply func()) error {
+	writeMu.Lock()
+	defer writeMu.Unlock()
+	return loggedLocked(dict, rec, apply)
+}
+
+// loggedLocked is logged for callers that decide on rec holding writeMu,
+// e.g. checking it against the dictionary's quota.
+func loggedLocked(dict *dictionary.Dictionary, rec store.Record, apply func()) error {
+	if walEnabled.Load() {
+		l, ok := logs[dict.Name]
+		if !ok {
+			var err error
+			if l, err = versions.ResetLog(dict.Name, dict.Version(), walSync); err != nil {
+				return err
+			}
+			logs[dict.Name] = l
+		}
+		if err := l.Append(rec); err != nil {
+			return err
+		}
+	}
+	apply()
+	dict.Applied(1)
+	return nil
+}
+
+// CloseWriteAheadLogs closes the write-ahead logs and stops logging, so the
+// version store can be reopened by another process. Mutations applied
+// afterwards are not durable.
+func CloseWriteAheadLogs() {
+	writeMu.Lock()
+	defer writeMu.Unlock()
+	for name, l := range logs {
+		if err := l.Close(); err != nil {
+			log.Printf("closing write-ahead log of %q: %v", name, err)
+		}
+		delete(logs, name)
+	}
+	walEnabled.Store(false)
+}
+
+// ReopenWriteAheadLogs resumes logging after CloseWriteAheadLogs, appending
+// to the logs left on disk. It must only be called when this process is the
+// only one writing to them again.
+func ReopenWriteAheadLogs() error {
+	writeMu.Lock()
+	defer writeMu.Unlock()
+	if versions == nil {
+		return nil
+	}
+	for _, dict := range dicts.List() {
+		l, _, err := versions.ReplayLog(dict.Name, walSync, false, func(store.Record) {})
+		if errors.Is(err, store.ErrNoLog) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("reopening log of %q: %w", dict.Name, err)
+		}
+		logs[dict.Name] = l
+	}
+	walEnabled.Store(true)
+	return nil
+}
+
+// resetLog starts an empty log for dict after it was replaced by version.
+// The caller must hold writeMu.
+func resetLog(dict *dictionary.Dictionary, version int) error {
+	if !walEnabled.Load() {
+		return nil
+	}
+	if l, ok := logs[dict.Name]; ok {
+		l.Close()
+		delete(logs, dict.Name)
+	}
+	l, err := versions.ResetLog(dict.Name, version, walSync)
+	if err != nil {
+		return err
+	}
+	logs[dict.Name] = l
+	return nil
+}
+
+// applyRecord replays a logged mutation onto t.
+func applyRecord(t *trie.Trie, rec store.Record) {
+	switch rec.Op {
+	case store.OpInsert:
+		t.InsertWords(rec.Words, rec.Contexts, rec.Display)
+		for word, s := range rec.Snippets {
+			t.SetSnippet(word, s)
+		}
+	case store.OpDelete:
+		for _, word := range rec.Words {
+			t.Delete(word)
+		}
+	case store.OpClear:
+		t.Clear()
+	case store.OpBoost:
+		for _, word := range rec.Words {
+			t.Boost(word, rec.Amount)
+		}
+	case store.OpDecay:
+		t.Decay(rec.Amount)
+	}
+}
+
+// Decay multiplies the word weights of every dictionary by factor. Each pass
+// is logged like any other mutation so replaying the log after a restart
+// restores the decayed weights rather than those of the last snapshot.
+func Decay(factor float64) {
+	for _, dict := range dicts.List() {
+		err := logged(dict, store.Record{Op: store.OpDecay, Amount: factor}, func() {
+			dict.Trie().Decay(factor)
+		})
+		if err != nil {
+			log.Printf("decaying dictionary %q: %v", dict.Name, err)
+		}
+	}
+}
+
+// compact snapshots dict as a new version and truncates its log, bounding
+// replay time and disk usage. Mutations wait while the snapshot is written.
+func compact(dict *dictionary.Dictionary) (int, error) {
+	writeMu.Lock()
+	defer writeMu.Unlock()
+	t := dict.Trie()
+	version, err := versions.SaveCompaction(dict.Name, t.Entries())
+	if err != nil {
+		return 0, err
+	}
+	dict.Swap(t, version)
+	return version, resetLog(dict, version)
+}
+
+// RunCompactor snapshots every dictionary whose log has grown beyond
+// minBytes, checking every interval until ctx is done.
+func RunCompactor(ctx context.Context, interval time.Duration, minBytes int64) {
+	if !walEnabled.Load() || interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for _, dict := range dicts.List() {
+			writeMu.Lock()
+			l, ok := logs[dict.Name]
+			writeMu.Unlock()
+			if !ok || l.Size() == 0 || l.Size() < minBytes {
+				continue
+			}
+			start := time.Now()
+			version, err := compact(dict)
+			if err != nil {
+				log.Printf("compacting dictionary %q: %v", dict.Name, err)
+				continue
+			}
+			log.Printf("snapshotted dictionary %q as version %d in %s", dict.Name, version, time.Since(start))
+		}
+	}
+}
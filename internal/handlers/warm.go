@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"log"
+	"time"
+
+	"github.com/cg011235/autocomplete/internal/analytics"
+)
+
+// queries counts suggest requests per dictionary and prefix; nil disables recording.
+var queries *analytics.Popular
+
+// SetQueryAnalytics enables recording of popular suggest queries.
+func SetQueryAnalytics(p *analytics.Popular) {
+	queries = p
+}
+
+// WarmCache pre-populates the suggest cache with the n most popular recorded
+// queries, so the first requests after a deploy do not all miss.
+func WarmCache(n int) {
+	if queries == nil || n <= 0 {
+		return
+	}
+	start := time.Now()
+	top := queries.Top(n)
+	for _, q := range top {
+		suggest(dicts.Get(q.Dict), q.Prefix, "")
+	}
+	log.Printf("warmed cache with %d popular prefixes in %s", len(top), time.Since(start))
+}
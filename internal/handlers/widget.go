@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cg011235/autocomplete/internal/response"
+)
+
+var (
+	// widgetDictionaries are the dictionaries the widget endpoint serves;
+	// the first is used when a request names none.
+	widgetDictionaries []string
+	// widgetLimit and widgetMaxLimit are the default and maximum number of
+	// suggestions returned to widgets.
+	widgetLimit    = 8
+	widgetMaxLimit = 20
+)
+
+// SetWidget configures the widget endpoint to serve the given dictionaries,
+// returning limit suggestions unless a request asks for up to maxLimit.
+func SetWidget(dicts []string, limit, maxLimit int) {
+	widgetDictionaries = dicts
+	widgetLimit = limit
+	widgetMaxLimit = maxLimit
+}
+
+// WidgetSuggestHandler serves suggestions to browser widgets without
+// authentication, as a bare JSON array of words to keep payloads small.
+// @Summary Suggest words for browser widgets
+// @Description Returns the top suggestions for a prefix as a JSON array; only designated dictionaries are served
+// @Tags widget
+// @Produce json
+// @Param q query string true "Prefix typed so far"
+// @Param dict query string false "Dictionary name, one of the widget dictionaries"
+// @Param limit query int false "Number of suggestions"
+// @Success 200 {array} string
+// @Success 304 {string} string "Not modified since the given ETag"
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 429 {object} map[string]string
+// @Router /widget/suggest [get]
+func WidgetSuggestHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	if len(widgetDictionaries) == 0 {
+		response.Error(w, http.StatusNotFound, "Widget endpoint is disabled")
+		return
+	}
+	query := r.URL.Query()
+	name := query.Get("dict")
+	if name == "" {
+		name = widgetDictionaries[0]
+	}
+	served := false
+	for _, d := range widgetDictionaries {
+		served = served || d == name
+	}
+	if !served {
+		response.Error(w, http.StatusNotFound, "Unknown dictionary")
+		return
+	}
+	limit := widgetLimit
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			response.Error(w, http.StatusBadRequest, "Invalid 'limit' query parameter")
+			return
+		}
+		limit = min(n, widgetMaxLimit)
+	}
+	prefix := query.Get("q")
+	if prefix == "" {
+		response.Error(w, http.StatusBadRequest, "Missing 'q' query parameter")
+		return
+	}
+	if !validField(w, "q", prefix) {
+		return
+	}
+	dict := dicts.Get(name)
+	if writeCacheHeaders(w, r, limit, dict) {
+		return
+	}
+
+	prefix = dict.Resolve(queryPrefix(dict, prefix))
+	if queries != nil {
+		queries.Record(dict.Name, prefix)
+	}
+	results := capResults(dict, suggest(dict, prefix, ""))
+	results = results[:min(limit, len(results))]
+	logQuery(r, dict.Name, prefix, start, len(results))
+	response.JSON(w, http.StatusOK, displayForms(dict.Trie(), results))
+}
@@ -0,0 +1,111 @@
+package importer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/cg011235/autocomplete/internal/trie"
+)
+
+// Import body formats.
+const (
+	// FormatWords is one word per line.
+	FormatWords = "words"
+	// FormatHunspell is a hunspell/myspell .dic file: an approximate word
+	// count on the first line, then one stem per line with optional /FLAGS
+	// and morphological fields. Affix flags are not expanded.
+	FormatHunspell = "hunspell"
+	// FormatFrequency is a frequency list with a word and its count per line,
+	// separated by a tab or, failing that, the last run of whitespace. The
+	// count becomes the word's weight.
+	FormatFrequency = "frequency"
+)
+
+// Parse reads entries from r in the given text format.
+func Parse(r io.Reader, format string) ([]trie.Entry, error) {
+	var parse func(line string) (trie.Entry, bool, error)
+	switch format {
+	case FormatWords:
+		parse = parseWord
+	case FormatHunspell:
+		parse = parseHunspell
+	case FormatFrequency:
+		parse = parseFrequency
+	default:
+		return nil, fmt.Errorf("unknown import format %q", format)
+	}
+
+	var entries []trie.Entry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if n == 1 {
+			line = strings.TrimPrefix(line, "\ufeff")
+			if format == FormatHunspell {
+				if _, err := strconv.Atoi(strings.TrimSpace(line)); err == nil {
+					continue // The approximate word count.
+				}
+			}
+		}
+		e, ok, err := parse(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		if ok {
+			entries = append(entries, e)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+func parseWord(line string) (trie.Entry, bool, error) {
+	word := strings.TrimSpace(line)
+	return trie.Entry{Word: word}, word != "", nil
+}
+
+func parseHunspell(line string) (trie.Entry, bool, error) {
+	// Lines starting with whitespace are comments in some dictionaries.
+	if line == "" || unicode.IsSpace(rune(line[0])) || strings.HasPrefix(line, "#") {
+		return trie.Entry{}, false, nil
+	}
+	var word strings.Builder
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		if c == '\\' && i+1 < len(line) && line[i+1] == '/' {
+			word.WriteByte('/')
+			i++
+			continue
+		}
+		// Flags follow a slash; morphological fields follow a tab or space.
+		if c == '/' || c == '\t' || c == ' ' {
+			break
+		}
+		word.WriteByte(c)
+	}
+	return trie.Entry{Word: word.String()}, word.Len() > 0, nil
+}
+
+func parseFrequency(line string) (trie.Entry, bool, error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return trie.Entry{}, false, nil
+	}
+	i := strings.LastIndexByte(line, '\t')
+	if i < 0 {
+		i = strings.LastIndexFunc(line, unicode.IsSpace)
+	}
+	if i < 0 {
+		return trie.Entry{}, false, fmt.Errorf("expected word and count, got %q", line)
+	}
+	count, err := strconv.ParseFloat(strings.TrimSpace(line[i+1:]), 64)
+	if err != nil {
+		return trie.Entry{}, false, fmt.Errorf("invalid count in %q", line)
+	}
+	word := strings.TrimSpace(line[:i])
+	return trie.Entry{Word: word, Weight: count}, word != "", nil
+}
@@ -0,0 +1,133 @@
+// Package importer turns uploaded word lists into dictionary entries.
+package importer
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/cg011235/autocomplete/internal/trie"
+)
+
+// Policy decides what happens when an imported word already exists, either in
+// the dictionary being merged into or earlier in the same import.
+type Policy string
+
+// Conflict policies.
+const (
+	// Skip keeps the existing entry and ignores the imported one.
+	Skip Policy = "skip"
+	// Replace overwrites the existing weight and contexts.
+	Replace Policy = "replace"
+	// Sum adds the weights and merges the contexts.
+	Sum Policy = "sum"
+	// Error rejects the whole import.
+	Error Policy = "error"
+)
+
+// ParsePolicy returns the policy named s, defaulting to Skip when s is empty.
+func ParsePolicy(s string) (Policy, error) {
+	switch p := Policy(s); p {
+	case "":
+		return Skip, nil
+	case Skip, Replace, Sum, Error:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown conflict policy %q", s)
+	}
+}
+
+// Conflict reports how an already existing word was resolved.
+type Conflict struct {
+	Word   string
+	Action Policy
+}
+
+// Result summarizes a merge.
+type Result struct {
+	Entries   []trie.Entry
+	Added     int
+	Conflicts []Conflict
+}
+
+// Merge applies incoming on top of base, resolving words present in both, or
+// repeated within incoming, with p. The returned entries are sorted by word.
+// With the Error policy nothing is merged and every conflict is returned.
+func Merge(base, incoming []trie.Entry, p Policy) Result {
+	m := NewMerger(base, p)
+	m.Add(incoming)
+	return m.Result()
+}
+
+// Merger is Merge for incoming entries that arrive in batches. It holds only
+// the merged entries, so repeated words cost nothing beyond the first.
+type Merger struct {
+	policy Policy
+	merged map[string]trie.Entry
+	res    Result
+}
+
+// NewMerger returns a Merger applying batches on top of base with p.
+func NewMerger(base []trie.Entry, p Policy) *Merger {
+	m := &Merger{policy: p, merged: make(map[string]trie.Entry, len(base))}
+	for _, e := range base {
+		m.merged[e.Word] = e
+	}
+	return m
+}
+
+// Add merges the next batch of incoming entries.
+func (m *Merger) Add(incoming []trie.Entry) {
+	for _, e := range incoming {
+		existing, ok := m.merged[e.Word]
+		if !ok {
+			m.merged[e.Word] = e
+			m.res.Added++
+			continue
+		}
+		m.res.Conflicts = append(m.res.Conflicts, Conflict{Word: e.Word, Action: m.policy})
+		switch m.policy {
+		case Replace:
+			m.merged[e.Word] = e
+		case Sum:
+			existing.Weight += e.Weight
+			existing.Contexts = union(existing.Contexts, e.Contexts)
+			m.merged[e.Word] = existing
+		}
+	}
+}
+
+// Conflicts returns the number of conflicts resolved so far.
+func (m *Merger) Conflicts() int {
+	return len(m.res.Conflicts)
+}
+
+// Result returns the merge of every batch added so far.
+func (m *Merger) Result() Result {
+	if m.policy == Error && len(m.res.Conflicts) > 0 {
+		return Result{Conflicts: m.res.Conflicts}
+	}
+	res := m.res
+	res.Entries = make([]trie.Entry, 0, len(m.merged))
+	for _, e := range m.merged {
+		res.Entries = append(res.Entries, e)
+	}
+	sort.Slice(res.Entries, func(i, j int) bool { return res.Entries[i].Word < res.Entries[j].Word })
+	return res
+}
+
+func union(a, b []string) []string {
+	out := append([]string(nil), a...)
+	for _, s := range b {
+		found := false
+		for _, t := range out {
+			if s == t {
+				found = true
+				break
+			}
+		}
+		if !found {
+			out = append(out, s)
+		}
+	}
+	return out
+}
@@ -0,0 +1,50 @@
+// Package intern deduplicates strings so that equal strings share storage.
+package intern
+
+import "sync"
+
+// Pool holds one canonical copy of every string interned into it.
+type Pool struct {
+	mu      sync.Mutex
+	strings map[string]string
+	bytes   int
+	hits    int64
+	saved   int64
+}
+
+// New creates an empty Pool.
+func New() *Pool {
+	return &Pool{strings: make(map[string]string)}
+}
+
+// String returns the pooled copy of s, adding s to the pool if it is new.
+func (p *Pool) String(s string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if c, ok := p.strings[s]; ok {
+		p.hits++
+		p.saved += int64(len(s))
+		return c
+	}
+	p.strings[s] = s
+	p.bytes += len(s)
+	return s
+}
+
+// Stats describes the contents and effectiveness of a Pool.
+type Stats struct {
+	// Strings and Bytes count the distinct strings held.
+	Strings int
+	Bytes   int
+	// Hits counts lookups answered with an existing copy, and SavedBytes
+	// the bytes those lookups did not have to keep.
+	Hits       int64
+	SavedBytes int64
+}
+
+// Stats returns the Pool's statistics.
+func (p *Pool) Stats() Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return Stats{Strings: len(p.strings), Bytes: p.bytes, Hits: p.hits, SavedBytes: p.saved}
+}
@@ -0,0 +1,147 @@
+// Package jwks fetches and caches RSA verification keys from a JSON Web Key Set URL.
+package jwks
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// minRefetch limits how often an unknown key ID can trigger a refetch.
+const minRefetch = 30 * time.Second
+
+// Set is a cached JSON Web Key Set. Keys are refreshed periodically and
+// whenever a token references a key ID that is not cached yet, so rotations
+// at the identity provider are picked up without a restart.
+type Set struct {
+	url     string
+	client  *http.Client
+	mu      sync.RWMutex
+	keys    map[string]*rsa.PublicKey
+	fetched time.Time
+}
+
+// New creates a Set for url, fetches it once, and refreshes it every interval
+// in the background until ctx is done. An initial fetch failure is logged,
+// not fatal, so the service can start while the identity provider is
+// unavailable.
+func New(ctx context.Context, url string, interval time.Duration) *Set {
+	s := &Set{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+		keys:   map[string]*rsa.PublicKey{},
+	}
+	if err := s.refresh(); err != nil {
+		log.Printf("jwks: initial fetch of %s failed: %v", url, err)
+	}
+	if interval > 0 {
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+				if err := s.refresh(); err != nil {
+					log.Printf("jwks: refreshing %s: %v", url, err)
+				}
+			}
+		}()
+	}
+	return s
+}
+
+// Key returns the RSA public key with the given key ID.
+func (s *Set) Key(kid string) (*rsa.PublicKey, error) {
+	s.mu.RLock()
+	key, ok := s.keys[kid]
+	stale := time.Since(s.fetched) > minRefetch
+	s.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+	if stale {
+		if err := s.refresh(); err != nil {
+			return nil, err
+		}
+		s.mu.RLock()
+		key, ok = s.keys[kid]
+		s.mu.RUnlock()
+		if ok {
+			return key, nil
+		}
+	}
+	return nil, errors.New("unknown key id " + kid)
+}
+
+// jwk is the subset of RFC 7517 fields needed for RSA signature keys.
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+func (s *Set) refresh() error {
+	resp, err := s.client.Get(s.url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return err
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(doc.Keys))
+	for _, k := range doc.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		key, err := parseRSA(k)
+		if err != nil {
+			log.Printf("jwks: skipping key %q: %v", k.Kid, err)
+			continue
+		}
+		keys[k.Kid] = key
+	}
+
+	s.mu.Lock()
+	s.keys = keys
+	s.fetched = time.Now()
+	s.mu.Unlock()
+	return nil
+}
+
+func parseRSA(k jwk) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("modulus: %w", err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, fmt.Errorf("exponent: %w", err)
+	}
+	exp := new(big.Int).SetBytes(e)
+	if !exp.IsInt64() || exp.Int64() > 1<<31-1 {
+		return nil, errors.New("exponent too large")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}, nil
+}
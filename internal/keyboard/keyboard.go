@@ -0,0 +1,86 @@
+// Package keyboard models physical key adjacency so typos between
+// neighbouring keys can be treated as cheaper than arbitrary substitutions.
+package keyboard
+
+import (
+	"fmt"
+	"unicode"
+)
+
+// Layouts are the supported keyboard layouts as rows of keys, top to bottom.
+// Each row is offset by roughly half a key to the right of the one above.
+var Layouts = map[string][]string{
+	"qwerty": {"1234567890", "qwertyuiop", "asdfghjkl", "zxcvbnm"},
+	"azerty": {"1234567890", "azertyuiop", "qsdfghjklm", "wxcvbn"},
+	"qwertz": {"1234567890", "qwertzuiop", "asdfghjkl", "yxcvbnm"},
+}
+
+// Layout answers whether two keys are neighbours on a keyboard.
+type Layout struct {
+	adjacent map[rune]map[rune]bool
+}
+
+// New returns the named layout.
+func New(name string) (*Layout, error) {
+	rows, ok := Layouts[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown keyboard layout %q", name)
+	}
+	l := &Layout{adjacent: make(map[rune]map[rune]bool)}
+	grid := make([][]rune, len(rows))
+	for i, row := range rows {
+		grid[i] = []rune(row)
+	}
+	for r, row := range grid {
+		for c, key := range row {
+			// Same row: left and right. Row above: the keys at c and c+1
+			// because of the stagger; row below: c-1 and c.
+			l.link(key, grid, r, c-1)
+			l.link(key, grid, r, c+1)
+			l.link(key, grid, r-1, c)
+			l.link(key, grid, r-1, c+1)
+			l.link(key, grid, r+1, c-1)
+			l.link(key, grid, r+1, c)
+		}
+	}
+	return l, nil
+}
+
+func (l *Layout) link(key rune, grid [][]rune, r, c int) {
+	if r < 0 || r >= len(grid) || c < 0 || c >= len(grid[r]) {
+		return
+	}
+	if l.adjacent[key] == nil {
+		l.adjacent[key] = make(map[rune]bool)
+	}
+	l.adjacent[key][grid[r][c]] = true
+}
+
+// Adjacent reports whether a and b are neighbouring keys, ignoring case.
+func (l *Layout) Adjacent(a, b rune) bool {
+	return l.adjacent[unicode.ToLower(a)][unicode.ToLower(b)]
+}
+
+// SubstitutionCost returns a cost function for edit distance in which
+// substituting neighbouring keys costs adjacentCost and any other
+// substitution costs 1.
+func (l *Layout) SubstitutionCost(adjacentCost float64) func(a, b rune) float64 {
+	return func(a, b rune) float64 {
+		switch {
+		case a == b:
+			return 0
+		case l.Adjacent(a, b):
+			return adjacentCost
+		default:
+			return 1
+		}
+	}
+}
+
+// UniformCost prices every substitution as a full edit, ignoring layout.
+func UniformCost(a, b rune) float64 {
+	if a == b {
+		return 0
+	}
+	return 1
+}
@@ -0,0 +1,72 @@
+// Package listen opens the server's listeners from address strings, supporting
+// TCP, Unix domain sockets and systemd socket activation.
+package listen
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// listenFdsStart is the first file descriptor passed by systemd.
+const listenFdsStart = 3
+
+// Listen opens a listener for addr, which is one of:
+//
+//	host:port       a TCP address
+//	unix:/path      a Unix domain socket, replacing any stale socket file
+//	systemd[:N]     the Nth (default 0) socket passed by systemd activation
+func Listen(addr string) (net.Listener, error) {
+	switch {
+	case strings.HasPrefix(addr, "unix:"):
+		path := strings.TrimPrefix(addr, "unix:")
+		if err := removeStaleSocket(path); err != nil {
+			return nil, err
+		}
+		return net.Listen("unix", path)
+	case addr == "systemd" || strings.HasPrefix(addr, "systemd:"):
+		index := 0
+		if s, ok := strings.CutPrefix(addr, "systemd:"); ok {
+			var err error
+			if index, err = strconv.Atoi(s); err != nil || index < 0 {
+				return nil, fmt.Errorf("invalid systemd socket index %q", s)
+			}
+		}
+		return systemdListener(index)
+	default:
+		return net.Listen("tcp", addr)
+	}
+}
+
+// removeStaleSocket deletes a socket file left behind by a previous process.
+// Other file types are left alone so a misconfigured path cannot delete data.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+	return os.Remove(path)
+}
+
+// systemdListener returns the index'th listener passed via LISTEN_FDS.
+func systemdListener(index int) (net.Listener, error) {
+	if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err != nil || pid != os.Getpid() {
+		return nil, errors.New("no sockets passed by systemd (LISTEN_PID not set for this process)")
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || index >= n {
+		return nil, fmt.Errorf("systemd passed %d sockets, wanted socket %d", n, index)
+	}
+	f := os.NewFile(uintptr(listenFdsStart+index), "systemd-socket-"+strconv.Itoa(index))
+	defer f.Close()
+	return net.FileListener(f)
+}
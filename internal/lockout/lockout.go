@@ -0,0 +1,106 @@
+// Package lockout tracks failed login attempts and locks out the usernames
+// and client addresses they come from, with exponentially growing lockouts.
+package lockout
+
+import (
+	"sync"
+	"time"
+)
+
+// Tracker counts failures per key, e.g. a username or a client IP. Once a
+// key has failed Threshold times, every further failure locks it out for
+// Base, doubling each time up to Max. Failures are forgotten after Window
+// without any, counted from the end of the last lockout.
+type Tracker struct {
+	Threshold int
+	Base      time.Duration
+	Max       time.Duration
+	Window    time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*entry
+	swept   time.Time
+}
+
+type entry struct {
+	failures    int
+	last        time.Time
+	lockedUntil time.Time
+}
+
+// idle reports whether the entry has seen no failure or lockout for window.
+func (e *entry) idle(now time.Time, window time.Duration) bool {
+	since := e.last
+	if e.lockedUntil.After(since) {
+		since = e.lockedUntil
+	}
+	return now.Sub(since) > window
+}
+
+// New creates a Tracker.
+func New(threshold int, base, max, window time.Duration) *Tracker {
+	return &Tracker{
+		Threshold: threshold,
+		Base:      base,
+		Max:       max,
+		Window:    window,
+		entries:   make(map[string]*entry),
+	}
+}
+
+// Locked returns how much longer key is locked out, or zero.
+func (t *Tracker) Locked(key string, now time.Time) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	e, ok := t.entries[key]
+	if !ok || !now.Before(e.lockedUntil) {
+		return 0
+	}
+	return e.lockedUntil.Sub(now)
+}
+
+// Fail records a failed attempt by key and returns the lockout it triggers,
+// or zero if key may still retry immediately.
+func (t *Tracker) Fail(key string, now time.Time) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sweep(now)
+	e, ok := t.entries[key]
+	if !ok || e.idle(now, t.Window) {
+		e = &entry{}
+		t.entries[key] = e
+	}
+	e.failures++
+	e.last = now
+	if e.failures < t.Threshold {
+		return 0
+	}
+	lockout := t.Base
+	for i := t.Threshold; i < e.failures && lockout < t.Max; i++ {
+		lockout *= 2
+	}
+	lockout = min(lockout, t.Max)
+	e.lockedUntil = now.Add(lockout)
+	return lockout
+}
+
+// Succeed forgets the failures of key.
+func (t *Tracker) Succeed(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.entries, key)
+}
+
+// sweep drops entries idle for longer than Window, at most once per Window.
+// The caller must hold the lock.
+func (t *Tracker) sweep(now time.Time) {
+	if now.Sub(t.swept) < t.Window {
+		return
+	}
+	t.swept = now
+	for key, e := range t.entries {
+		if e.idle(now, t.Window) {
+			delete(t.entries, key)
+		}
+	}
+}
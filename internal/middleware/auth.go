@@ -4,72 +4,262 @@ import (
 	"context"
 	"errors"
 	"net/http"
+	"slices"
 	"strings"
+	"time"
 
+	"github.com/cg011235/autocomplete/internal/jwks"
+	"github.com/cg011235/autocomplete/internal/response"
 	"github.com/golang-jwt/jwt"
-	"golang.org/x/time/rate"
 )
 
 var (
+	// secretKey verifies tokens that carry no key ID.
 	secretKey []byte
-	// Create a rate limiter with a rate of 1 request per second and a burst size of 3.
-	limiter = rate.NewLimiter(1, 3)
+	// verificationKeys maps key IDs ("kid" header) to HMAC secrets, so tokens
+	// signed with previous keys stay valid while keys are rotated. Once set,
+	// tokens without a key ID are only accepted before unkeyedUntil.
+	verificationKeys = map[string][]byte{}
+	unkeyedUntil     time.Time
+	// keySet verifies RS256 tokens from an external identity provider,
+	// whose claims must match external; nil disables them.
+	keySet   *jwks.Set
+	external ExternalClaims
+
+	// issuers and audiences are the accepted "iss" and "aud" claims; empty
+	// accepts any. clockSkew is tolerated on the "exp", "nbf" and "iat" claims.
+	issuers   []string
+	audiences []string
+	clockSkew time.Duration
 )
 
-// SetSecretKey sets the secret key for JWT authentication.
+// SetSecretKey sets the secret key for JWT authentication of tokens without a key ID.
 func SetSecretKey(key []byte) {
 	secretKey = key
 }
 
+// SetVerificationKeys sets the HMAC secrets accepted for tokens carrying a key
+// ID. Tokens without one are rejected from until on, or right away if until
+// is zero, when any keys are set.
+func SetVerificationKeys(keys map[string][]byte, until time.Time) {
+	verificationKeys = keys
+	unkeyedUntil = until
+}
+
+// ExternalClaims describes the RS256 tokens accepted from an identity provider.
+type ExternalClaims struct {
+	// Issuer and Audience are the required "iss" and "aud" claims.
+	Issuer   string
+	Audience string
+	// RoleClaim names the claim (string or list) checked against
+	// AdminValues; tokens with none of them get the user role.
+	RoleClaim   string
+	AdminValues []string
+}
+
+// role maps the identity provider's role claim to a local role.
+func (c ExternalClaims) role(claims jwt.MapClaims) string {
+	var values []string
+	switch v := claims[c.RoleClaim].(type) {
+	case string:
+		values = []string{v}
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+	for _, v := range values {
+		if slices.Contains(c.AdminValues, v) {
+			return RoleAdmin
+		}
+	}
+	return RoleUser
+}
+
+// SetKeySet enables RS256 tokens verified against the given JWKS and
+// carrying the given claims.
+func SetKeySet(s *jwks.Set, c ExternalClaims) {
+	keySet = s
+	external = c
+}
+
+// SetClaimsValidation requires HMAC tokens to be issued by one of issuers and
+// intended for one of audiences, when given, and tolerates clocks that are
+// up to skew apart when checking the validity period of all tokens.
+func SetClaimsValidation(iss, aud []string, skew time.Duration) {
+	issuers = iss
+	audiences = aud
+	clockSkew = skew
+}
+
+// validateClaims checks the validity period of claims and that they name one
+// of iss and aud, when given.
+func validateClaims(claims jwt.MapClaims, iss, aud []string) error {
+	now := time.Now()
+	if !claims.VerifyExpiresAt(now.Add(-clockSkew).Unix(), false) {
+		return errors.New("token is expired")
+	}
+	if !claims.VerifyNotBefore(now.Add(clockSkew).Unix(), false) {
+		return errors.New("token is not valid yet")
+	}
+	if !claims.VerifyIssuedAt(now.Add(clockSkew).Unix(), false) {
+		return errors.New("token used before issued")
+	}
+	if len(iss) > 0 && !slices.ContainsFunc(iss, func(iss string) bool { return claims.VerifyIssuer(iss, true) }) {
+		return errors.New("unexpected issuer")
+	}
+	if len(aud) > 0 && !slices.ContainsFunc(aud, func(aud string) bool { return claims.VerifyAudience(aud, true) }) {
+		return errors.New("unexpected audience")
+	}
+	return nil
+}
+
+// verificationKey selects the secret for a token by its "kid" header.
+func verificationKey(token *jwt.Token) ([]byte, error) {
+	kid, ok := token.Header["kid"].(string)
+	if !ok || kid == "" {
+		if len(verificationKeys) > 0 && !time.Now().Before(unkeyedUntil) {
+			return nil, errors.New("missing key id")
+		}
+		return secretKey, nil
+	}
+	key, ok := verificationKeys[kid]
+	if !ok {
+		return nil, errors.New("unknown key id " + kid)
+	}
+	return key, nil
+}
+
 // Define a custom type for context keys to avoid potential conflicts.
 type contextKey string
 
 const userContextKey contextKey = "user"
 
-// JwtMiddleware handles JWT authentication.
+// Roles carried in the "role" claim of issued tokens.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// Username returns the authenticated username stored in the context by
+// JwtMiddleware, or an empty string if the request is not authenticated.
+// Tokens from external identity providers fall back to the
+// preferred_username and sub claims.
+func Username(ctx context.Context) string {
+	claims, ok := ctx.Value(userContextKey).(jwt.MapClaims)
+	if !ok {
+		return ""
+	}
+	for _, claim := range []string{"username", "preferred_username", "sub"} {
+		if name, _ := claims[claim].(string); name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// Claims returns the claims of the request's token stored in the context by
+// JwtMiddleware, or nil if the request is not authenticated.
+func Claims(ctx context.Context) jwt.MapClaims {
+	claims, _ := ctx.Value(userContextKey).(jwt.MapClaims)
+	return claims
+}
+
+// Role returns the role claim of the authenticated user, or an empty string.
+// Tokens from external identity providers carry the local role JwtMiddleware
+// mapped their role claim to.
+func Role(ctx context.Context) string {
+	claims, ok := ctx.Value(userContextKey).(jwt.MapClaims)
+	if !ok {
+		return ""
+	}
+	role, _ := claims["role"].(string)
+	return role
+}
+
+// RequireRole rejects authenticated requests whose role claim does not match role.
+// It must be used after JwtMiddleware.
+func RequireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if Role(r.Context()) != role {
+				response.Error(w, http.StatusForbidden, "Forbidden")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// JwtMiddleware handles JWT authentication. Requests carrying an API key
+// instead are authenticated as its consumer. Requests without either are
+// let through, marked anonymous, if they are public.
 func JwtMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		tokenString := r.Header.Get("Authorization")
+		if key := r.Header.Get(APIKeyHeader); key != "" && tokenString == "" {
+			authenticateKey(w, r, key, next)
+			return
+		}
+		if tokenString == "" && isPublic(r) {
+			ctx := context.WithValue(r.Context(), anonymousContextKey, true)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
 		if tokenString == "" {
-			http.Error(w, "Missing token", http.StatusUnauthorized)
+			response.Error(w, http.StatusUnauthorized, "Missing token")
 			return
 		}
 
 		// Remove the "Bearer " prefix from the token string.
 		tokenString = strings.TrimPrefix(tokenString, "Bearer ")
 
-		// Parse and validate the token.
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		// Parse the token and verify its signature; claims are validated
+		// below with the configured clock skew.
+		parser := jwt.Parser{SkipClaimsValidation: true}
+		token, err := parser.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+			switch token.Method.(type) {
+			case *jwt.SigningMethodHMAC:
+				return verificationKey(token)
+			case *jwt.SigningMethodRSA:
+				if keySet == nil {
+					return nil, errors.New("unexpected signing method")
+				}
+				kid, _ := token.Header["kid"].(string)
+				return keySet.Key(kid)
+			default:
 				return nil, errors.New("unexpected signing method")
 			}
-			return secretKey, nil
 		})
 
 		if err != nil {
-			http.Error(w, "Invalid token: "+err.Error(), http.StatusUnauthorized)
+			response.Error(w, http.StatusUnauthorized, "Invalid token: "+err.Error())
 			return
 		}
 
 		if !token.Valid {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			response.Error(w, http.StatusUnauthorized, "Invalid token")
+			return
+		}
+		claims := token.Claims.(jwt.MapClaims)
+		iss, aud := issuers, audiences
+		_, fromProvider := token.Method.(*jwt.SigningMethodRSA)
+		if fromProvider {
+			iss, aud = []string{external.Issuer}, []string{external.Audience}
+		}
+		if err := validateClaims(claims, iss, aud); err != nil {
+			response.Error(w, http.StatusUnauthorized, "Invalid token: "+err.Error())
 			return
 		}
+		if fromProvider {
+			claims["role"] = external.role(claims)
+		}
 
 		// Store the token claims in the context.
 		ctx := context.WithValue(r.Context(), userContextKey, token.Claims)
+		setAccessUser(ctx, Username(ctx))
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
-
-// RateLimitMiddleware handles rate limiting.
-func RateLimitMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Check if the request is allowed by the rate limiter.
-		if !limiter.Allow() {
-			http.Error(w, "Too many requests", http.StatusTooManyRequests)
-			return
-		}
-		next.ServeHTTP(w, r)
-	})
-}
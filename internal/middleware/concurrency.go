@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cg011235/autocomplete/internal/response"
+)
+
+var (
+	// inFlight holds a token per request being served; nil disables the limit.
+	inFlight chan struct{}
+	// overloadRetryAfter is advertised to requests rejected while saturated.
+	overloadRetryAfter = time.Second
+)
+
+// SetMaxInFlight limits how many requests are served concurrently, asking
+// clients to retry after retryAfter once saturated. Zero disables the limit.
+func SetMaxInFlight(n int, retryAfter time.Duration) {
+	inFlight = nil
+	if n > 0 {
+		inFlight = make(chan struct{}, n)
+	}
+	overloadRetryAfter = retryAfter
+}
+
+// ConcurrencyMiddleware rejects requests with 503 while the maximum number
+// of requests is in flight, instead of queueing them until they time out.
+// Admin routes are exempt so the server can still be inspected.
+func ConcurrencyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if inFlight == nil || strings.HasPrefix(r.URL.Path, adminPathPrefix) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		select {
+		case inFlight <- struct{}{}:
+			defer func() { <-inFlight }()
+			next.ServeHTTP(w, r)
+		default:
+			response.Throttled(w, http.StatusServiceUnavailable, response.ReasonOverloaded, overloadRetryAfter, "Server is overloaded")
+		}
+	})
+}
@@ -0,0 +1,304 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cg011235/autocomplete/internal/response"
+	"github.com/golang-jwt/jwt"
+	"github.com/gorilla/mux"
+)
+
+// APIKeyHeader carries the API key of a consumer in place of a token.
+const APIKeyHeader = "X-API-Key"
+
+// Consumer is an API client that authenticates with an API key instead of
+// a token. Its name shares the username namespace for rate limiting and
+// access logs.
+type Consumer struct {
+	Name string `json:"name"`
+	Role string `json:"role"`
+	// Tier is the consumer's rate limit tier; empty falls back to the role default.
+	Tier string `json:"tier,omitempty"`
+	// Dictionaries restricts the consumer to the named dictionaries; empty allows all.
+	Dictionaries []string `json:"dictionaries,omitempty"`
+	Keys         []APIKey `json:"keys,omitempty"`
+}
+
+// APIKey is a key issued to a consumer. Only a hash of the key is kept.
+type APIKey struct {
+	ID      string    `json:"id"`
+	Hash    string    `json:"hash"`
+	Created time.Time `json:"created"`
+}
+
+var (
+	consumersMu sync.RWMutex
+	consumers   = map[string]Consumer{}
+	// consumerKeys maps key hashes to the name of the consumer holding the key.
+	consumerKeys = map[string]string{}
+)
+
+// ResetAccess drops every consumer, custom tier, tier assignment and token
+// bucket, restoring the built-in tiers, so a service started again in the
+// same process sees only the access state it loads.
+func ResetAccess() {
+	consumersMu.Lock()
+	consumers = map[string]Consumer{}
+	consumerKeys = map[string]string{}
+	consumersMu.Unlock()
+	tiersMu.Lock()
+	tiers = builtinTiers()
+	userTiers = map[string]string{}
+	limiters.Flush()
+	tiersMu.Unlock()
+}
+
+// SetConsumer creates or updates a consumer, keeping the keys of an existing
+// consumer of the same name if c has none, and assigns it its tier.
+func SetConsumer(c Consumer) error {
+	if c.Name == "" {
+		return errors.New("consumer name is required")
+	}
+	if c.Role != RoleUser && c.Role != RoleAdmin {
+		return errors.New("unknown role " + c.Role)
+	}
+	if c.Tier != "" {
+		if _, ok := Tiers()[c.Tier]; !ok {
+			return errors.New("unknown tier " + c.Tier)
+		}
+	}
+
+	consumersMu.Lock()
+	defer consumersMu.Unlock()
+	if existing, ok := consumers[c.Name]; ok {
+		if c.Keys == nil {
+			c.Keys = existing.Keys
+		}
+		for _, key := range existing.Keys {
+			delete(consumerKeys, key.Hash)
+		}
+	}
+	for _, key := range c.Keys {
+		consumerKeys[key.Hash] = c.Name
+	}
+	consumers[c.Name] = c
+	AssignTier(c.Name, c.Tier)
+	return nil
+}
+
+// DeleteConsumer removes a consumer, revoking its keys. It returns false if
+// the consumer does not exist.
+func DeleteConsumer(name string) bool {
+	consumersMu.Lock()
+	defer consumersMu.Unlock()
+	c, ok := consumers[name]
+	if !ok {
+		return false
+	}
+	for _, key := range c.Keys {
+		delete(consumerKeys, key.Hash)
+	}
+	delete(consumers, name)
+	AssignTier(name, "")
+	return true
+}
+
+// LookupConsumer returns the named consumer.
+func LookupConsumer(name string) (Consumer, bool) {
+	consumersMu.RLock()
+	defer consumersMu.RUnlock()
+	c, ok := consumers[name]
+	return c, ok
+}
+
+// Consumers returns the consumers sorted by name.
+func Consumers() []Consumer {
+	consumersMu.RLock()
+	defer consumersMu.RUnlock()
+	list := make([]Consumer, 0, len(consumers))
+	for _, c := range consumers {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// IssueKey generates a new API key for the named consumer, returning the
+// key, which cannot be recovered later, and its ID.
+func IssueKey(name string) (key, id string, err error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+	key = base64.RawURLEncoding.EncodeToString(secret)
+	hash := hashKey(key)
+
+	consumersMu.Lock()
+	defer consumersMu.Unlock()
+	c, ok := consumers[name]
+	if !ok {
+		return "", "", errors.New("unknown consumer " + name)
+	}
+	id = hash[:12]
+	c.Keys = append(slices.Clip(c.Keys), APIKey{ID: id, Hash: hash, Created: time.Now().UTC()})
+	consumers[name] = c
+	consumerKeys[hash] = name
+	return key, id, nil
+}
+
+// RevokeKey removes the key with the given ID from the named consumer. It
+// returns false if the consumer has no such key.
+func RevokeKey(name, id string) bool {
+	consumersMu.Lock()
+	defer consumersMu.Unlock()
+	c, ok := consumers[name]
+	if !ok {
+		return false
+	}
+	i := slices.IndexFunc(c.Keys, func(key APIKey) bool { return key.ID == id })
+	if i < 0 {
+		return false
+	}
+	delete(consumerKeys, c.Keys[i].Hash)
+	c.Keys = slices.Delete(slices.Clone(c.Keys), i, i+1)
+	consumers[name] = c
+	return true
+}
+
+// consumerFor returns the consumer holding key.
+func consumerFor(key string) (Consumer, bool) {
+	consumersMu.RLock()
+	defer consumersMu.RUnlock()
+	name, ok := consumerKeys[hashKey(key)]
+	if !ok {
+		return Consumer{}, false
+	}
+	return consumers[name], true
+}
+
+// dictScopedVars are the path variables that name something within the
+// dictionaries of the query rather than a dictionary, e.g. an entity ID.
+var dictScopedVars = map[string]bool{"id": true, "alias": true}
+
+// checkedByHandlerKey marks requests whose handler checks the dictionaries
+// it touches itself.
+const checkedByHandlerKey contextKey = "dictionariesCheckedByHandler"
+
+// DictionariesCheckedByHandler lets consumers restricted to some dictionaries
+// through to next, which must check the dictionaries named in the request
+// body with AllowsDictionary. It must be used before JwtMiddleware.
+func DictionariesCheckedByHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), checkedByHandlerKey, true)))
+	})
+}
+
+// dictScopedAdminRoutes are the admin routes, by method and path template,
+// that act on the one dictionary named by the dict query or path variable.
+// Other admin routes act on every dictionary, on a dictionary named
+// elsewhere or on no dictionary at all.
+var dictScopedAdminRoutes = map[string]bool{
+	"POST /api/v1/admin/import":            true,
+	"POST /api/v1/admin/rollback":          true,
+	"GET /api/v1/admin/versions":           true,
+	"GET /api/v1/admin/diff":               true,
+	"POST /api/v1/admin/diff":              true,
+	"GET /api/v1/admin/export":             true,
+	"DELETE /api/v1/admin/cache":           true,
+	"GET /api/v1/admin/histogram":          true,
+	"GET /api/v1/admin/compact":            true,
+	"POST /api/v1/admin/compact":           true,
+	"GET /api/v1/admin/aliases":            true,
+	"PUT /api/v1/admin/aliases/{alias}":    true,
+	"DELETE /api/v1/admin/aliases/{alias}": true,
+	"PUT /api/v1/admin/quotas/{dict}":      true,
+	"PUT /api/v1/admin/settings/{dict}":    true,
+}
+
+// allows reports whether c may access every dictionary r names. Consumers
+// restricted to some dictionaries are denied routes whose path names a
+// resource other than a dictionary they may access, e.g. another
+// dictionary to copy or a consumer, since its dictionaries are unknown,
+// and admin routes not scoped to one dictionary.
+func (c Consumer) allows(r *http.Request) bool {
+	if len(c.Dictionaries) == 0 || r.Context().Value(checkedByHandlerKey) != nil {
+		return true
+	}
+	if strings.HasPrefix(r.URL.Path, adminPathPrefix) {
+		route := mux.CurrentRoute(r)
+		if route == nil {
+			return false
+		}
+		tpl, err := route.GetPathTemplate()
+		if err != nil || !dictScopedAdminRoutes[r.Method+" "+tpl] {
+			return false
+		}
+	}
+	vars := mux.Vars(r)
+	for name, value := range vars {
+		switch {
+		case name == "dict":
+			if !slices.Contains(c.Dictionaries, value) {
+				return false
+			}
+		case !dictScopedVars[name]:
+			return false
+		}
+	}
+	query := r.URL.Query()
+	if _, ok := vars["dict"]; ok && !query.Has("dict") && !query.Has("dicts") {
+		return true
+	}
+	for _, name := range requestedDictionaries(r) {
+		if !slices.Contains(c.Dictionaries, name) {
+			return false
+		}
+	}
+	return true
+}
+
+// AllowsDictionary reports whether the caller authenticated in ctx may access
+// the named dictionary, for handlers taking dictionary names from the request
+// body. Only consumers are restricted to some dictionaries.
+func AllowsDictionary(ctx context.Context, name string) bool {
+	consumer, _ := Claims(ctx)["consumer"].(string)
+	if consumer == "" {
+		return true
+	}
+	c, ok := LookupConsumer(consumer)
+	return ok && (len(c.Dictionaries) == 0 || slices.Contains(c.Dictionaries, name))
+}
+
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// authenticateKey serves r as the consumer holding key, with the consumer's
+// name, as both username and consumer, and role as claims.
+func authenticateKey(w http.ResponseWriter, r *http.Request, key string, next http.Handler) {
+	c, ok := consumerFor(key)
+	if !ok {
+		response.Error(w, http.StatusUnauthorized, "Invalid API key")
+		return
+	}
+	if !c.allows(r) {
+		response.Error(w, http.StatusForbidden, "Dictionary not allowed")
+		return
+	}
+	claims := jwt.MapClaims{"username": c.Name, "consumer": c.Name, "role": c.Role}
+	ctx := context.WithValue(r.Context(), userContextKey, claims)
+	setAccessUser(ctx, c.Name)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
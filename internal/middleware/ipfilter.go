@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/cg011235/autocomplete/internal/response"
+)
+
+// IPRule restricts the client addresses allowed on paths starting with PathPrefix.
+// A client is denied if it matches Deny, or if Allow is non-empty and it does
+// not match Allow.
+type IPRule struct {
+	PathPrefix string
+	Allow      []*net.IPNet
+	Deny       []*net.IPNet
+}
+
+var ipRules []IPRule
+
+// SetIPRules sets the address rules enforced by IPFilterMiddleware.
+func SetIPRules(rules []IPRule) {
+	ipRules = rules
+}
+
+// IPFilterMiddleware rejects clients denied by any rule matching the request
+// path with 403, logging an audit entry. It runs before authentication, so
+// denied clients never reach the token checks.
+func IPFilterMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := net.ParseIP(ClientIP(r))
+		for _, rule := range ipRules {
+			if !strings.HasPrefix(r.URL.Path, rule.PathPrefix) {
+				continue
+			}
+			if ip == nil || contains(rule.Deny, ip) || (len(rule.Allow) > 0 && !contains(rule.Allow, ip)) {
+				log.Printf("audit: denied %s %s from %s by IP rule for %q", r.Method, r.URL.Path, r.RemoteAddr, rule.PathPrefix)
+				response.Error(w, http.StatusForbidden, "Forbidden")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func contains(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseCIDRs parses CIDR ranges; bare IP addresses are treated as single-host ranges.
+func ParseCIDRs(list []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(list))
+	for _, item := range list {
+		if !strings.Contains(item, "/") {
+			if ip := net.ParseIP(item); ip != nil && ip.To4() != nil {
+				item += "/32"
+			} else {
+				item += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
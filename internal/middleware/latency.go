@@ -0,0 +1,232 @@
+package middleware
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// latencySamples is how many recent requests per route percentiles are computed over.
+const latencySamples = 1024
+
+// maxLabeledSeries caps how many labeled series are tracked so that
+// arbitrary dictionary names cannot grow the table without bound; requests
+// beyond it are counted under OtherDict.
+const maxLabeledSeries = 4096
+
+// OtherDict labels requests whose series did not fit under maxLabeledSeries.
+const OtherDict = "(other)"
+
+// Labels identify who a request was served for: the listener address it
+// arrived on, the API version that handled it and the dictionary it named.
+// Version and Dict are empty for requests without one.
+type Labels struct {
+	Listener string
+	Version  string
+	Dict     string
+}
+
+// RouteLatency summarizes the recent latencies of a route, for a single set
+// of labels when returned by LabeledLatencies.
+type RouteLatency struct {
+	Route string
+	Labels
+	Count uint64
+	Slow  uint64
+	P50   time.Duration
+	P90   time.Duration
+	P99   time.Duration
+	Max   time.Duration
+}
+
+type labeledRoute struct {
+	route string
+	Labels
+}
+
+type routeLatency struct {
+	samples [latencySamples]time.Duration
+	next    int
+	count   uint64
+	slow    uint64
+	max     time.Duration
+}
+
+var (
+	latencyMu sync.Mutex
+	latencies = map[string]*routeLatency{}
+	labeled   = map[labeledRoute]*routeLatency{}
+
+	// slowThreshold is the latency above which requests are logged; zero disables logging.
+	slowThreshold time.Duration
+	// slowInfo describes the state a slow request ran against, e.g. Trie sizes.
+	slowInfo func(r *http.Request) string
+)
+
+// SetSlowRequests logs requests slower than threshold along with info(r).
+func SetSlowRequests(threshold time.Duration, info func(r *http.Request) string) {
+	slowThreshold = threshold
+	slowInfo = info
+}
+
+// LatencyMiddleware records the latency of every request per route and logs
+// those exceeding the slow request threshold.
+func LatencyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		next.ServeHTTP(w, r)
+		elapsed := time.Since(start)
+
+		route := routeName(r)
+		slow := slowThreshold > 0 && elapsed > slowThreshold
+		record(route, labelsOf(w, r), elapsed, slow)
+		if slow {
+			info := ""
+			if slowInfo != nil {
+				info = " " + slowInfo(r)
+			}
+			log.Printf("slow request: %s %s took %s%s", route, r.URL.RequestURI(), elapsed, info)
+		}
+	})
+}
+
+// routeName returns "METHOD /path/template" for the matched route.
+func routeName(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if tpl, err := route.GetPathTemplate(); err == nil {
+			return r.Method + " " + tpl
+		}
+	}
+	return r.Method + " (unmatched)"
+}
+
+// labelsOf labels r by the listener it arrived on, the API version that
+// served it (as announced by APIVersion) and the dictionary it named via the
+// dict parameter, a {dict} path variable or the dicts list of a merged query.
+func labelsOf(w http.ResponseWriter, r *http.Request) Labels {
+	l := Labels{Version: w.Header().Get("API-Version")}
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		l.Listener = addr.String()
+	}
+	query := r.URL.Query()
+	switch {
+	case query.Get("dict") != "":
+		l.Dict = query.Get("dict")
+	case mux.Vars(r)["dict"] != "":
+		l.Dict = mux.Vars(r)["dict"]
+	default:
+		l.Dict = query.Get("dicts")
+	}
+	return l
+}
+
+func record(route string, labels Labels, d time.Duration, slow bool) {
+	latencyMu.Lock()
+	defer latencyMu.Unlock()
+	l, ok := latencies[route]
+	if !ok {
+		l = &routeLatency{}
+		latencies[route] = l
+	}
+	l.add(d, slow)
+
+	key := labeledRoute{route, labels}
+	ll, ok := labeled[key]
+	if !ok {
+		if len(labeled) >= maxLabeledSeries {
+			key.Dict = OtherDict
+			ll, ok = labeled[key]
+		}
+		if !ok {
+			ll = &routeLatency{}
+			labeled[key] = ll
+		}
+	}
+	ll.add(d, slow)
+}
+
+func (l *routeLatency) add(d time.Duration, slow bool) {
+	l.samples[l.next] = d
+	l.next = (l.next + 1) % latencySamples
+	l.count++
+	if slow {
+		l.slow++
+	}
+	if d > l.max {
+		l.max = d
+	}
+}
+
+// Latencies returns the latency percentiles of every route over its most
+// recent requests, sorted by route.
+func Latencies() []RouteLatency {
+	latencyMu.Lock()
+	defer latencyMu.Unlock()
+	stats := make([]RouteLatency, 0, len(latencies))
+	for route, l := range latencies {
+		stats = append(stats, l.summary(route, Labels{}))
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Route < stats[j].Route })
+	return stats
+}
+
+// LabeledLatencies returns the latency percentiles of every route per
+// listener, API version and dictionary, sorted by dictionary, version,
+// listener and route. A non-empty dict keeps only that dictionary's series.
+func LabeledLatencies(dict string) []RouteLatency {
+	latencyMu.Lock()
+	defer latencyMu.Unlock()
+	stats := []RouteLatency{}
+	for key, l := range labeled {
+		if dict != "" && key.Dict != dict {
+			continue
+		}
+		stats = append(stats, l.summary(key.route, key.Labels))
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		a, b := stats[i], stats[j]
+		if a.Dict != b.Dict {
+			return a.Dict < b.Dict
+		}
+		if a.Version != b.Version {
+			return a.Version < b.Version
+		}
+		if a.Listener != b.Listener {
+			return a.Listener < b.Listener
+		}
+		return a.Route < b.Route
+	})
+	return stats
+}
+
+func (l *routeLatency) summary(route string, labels Labels) RouteLatency {
+	n := latencySamples
+	if l.count < latencySamples {
+		n = int(l.count)
+	}
+	samples := append([]time.Duration(nil), l.samples[:n]...)
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	return RouteLatency{
+		Route:  route,
+		Labels: labels,
+		Count:  l.count,
+		Slow:   l.slow,
+		P50:    percentile(samples, 0.50),
+		P90:    percentile(samples, 0.90),
+		P99:    percentile(samples, 0.99),
+		Max:    l.max,
+	}
+}
+
+// percentile returns the p-th percentile of sorted samples.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[int(p*float64(len(sorted)-1))]
+}
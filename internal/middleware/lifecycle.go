@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cg011235/autocomplete/internal/response"
+)
+
+// Lifecycle describes where an API version is in its deprecation lifecycle.
+type Lifecycle struct {
+	// Version is advertised in the API-Version header of every response.
+	Version string
+	// Deprecated is when the version was or will be deprecated; zero if it is not.
+	Deprecated time.Time
+	// Sunset is when the version will stop being served; zero if unscheduled.
+	Sunset time.Time
+	// Successor is the path of the version replacing this one, linked from
+	// deprecated responses.
+	Successor string
+	// Disabled rejects every request to the version with 410 Gone. Admin
+	// routes are exempt so the server can still be operated.
+	Disabled bool
+}
+
+// APIVersion annotates responses of an API version with its lifecycle:
+// API-Version always, Deprecation (RFC 9745) and Sunset (RFC 8594) once
+// scheduled, and a successor-version link.
+func APIVersion(l Lifecycle) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			h.Set("API-Version", l.Version)
+			if !l.Deprecated.IsZero() {
+				h.Set("Deprecation", "@"+strconv.FormatInt(l.Deprecated.Unix(), 10))
+			}
+			if !l.Sunset.IsZero() {
+				h.Set("Sunset", l.Sunset.UTC().Format(http.TimeFormat))
+			}
+			if l.Successor != "" && (!l.Deprecated.IsZero() || l.Disabled) {
+				h.Add("Link", "<"+l.Successor+`>; rel="successor-version"`)
+			}
+			if l.Disabled && !strings.HasPrefix(r.URL.Path, adminPathPrefix) {
+				response.Error(w, http.StatusGone, "API "+l.Version+" is no longer available")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -1,21 +1,61 @@
 package middleware
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
 )
 
+// Access log formats.
+const (
+	// AccessLogCombined is the Apache combined log format.
+	AccessLogCombined = "combined"
+	// AccessLogJSON writes one JSON object per request.
+	AccessLogJSON = "json"
+)
+
+var (
+	// accessLog receives a line per request in accessLogFormat; nil logs
+	// requests to the application log instead.
+	accessLog       io.Writer
+	accessLogFormat string
+	accessLogMu     sync.Mutex
+)
+
+// SetAccessLog writes a line per request to w in format (combined or json)
+// instead of logging requests to the application log.
+func SetAccessLog(w io.Writer, format string) {
+	accessLog = w
+	accessLogFormat = format
+}
+
+// accessUserKey holds a pointer to the username of the request, filled in by
+// JwtMiddleware so the access log sees it from outside the handler chain.
+const accessUserKey contextKey = "accessUser"
+
 // LoggingMiddleware logs the details of incoming requests and responses.
 func LoggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 
 		// Create a response writer that captures the status code
-		rw := &responseWriter{w, http.StatusOK}
+		rw := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		user := new(string)
+		r = r.WithContext(context.WithValue(r.Context(), accessUserKey, user))
 
 		next.ServeHTTP(rw, r)
 
+		if accessLog != nil {
+			writeAccessLog(r, rw, *user, start)
+			return
+		}
 		log.Printf(
 			"[%s] %s %s %s %d %s",
 			r.Method,
@@ -28,10 +68,86 @@ func LoggingMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-// responseWriter is a wrapper around http.ResponseWriter that captures the status code.
+// setAccessUser records the authenticated username for the access log.
+func setAccessUser(ctx context.Context, username string) {
+	if user, ok := ctx.Value(accessUserKey).(*string); ok {
+		*user = username
+	}
+}
+
+// accessEntry is a request as written in the JSON access log format.
+type accessEntry struct {
+	Time      time.Time `json:"time"`
+	Remote    string    `json:"remote"`
+	User      string    `json:"user,omitempty"`
+	Method    string    `json:"method"`
+	URI       string    `json:"uri"`
+	Proto     string    `json:"proto"`
+	Status    int       `json:"status"`
+	Bytes     int64     `json:"bytes"`
+	Duration  float64   `json:"duration_ms"`
+	Referer   string    `json:"referer,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+}
+
+func writeAccessLog(r *http.Request, rw *responseWriter, user string, start time.Time) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	var line []byte
+	if accessLogFormat == AccessLogJSON {
+		line, _ = json.Marshal(accessEntry{
+			Time:      start.UTC(),
+			Remote:    host,
+			User:      user,
+			Method:    r.Method,
+			URI:       r.RequestURI,
+			Proto:     r.Proto,
+			Status:    rw.statusCode,
+			Bytes:     rw.bytes,
+			Duration:  float64(time.Since(start)) / float64(time.Millisecond),
+			Referer:   r.Referer(),
+			UserAgent: r.UserAgent(),
+		})
+		line = append(line, '\n')
+	} else {
+		size := "-"
+		if rw.bytes > 0 {
+			size = strconv.FormatInt(rw.bytes, 10)
+		}
+		line = []byte(fmt.Sprintf("%s - %s [%s] %q %d %s %q %q\n",
+			host,
+			orDash(user),
+			start.Format("02/Jan/2006:15:04:05 -0700"),
+			r.Method+" "+r.RequestURI+" "+r.Proto,
+			rw.statusCode,
+			size,
+			orDash(r.Referer()),
+			orDash(r.UserAgent()),
+		))
+	}
+	accessLogMu.Lock()
+	defer accessLogMu.Unlock()
+	if _, err := accessLog.Write(line); err != nil {
+		log.Printf("writing access log: %v", err)
+	}
+}
+
+// orDash returns s, or "-" if it is empty as in Apache logs.
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// responseWriter is a wrapper around http.ResponseWriter that captures the
+// status code and the number of body bytes written.
 type responseWriter struct {
 	http.ResponseWriter
 	statusCode int
+	bytes      int64
 }
 
 // WriteHeader captures the status code.
@@ -39,3 +155,10 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.statusCode = code
 	rw.ResponseWriter.WriteHeader(code)
 }
+
+// Write counts the bytes written.
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytes += int64(n)
+	return n, err
+}
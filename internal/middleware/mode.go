@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cg011235/autocomplete/internal/response"
+)
+
+// Server modes.
+const (
+	ModeNormal      = "normal"
+	ModeReadOnly    = "read-only"
+	ModeMaintenance = "maintenance"
+)
+
+// adminPathPrefix identifies routes that stay available in every mode so the
+// mode can always be switched back.
+const adminPathPrefix = "/api/v1/admin/"
+
+// defaultRetryAfter is the Retry-After, in seconds, of the initial mode.
+const defaultRetryAfter = 60
+
+// readOnlyPosts are the POST routes that only read, taking their input in
+// the request body, and so are served in read-only mode.
+var readOnlyPosts = map[string]bool{
+	"/api/v1/words/exists": true,
+}
+
+var (
+	modeMu     sync.RWMutex
+	mode       = ModeNormal
+	retryAfter = defaultRetryAfter
+)
+
+// ValidMode reports whether m is a known server mode.
+func ValidMode(m string) bool {
+	return m == ModeNormal || m == ModeReadOnly || m == ModeMaintenance
+}
+
+// SetMode switches the server mode. retryAfterSeconds is advertised in the
+// Retry-After header of rejected requests.
+func SetMode(m string, retryAfterSeconds int) {
+	modeMu.Lock()
+	defer modeMu.Unlock()
+	mode = m
+	retryAfter = retryAfterSeconds
+}
+
+// ResetMode switches back to normal mode with the default Retry-After.
+func ResetMode() {
+	SetMode(ModeNormal, defaultRetryAfter)
+}
+
+// Mode returns the current server mode and its Retry-After value in seconds.
+func Mode() (string, int) {
+	modeMu.RLock()
+	defer modeMu.RUnlock()
+	return mode, retryAfter
+}
+
+// ModeMiddleware rejects requests not allowed in the current mode with 503.
+// In read-only mode only reads and logins are served; in maintenance mode only
+// logins and admin routes are.
+func ModeMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m, after := Mode()
+		if m != ModeNormal && !exemptFromMode(r) {
+			if m == ModeMaintenance || !isRead(r) {
+				reason := response.ReasonMaintenance
+				if m == ModeReadOnly {
+					reason = response.ReasonReadOnly
+				}
+				response.Throttled(w, http.StatusServiceUnavailable, reason, time.Duration(after)*time.Second, "Server is in "+m+" mode")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func exemptFromMode(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/api/login") || strings.HasPrefix(r.URL.Path, adminPathPrefix)
+}
+
+func isRead(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	case http.MethodPost:
+		return readOnlyPosts[r.URL.Path]
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/cg011235/autocomplete/internal/dictionary"
+)
+
+const anonymousContextKey contextKey = "anonymous"
+
+var (
+	// publicRoutes holds the "METHOD /path" routes that may be called
+	// without a token.
+	publicRoutes = map[string]bool{}
+	// publicDictionaries holds the dictionaries public routes may read.
+	publicDictionaries = map[string]bool{}
+)
+
+// SetPublicAccess lets routes, given as "METHOD /path", be called without a
+// token, but only on the given dictionaries. Anonymous requests are rate
+// limited per client IP at the public tier.
+func SetPublicAccess(routes, dicts []string) {
+	publicRoutes = make(map[string]bool, len(routes))
+	for _, route := range routes {
+		publicRoutes[route] = true
+	}
+	publicDictionaries = make(map[string]bool, len(dicts))
+	for _, name := range dicts {
+		publicDictionaries[name] = true
+	}
+}
+
+// Anonymous reports whether the request was let through JwtMiddleware
+// without a token because its route is public.
+func Anonymous(ctx context.Context) bool {
+	anonymous, _ := ctx.Value(anonymousContextKey).(bool)
+	return anonymous
+}
+
+// isPublic reports whether r may be served without a token: its route is
+// public and every dictionary it names is public.
+func isPublic(r *http.Request) bool {
+	if len(publicDictionaries) == 0 || !publicRoutes[r.Method+" "+r.URL.Path] {
+		return false
+	}
+	for _, name := range requestedDictionaries(r) {
+		if !publicDictionaries[name] {
+			return false
+		}
+	}
+	return true
+}
+
+// requestedDictionaries returns the dictionaries r names in its dicts or
+// dict parameter, or the default dictionary if it names none.
+func requestedDictionaries(r *http.Request) []string {
+	query := r.URL.Query()
+	if names := query.Get("dicts"); names != "" {
+		var dicts []string
+		for _, item := range strings.Split(names, ",") {
+			name, _, _ := strings.Cut(strings.TrimSpace(item), ":")
+			dicts = append(dicts, name)
+		}
+		return dicts
+	}
+	if name := query.Get("dict"); name != "" {
+		return []string{name}
+	}
+	return []string{dictionary.Default}
+}
@@ -0,0 +1,285 @@
+package middleware
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cg011235/autocomplete/internal/response"
+	"github.com/patrickmn/go-cache"
+	"golang.org/x/time/rate"
+)
+
+// Built-in rate limit tiers.
+const (
+	TierFree     = "free"
+	TierStandard = "standard"
+	TierInternal = "internal"
+	// TierPublic limits anonymous requests to public routes.
+	TierPublic = "public"
+	// TierWidget limits requests from browser suggest widgets.
+	TierWidget = "widget"
+)
+
+// ErrUnknownTier is returned for tiers that do not exist.
+var ErrUnknownTier = errors.New("unknown tier")
+
+// Tier is a token bucket configuration: Rate tokens per second with bursts of up to Burst.
+type Tier struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+// builtinTiers returns the tiers every server starts with.
+func builtinTiers() map[string]Tier {
+	return map[string]Tier{
+		TierFree:     {Rate: 1, Burst: 3},
+		TierStandard: {Rate: 10, Burst: 20},
+		TierInternal: {Rate: 100, Burst: 200},
+		TierPublic:   {Rate: 0.5, Burst: 3},
+		TierWidget:   {Rate: 5, Burst: 20},
+	}
+}
+
+var (
+	tiersMu sync.RWMutex
+	tiers   = builtinTiers()
+	// userTiers assigns tiers to individual usernames, overriding the role default.
+	userTiers = map[string]string{}
+
+	// limiters holds one token bucket per principal; idle buckets expire.
+	limiters = cache.New(10*time.Minute, 20*time.Minute)
+
+	// limiter decides whether requests are allowed.
+	limiter Limiter = LocalLimiter{}
+)
+
+// Limiter decides whether the principal identified by key may make another
+// request under tier t.
+type Limiter interface {
+	Allow(key string, t Tier) bool
+}
+
+// SetLimiter replaces the in-process token buckets, e.g. with a limiter
+// shared by all replicas.
+func SetLimiter(l Limiter) {
+	limiter = l
+}
+
+// LocalLimiter keeps a token bucket per principal in process memory, so
+// each replica enforces limits on its own.
+type LocalLimiter struct{}
+
+// Allow takes a token from the principal's bucket.
+func (LocalLimiter) Allow(key string, t Tier) bool {
+	return limiterFor(key, t).Allow()
+}
+
+// SetTier creates or updates a tier. Existing buckets are reset so the new
+// limits apply immediately.
+func SetTier(name string, t Tier) {
+	tiersMu.Lock()
+	defer tiersMu.Unlock()
+	tiers[name] = t
+	limiters.Flush()
+}
+
+// DeleteTier removes a tier. Built-in tiers and tiers assigned to a user
+// cannot be removed.
+func DeleteTier(name string) error {
+	tiersMu.Lock()
+	defer tiersMu.Unlock()
+	switch name {
+	case TierFree, TierStandard, TierInternal, TierPublic, TierWidget:
+		return errors.New("built-in tier " + name + " cannot be deleted")
+	}
+	if _, ok := tiers[name]; !ok {
+		return ErrUnknownTier
+	}
+	for user, tier := range userTiers {
+		if tier == name {
+			return errors.New("tier " + name + " is assigned to " + user)
+		}
+	}
+	delete(tiers, name)
+	return nil
+}
+
+// Tiers returns a copy of the configured tiers.
+func Tiers() map[string]Tier {
+	tiersMu.RLock()
+	defer tiersMu.RUnlock()
+	copied := make(map[string]Tier, len(tiers))
+	for name, t := range tiers {
+		copied[name] = t
+	}
+	return copied
+}
+
+// AssignTier sets the tier of a username. An empty tier removes the assignment.
+// It returns false if the tier does not exist.
+func AssignTier(username, tier string) bool {
+	tiersMu.Lock()
+	defer tiersMu.Unlock()
+	if tier == "" {
+		delete(userTiers, username)
+	} else if _, ok := tiers[tier]; !ok {
+		return false
+	} else {
+		userTiers[username] = tier
+	}
+	limiters.Delete("user:" + username)
+	return true
+}
+
+// TierAssignments returns a copy of the per-username tier assignments.
+func TierAssignments() map[string]string {
+	tiersMu.RLock()
+	defer tiersMu.RUnlock()
+	copied := make(map[string]string, len(userTiers))
+	for user, tier := range userTiers {
+		copied[user] = tier
+	}
+	return copied
+}
+
+// TierOf returns the tier applied to a principal: an explicit assignment if
+// any, otherwise internal for admins and free for everyone else.
+func TierOf(username, role string) string {
+	tiersMu.RLock()
+	defer tiersMu.RUnlock()
+	if tier, ok := userTiers[username]; ok {
+		return tier
+	}
+	if role == RoleAdmin {
+		return TierInternal
+	}
+	return TierFree
+}
+
+// tierConfig returns the named tier, or a one request per second tier if it
+// does not exist.
+func tierConfig(name string) Tier {
+	tiersMu.RLock()
+	defer tiersMu.RUnlock()
+	if t, ok := tiers[name]; ok {
+		return t
+	}
+	return Tier{Rate: 1, Burst: 1}
+}
+
+// limiterFor returns the token bucket of the given principal key.
+func limiterFor(key string, t Tier) *rate.Limiter {
+	if l, found := limiters.Get(key); found {
+		return l.(*rate.Limiter)
+	}
+	l := rate.NewLimiter(rate.Limit(t.Rate), t.Burst)
+	if err := limiters.Add(key, l, cache.DefaultExpiration); err != nil {
+		// Another request created the bucket concurrently; use theirs.
+		if existing, found := limiters.Get(key); found {
+			return existing.(*rate.Limiter)
+		}
+	}
+	return l
+}
+
+// RateLimitMiddleware handles rate limiting. Authenticated requests are
+// limited per username according to their tier; anonymous requests are
+// limited per client IP at the free tier, or the public tier on public
+// routes. On authenticated routes it must run after JwtMiddleware.
+func RateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var key, tier string
+		if username := Username(r.Context()); username != "" {
+			key, tier = "user:"+username, TierOf(username, Role(r.Context()))
+		} else if Anonymous(r.Context()) {
+			key, tier = "public:"+ClientIP(r), TierPublic
+		} else {
+			key, tier = "ip:"+ClientIP(r), TierFree
+		}
+
+		// Check if the request is allowed by the principal's rate limiter.
+		if t := tierConfig(tier); !limiter.Allow(key, t) {
+			rateLimited(w, t)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ClientRateLimit limits requests per client IP at tier, with buckets
+// separate from those of RateLimitMiddleware. It is meant for
+// unauthenticated routes with limits of their own.
+func ClientRateLimit(tier string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if t := tierConfig(tier); !limiter.Allow(tier+":"+ClientIP(r), t) {
+				rateLimited(w, t)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// rateLimited rejects a request over the limits of tier t, asking the client
+// to retry once its bucket has refilled a token.
+func rateLimited(w http.ResponseWriter, t Tier) {
+	retry := time.Minute
+	if t.Rate > 0 {
+		retry = time.Duration(float64(time.Second) / t.Rate)
+	}
+	response.Throttled(w, http.StatusTooManyRequests, response.ReasonRateLimited, retry, "Too many requests")
+}
+
+// trustedProxies are the peers whose X-Forwarded-For header is believed.
+var trustedProxies []*net.IPNet
+
+// SetTrustedProxies sets the reverse proxies ClientIP looks through.
+func SetTrustedProxies(nets []*net.IPNet) {
+	trustedProxies = nets
+}
+
+// ClientIP returns the address of the client that sent the request: the host
+// part of the request's remote address or, when that is a trusted proxy, the
+// last address in X-Forwarded-For not added by a trusted proxy. Addresses
+// further left were supplied by the client and cannot be trusted.
+func ClientIP(r *http.Request) string {
+	ip := peerIP(r)
+	if !isTrustedProxy(ip) {
+		return ip
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		ip = hop
+		if !isTrustedProxy(hop) {
+			break
+		}
+	}
+	return ip
+}
+
+// peerIP returns the host part of the request's remote address.
+func peerIP(r *http.Request) string {
+	// Peers on a Unix socket have no address and are local by definition.
+	if r.RemoteAddr == "" || r.RemoteAddr == "@" {
+		return "127.0.0.1"
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func isTrustedProxy(ip string) bool {
+	parsed := net.ParseIP(ip)
+	return parsed != nil && contains(trustedProxies, parsed)
+}
@@ -0,0 +1,143 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cg011235/autocomplete/internal/response"
+	"github.com/gorilla/mux"
+)
+
+var (
+	// defaultTimeout applies to routes without an entry in routeTimeouts.
+	defaultTimeout = 10 * time.Second
+	// routeTimeouts maps "METHOD /path/template" or, for requests with a
+	// non-empty query parameter, "METHOD /path/template?param" to the
+	// route's deadline.
+	routeTimeouts = map[string]time.Duration{}
+)
+
+// SetTimeouts configures the default request deadline and per-route overrides
+// keyed by "METHOD /path/template", e.g. "GET /api/v1/words", or by
+// "METHOD /path/template?param" to only apply to requests with param, e.g.
+// "GET /api/v1/words?prefix". A zero duration disables the deadline.
+func SetTimeouts(def time.Duration, routes map[string]time.Duration) {
+	defaultTimeout = def
+	routeTimeouts = routes
+}
+
+// routeTimeout returns the deadline configured for the matched route,
+// preferring an override for a query parameter of the request.
+func routeTimeout(r *http.Request) time.Duration {
+	if route := mux.CurrentRoute(r); route != nil {
+		if tpl, err := route.GetPathTemplate(); err == nil {
+			key := r.Method + " " + tpl
+			query := r.URL.Query()
+			params := make([]string, 0, len(query))
+			for param := range query {
+				params = append(params, param)
+			}
+			sort.Strings(params)
+			for _, param := range params {
+				if d, ok := routeTimeouts[key+"?"+param]; ok && query.Get(param) != "" {
+					return d
+				}
+			}
+			if d, ok := routeTimeouts[key]; ok {
+				return d
+			}
+		}
+	}
+	return defaultTimeout
+}
+
+// TimeoutMiddleware enforces the route's deadline on reads. The handler runs
+// with a context cancelled at the deadline; if it has not finished by then,
+// its output is discarded and 504 is returned instead. Writes are not timed
+// out: the handler would still commit after the client was told it failed.
+func TimeoutMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isRead(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		timeout := routeTimeout(r)
+		if timeout <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		tw := &timeoutWriter{header: make(http.Header), code: http.StatusOK}
+		done := make(chan struct{})
+		panicked := make(chan interface{}, 1)
+		go func() {
+			defer func() {
+				if p := recover(); p != nil {
+					panicked <- p
+				}
+			}()
+			next.ServeHTTP(tw, r.WithContext(ctx))
+			close(done)
+		}()
+
+		select {
+		case p := <-panicked:
+			panic(p)
+		case <-done:
+			tw.mu.Lock()
+			defer tw.mu.Unlock()
+			dst := w.Header()
+			for k, v := range tw.header {
+				dst[k] = v
+			}
+			w.WriteHeader(tw.code)
+			w.Write(tw.buf.Bytes())
+		case <-ctx.Done():
+			tw.mu.Lock()
+			defer tw.mu.Unlock()
+			tw.timedOut = true
+			response.Error(w, http.StatusGatewayTimeout, "Request timed out")
+		}
+	})
+}
+
+// timeoutWriter buffers a handler's response until it completes in time.
+type timeoutWriter struct {
+	mu          sync.Mutex
+	header      http.Header
+	buf         bytes.Buffer
+	code        int
+	wroteHeader bool
+	timedOut    bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	tw.wroteHeader = true
+	return tw.buf.Write(p)
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.wroteHeader {
+		return
+	}
+	tw.wroteHeader = true
+	tw.code = code
+}
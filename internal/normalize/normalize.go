@@ -0,0 +1,181 @@
+// Package normalize maps words and prefixes to the form they are stored and
+// looked up under, e.g. so that "Café" and "cafe" are stored as one word,
+// and splits text into the words indexed for it.
+package normalize
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Normalizer rewrites a word or prefix.
+type Normalizer interface {
+	Normalize(s string) string
+}
+
+// Func adapts a function to the Normalizer interface.
+type Func func(s string) string
+
+// Normalize calls f.
+func (f Func) Normalize(s string) string {
+	return f(s)
+}
+
+// Tokenizer splits text into the words it is indexed under.
+type Tokenizer interface {
+	Tokenize(s string) []string
+}
+
+// TokenizerFunc adapts a function to the Tokenizer interface.
+type TokenizerFunc func(s string) []string
+
+// Tokenize calls f.
+func (f TokenizerFunc) Tokenize(s string) []string {
+	return f(s)
+}
+
+// None is the name of the empty pipeline and of the tokenizer keeping text
+// whole.
+const None = "none"
+
+var (
+	mu          sync.RWMutex
+	normalizers = map[string]Normalizer{
+		"lowercase":  Func(strings.ToLower),
+		"nfc":        Func(norm.NFC.String),
+		"diacritics": Func(StripDiacritics),
+		"whitespace": Func(CollapseWhitespace),
+	}
+	tokenizers = map[string]Tokenizer{
+		None:         TokenizerFunc(func(s string) []string { return []string{s} }),
+		"whitespace": TokenizerFunc(strings.Fields),
+	}
+)
+
+// RegisterNormalizer makes a normalizer available under name, replacing any
+// registered before.
+func RegisterNormalizer(name string, n Normalizer) {
+	mu.Lock()
+	defer mu.Unlock()
+	normalizers[name] = n
+}
+
+// RegisterTokenizer makes a tokenizer available under name, replacing any
+// registered before.
+func RegisterTokenizer(name string, t Tokenizer) {
+	mu.Lock()
+	defer mu.Unlock()
+	tokenizers[name] = t
+}
+
+// LookupTokenizer returns the tokenizer registered under name; "" is None.
+func LookupTokenizer(name string) (Tokenizer, error) {
+	if name == "" {
+		name = None
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	t, ok := tokenizers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown tokenizer %q", name)
+	}
+	return t, nil
+}
+
+// Pipeline applies normalizers in order.
+type Pipeline struct {
+	names []string
+	steps []Normalizer
+}
+
+// Parse builds a pipeline from normalizer names: lowercase, nfc,
+// diacritics, whitespace or registered ones. The single name "none" is the
+// empty pipeline.
+func Parse(names []string) (Pipeline, error) {
+	if len(names) == 1 && names[0] == None {
+		return Pipeline{}, nil
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	p := Pipeline{names: names, steps: make([]Normalizer, len(names))}
+	for i, name := range names {
+		n, ok := normalizers[name]
+		if !ok {
+			return Pipeline{}, fmt.Errorf("unknown normalizer %q", name)
+		}
+		p.steps[i] = n
+	}
+	return p, nil
+}
+
+// Normalize applies the pipeline to s.
+func (p Pipeline) Normalize(s string) string {
+	for _, n := range p.steps {
+		s = n.Normalize(s)
+	}
+	return s
+}
+
+// Names returns the names of the pipeline's normalizers.
+func (p Pipeline) Names() []string {
+	return append([]string(nil), p.names...)
+}
+
+// Has reports whether the pipeline includes the named normalizer.
+func (p Pipeline) Has(name string) bool {
+	for _, n := range p.names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Without returns the pipeline without the named normalizer.
+func (p Pipeline) Without(name string) Pipeline {
+	var q Pipeline
+	for i, n := range p.names {
+		if n != name {
+			q.names = append(q.names, n)
+			q.steps = append(q.steps, p.steps[i])
+		}
+	}
+	return q
+}
+
+// With returns the pipeline with the named normalizer appended unless it
+// is already included.
+func (p Pipeline) With(name string) (Pipeline, error) {
+	if p.Has(name) {
+		return p, nil
+	}
+	extra, err := Parse([]string{name})
+	if err != nil {
+		return Pipeline{}, err
+	}
+	return Pipeline{
+		names: append(p.Names(), name),
+		steps: append(append([]Normalizer(nil), p.steps...), extra.steps...),
+	}, nil
+}
+
+// StripDiacritics removes accents and other combining marks, e.g. "café"
+// becomes "cafe".
+func StripDiacritics(s string) string {
+	return norm.NFC.String(strings.Map(func(c rune) rune {
+		if unicode.Is(unicode.Mn, c) {
+			return -1
+		}
+		return c
+	}, norm.NFD.String(s)))
+}
+
+// CollapseWhitespace trims s and replaces each run of whitespace within it
+// with a single space.
+func CollapseWhitespace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
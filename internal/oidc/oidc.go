@@ -0,0 +1,162 @@
+// Package oidc implements the OAuth2 authorization code flow against an
+// OpenID Connect provider and maps provider claims to service roles.
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cg011235/autocomplete/internal/jwks"
+	"github.com/golang-jwt/jwt"
+	"golang.org/x/oauth2"
+)
+
+// Config describes the OIDC client registration.
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	// RoleClaim names the ID token claim (string or list) checked against AdminValues.
+	RoleClaim string
+	// AdminValues are the RoleClaim values granting the admin role.
+	AdminValues []string
+}
+
+// Provider performs logins against an OIDC provider.
+type Provider struct {
+	oauth2      oauth2.Config
+	keys        *jwks.Set
+	issuer      string
+	clientID    string
+	roleClaim   string
+	adminValues []string
+}
+
+// discovery is the subset of the provider metadata document we use.
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// NewProvider fetches the provider's discovery document and prepares the
+// client. The provider's signing keys are refreshed until ctx is done.
+func NewProvider(ctx context.Context, cfg Config) (*Provider, error) {
+	url := strings.TrimSuffix(cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := (&http.Client{Timeout: 10 * time.Second}).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching discovery document: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching discovery document: unexpected status %s", resp.Status)
+	}
+	var doc discovery
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("decoding discovery document: %w", err)
+	}
+
+	return &Provider{
+		oauth2: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  doc.AuthorizationEndpoint,
+				TokenURL: doc.TokenEndpoint,
+			},
+			Scopes: []string{"openid", "profile", "email"},
+		},
+		keys:        jwks.New(ctx, doc.JWKSURI, time.Hour),
+		issuer:      doc.Issuer,
+		clientID:    cfg.ClientID,
+		roleClaim:   cfg.RoleClaim,
+		adminValues: cfg.AdminValues,
+	}, nil
+}
+
+// AuthCodeURL returns the provider URL the user is redirected to for login.
+func (p *Provider) AuthCodeURL(state string) string {
+	return p.oauth2.AuthCodeURL(state)
+}
+
+// Identity is the authenticated user as mapped from the ID token.
+type Identity struct {
+	Username string
+	Admin    bool
+}
+
+// Exchange trades an authorization code for tokens and returns the identity
+// in the verified ID token.
+func (p *Provider) Exchange(ctx context.Context, code string) (*Identity, error) {
+	token, err := p.oauth2.Exchange(ctx, code)
+	if err != nil {
+		return nil, fmt.Errorf("exchanging code: %w", err)
+	}
+	raw, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("token response has no id_token")
+	}
+
+	parsed, err := jwt.Parse(raw, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		kid, _ := t.Header["kid"].(string)
+		return p.keys.Key(kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("verifying id_token: %w", err)
+	}
+	claims := parsed.Claims.(jwt.MapClaims)
+	if !claims.VerifyIssuer(p.issuer, true) || !claims.VerifyAudience(p.clientID, true) {
+		return nil, errors.New("id_token issued for another issuer or client")
+	}
+
+	identity := &Identity{Admin: p.isAdmin(claims[p.roleClaim])}
+	for _, claim := range []string{"preferred_username", "email", "sub"} {
+		if name, _ := claims[claim].(string); name != "" {
+			identity.Username = name
+			break
+		}
+	}
+	if identity.Username == "" {
+		return nil, errors.New("id_token has no usable subject")
+	}
+	return identity, nil
+}
+
+// isAdmin reports whether the role claim (a string or list of strings)
+// contains one of the configured admin values.
+func (p *Provider) isAdmin(claim interface{}) bool {
+	var values []string
+	switch v := claim.(type) {
+	case string:
+		values = []string{v}
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+	for _, v := range values {
+		for _, admin := range p.adminValues {
+			if v == admin {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+// Package personal keeps per-user suggestion history used to personalize rankings.
+package personal
+
+import "sync"
+
+// entry is a word a user accepted and how often they accepted it.
+type entry struct {
+	word  string
+	count int
+}
+
+// History records accepted suggestions per user. Each user keeps at most
+// size entries; when full, the least accepted word is evicted.
+type History struct {
+	mu    sync.RWMutex
+	users map[string][]entry
+	size  int
+}
+
+// NewHistory creates a History keeping at most size words per user.
+func NewHistory(size int) *History {
+	return &History{users: make(map[string][]entry), size: size}
+}
+
+// Record counts an accepted suggestion for the given user.
+func (h *History) Record(user, word string) {
+	if user == "" || h.size <= 0 {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	entries := h.users[user]
+	for i := range entries {
+		if entries[i].word == word {
+			entries[i].count++
+			return
+		}
+	}
+	if len(entries) < h.size {
+		h.users[user] = append(entries, entry{word, 1})
+		return
+	}
+	// Evict the least accepted word to make room.
+	min := 0
+	for i := range entries {
+		if entries[i].count < entries[min].count {
+			min = i
+		}
+	}
+	entries[min] = entry{word, 1}
+}
+
+// Counts returns a copy of the user's accepted words and their counts.
+func (h *History) Counts(user string) map[string]int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	entries := h.users[user]
+	if len(entries) == 0 {
+		return nil
+	}
+	counts := make(map[string]int, len(entries))
+	for _, e := range entries {
+		counts[e.word] = e.count
+	}
+	return counts
+}
+
+// Clear deletes all history of the given user.
+func (h *History) Clear(user string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.users, user)
+}
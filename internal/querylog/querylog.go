@@ -0,0 +1,191 @@
+// Package querylog samples raw suggest queries and exports them as NDJSON,
+// to rotated files or an HTTP endpoint, e.g. to train ranking models offline.
+package querylog
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/cg011235/autocomplete/internal/rotate"
+)
+
+const queueSize = 4096
+
+// Entry is one sampled query. User is a keyed hash of the username, so
+// queries of a user can be grouped without revealing who they are; it is
+// empty for anonymous requests.
+type Entry struct {
+	Time    time.Time `json:"time"`
+	Dict    string    `json:"dict"`
+	Prefix  string    `json:"prefix"`
+	Latency float64   `json:"latency_ms"`
+	Results int       `json:"results"`
+	User    string    `json:"user,omitempty"`
+}
+
+// Sink receives batches of sampled entries.
+type Sink interface {
+	Write(entries []Entry) error
+}
+
+// Logger samples queries and hands them to its sinks in batches from a
+// background worker, so recording never blocks a request. Entries arriving
+// while the queue is full are dropped.
+type Logger struct {
+	rate  float64
+	salt  []byte
+	sinks []Sink
+	queue chan Entry
+	done  chan struct{}
+}
+
+// New starts a Logger keeping a rate fraction (0 to 1) of queries and
+// writing them to sinks once batch entries are pending or every interval.
+// Usernames are hashed with salt.
+func New(rate float64, salt []byte, batch int, interval time.Duration, sinks ...Sink) *Logger {
+	l := &Logger{
+		rate:  rate,
+		salt:  salt,
+		sinks: sinks,
+		queue: make(chan Entry, queueSize),
+		done:  make(chan struct{}),
+	}
+	go l.run(max(batch, 1), interval)
+	return l
+}
+
+// Record samples a query for prefix in dict by user that returned results
+// after latency.
+func (l *Logger) Record(dict, prefix, user string, latency time.Duration, results int) {
+	if rand.Float64() >= l.rate {
+		return
+	}
+	e := Entry{
+		Time:    time.Now().UTC(),
+		Dict:    dict,
+		Prefix:  prefix,
+		Latency: float64(latency) / float64(time.Millisecond),
+		Results: results,
+	}
+	if user != "" {
+		mac := hmac.New(sha256.New, l.salt)
+		mac.Write([]byte(user))
+		e.User = hex.EncodeToString(mac.Sum(nil))[:16]
+	}
+	select {
+	case l.queue <- e:
+	default:
+	}
+}
+
+// Close writes the pending entries and stops the worker.
+func (l *Logger) Close() {
+	close(l.queue)
+	<-l.done
+}
+
+func (l *Logger) run(batch int, interval time.Duration) {
+	defer close(l.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	pending := make([]Entry, 0, batch)
+	flush := func() {
+		if len(pending) == 0 {
+			return
+		}
+		for _, s := range l.sinks {
+			if err := s.Write(pending); err != nil {
+				log.Printf("querylog: dropping %d entries: %v", len(pending), err)
+			}
+		}
+		pending = pending[:0]
+	}
+	for {
+		select {
+		case e, ok := <-l.queue:
+			if !ok {
+				flush()
+				return
+			}
+			pending = append(pending, e)
+			if len(pending) >= batch {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+func encode(entries []Entry) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// FileSink appends entries to queries.ndjson in a directory, rotated once
+// it exceeds maxBytes, keeping at most maxFiles rotated files.
+type FileSink struct {
+	f *rotate.File
+}
+
+// NewFileSink opens or creates the current file in dir.
+func NewFileSink(dir string, maxBytes int64, maxFiles int) (*FileSink, error) {
+	f, err := rotate.Open(filepath.Join(dir, "queries.ndjson"), maxBytes, 0, maxFiles)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{f: f}, nil
+}
+
+// Write appends entries, rotating the file first if it is full.
+func (s *FileSink) Write(entries []Entry) error {
+	data, err := encode(entries)
+	if err != nil {
+		return err
+	}
+	_, err = s.f.Write(data)
+	return err
+}
+
+// HTTPSink POSTs each batch to a URL as an application/x-ndjson body.
+type HTTPSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPSink ships batches to url.
+func NewHTTPSink(url string) *HTTPSink {
+	return &HTTPSink{url: url, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Write posts entries in a single request.
+func (s *HTTPSink) Write(entries []Entry) error {
+	data, err := encode(entries)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Post(s.url, "application/x-ndjson", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
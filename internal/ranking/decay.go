@@ -0,0 +1,56 @@
+// Package ranking provides background jobs and helpers that order suggestions.
+package ranking
+
+import (
+	"context"
+	"log"
+	"math"
+	"time"
+)
+
+// Decayer periodically decays word weights so that rankings follow recent
+// popularity: a selection counted now is worth half as much after HalfLife.
+type Decayer struct {
+	// Decay multiplies every weight by factor on each run.
+	Decay    func(factor float64)
+	HalfLife time.Duration
+	Interval time.Duration
+	// Decayed, if not nil, is called after every pass, e.g. to drop
+	// results ranked with the previous weights.
+	Decayed func()
+}
+
+// NewDecayer creates a Decayer applying each pass with decay.
+func NewDecayer(decay func(factor float64), halfLife, interval time.Duration) *Decayer {
+	return &Decayer{Decay: decay, HalfLife: halfLife, Interval: interval}
+}
+
+// Factor returns the multiplier applied to weights after one interval.
+func (d *Decayer) Factor() float64 {
+	return math.Pow(0.5, d.Interval.Seconds()/d.HalfLife.Seconds())
+}
+
+// Run decays weights every Interval until the context is cancelled.
+// It returns immediately if HalfLife or Interval is not positive.
+func (d *Decayer) Run(ctx context.Context) {
+	if d.HalfLife <= 0 || d.Interval <= 0 {
+		return
+	}
+	factor := d.Factor()
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			start := time.Now()
+			d.Decay(factor)
+			if d.Decayed != nil {
+				d.Decayed()
+			}
+			log.Printf("decayed word weights by %.4f in %s", factor, time.Since(start))
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package ranking
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/cg011235/autocomplete/internal/trie"
+)
+
+// Candidate is a word to be ranked with its ranking inputs.
+type Candidate struct {
+	Word string
+	// Weight is the word's stored weight, including decayed selection boosts.
+	Weight float64
+	// InContext reports whether the word is tagged with the query context.
+	InContext bool
+	// Updated is when the word was last added or selected, or zero if not
+	// known, e.g. after a restart.
+	Updated time.Time
+}
+
+// Query is the request candidates are ranked for.
+type Query struct {
+	Prefix  string
+	Context string
+}
+
+// Ranker orders suggestion candidates. Rank may reorder candidates in place
+// and returns them in the order they are suggested.
+type Ranker interface {
+	Rank(candidates []Candidate, q Query) []Candidate
+}
+
+// Booster is implemented by rankers that add to a candidate's score beyond
+// its weight and context boost, so explanations can report the addition.
+type Booster interface {
+	BoostFor(c Candidate, now time.Time) float64
+}
+
+// RankerFunc adapts a function to the Ranker interface.
+type RankerFunc func(candidates []Candidate, q Query) []Candidate
+
+// Rank calls f.
+func (f RankerFunc) Rank(candidates []Candidate, q Query) []Candidate {
+	return f(candidates, q)
+}
+
+// DefaultRanker is the name of the ranker used when none is selected.
+const DefaultRanker = "frequency"
+
+var (
+	rankersMu sync.RWMutex
+	rankers   = map[string]Ranker{
+		"frequency":    RankerFunc(Frequency),
+		"alphabetical": RankerFunc(Alphabetical),
+		"shortest":     RankerFunc(Shortest),
+		"recency":      &RecencyBlend{Boost: 10, HalfLife: 24 * time.Hour},
+	}
+)
+
+// Register makes a ranker available under name, replacing any registered
+// before, so it can be selected per dictionary.
+func Register(name string, r Ranker) {
+	rankersMu.Lock()
+	defer rankersMu.Unlock()
+	rankers[name] = r
+}
+
+// Lookup returns the ranker registered under name.
+func Lookup(name string) (Ranker, error) {
+	rankersMu.RLock()
+	defer rankersMu.RUnlock()
+	r, ok := rankers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown ranker %q", name)
+	}
+	return r, nil
+}
+
+// Order ranks words of t in place with r. Candidates are handed to r in word
+// order, so a registered ranker that sorts stably, or deterministically,
+// orders ties the same way whatever order the Trie collected the words in.
+func Order(r Ranker, t *trie.Trie, words []string, q Query) {
+	OrderBoosted(r, t, words, q, nil)
+}
+
+// OrderBoosted is Order with boost[word] added to the weight of each word.
+func OrderBoosted(r Ranker, t *trie.Trie, words []string, q Query, boost map[string]float64) {
+	candidates := make([]Candidate, len(words))
+	for i, word := range words {
+		candidates[i] = NewCandidate(t, word, q)
+		candidates[i].Weight += boost[word]
+	}
+	for i, c := range OrderCandidates(r, candidates, q) {
+		words[i] = c.Word
+	}
+}
+
+// NewCandidate returns the ranking inputs of word in t for q.
+func NewCandidate(t *trie.Trie, word string, q Query) Candidate {
+	return Candidate{
+		Word:      word,
+		Weight:    t.Weight(word),
+		InContext: q.Context != "" && t.HasContext(word, q.Context),
+		Updated:   t.Updated(word),
+	}
+}
+
+// OrderCandidates ranks candidates with r, handing them to r in word order
+// like Order, and returns them in the order they are suggested.
+func OrderCandidates(r Ranker, candidates []Candidate, q Query) []Candidate {
+	byWord := func(i, j int) bool { return candidates[i].Word < candidates[j].Word }
+	if !sort.SliceIsSorted(candidates, byWord) {
+		sort.Slice(candidates, byWord)
+	}
+	return r.Rank(candidates, q)
+}
+
+// score is the frequency score of a candidate.
+func (c Candidate) score() float64 {
+	if c.InContext {
+		return c.Weight + ContextBoost
+	}
+	return c.Weight
+}
+
+// Before reports whether a word scoring si ranks before one scoring sj:
+// by descending score, with equal scores broken by word so they come out in
+// the same order on every request and replica, whatever order the words
+// were collected in. NaN scores rank last.
+func Before(si float64, wi string, sj float64, wj string) bool {
+	if ni, nj := math.IsNaN(si), math.IsNaN(sj); ni || nj {
+		if ni != nj {
+			return nj
+		}
+	} else if si != sj {
+		return si > sj
+	}
+	return wi < wj
+}
+
+// Frequency orders candidates by descending score, breaking ties
+// alphabetically, like Rank.
+func Frequency(candidates []Candidate, _ Query) []Candidate {
+	less := func(i, j int) bool {
+		return Before(candidates[i].score(), candidates[i].Word, candidates[j].score(), candidates[j].Word)
+	}
+	if !sort.SliceIsSorted(candidates, less) {
+		sort.Slice(candidates, less)
+	}
+	return candidates
+}
+
+// Alphabetical orders candidates alphabetically, ignoring scores.
+func Alphabetical(candidates []Candidate, _ Query) []Candidate {
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Word < candidates[j].Word })
+	return candidates
+}
+
+// Shortest orders candidates by length in characters, breaking ties by
+// descending score and then alphabetically.
+func Shortest(candidates []Candidate, _ Query) []Candidate {
+	sort.Slice(candidates, func(i, j int) bool {
+		li, lj := utf8.RuneCountInString(candidates[i].Word), utf8.RuneCountInString(candidates[j].Word)
+		if li != lj {
+			return li < lj
+		}
+		return Before(candidates[i].score(), candidates[i].Word, candidates[j].score(), candidates[j].Word)
+	})
+	return candidates
+}
+
+// RecencyBlend orders candidates by score plus a boost for recently added or
+// selected words, worth Boost when just updated and halving every HalfLife.
+type RecencyBlend struct {
+	Boost    float64
+	HalfLife time.Duration
+}
+
+// Boost implements Booster.
+func (b *RecencyBlend) BoostFor(c Candidate, now time.Time) float64 {
+	if c.Updated.IsZero() || b.HalfLife <= 0 {
+		return 0
+	}
+	return b.Boost * math.Pow(0.5, now.Sub(c.Updated).Seconds()/b.HalfLife.Seconds())
+}
+
+// Rank implements Ranker.
+func (b *RecencyBlend) Rank(candidates []Candidate, _ Query) []Candidate {
+	now := time.Now()
+	scores := make(map[string]float64, len(candidates))
+	for _, c := range candidates {
+		scores[c.Word] = c.score() + b.BoostFor(c, now)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		wi, wj := candidates[i].Word, candidates[j].Word
+		return Before(scores[wi], wi, scores[wj], wj)
+	})
+	return candidates
+}
@@ -0,0 +1,144 @@
+package ranking
+
+import (
+	"math"
+	"math/rand"
+	"slices"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/cg011235/autocomplete/internal/trie"
+)
+
+func TestTiesBrokenByWord(t *testing.T) {
+	tr := trie.NewTrie()
+	for _, word := range []string{"dog", "cat", "cow", "ant", "bee", "eel"} {
+		tr.Insert(word)
+	}
+	tr.Boost("cow", 2)
+	want := map[string][]string{
+		"frequency":    {"cow", "ant", "bee", "cat", "dog", "eel"},
+		"alphabetical": {"ant", "bee", "cat", "cow", "dog", "eel"},
+		"shortest":     {"cow", "ant", "bee", "cat", "dog", "eel"},
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	for name, expected := range want {
+		r, err := Lookup(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 20; i++ {
+			words := slices.Clone(expected)
+			rng.Shuffle(len(words), func(i, j int) { words[i], words[j] = words[j], words[i] })
+			Order(r, tr, words, Query{})
+			if !slices.Equal(words, expected) {
+				t.Fatalf("%s: got %v, want %v", name, words, expected)
+			}
+		}
+	}
+}
+
+func TestOrderGivesRankersWordOrder(t *testing.T) {
+	tr := trie.NewTrie()
+	for _, word := range []string{"pear", "plum", "peach"} {
+		tr.Insert(word)
+	}
+	// A ranker that ranks every candidate equal and sorts stably keeps the
+	// order it was given.
+	stable := RankerFunc(func(c []Candidate, _ Query) []Candidate {
+		sort.SliceStable(c, func(i, j int) bool { return false })
+		return c
+	})
+	for _, words := range [][]string{{"plum", "pear", "peach"}, {"peach", "plum", "pear"}} {
+		Order(stable, tr, words, Query{})
+		if want := []string{"peach", "pear", "plum"}; !slices.Equal(words, want) {
+			t.Fatalf("got %v, want %v", words, want)
+		}
+	}
+}
+
+func TestBlendUsesRanker(t *testing.T) {
+	tr := trie.NewTrie()
+	for _, word := range []string{"pear", "plum", "peach"} {
+		tr.Insert(word)
+	}
+	history := map[string]int{"plum": 3}
+	want := map[string][]string{
+		"frequency":    {"plum", "peach", "pear"},
+		"alphabetical": {"peach", "pear", "plum"},
+	}
+	for name, expected := range want {
+		r, err := Lookup(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		words := []string{"peach", "pear", "plum"}
+		Blend(r, tr, words, Query{}, history, 1)
+		if !slices.Equal(words, expected) {
+			t.Fatalf("%s: got %v, want %v", name, words, expected)
+		}
+	}
+}
+
+func TestBefore(t *testing.T) {
+	nan := math.NaN()
+	cases := []struct {
+		si     float64
+		wi     string
+		sj     float64
+		wj     string
+		before bool
+	}{
+		{2, "b", 1, "a", true},
+		{1, "a", 2, "b", false},
+		{1, "a", 1, "b", true},
+		{1, "b", 1, "a", false},
+		{1, "b", nan, "a", true},
+		{nan, "a", 1, "b", false},
+		{nan, "a", nan, "b", true},
+	}
+	for _, c := range cases {
+		if got := Before(c.si, c.wi, c.sj, c.wj); got != c.before {
+			t.Errorf("Before(%v, %q, %v, %q) = %v, want %v", c.si, c.wi, c.sj, c.wj, got, c.before)
+		}
+	}
+}
+
+func TestRecencyTiesBrokenByWord(t *testing.T) {
+	b := &RecencyBlend{Boost: 10, HalfLife: time.Hour}
+	updated := time.Now().Add(-time.Minute)
+	candidates := []Candidate{
+		{Word: "zebra", Weight: 1},
+		{Word: "yak", Weight: 1, Updated: updated},
+		{Word: "xerus", Weight: 1, Updated: updated},
+		{Word: "aardvark", Weight: 1},
+	}
+	got := b.Rank(candidates, Query{})
+	want := []string{"xerus", "yak", "aardvark", "zebra"}
+	for i, c := range got {
+		if c.Word != want[i] {
+			t.Fatalf("got %v at %d, want %v", c.Word, i, want[i])
+		}
+	}
+}
+
+func TestExplainRecency(t *testing.T) {
+	tr := trie.NewTrie()
+	tr.Insert("apple")
+	tr.Boost("apple", 2)
+	recency, _ := Lookup("recency")
+	frequency, _ := Lookup("frequency")
+
+	c := Explain(recency, tr, "apple", Query{Prefix: "a"})
+	if c.Weight != 2 || c.Recency <= 9 || c.Recency > 10 {
+		t.Fatalf("recency: got %+v, want weight 2 and a boost just under 10", c)
+	}
+	if c.Score() != c.Weight+c.Recency {
+		t.Fatalf("recency: score %v is not the sum of %+v", c.Score(), c)
+	}
+	if c := Explain(frequency, tr, "apple", Query{Prefix: "a"}); c.Recency != 0 {
+		t.Fatalf("frequency: got recency boost %v, want 0", c.Recency)
+	}
+}
@@ -0,0 +1,52 @@
+package ranking
+
+import (
+	"time"
+
+	"github.com/cg011235/autocomplete/internal/trie"
+)
+
+// ContextBoost is added to the score of words tagged with the requested context.
+var ContextBoost = 10.0
+
+// Components are the parts of a word's ranking score.
+type Components struct {
+	// Weight is the word's stored weight, including decayed selection boosts.
+	Weight float64
+	// Context is ContextBoost if the word is tagged with the requested context.
+	Context float64
+	// Recency is the boost a Booster ranker gives the word.
+	Recency float64
+}
+
+// Score returns the total score.
+func (c Components) Score() float64 {
+	return c.Weight + c.Context + c.Recency
+}
+
+// Explain returns the components of a word's score as ranked by r for q.
+func Explain(r Ranker, t *trie.Trie, word string, q Query) Components {
+	c := NewCandidate(t, word, q)
+	parts := Components{Weight: c.Weight}
+	if c.InContext {
+		parts.Context = ContextBoost
+	}
+	if b, ok := r.(Booster); ok {
+		parts.Recency = b.BoostFor(c, time.Now())
+	}
+	return parts
+}
+
+// Blend re-ranks words of t with r, the user's personal history mixed in:
+// each recorded selection adds boost to the word's weight. It is a no-op when
+// the user has no history, so shared (cached) rankings are returned unchanged.
+func Blend(r Ranker, t *trie.Trie, words []string, q Query, history map[string]int, boost float64) {
+	if len(history) == 0 {
+		return
+	}
+	boosts := make(map[string]float64, len(words))
+	for _, w := range words {
+		boosts[w] = float64(history[w]) * boost
+	}
+	OrderBoosted(r, t, words, q, boosts)
+}
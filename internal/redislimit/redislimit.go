@@ -0,0 +1,95 @@
+// Package redislimit implements rate limiting shared by all replicas, with
+// token buckets stored in Redis.
+package redislimit
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/cg011235/autocomplete/internal/middleware"
+	"github.com/redis/go-redis/v9"
+)
+
+// Timeout bounds each round trip to Redis.
+var Timeout = 50 * time.Millisecond
+
+// takeToken refills the bucket at KEYS[1] for the time elapsed since it was
+// last used, at ARGV[1] tokens per second up to ARGV[2], then takes a token
+// if there is one. Redis' clock is used so replicas need not agree on time.
+var takeToken = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) + tonumber(t[2]) / 1000000
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil then
+  tokens = burst
+  ts = now
+end
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate)
+local allowed = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate * 1000) + 1000)
+return allowed
+`)
+
+// Limiter is a middleware.Limiter keeping token buckets in Redis. When Redis
+// cannot be reached it falls back to another limiter, so an outage degrades
+// fairness rather than availability.
+type Limiter struct {
+	client   *redis.Client
+	prefix   string
+	fallback middleware.Limiter
+	// degraded is set while Redis is failing, so the outage is logged once.
+	degraded atomic.Bool
+}
+
+// New connects to the Redis server at url (redis://[user:password@]host:port/db)
+// and stores buckets under keys starting with prefix.
+func New(url, prefix string, fallback middleware.Limiter) (*Limiter, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	client := redis.NewClient(opts)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return &Limiter{client: client, prefix: prefix, fallback: fallback}, nil
+}
+
+// Allow takes a token from the principal's shared bucket.
+func (l *Limiter) Allow(key string, t middleware.Tier) bool {
+	if t.Rate <= 0 || t.Burst <= 0 {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	allowed, err := takeToken.Run(ctx, l.client, []string{l.prefix + key}, t.Rate, t.Burst).Int()
+	if err != nil {
+		if !l.degraded.Swap(true) {
+			log.Printf("redislimit: %v; falling back to local rate limiting", err)
+		}
+		return l.fallback.Allow(key, t)
+	}
+	if l.degraded.Swap(false) {
+		log.Printf("redislimit: Redis reachable again")
+	}
+	return allowed == 1
+}
+
+// Close closes the connection to Redis.
+func (l *Limiter) Close() error {
+	return l.client.Close()
+}
@@ -0,0 +1,111 @@
+// Package refresh fetches dictionary sources over HTTP so dictionaries can be
+// rebuilt from them on a schedule.
+package refresh
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/cg011235/autocomplete/internal/importer"
+	"github.com/cg011235/autocomplete/internal/trie"
+)
+
+// maxBodySize bounds the size of a fetched source.
+const maxBodySize = 1 << 30
+
+// Source is a remote list of words a dictionary is refreshed from. The
+// validators of the last installed fetch make refetches conditional.
+type Source struct {
+	Dict string
+	URL  string
+	// Format is the importer text format of the body. Empty decodes JSON
+	// bodies as {"words": [...]} or {"entries": [...]} and anything else as
+	// one word per line.
+	Format string
+
+	ETag         string
+	LastModified string
+}
+
+// ParseSources parses "dict=url" items. The format of a source can be given
+// as the URL fragment, e.g. "products=https://example.com/words.tsv#frequency".
+func ParseSources(items []string) ([]*Source, error) {
+	var sources []*Source
+	for _, item := range items {
+		dict, raw, ok := strings.Cut(item, "=")
+		if !ok || dict == "" || raw == "" {
+			return nil, fmt.Errorf("expected dict=url, got %q", item)
+		}
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, fmt.Errorf("invalid source URL %q", raw)
+		}
+		format := u.Fragment
+		u.Fragment = ""
+		sources = append(sources, &Source{Dict: dict, URL: u.String(), Format: format})
+	}
+	return sources, nil
+}
+
+// Result is a fetched source.
+type Result struct {
+	// NotModified is set when the source is unchanged since the last
+	// installed fetch; Entries is then empty.
+	NotModified  bool
+	Entries      []trie.Entry
+	ETag         string
+	LastModified string
+}
+
+// Fetch downloads and parses the source.
+func (s *Source) Fetch(ctx context.Context, client *http.Client) (*Result, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if s.ETag != "" {
+		req.Header.Set("If-None-Match", s.ETag)
+	}
+	if s.LastModified != "" {
+		req.Header.Set("If-Modified-Since", s.LastModified)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return &Result{NotModified: true}, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	result := &Result{ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")}
+	body := io.LimitReader(resp.Body, maxBodySize)
+	switch {
+	case s.Format != "":
+		result.Entries, err = importer.Parse(body, s.Format)
+	case strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json"):
+		var list struct {
+			Words   []string     `json:"words"`
+			Entries []trie.Entry `json:"entries"`
+		}
+		err = json.NewDecoder(body).Decode(&list)
+		for _, word := range list.Words {
+			result.Entries = append(result.Entries, trie.Entry{Word: word})
+		}
+		result.Entries = append(result.Entries, list.Entries...)
+	default:
+		result.Entries, err = importer.Parse(body, importer.FormatWords)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing source: %w", err)
+	}
+	return result, nil
+}
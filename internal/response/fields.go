@@ -0,0 +1,65 @@
+package response
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Fields are the JSON fields of response items a client selected with the
+// fields query parameter, e.g. "word,score", in the order given.
+type Fields []string
+
+// ParseFields parses a comma-separated list of JSON field names of item,
+// a struct. It returns nil, selecting every field, if v is empty.
+func ParseFields(v string, item any) (Fields, error) {
+	if v == "" {
+		return nil, nil
+	}
+	known := jsonFields(reflect.TypeOf(item))
+	var fields Fields
+	for _, name := range strings.Split(v, ",") {
+		name = strings.TrimSpace(name)
+		if _, ok := known[name]; !ok {
+			return nil, fmt.Errorf("unknown field %q", name)
+		}
+		fields = append(fields, name)
+	}
+	return fields, nil
+}
+
+// Project returns the selected fields of each item by JSON name. Selected
+// fields are included even if empty.
+func Project[T any](items []T, fields Fields) []map[string]any {
+	index := jsonFields(reflect.TypeOf(*new(T)))
+	projected := make([]map[string]any, len(items))
+	for i, item := range items {
+		v := reflect.ValueOf(item)
+		m := make(map[string]any, len(fields))
+		for _, name := range fields {
+			m[name] = v.Field(index[name]).Interface()
+		}
+		projected[i] = m
+	}
+	return projected
+}
+
+// jsonFields maps the JSON names of a struct's exported fields to their index.
+func jsonFields(t reflect.Type) map[string]int {
+	fields := make(map[string]int, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		switch name {
+		case "-":
+			continue
+		case "":
+			name = f.Name
+		}
+		fields[name] = i
+	}
+	return fields
+}
@@ -0,0 +1,67 @@
+package response
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Supported response content types.
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeMsgpack  = "application/msgpack"
+	ContentTypeProtobuf = "application/x-protobuf"
+)
+
+// ProtoMarshaler is implemented by responses that have a protobuf encoding.
+type ProtoMarshaler interface {
+	MarshalProto() []byte
+}
+
+// Negotiated writes v in the first format listed in the request's Accept
+// header that the response supports, falling back to JSON. MessagePack uses
+// the same field names as JSON; protobuf is available for values
+// implementing ProtoMarshaler.
+func Negotiated(w http.ResponseWriter, r *http.Request, code int, v interface{}) {
+	switch preferred(r.Header.Get("Accept"), v) {
+	case ContentTypeMsgpack:
+		var buf bytes.Buffer
+		enc := msgpack.NewEncoder(&buf)
+		enc.SetCustomStructTag("json")
+		if err := enc.Encode(v); err != nil {
+			Error(w, http.StatusInternalServerError, "Error encoding response")
+			return
+		}
+		write(w, code, ContentTypeMsgpack, buf.Bytes())
+	case ContentTypeProtobuf:
+		write(w, code, ContentTypeProtobuf, v.(ProtoMarshaler).MarshalProto())
+	default:
+		JSON(w, code, v)
+	}
+}
+
+// preferred returns the first supported media type in an Accept header.
+func preferred(accept string, v interface{}) string {
+	for _, item := range strings.Split(accept, ",") {
+		mediaType, _, _ := strings.Cut(item, ";")
+		switch strings.TrimSpace(mediaType) {
+		case ContentTypeJSON, "*/*":
+			return ContentTypeJSON
+		case ContentTypeMsgpack, "application/x-msgpack":
+			return ContentTypeMsgpack
+		case ContentTypeProtobuf, "application/protobuf":
+			if _, ok := v.(ProtoMarshaler); ok {
+				return ContentTypeProtobuf
+			}
+		}
+	}
+	return ContentTypeJSON
+}
+
+func write(w http.ResponseWriter, code int, contentType string, body []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(code)
+	w.Write(body)
+}
@@ -0,0 +1,66 @@
+// Package response writes JSON responses using the API's standard envelope.
+package response
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cg011235/autocomplete/pkg/models"
+)
+
+// JSON writes v as a JSON response with the given status code.
+func JSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// Error writes the standard error envelope with the given status code.
+func Error(w http.ResponseWriter, code int, message string) {
+	w.Header().Del("Content-Length")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	JSON(w, code, models.ErrorResponse{Status: "error", Message: message})
+}
+
+// Reasons for throttling and refusing requests, reported by Throttled.
+const (
+	// ReasonRateLimited means the caller exceeded its rate limit.
+	ReasonRateLimited = "rate_limited"
+	// ReasonLockedOut means logins are locked out after repeated failures.
+	ReasonLockedOut = "locked_out"
+	// ReasonOverloaded means the server is serving its maximum number of
+	// concurrent requests.
+	ReasonOverloaded = "overloaded"
+	// ReasonMaintenance and ReasonReadOnly mean the server mode does not
+	// allow the request.
+	ReasonMaintenance = "maintenance"
+	ReasonReadOnly    = "read_only"
+)
+
+// Throttled writes the error envelope for a request that should be retried
+// later, with the reason and a Retry-After header of at least one second.
+func Throttled(w http.ResponseWriter, code int, reason string, retryAfter time.Duration, message string) {
+	seconds := max(int(math.Ceil(retryAfter.Seconds())), 1)
+	w.Header().Del("Content-Length")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	JSON(w, code, models.ErrorResponse{
+		Status:     "error",
+		Message:    message,
+		Reason:     reason,
+		RetryAfter: seconds,
+	})
+}
+
+// ValidationError writes a 400 error envelope listing the rejected fields.
+func ValidationError(w http.ResponseWriter, errs []models.FieldError) {
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	JSON(w, http.StatusBadRequest, models.ErrorResponse{
+		Status:  "error",
+		Message: "Invalid input",
+		Errors:  errs,
+	})
+}
@@ -0,0 +1,118 @@
+// Package rotate provides a log file that is rotated by size and age.
+package rotate
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// timeFormat stamps rotated files; it sorts chronologically.
+const timeFormat = "20060102T150405.000000000"
+
+// File appends to a file and, once a write would grow it beyond MaxBytes or
+// it is older than MaxAge, renames it with a timestamp inserted before its
+// extension (queries.ndjson becomes queries-<time>.ndjson) and starts a new
+// one, keeping at most MaxFiles rotated files. Zero limits are disabled.
+type File struct {
+	path     string
+	maxBytes int64
+	maxAge   time.Duration
+	maxFiles int
+
+	mu      sync.Mutex
+	f       *os.File
+	size    int64
+	created time.Time
+}
+
+// Open opens or creates the file at path, creating its directory.
+func Open(path string, maxBytes int64, maxAge time.Duration, maxFiles int) (*File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	f := &File{path: path, maxBytes: maxBytes, maxAge: maxAge, maxFiles: maxFiles}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *File) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	// An existing file is aged from when it was last modified, as its
+	// creation time is not portable.
+	f.f, f.size, f.created = file, info.Size(), time.Now()
+	if info.Size() > 0 {
+		f.created = info.ModTime()
+	}
+	return nil
+}
+
+// Write appends p, rotating the file first if it is full or too old.
+func (f *File) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.size > 0 && (f.maxBytes > 0 && f.size+int64(len(p)) > f.maxBytes ||
+		f.maxAge > 0 && time.Since(f.created) > f.maxAge) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.f.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Close closes the current file.
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.f.Close()
+}
+
+func (f *File) rotate() error {
+	if err := f.f.Close(); err != nil {
+		return err
+	}
+	ext := filepath.Ext(f.path)
+	stem := strings.TrimSuffix(f.path, ext)
+	if err := os.Rename(f.path, stem+"-"+time.Now().UTC().Format(timeFormat)+ext); err != nil {
+		return err
+	}
+	if err := f.prune(stem, ext); err != nil {
+		log.Printf("rotate: removing old files of %s: %v", f.path, err)
+	}
+	return f.open()
+}
+
+// prune removes the oldest rotated files beyond maxFiles.
+func (f *File) prune(stem, ext string) error {
+	if f.maxFiles <= 0 {
+		return nil
+	}
+	rotated, err := filepath.Glob(stem + "-*" + ext)
+	if err != nil {
+		return err
+	}
+	sort.Strings(rotated)
+	for len(rotated) > f.maxFiles {
+		if err := os.Remove(rotated[0]); err != nil {
+			return err
+		}
+		rotated = rotated[1:]
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// settingsFile holds a dictionary's settings next to its versions.
+const settingsFile = "settings.json"
+
+// SaveSettings stores the settings of dict as JSON.
+func (s *VersionStore) SaveSettings(dict string, settings any) error {
+	if err := os.MkdirAll(s.dictDir(dict), 0o755); err != nil {
+		return err
+	}
+	return writeJSON(filepath.Join(s.dictDir(dict), settingsFile), settings)
+}
+
+// LoadSettings reads the settings of dict into settings, reporting false if
+// none are stored.
+func (s *VersionStore) LoadSettings(dict string, settings any) (bool, error) {
+	return readJSON(filepath.Join(s.dictDir(dict), settingsFile), settings)
+}
+
+// SaveDictState stores state of dict other than its words and settings,
+// such as its entities, as JSON under name next to its versions.
+func (s *VersionStore) SaveDictState(dict, name string, state any) error {
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return errors.New("invalid state name " + name)
+	}
+	if err := os.MkdirAll(s.dictDir(dict), 0o755); err != nil {
+		return err
+	}
+	return writeJSON(filepath.Join(s.dictDir(dict), name+".json"), state)
+}
+
+// LoadDictState reads the state of dict stored under name into state,
+// reporting false if none is stored.
+func (s *VersionStore) LoadDictState(dict, name string, state any) (bool, error) {
+	return readJSON(filepath.Join(s.dictDir(dict), name+".json"), state)
+}
+
+// SaveState stores server-wide state that belongs to no dictionary, such as
+// API consumers, as JSON under name.
+func (s *VersionStore) SaveState(name string, state any) error {
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return errors.New("invalid state name " + name)
+	}
+	return writeJSON(filepath.Join(s.dir, name+".json"), state)
+}
+
+// LoadState reads the state stored under name into state, reporting false
+// if none is stored.
+func (s *VersionStore) LoadState(name string, state any) (bool, error) {
+	return readJSON(filepath.Join(s.dir, name+".json"), state)
+}
+
+// writeJSON replaces the file at path with v encoded as JSON, atomically.
+func writeJSON(path string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(filepath.Dir(path), "tmp-"+filepath.Base(path))
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// readJSON decodes the file at path into v, reporting false if it does not exist.
+func readJSON(path string, v any) (bool, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal(data, v)
+}
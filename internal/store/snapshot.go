@@ -0,0 +1,177 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/cg011235/autocomplete/internal/trie"
+	"github.com/klauspost/compress/zstd"
+)
+
+// SnapshotFormat is the newest snapshot format version this binary writes and
+// reads. Readers accept every older version, including the headerless JSON
+// files (version 0) written before the format existed.
+const SnapshotFormat = 1
+
+// snapshotMagic starts every snapshot file.
+var snapshotMagic = [6]byte{'A', 'C', 'S', 'N', 'A', 'P'}
+
+// Compression is the codec of a snapshot payload.
+type Compression uint8
+
+// Snapshot compression codecs.
+const (
+	CompressionNone Compression = iota
+	CompressionGzip
+	CompressionZstd
+)
+
+var compressionNames = map[Compression]string{
+	CompressionNone: "none",
+	CompressionGzip: "gzip",
+	CompressionZstd: "zstd",
+}
+
+func (c Compression) String() string {
+	if name, ok := compressionNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("compression(%d)", uint8(c))
+}
+
+// ParseCompression returns the codec named name: none, gzip or zstd.
+func ParseCompression(name string) (Compression, error) {
+	for c, n := range compressionNames {
+		if n == name {
+			return c, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown snapshot compression %q", name)
+}
+
+var (
+	// ErrSnapshotCorrupt is returned when a snapshot fails its checksum or is truncated.
+	ErrSnapshotCorrupt = errors.New("snapshot is corrupt")
+	// ErrSnapshotTooNew is returned for snapshots written by a newer binary.
+	ErrSnapshotTooNew = errors.New("snapshot format is newer than supported")
+)
+
+// snapshotHeader precedes the payload of a snapshot. The payload is the JSON
+// encoded entries, compressed with Compression; Length and CRC (Castagnoli)
+// cover the uncompressed payload.
+type snapshotHeader struct {
+	Magic       [6]byte
+	Format      uint16
+	Compression Compression
+	Flags       uint8
+	Length      uint64
+	CRC         uint32
+}
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// WriteSnapshot writes entries to w in the current snapshot format.
+func WriteSnapshot(w io.Writer, entries []trie.Entry, c Compression) error {
+	payload, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	header := snapshotHeader{
+		Magic:       snapshotMagic,
+		Format:      SnapshotFormat,
+		Compression: c,
+		Length:      uint64(len(payload)),
+		CRC:         crc32.Checksum(payload, crcTable),
+	}
+	if err := binary.Write(w, binary.BigEndian, header); err != nil {
+		return err
+	}
+
+	switch c {
+	case CompressionNone:
+		_, err = w.Write(payload)
+		return err
+	case CompressionGzip:
+		zw := gzip.NewWriter(w)
+		if _, err := zw.Write(payload); err != nil {
+			return err
+		}
+		return zw.Close()
+	case CompressionZstd:
+		zw, err := zstd.NewWriter(w)
+		if err != nil {
+			return err
+		}
+		if _, err := zw.Write(payload); err != nil {
+			return err
+		}
+		return zw.Close()
+	default:
+		return fmt.Errorf("unsupported snapshot compression %s", c)
+	}
+}
+
+// ReadSnapshot reads entries written by WriteSnapshot in this or any older
+// format, verifying the checksum.
+func ReadSnapshot(r io.Reader) ([]trie.Entry, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(snapshotMagic))
+	if err != nil || !bytes.Equal(magic, snapshotMagic[:]) {
+		// Format 0: a bare JSON array of entries.
+		var entries []trie.Entry
+		if err := json.NewDecoder(br).Decode(&entries); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrSnapshotCorrupt, err)
+		}
+		return entries, nil
+	}
+
+	var header snapshotHeader
+	if err := binary.Read(br, binary.BigEndian, &header); err != nil {
+		return nil, fmt.Errorf("%w: reading header: %v", ErrSnapshotCorrupt, err)
+	}
+	if header.Format > SnapshotFormat {
+		return nil, fmt.Errorf("%w: format %d, this binary reads up to %d", ErrSnapshotTooNew, header.Format, SnapshotFormat)
+	}
+
+	var payload io.Reader
+	switch header.Compression {
+	case CompressionNone:
+		payload = br
+	case CompressionGzip:
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrSnapshotCorrupt, err)
+		}
+		defer zr.Close()
+		payload = zr
+	case CompressionZstd:
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		payload = zr
+	default:
+		return nil, fmt.Errorf("%w: unknown compression %d", ErrSnapshotTooNew, header.Compression)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(payload, int64(header.Length)+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSnapshotCorrupt, err)
+	}
+	if uint64(len(data)) != header.Length || crc32.Checksum(data, crcTable) != header.CRC {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrSnapshotCorrupt)
+	}
+	var entries []trie.Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSnapshotCorrupt, err)
+	}
+	return entries, nil
+}
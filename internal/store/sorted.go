@@ -0,0 +1,177 @@
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/cg011235/autocomplete/internal/trie"
+)
+
+// SortedFormat is the version of the sorted export format.
+const SortedFormat = 1
+
+// sortedMagic starts every sorted export.
+var sortedMagic = [6]byte{'A', 'C', 'S', 'O', 'R', 'T'}
+
+// sortedHeader precedes the records of a sorted export. Records follow the
+// header in ascending byte order of their words, each laid out as
+//
+//	uint16 word length, word, uint16 display length, display, float64 weight
+//
+// with the display form empty where it is the word. The index at
+// IndexOffset holds Count uint64 file offsets, one per record in order, so
+// a client that memory-maps the file binary searches the index without
+// parsing it. CRC (Castagnoli) covers everything after the header. All
+// integers are big-endian.
+type sortedHeader struct {
+	Magic       [6]byte
+	Format      uint16
+	Count       uint64
+	IndexOffset uint64
+	CRC         uint32
+}
+
+var sortedHeaderSize = binary.Size(sortedHeader{})
+
+// maxSortedField is the longest word or display form a record can hold.
+const maxSortedField = math.MaxUint16
+
+// WriteSorted writes entries to w as a sorted export: length-prefixed
+// records sorted by word, followed by an index of their offsets.
+func WriteSorted(w io.Writer, entries []trie.Entry) error {
+	sorted := append([]trie.Entry(nil), entries...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Word < sorted[j].Word })
+
+	var body bytes.Buffer
+	offsets := make([]uint64, len(sorted))
+	for i, e := range sorted {
+		display := e.Display
+		if display == e.Word {
+			display = ""
+		}
+		if len(e.Word) > maxSortedField || len(display) > maxSortedField {
+			return fmt.Errorf("word %.20q is too long for a sorted export", e.Word)
+		}
+		offsets[i] = uint64(sortedHeaderSize + body.Len())
+		binary.Write(&body, binary.BigEndian, uint16(len(e.Word)))
+		body.WriteString(e.Word)
+		binary.Write(&body, binary.BigEndian, uint16(len(display)))
+		body.WriteString(display)
+		binary.Write(&body, binary.BigEndian, math.Float64bits(e.Weight))
+	}
+	indexOffset := uint64(sortedHeaderSize + body.Len())
+	binary.Write(&body, binary.BigEndian, offsets)
+
+	header := sortedHeader{
+		Magic:       sortedMagic,
+		Format:      SortedFormat,
+		Count:       uint64(len(sorted)),
+		IndexOffset: indexOffset,
+		CRC:         crc32.Checksum(body.Bytes(), crcTable),
+	}
+	if err := binary.Write(w, binary.BigEndian, header); err != nil {
+		return err
+	}
+	_, err := w.Write(body.Bytes())
+	return err
+}
+
+// Sorted reads a sorted export in place, e.g. from a memory-mapped file.
+type Sorted struct {
+	data  []byte
+	count int
+	index []byte
+}
+
+// OpenSorted verifies a sorted export held in data and returns a reader
+// over it. Data is not copied.
+func OpenSorted(data []byte) (*Sorted, error) {
+	var header sortedHeader
+	if err := binary.Read(bytes.NewReader(data), binary.BigEndian, &header); err != nil {
+		return nil, fmt.Errorf("%w: reading header: %v", ErrSnapshotCorrupt, err)
+	}
+	if header.Magic != sortedMagic {
+		return nil, fmt.Errorf("%w: not a sorted export", ErrSnapshotCorrupt)
+	}
+	if header.Format > SortedFormat {
+		return nil, fmt.Errorf("%w: format %d, this binary reads up to %d", ErrSnapshotTooNew, header.Format, SortedFormat)
+	}
+	end := header.IndexOffset + 8*header.Count
+	if header.IndexOffset < uint64(sortedHeaderSize) || end != uint64(len(data)) || end < header.IndexOffset {
+		return nil, fmt.Errorf("%w: index out of bounds", ErrSnapshotCorrupt)
+	}
+	if crc32.Checksum(data[sortedHeaderSize:], crcTable) != header.CRC {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrSnapshotCorrupt)
+	}
+	s := &Sorted{data: data, count: int(header.Count), index: data[header.IndexOffset:]}
+	for i := 0; i < s.count; i++ {
+		if _, err := s.entry(i); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Len returns the number of words in the export.
+func (s *Sorted) Len() int {
+	return s.count
+}
+
+// Entry returns the i-th word of the export in sorted order.
+func (s *Sorted) Entry(i int) trie.Entry {
+	e, _ := s.entry(i)
+	return e
+}
+
+// Prefix returns the words starting with prefix, in sorted order.
+func (s *Sorted) Prefix(prefix string) []trie.Entry {
+	first := sort.Search(s.count, func(i int) bool { return s.word(i) >= prefix })
+	var matches []trie.Entry
+	for i := first; i < s.count && strings.HasPrefix(s.word(i), prefix); i++ {
+		matches = append(matches, s.Entry(i))
+	}
+	return matches
+}
+
+// word returns the i-th word without its metadata.
+func (s *Sorted) word(i int) string {
+	off := binary.BigEndian.Uint64(s.index[8*i:])
+	n := uint64(binary.BigEndian.Uint16(s.data[off:]))
+	return string(s.data[off+2 : off+2+n])
+}
+
+var errSortedRecord = errors.New("record out of bounds")
+
+// entry decodes the i-th record, checking its bounds.
+func (s *Sorted) entry(i int) (trie.Entry, error) {
+	off := binary.BigEndian.Uint64(s.index[8*i:])
+	field := func() (string, error) {
+		if off+2 > uint64(len(s.data)) {
+			return "", errSortedRecord
+		}
+		n := uint64(binary.BigEndian.Uint16(s.data[off:]))
+		if off+2+n > uint64(len(s.data)) {
+			return "", errSortedRecord
+		}
+		value := string(s.data[off+2 : off+2+n])
+		off += 2 + n
+		return value, nil
+	}
+	word, err := field()
+	if err != nil {
+		return trie.Entry{}, fmt.Errorf("%w: record %d: %v", ErrSnapshotCorrupt, i, err)
+	}
+	display, err := field()
+	if err != nil || off+8 > uint64(len(s.data)) {
+		return trie.Entry{}, fmt.Errorf("%w: record %d: %v", ErrSnapshotCorrupt, i, errSortedRecord)
+	}
+	weight := math.Float64frombits(binary.BigEndian.Uint64(s.data[off:]))
+	return trie.Entry{Word: word, Display: display, Weight: weight}, nil
+}
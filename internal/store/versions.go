@@ -0,0 +1,251 @@
+// Package store persists dictionary versions on disk.
+package store
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cg011235/autocomplete/internal/trie"
+)
+
+// ErrVersionNotFound is returned when a requested version is not on disk.
+var ErrVersionNotFound = errors.New("version not found")
+
+// versionExt is the extension of snapshot files; legacyVersionExt that of
+// the plain JSON files written before the snapshot format, which are still
+// listed and loaded. An empty file with compactionExt marks a version saved
+// by SaveCompaction.
+const (
+	versionExt       = ".snap"
+	legacyVersionExt = ".json"
+	compactionExt    = ".compaction"
+)
+
+// VersionInfo describes a stored dictionary version.
+type VersionInfo struct {
+	Version int
+	Created time.Time
+	Size    int64
+	// Compaction reports a version saved by SaveCompaction.
+	Compaction bool
+}
+
+// VersionStore keeps the most recent versions of each dictionary as
+// snapshots under dir/<dictionary>/<version>.snap, pruning older ones.
+// Compaction snapshots are retained separately from the versions saved
+// otherwise, e.g. by imports and rollbacks, so frequent compactions do not
+// push those out.
+type VersionStore struct {
+	// Compression is the codec new snapshots are written with.
+	Compression Compression
+
+	dir  string
+	keep int
+}
+
+// NewVersionStore creates a VersionStore in dir keeping keep versions per
+// dictionary, writing gzip-compressed snapshots.
+func NewVersionStore(dir string, keep int) (*VersionStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &VersionStore{Compression: CompressionGzip, dir: dir, keep: keep}, nil
+}
+
+// dictDir returns the directory of a dictionary; names are escaped so any
+// dictionary name maps to a single safe path element.
+func (s *VersionStore) dictDir(dict string) string {
+	return filepath.Join(s.dir, url.PathEscape(dict))
+}
+
+func (s *VersionStore) path(dict string, version int) string {
+	return filepath.Join(s.dictDir(dict), strconv.Itoa(version)+versionExt)
+}
+
+// open opens a stored version, falling back to the legacy file name.
+func (s *VersionStore) open(dict string, version int) (*os.File, error) {
+	f, err := os.Open(s.path(dict, version))
+	if errors.Is(err, os.ErrNotExist) {
+		f, err = os.Open(filepath.Join(s.dictDir(dict), strconv.Itoa(version)+legacyVersionExt))
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrVersionNotFound
+	}
+	return f, err
+}
+
+// Save writes entries as the next version of dict and returns its number.
+func (s *VersionStore) Save(dict string, entries []trie.Entry) (int, error) {
+	return s.save(dict, entries, false)
+}
+
+// SaveCompaction is Save for a snapshot of the dictionary as it already is,
+// taken to truncate its write-ahead log.
+func (s *VersionStore) SaveCompaction(dict string, entries []trie.Entry) (int, error) {
+	return s.save(dict, entries, true)
+}
+
+func (s *VersionStore) save(dict string, entries []trie.Entry, compaction bool) (int, error) {
+	if err := os.MkdirAll(s.dictDir(dict), 0o755); err != nil {
+		return 0, err
+	}
+	versions, err := s.List(dict)
+	if err != nil {
+		return 0, err
+	}
+	version := 1
+	if len(versions) > 0 {
+		version = versions[len(versions)-1].Version + 1
+	}
+
+	// Write to a temporary file and rename so a crash never leaves a partial version.
+	tmp, err := os.CreateTemp(s.dictDir(dict), "tmp-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	w := bufio.NewWriter(tmp)
+	if err := WriteSnapshot(w, entries, s.Compression); err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmp.Name(), s.path(dict, version)); err != nil {
+		return 0, err
+	}
+	if compaction {
+		if err := os.WriteFile(filepath.Join(s.dictDir(dict), strconv.Itoa(version)+compactionExt), nil, 0o644); err != nil {
+			return 0, err
+		}
+	}
+
+	return version, s.prune(dict)
+}
+
+// Load reads a stored version of dict. Corrupt snapshots and snapshots
+// written in a newer format are reported as ErrSnapshotCorrupt and
+// ErrSnapshotTooNew rather than loaded.
+func (s *VersionStore) Load(dict string, version int) ([]trie.Entry, error) {
+	f, err := s.open(dict, version)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entries, err := ReadSnapshot(f)
+	if err != nil {
+		return nil, fmt.Errorf("loading version %d of %q: %w", version, dict, err)
+	}
+	return entries, nil
+}
+
+// List returns the stored versions of dict in ascending order.
+func (s *VersionStore) List(dict string) ([]VersionInfo, error) {
+	files, err := os.ReadDir(s.dictDir(dict))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []VersionInfo
+	compactions := make(map[string]bool)
+	for _, f := range files {
+		if name, ok := strings.CutSuffix(f.Name(), compactionExt); ok {
+			compactions[name] = true
+		}
+	}
+	for _, f := range files {
+		ext := filepath.Ext(f.Name())
+		if ext != versionExt && ext != legacyVersionExt {
+			continue
+		}
+		v, err := strconv.Atoi(strings.TrimSuffix(f.Name(), ext))
+		if err != nil {
+			continue
+		}
+		info, err := f.Info()
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, VersionInfo{
+			Version:    v,
+			Created:    info.ModTime(),
+			Size:       info.Size(),
+			Compaction: compactions[strconv.Itoa(v)],
+		})
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version < versions[j].Version })
+	return versions, nil
+}
+
+// Dictionaries returns the names of all dictionaries with stored versions.
+func (s *VersionStore) Dictionaries() ([]string, error) {
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, f := range files {
+		if !f.IsDir() {
+			continue
+		}
+		name, err := url.PathUnescape(f.Name())
+		if err != nil {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// Remove deletes every stored version, the log, the settings and the other
+// state of dict.
+func (s *VersionStore) Remove(dict string) error {
+	return os.RemoveAll(s.dictDir(dict))
+}
+
+// prune removes all but the newest keep versions of dict and the newest keep
+// compaction snapshots. The newest version is kept in any case, as it is what
+// the write-ahead log applies to.
+func (s *VersionStore) prune(dict string) error {
+	versions, err := s.List(dict)
+	if err != nil {
+		return err
+	}
+	kept := make(map[bool]int)
+	for i := len(versions) - 1; i >= 0; i-- {
+		v := versions[i]
+		if kept[v.Compaction] < s.keep || i == len(versions)-1 {
+			kept[v.Compaction]++
+			continue
+		}
+		name := strconv.Itoa(v.Version)
+		for _, ext := range []string{versionExt, legacyVersionExt, compactionExt} {
+			err := os.Remove(filepath.Join(s.dictDir(dict), name+ext))
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+	}
+	return nil
+}
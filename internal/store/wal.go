@@ -0,0 +1,287 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/cg011235/autocomplete/internal/trie"
+)
+
+// Log operations.
+const (
+	OpInsert = "insert"
+	OpDelete = "delete"
+	OpClear  = "clear"
+	OpBoost  = "boost"
+	// OpDecay multiplies every weight by the record's Amount.
+	OpDecay = "decay"
+)
+
+// Record is a mutation of a dictionary written to its write-ahead log.
+type Record struct {
+	// Seq numbers the records of a log from 1, so a gap is detected on
+	// replay. Records written before sequence numbers have none.
+	Seq      uint64   `json:"seq,omitempty"`
+	Op       string   `json:"op"`
+	Words    []string `json:"words,omitempty"`
+	Contexts []string `json:"contexts,omitempty"`
+	Amount   float64  `json:"amount,omitempty"`
+	// Display holds the display form of each inserted word, or "" where
+	// it is the word itself.
+	Display []string `json:"display,omitempty"`
+	// Snippets holds the snippets set with inserted words, by word.
+	Snippets map[string]trie.Snippet `json:"snippets,omitempty"`
+}
+
+const (
+	logName   = "wal.log"
+	logFormat = 1
+	// maxRecordSize bounds the length read from a frame so a corrupt length
+	// cannot trigger a huge allocation.
+	maxRecordSize = 64 << 20
+)
+
+var logMagic = [6]byte{'A', 'C', 'W', 'A', 'L', 0}
+
+// logHeader starts every log file. Base is the stored version the log's
+// records apply on top of; version 0 is the empty dictionary.
+type logHeader struct {
+	Magic  [6]byte
+	Format uint16
+	Base   uint64
+}
+
+// Log is the write-ahead log of one dictionary. Each record is framed by its
+// length and CRC so a write torn by a crash is detected and discarded on
+// replay.
+type Log struct {
+	mu   sync.Mutex
+	f    *os.File
+	sync bool
+	size int64
+	base int
+	seq  uint64
+}
+
+// Base returns the version the log's records apply on top of.
+func (l *Log) Base() int {
+	return l.base
+}
+
+// Size returns the size of the log's records in bytes.
+func (l *Log) Size() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.size
+}
+
+// Append writes rec to the log, syncing it to disk if the log was opened
+// with sync.
+func (l *Log) Append(rec Record) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	rec.Seq = l.seq + 1
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	frame := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint32(frame[0:], uint32(len(payload)))
+	binary.BigEndian.PutUint32(frame[4:], crc32.Checksum(payload, crcTable))
+	frame = append(frame, payload...)
+
+	n, err := l.f.Write(frame)
+	if n == len(frame) {
+		l.seq = rec.Seq
+	}
+	l.size += int64(n)
+	if err != nil {
+		return err
+	}
+	if l.sync {
+		return l.f.Sync()
+	}
+	return nil
+}
+
+// Close closes the log file.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.f.Close()
+}
+
+func (s *VersionStore) logPath(dict string) string {
+	return filepath.Join(s.dictDir(dict), logName)
+}
+
+// ResetLog atomically replaces the log of dict with an empty one based on
+// version and opens it for appending. It is called after every snapshot,
+// import or rollback, which makes the records of the previous log redundant.
+func (s *VersionStore) ResetLog(dict string, version int, sync bool) (*Log, error) {
+	if err := os.MkdirAll(s.dictDir(dict), 0o755); err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp(s.dictDir(dict), "tmp-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	header := logHeader{Magic: logMagic, Format: logFormat, Base: uint64(version)}
+	if err := binary.Write(tmp, binary.BigEndian, header); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp.Name(), s.logPath(dict)); err != nil {
+		return nil, err
+	}
+	return s.openLog(dict, version, 0, 0, sync)
+}
+
+func (s *VersionStore) openLog(dict string, base int, size int64, seq uint64, sync bool) (*Log, error) {
+	f, err := os.OpenFile(s.logPath(dict), os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &Log{f: f, sync: sync, size: size, base: base, seq: seq}, nil
+}
+
+// ErrNoLog is returned by LogBase and ReplayLog when a dictionary has no log.
+var ErrNoLog = errors.New("no write-ahead log")
+
+// LogBase returns the version the log of dict applies on top of.
+func (s *VersionStore) LogBase(dict string) (int, error) {
+	f, err := os.Open(s.logPath(dict))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, ErrNoLog
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	header, err := readLogHeader(f, dict)
+	if err != nil {
+		return 0, err
+	}
+	return int(header.Base), nil
+}
+
+func readLogHeader(r io.Reader, dict string) (logHeader, error) {
+	var header logHeader
+	if err := binary.Read(r, binary.BigEndian, &header); err != nil || header.Magic != logMagic {
+		return header, fmt.Errorf("log of %q: %w: bad header", dict, ErrSnapshotCorrupt)
+	}
+	if header.Format > logFormat {
+		return header, fmt.Errorf("log of %q: %w: format %d", dict, ErrSnapshotTooNew, header.Format)
+	}
+	return header, nil
+}
+
+// ErrLogCorrupt is returned by ReplayLog for a damaged record that is not
+// a write torn at the end of the log.
+var ErrLogCorrupt = errors.New("write-ahead log is corrupt")
+
+// Truncation describes the tail of a log dropped by ReplayLog.
+type Truncation struct {
+	// Offset is where the intact records end.
+	Offset int64
+	// Bytes is the number of bytes dropped.
+	Bytes int64
+	// Reason describes the first damaged record.
+	Reason string
+}
+
+// ReplayLog reads the log of dict, calling apply for each intact record in
+// order, and reopens it for appending. A torn record at the end, left by a
+// crash mid-write, is truncated away. Other damage, a failed checksum or a
+// gap in the record sequence, is reported as ErrLogCorrupt unless repair is
+// set, in which case the log is truncated before the damaged record too.
+// The returned Truncation describes what was dropped, or is nil.
+func (s *VersionStore) ReplayLog(dict string, sync, repair bool, apply func(Record)) (*Log, *Truncation, error) {
+	f, err := os.Open(s.logPath(dict))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, ErrNoLog
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r := bufio.NewReader(f)
+	header, err := readLogHeader(r, dict)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	valid := int64(binary.Size(header))
+	var seq uint64
+	reason, torn := "", false
+	frame := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, frame); err != nil {
+			torn = err == io.ErrUnexpectedEOF
+			reason = "incomplete record header"
+			break
+		}
+		n := binary.BigEndian.Uint32(frame[0:])
+		if n > maxRecordSize {
+			reason = fmt.Sprintf("record length %d too large", n)
+			break
+		}
+		payload := make([]byte, n)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			torn, reason = true, "incomplete record"
+			break
+		}
+		if crc32.Checksum(payload, crcTable) != binary.BigEndian.Uint32(frame[4:]) {
+			reason = "checksum mismatch"
+			break
+		}
+		var rec Record
+		if err := json.NewDecoder(bytes.NewReader(payload)).Decode(&rec); err != nil {
+			reason = "undecodable record: " + err.Error()
+			break
+		}
+		if rec.Seq != 0 && rec.Seq != seq+1 {
+			reason = fmt.Sprintf("record %d follows record %d", rec.Seq, seq)
+			break
+		}
+		apply(rec)
+		seq = rec.Seq
+		valid += int64(len(frame) + len(payload))
+	}
+
+	var cut *Truncation
+	if valid < info.Size() {
+		cut = &Truncation{Offset: valid, Bytes: info.Size() - valid, Reason: reason}
+		if !torn && !repair {
+			return nil, nil, fmt.Errorf("log of %q: %w: %s at offset %d, %d bytes follow",
+				dict, ErrLogCorrupt, reason, valid, cut.Bytes)
+		}
+		if err := os.Truncate(s.logPath(dict), valid); err != nil {
+			return nil, nil, err
+		}
+	}
+	l, err := s.openLog(dict, int(header.Base), valid-int64(binary.Size(header)), seq, sync)
+	return l, cut, err
+}
@@ -0,0 +1,69 @@
+package trie
+
+import "unsafe"
+
+// SlabSize is the number of nodes new Tries allocate at a time. Allocating in
+// slabs keeps the number of heap objects the GC tracks low for large
+// dictionaries. Zero allocates every node separately.
+var SlabSize = 1024
+
+// arena hands out the nodes of one Trie from slabs. Nodes are never freed
+// individually: they are released all at once when the Trie is cleared or
+// dropped.
+type arena struct {
+	slabSize int
+	slab     []Node
+	slabs    int
+	nodes    int
+	removed  int
+}
+
+func newArena(slabSize int) *arena {
+	return &arena{slabSize: slabSize}
+}
+
+func (a *arena) alloc() *Node {
+	a.nodes++
+	if a.slabSize <= 0 {
+		return NewNode()
+	}
+	if len(a.slab) == cap(a.slab) {
+		a.slab = make([]Node, 0, a.slabSize)
+		a.slabs++
+	}
+	a.slab = a.slab[:len(a.slab)+1]
+	n := &a.slab[len(a.slab)-1]
+	n.Children = make(map[rune]*Node)
+	return n
+}
+
+// AllocStats describes the node allocation of a Trie.
+type AllocStats struct {
+	// Slabs is the number of slabs allocated, each holding SlabSize nodes.
+	Slabs int
+	// Nodes is the number of nodes handed out, including removed ones.
+	Nodes int
+	// LiveNodes is the number of nodes still reachable from the root.
+	LiveNodes int
+	// Bytes is the memory taken by the nodes themselves, excluding their
+	// child maps and contexts.
+	Bytes int
+}
+
+// AllocStats returns the Trie's node allocation statistics.
+func (t *Trie) AllocStats() AllocStats {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	a := t.arena
+	size := int(unsafe.Sizeof(Node{}))
+	bytes := a.nodes * size
+	if a.slabSize > 0 {
+		bytes = a.slabs * a.slabSize * size
+	}
+	return AllocStats{
+		Slabs:     a.slabs,
+		Nodes:     a.nodes,
+		LiveNodes: a.nodes - a.removed,
+		Bytes:     bytes,
+	}
+}
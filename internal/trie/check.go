@@ -0,0 +1,35 @@
+package trie
+
+import "fmt"
+
+// Check verifies the Trie's invariants: every node other than the root ends
+// a word or leads to one, and the word count matches the words stored. It
+// returns a description of each violation found.
+func (t *Trie) Check() []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	var problems []string
+	orphans, words := 0, 0
+	var walk func(node *Node, root bool)
+	walk = func(node *Node, root bool) {
+		if node.IsWord {
+			words++
+		} else if !root && len(node.Children) == 0 {
+			orphans++
+		}
+		if t.sorted && len(node.Keys) != len(node.Children) {
+			problems = append(problems, fmt.Sprintf("node with %d children indexes %d keys", len(node.Children), len(node.Keys)))
+		}
+		for _, child := range node.Children {
+			walk(child, false)
+		}
+	}
+	walk(t.Root, true)
+	if orphans > 0 {
+		problems = append(problems, fmt.Sprintf("%d orphaned empty nodes", orphans))
+	}
+	if words != t.size {
+		problems = append(problems, fmt.Sprintf("%d words stored but %d counted", words, t.size))
+	}
+	return problems
+}
@@ -0,0 +1,183 @@
+package trie
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"unicode/utf8"
+)
+
+// EncodingVersion is the version of the JSON and binary encodings written by
+// MarshalJSON and MarshalBinary. Decoding accepts this and older versions.
+const EncodingVersion = 1
+
+// ErrEncodingVersion is returned when decoding an encoding written by a
+// newer version of the package.
+var ErrEncodingVersion = errors.New("trie: unsupported encoding version")
+
+// record is a word with all of its node's state, as encoded.
+type record struct {
+	Entry
+	Updated int64
+}
+
+// records returns every word with its state, sorted by word.
+func (t *Trie) records() []record {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	records := make([]record, 0, t.size)
+	var walk func(node *Node, prefix []rune)
+	walk = func(node *Node, prefix []rune) {
+		if node.IsWord {
+			records = append(records, record{
+				Entry: Entry{
+					Word:     string(prefix),
+					Weight:   node.Weight,
+					Contexts: append([]string(nil), node.Contexts...),
+					Display:  node.Display,
+					Snippet:  node.Snippet,
+				},
+				Updated: node.Updated,
+			})
+		}
+		for char, child := range node.Children {
+			walk(child, append(prefix, char))
+		}
+	}
+	walk(t.Root, nil)
+	sort.Slice(records, func(i, j int) bool { return records[i].Word < records[j].Word })
+	return records
+}
+
+// load replaces the contents of the Trie with records.
+func (t *Trie) load(records []record) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.clear()
+	for _, r := range records {
+		node, _ := t.insert(r.Word)
+		node.Weight = r.Weight
+		node.Updated = r.Updated
+		t.tag(node, r.Contexts)
+		if r.Display != "" {
+			setDisplay(node, r.Word, r.Display, false)
+		}
+		if r.Snippet != nil {
+			t.setSnippet(node, *r.Snippet)
+		}
+	}
+}
+
+// binaryTrie is the gob encoding of a Trie: its words in order.
+type binaryTrie struct {
+	Version int
+	Words   []record
+}
+
+// MarshalBinary encodes the words of the Trie with their weights, contexts,
+// display forms, snippets and update times as gob.
+func (t *Trie) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(binaryTrie{Version: EncodingVersion, Words: t.records()})
+	return buf.Bytes(), err
+}
+
+// UnmarshalBinary replaces the contents of the Trie with data written by
+// MarshalBinary. The Trie must have been created with NewTrie.
+func (t *Trie) UnmarshalBinary(data []byte) error {
+	var decoded binaryTrie
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&decoded); err != nil {
+		return err
+	}
+	if decoded.Version > EncodingVersion {
+		return fmt.Errorf("%w: %d", ErrEncodingVersion, decoded.Version)
+	}
+	t.load(decoded.Words)
+	return nil
+}
+
+// jsonTrie is the JSON encoding of a Trie: its node tree under a version.
+type jsonTrie struct {
+	Version int       `json:"version"`
+	Root    *jsonNode `json:"root"`
+}
+
+// jsonNode is a node in the JSON encoding. Children are keyed by their
+// character; Word marks nodes ending a word, which carry its state.
+type jsonNode struct {
+	Word     bool                 `json:"word,omitempty"`
+	Weight   float64              `json:"weight,omitempty"`
+	Contexts []string             `json:"contexts,omitempty"`
+	Display  string               `json:"display,omitempty"`
+	Snippet  *Snippet             `json:"snippet,omitempty"`
+	Updated  int64                `json:"updated,omitempty"`
+	Children map[string]*jsonNode `json:"children,omitempty"`
+}
+
+// MarshalJSON encodes the Trie as a versioned tree of nodes, which unlike
+// Entries preserves its shape for tools that inspect it.
+func (t *Trie) MarshalJSON() ([]byte, error) {
+	root := &jsonNode{}
+	for _, r := range t.records() {
+		node := root
+		for _, char := range r.Word {
+			if node.Children == nil {
+				node.Children = make(map[string]*jsonNode)
+			}
+			child, ok := node.Children[string(char)]
+			if !ok {
+				child = &jsonNode{}
+				node.Children[string(char)] = child
+			}
+			node = child
+		}
+		node.Word = true
+		node.Weight = r.Weight
+		node.Contexts = r.Contexts
+		node.Display = r.Display
+		node.Snippet = r.Snippet
+		node.Updated = r.Updated
+	}
+	return json.Marshal(jsonTrie{Version: EncodingVersion, Root: root})
+}
+
+// UnmarshalJSON replaces the contents of the Trie with data written by
+// MarshalJSON. The Trie must have been created with NewTrie.
+func (t *Trie) UnmarshalJSON(data []byte) error {
+	var decoded jsonTrie
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	if decoded.Version > EncodingVersion {
+		return fmt.Errorf("%w: %d", ErrEncodingVersion, decoded.Version)
+	}
+	var records []record
+	var walk func(node *jsonNode, prefix string) error
+	walk = func(node *jsonNode, prefix string) error {
+		if node.Word {
+			records = append(records, record{
+				Entry:   Entry{Word: prefix, Weight: node.Weight, Contexts: node.Contexts, Display: node.Display, Snippet: node.Snippet},
+				Updated: node.Updated,
+			})
+		}
+		for key, child := range node.Children {
+			if utf8.RuneCountInString(key) != 1 || child == nil {
+				return fmt.Errorf("trie: invalid child %q under %q", key, prefix)
+			}
+			if err := walk(child, prefix+key); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if decoded.Root != nil {
+		if err := walk(decoded.Root, ""); err != nil {
+			return err
+		}
+	}
+	t.load(records)
+	return nil
+}
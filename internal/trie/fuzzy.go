@@ -0,0 +1,56 @@
+package trie
+
+// Match is a word found by a fuzzy search with the edit distance of its
+// closest prefix to the query.
+type Match struct {
+	Word     string
+	Distance float64
+}
+
+// FuzzyPrefix returns the words having a prefix within maxDistance edits of
+// prefix. Insertions and deletions cost 1; substitutions cost subst(want, got),
+// letting callers make likely typos cheaper.
+func (t *Trie) FuzzyPrefix(prefix string, maxDistance float64, subst func(a, b rune) float64) []Match {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	query := []rune(prefix)
+	row := make([]float64, len(query)+1)
+	for i := range row {
+		row[i] = float64(i)
+	}
+	f := fuzzy{query: query, max: maxDistance, subst: subst}
+	f.walk(t.Root, nil, row, row[len(query)])
+	return f.matches
+}
+
+type fuzzy struct {
+	query   []rune
+	max     float64
+	subst   func(a, b rune) float64
+	matches []Match
+}
+
+// walk visits node, reached by path. row holds the edit distances between
+// each prefix of the query and path; best is the lowest distance of the full
+// query to any prefix of path.
+func (f *fuzzy) walk(node *Node, path []rune, row []float64, best float64) {
+	if node.IsWord && best <= f.max {
+		f.matches = append(f.matches, Match{Word: string(path), Distance: best})
+	}
+	for char, child := range node.Children {
+		next := make([]float64, len(row))
+		next[0] = row[0] + 1
+		lowest := next[0]
+		for i, q := range f.query {
+			next[i+1] = min(row[i+1]+1, next[i]+1, row[i]+f.subst(q, char))
+			lowest = min(lowest, next[i+1])
+		}
+		childBest := min(best, next[len(f.query)])
+		// Prune once no continuation can match and nothing above matched.
+		if lowest > f.max && childBest > f.max {
+			continue
+		}
+		f.walk(child, append(path, char), next, childBest)
+	}
+}
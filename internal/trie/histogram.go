@@ -0,0 +1,63 @@
+package trie
+
+import (
+	"sort"
+	"unicode/utf8"
+)
+
+// histogram counts the words of a Trie by length and first character. It is
+// updated on every insert and delete so reading it never walks the Trie.
+type histogram struct {
+	lengths map[int]int
+	firsts  map[rune]int
+}
+
+func newHistogram() histogram {
+	return histogram{lengths: make(map[int]int), firsts: make(map[rune]int)}
+}
+
+func (h histogram) add(word string, delta int) {
+	n := utf8.RuneCountInString(word)
+	if h.lengths[n] += delta; h.lengths[n] == 0 {
+		delete(h.lengths, n)
+	}
+	if n == 0 {
+		return
+	}
+	first, _ := utf8.DecodeRuneInString(word)
+	if h.firsts[first] += delta; h.firsts[first] == 0 {
+		delete(h.firsts, first)
+	}
+}
+
+// Bucket is the number of words sharing a length or first character.
+type Bucket[K any] struct {
+	Key   K
+	Words int
+}
+
+// Histogram is the distribution of a Trie's words by length in characters
+// and by first character, each sorted by key.
+type Histogram struct {
+	Lengths    []Bucket[int]
+	FirstChars []Bucket[rune]
+}
+
+// Histogram returns the Trie's word length and first character distributions.
+func (t *Trie) Histogram() Histogram {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	h := Histogram{
+		Lengths:    make([]Bucket[int], 0, len(t.histogram.lengths)),
+		FirstChars: make([]Bucket[rune], 0, len(t.histogram.firsts)),
+	}
+	for n, words := range t.histogram.lengths {
+		h.Lengths = append(h.Lengths, Bucket[int]{Key: n, Words: words})
+	}
+	for c, words := range t.histogram.firsts {
+		h.FirstChars = append(h.FirstChars, Bucket[rune]{Key: c, Words: words})
+	}
+	sort.Slice(h.Lengths, func(i, j int) bool { return h.Lengths[i].Key < h.Lengths[j].Key })
+	sort.Slice(h.FirstChars, func(i, j int) bool { return h.FirstChars[i].Key < h.FirstChars[j].Key })
+	return h
+}
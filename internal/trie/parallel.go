@@ -0,0 +1,77 @@
+package trie
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// Broad prefix queries on large Tries are collected by up to
+// ParallelWorkers goroutines, each walking one child subtree of the prefix
+// at a time, when the Trie holds at least ParallelMinWords words and the
+// prefix is at most ParallelMaxPrefix characters long. ParallelWorkers
+// below 2 disables parallel traversal.
+var (
+	ParallelWorkers   = runtime.GOMAXPROCS(0)
+	ParallelMinWords  = 50000
+	ParallelMaxPrefix = 2
+)
+
+// parallel reports whether a query for prefix ending at node is broad
+// enough to be split across workers. The caller must hold the lock.
+func (t *Trie) parallel(prefix string, node *Node) bool {
+	return ParallelWorkers > 1 && t.size >= ParallelMinWords &&
+		utf8.RuneCountInString(prefix) <= ParallelMaxPrefix && len(node.Children) > 1
+}
+
+// collectParallel collects the words under node like collect, walking its
+// child subtrees concurrently and merging them in child order, so sorted
+// Tries still return words alphabetically. With a limit n > 0 each subtree
+// stops after n words, and in unsorted Tries, where any n words will do,
+// no further subtrees are started once n were found. The nodes walked are
+// added to visited. The caller must hold the read lock.
+func (t *Trie) collectParallel(node *Node, prefix string, n int, visited *int) []string {
+	keys := node.Keys
+	if !t.sorted {
+		keys = make([]rune, 0, len(node.Children))
+		for char := range node.Children {
+			keys = append(keys, char)
+		}
+	}
+	parts := make([][]string, len(keys))
+	var next, found, nodes atomic.Int64
+	var wg sync.WaitGroup
+	for w := min(ParallelWorkers, len(keys)); w > 0; w-- {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(next.Add(1) - 1)
+				if i >= len(keys) || !t.sorted && n > 0 && found.Load() >= int64(n) {
+					return
+				}
+				var part []string
+				var walked int
+				t.collect(node.Children[keys[i]], prefix+string(keys[i]), n, &part, &walked)
+				parts[i] = part
+				found.Add(int64(len(part)))
+				nodes.Add(int64(walked))
+			}
+		}()
+	}
+	wg.Wait()
+	*visited += int(nodes.Load()) + 1
+
+	var results []string
+	if node.IsWord && prefix != "" {
+		results = append(results, t.intern(prefix))
+	}
+	for _, part := range parts {
+		results = append(results, part...)
+		if n > 0 && len(results) >= n {
+			return results[:n]
+		}
+	}
+	return results
+}
@@ -1,12 +1,76 @@
 // Package trie provides the implementation of a Trie data structure.
 package trie
 
-import "sync"
+import (
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/cg011235/autocomplete/internal/bloom"
+	"github.com/cg011235/autocomplete/internal/intern"
+)
+
+// Prefix Bloom filter sizing for new Tries. BloomBits caps the bits of each
+// filter, which are otherwise sized from the number of words; setting it to 0
+// disables the filters.
+var (
+	BloomMaxLen = 16
+	BloomBits   = 1 << 20
+)
+
+// bloomBitsPerWord sizes prefix filters to the words they hold, for about a
+// 2% false positive rate, and minBloomWords is the fewest words a filter is
+// sized for.
+const (
+	bloomBitsPerWord = 8
+	minBloomWords    = 1 << 10
+)
+
+// SortedChildren makes new Tries keep an index of each node's children in
+// rune order, so words are collected alphabetically.
+var SortedChildren = false
+
+// InternStrings makes new Tries share one copy of each context tag and of
+// each collected word, which are otherwise duplicated across nodes and
+// cached suggestion lists.
+var InternStrings = true
 
 // Node represents a single node in the Trie.
 type Node struct {
 	Children map[rune]*Node
 	IsWord   bool
+	// Weight ranks the word ending at this node; higher weights are suggested first.
+	Weight float64
+	// Contexts tags the word with the surfaces (categories, segments) it is relevant to.
+	Contexts []string
+	// Display is the form the word is shown in when it differs from the
+	// folded form it is stored under, e.g. "Café" for "cafe".
+	Display string
+	// Keys indexes Children in rune order in Tries with sorted children.
+	Keys []rune
+	// Updated is when the word was last inserted or boosted, in Unix
+	// nanoseconds, or zero.
+	Updated int64
+	// Snippet holds rich rendering metadata for the word, or is nil.
+	Snippet *Snippet
+}
+
+// Snippet is optional metadata rendered alongside a suggestion, such as a
+// short description and an icon.
+type Snippet struct {
+	Description string `json:"description,omitempty"`
+	Icon        string `json:"icon,omitempty"`
+}
+
+// size returns the bytes of metadata the snippet holds.
+func (s *Snippet) size() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.Description) + len(s.Icon)
 }
 
 // NewNode creates and returns a new Trie node.
@@ -18,52 +82,432 @@ func NewNode() *Node {
 type Trie struct {
 	Root *Node
 	mu   sync.RWMutex
+	// sorted maintains Node.Keys.
+	sorted bool
+	arena  *arena
+	// strings interns contexts and collected words, or is nil.
+	strings *intern.Pool
+	// size, metadataBytes and histogram are maintained incrementally so
+	// quotas and distributions can be read without walking the Trie.
+	size          int
+	metadataBytes int
+	histogram     histogram
+	// prefixes records the prefixes of inserted words for lock-free misses,
+	// or is nil until the first word is inserted. Deleted words are not
+	// removed, which only causes false positives.
+	prefixes atomic.Pointer[bloom.PrefixSet]
+	// filtered keeps prefixes, which hold up to prefixWords words before
+	// they are rebuilt larger.
+	filtered    bool
+	prefixWords int
 }
 
 // NewTrie creates and returns a new Trie.
 func NewTrie() *Trie {
-	return &Trie{Root: NewNode()}
+	t := NewScratchTrie()
+	t.filtered = BloomBits > 0 && BloomMaxLen > 0
+	return t
+}
+
+// NewScratchTrie returns a Trie without prefix Bloom filters, for Tries
+// built to be read briefly, e.g. a past version or an upload to compare.
+func NewScratchTrie() *Trie {
+	t := &Trie{sorted: SortedChildren, arena: newArena(SlabSize), histogram: newHistogram()}
+	if InternStrings {
+		t.strings = intern.New()
+	}
+	t.Root = t.arena.alloc()
+	return t
+}
+
+// resetPrefixes drops the prefix filters until the next word is inserted.
+// The caller must hold the write lock.
+func (t *Trie) resetPrefixes() {
+	t.prefixes.Store(nil)
+	t.prefixWords = 0
+}
+
+// addPrefixes records the prefixes of word, which the caller has counted in
+// t.size, rebuilding the filters for twice the words once they are full. The
+// caller must hold the write lock.
+func (t *Trie) addPrefixes(word string) {
+	if !t.filtered {
+		return
+	}
+	if t.size > t.prefixWords {
+		t.sizePrefixes(2 * t.size)
+	}
+	t.prefixes.Load().AddWord(word)
+}
+
+// sizePrefixes replaces the prefix filters with ones sized for n words,
+// capped at BloomBits, holding the prefixes of every word in the Trie. The
+// caller must hold the write lock.
+func (t *Trie) sizePrefixes(n int) {
+	words := minBloomWords
+	for words < n {
+		words *= 2
+	}
+	bits := words * bloomBitsPerWord
+	if bits >= BloomBits {
+		bits, words = BloomBits, math.MaxInt
+	}
+	p := bloom.NewPrefixSet(BloomMaxLen, bits)
+	var walk func(node *Node, prefix []rune)
+	walk = func(node *Node, prefix []rune) {
+		if node.IsWord {
+			p.AddWord(string(prefix))
+		}
+		for char, child := range node.Children {
+			walk(child, append(prefix, char))
+		}
+	}
+	walk(t.Root, nil)
+	t.prefixes.Store(p)
+	t.prefixWords = words
+}
+
+// MayHavePrefix reports whether some word in the Trie may start with prefix.
+// A false result is definite and is answered without taking the lock.
+func (t *Trie) MayHavePrefix(prefix string) bool {
+	p := t.prefixes.Load()
+	return p == nil || p.MayHavePrefix(prefix)
 }
 
 // Insert adds a word to the Trie.
-func (t *Trie) Insert(word string) {
+// It returns false if the word was already present.
+func (t *Trie) Insert(word string) bool {
 	t.mu.Lock()
 	defer t.mu.Unlock()
+	_, added := t.insert(word)
+	return added
+}
+
+// InsertWords adds words under a single lock acquisition, tagging each with
+// contexts and recording displays[i], if given and non-empty, as the display
+// form of words[i] unless one is set. It returns the words that were not
+// already present.
+func (t *Trie) InsertWords(words, contexts, displays []string) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var added []string
+	for i, word := range words {
+		node, isNew := t.insert(word)
+		if isNew {
+			added = append(added, word)
+		}
+		t.tag(node, contexts)
+		if i < len(displays) && displays[i] != "" {
+			setDisplay(node, word, displays[i], false)
+		}
+	}
+	return added
+}
+
+// insert adds a word and returns its node and whether it was added. The
+// caller must hold the write lock.
+func (t *Trie) insert(word string) (*Node, bool) {
 	node := t.Root
 	for _, char := range word {
 		if _, found := node.Children[char]; !found {
-			node.Children[char] = NewNode()
+			node.Children[char] = t.arena.alloc()
+			if t.sorted {
+				node.addKey(char)
+			}
 		}
 		node = node.Children[char]
 	}
+	added := !node.IsWord
+	if added {
+		t.size++
+		t.histogram.add(word, 1)
+		t.addPrefixes(word)
+	}
 	node.IsWord = true
+	node.Updated = time.Now().UnixNano()
+	return node, added
 }
 
 // Delete removes a word from the Trie.
-func (t *Trie) Delete(word string) {
+// It returns false if the word was not present.
+func (t *Trie) Delete(word string) bool {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 	node := t.Root
 	stack := []*Node{node}
 	for _, char := range word {
 		if _, found := node.Children[char]; !found {
-			return // Word not found
+			return false // Word not found
 		}
 		node = node.Children[char]
 		stack = append(stack, node)
 	}
 	if !node.IsWord {
-		return // Word not found
+		return false // Word not found
 	}
 	node.IsWord = false
-	for i := len(word) - 1; i >= 0; i-- {
-		char := rune(word[i])
+	node.Weight = 0
+	node.Updated = 0
+	node.Display = ""
+	t.size--
+	t.histogram.add(word, -1)
+	t.metadataBytes -= contextBytes(node.Contexts) + node.Snippet.size()
+	node.Contexts = nil
+	node.Snippet = nil
+	chars := []rune(word)
+	for i := len(chars) - 1; i >= 0; i-- {
+		char := chars[i]
 		node := stack[i]
 		child := stack[i+1]
 		if len(child.Children) == 0 && !child.IsWord {
 			delete(node.Children, char)
+			t.arena.removed++
+			if t.sorted {
+				node.removeKey(char)
+			}
 		}
 	}
+	return true
+}
+
+func (n *Node) addKey(char rune) {
+	i := sort.Search(len(n.Keys), func(i int) bool { return n.Keys[i] >= char })
+	n.Keys = append(n.Keys, 0)
+	copy(n.Keys[i+1:], n.Keys[i:])
+	n.Keys[i] = char
+}
+
+func (n *Node) removeKey(char rune) {
+	i := sort.Search(len(n.Keys), func(i int) bool { return n.Keys[i] >= char })
+	if i < len(n.Keys) && n.Keys[i] == char {
+		n.Keys = append(n.Keys[:i], n.Keys[i+1:]...)
+	}
+}
+
+// Clear removes all words from the Trie, releasing all of its nodes at once.
+func (t *Trie) Clear() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.clear()
+}
+
+// clear resets the Trie to empty. The caller must hold the write lock.
+func (t *Trie) clear() {
+	t.arena = newArena(SlabSize)
+	if t.strings != nil {
+		t.strings = intern.New()
+	}
+	t.Root = t.arena.alloc()
+	t.size = 0
+	t.metadataBytes = 0
+	t.histogram = newHistogram()
+	t.resetPrefixes()
+}
+
+// Len returns the number of words in the Trie.
+func (t *Trie) Len() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.size
+}
+
+// MetadataBytes returns the total size of the metadata (context tags and
+// snippets) stored in the Trie.
+func (t *Trie) MetadataBytes() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.metadataBytes
+}
+
+// Boost adds delta to the weight of an existing word.
+// It returns false if the word is not in the Trie.
+func (t *Trie) Boost(word string, delta float64) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	node := t.find(word)
+	if node == nil || !node.IsWord {
+		return false
+	}
+	node.Weight += delta
+	if delta > 0 {
+		node.Updated = time.Now().UnixNano()
+	}
+	return true
+}
+
+// Updated returns when a word was last inserted or boosted, or the zero
+// time if it is not in the Trie.
+func (t *Trie) Updated(word string) time.Time {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	node := t.find(word)
+	if node == nil || !node.IsWord || node.Updated == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, node.Updated)
+}
+
+// Weight returns the weight of a word, or 0 if the word is not in the Trie.
+func (t *Trie) Weight(word string) float64 {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	node := t.find(word)
+	if node == nil || !node.IsWord {
+		return 0
+	}
+	return node.Weight
+}
+
+// Tag adds contexts to an existing word, ignoring ones it already has.
+// It returns false if the word is not in the Trie.
+func (t *Trie) Tag(word string, contexts ...string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	node := t.find(word)
+	if node == nil || !node.IsWord {
+		return false
+	}
+	t.tag(node, contexts)
+	return true
+}
+
+func (t *Trie) tag(node *Node, contexts []string) {
+	for _, c := range contexts {
+		if c != "" && !hasContext(node, c) {
+			node.Contexts = append(node.Contexts, t.intern(c))
+			t.metadataBytes += len(c)
+		}
+	}
+}
+
+// SetDisplay sets the form an existing word is shown in. Unless replace is
+// set, a display form already recorded is kept. It returns false if the word
+// is not in the Trie.
+func (t *Trie) SetDisplay(word, display string, replace bool) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	node := t.find(word)
+	if node == nil || !node.IsWord {
+		return false
+	}
+	setDisplay(node, word, display, replace)
+	return true
+}
+
+func setDisplay(node *Node, word, display string, replace bool) {
+	if display == word {
+		display = ""
+	}
+	if replace || node.Display == "" {
+		node.Display = display
+	}
+}
+
+// Display returns the form a word is shown in: its display form if one was
+// set, otherwise the word itself.
+func (t *Trie) Display(word string) string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if node := t.find(word); node != nil && node.IsWord && node.Display != "" {
+		return node.Display
+	}
+	return word
+}
+
+// SetSnippet sets the snippet of an existing word; an empty snippet removes
+// it. It returns false if the word is not in the Trie.
+func (t *Trie) SetSnippet(word string, s Snippet) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	node := t.find(word)
+	if node == nil || !node.IsWord {
+		return false
+	}
+	t.setSnippet(node, s)
+	return true
+}
+
+func (t *Trie) setSnippet(node *Node, s Snippet) {
+	t.metadataBytes -= node.Snippet.size()
+	if s == (Snippet{}) {
+		node.Snippet = nil
+		return
+	}
+	node.Snippet = &s
+	t.metadataBytes += s.size()
+}
+
+// Snippet returns the snippet of a word, which is empty if it has none or
+// is not in the Trie.
+func (t *Trie) Snippet(word string) Snippet {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if node := t.find(word); node != nil && node.IsWord && node.Snippet != nil {
+		return *node.Snippet
+	}
+	return Snippet{}
+}
+
+// HasContext reports whether a word is tagged with the given context.
+func (t *Trie) HasContext(word, context string) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	node := t.find(word)
+	return node != nil && node.IsWord && hasContext(node, context)
+}
+
+func contextBytes(contexts []string) int {
+	n := 0
+	for _, c := range contexts {
+		n += len(c)
+	}
+	return n
+}
+
+func hasContext(node *Node, context string) bool {
+	for _, c := range node.Contexts {
+		if c == context {
+			return true
+		}
+	}
+	return false
+}
+
+// minWeight is the weight below which decayed words are reset to zero.
+const minWeight = 1e-6
+
+// Decay multiplies the weight of every word by factor.
+// Because all weights are scaled uniformly, the relative ranking is preserved.
+func (t *Trie) Decay(factor float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	decay(t.Root, factor)
+}
+
+func decay(node *Node, factor float64) {
+	if node.Weight != 0 {
+		node.Weight *= factor
+		if math.Abs(node.Weight) < minWeight {
+			node.Weight = 0
+		}
+	}
+	for _, child := range node.Children {
+		decay(child, factor)
+	}
+}
+
+// find returns the node reached by following word from the root, or nil.
+// The caller must hold the lock.
+func (t *Trie) find(word string) *Node {
+	node := t.Root
+	for _, char := range word {
+		next, found := node.Children[char]
+		if !found {
+			return nil
+		}
+		node = next
+	}
+	return node
 }
 
 // Exists checks if a word exists in the Trie.
@@ -80,16 +524,154 @@ func (t *Trie) Exists(word string) bool {
 	return node.IsWord
 }
 
-// CollectWords collects all words in the Trie starting from the given node.
+// Next reports whether prefix is itself a word and which characters can
+// follow it in some word, in rune order.
+func (t *Trie) Next(prefix string) (complete bool, next []rune) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	node := t.find(prefix)
+	if node == nil {
+		return false, nil
+	}
+	next = make([]rune, 0, len(node.Children))
+	for char := range node.Children {
+		next = append(next, char)
+	}
+	sort.Slice(next, func(i, j int) bool { return next[i] < next[j] })
+	return node.IsWord, next
+}
+
+// LongestPrefix returns the longest word in the Trie that is a prefix of
+// text, reporting false if there is none.
+func (t *Trie) LongestPrefix(text string) (string, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	node := t.Root
+	end, found := 0, node.IsWord
+	for i, char := range text {
+		next, ok := node.Children[char]
+		if !ok {
+			break
+		}
+		node = next
+		if node.IsWord {
+			// An invalid byte ranges as utf8.RuneError, which encodes longer
+			_, size := utf8.DecodeRuneInString(text[i:])
+			end, found = i+size, true
+		}
+	}
+	return text[:end], found
+}
+
+// Search returns the words starting with prefix, in alphabetical order if
+// the Trie keeps sorted children.
+func (t *Trie) Search(prefix string) []string {
+	return t.SearchWithLimit(prefix, 0)
+}
+
+// SearchWithLimit is Search stopping after n words; n <= 0 means no limit.
+func (t *Trie) SearchWithLimit(prefix string, n int) []string {
+	return t.SearchTraced(prefix, n, nil)
+}
+
+// Trace records how a search was served, for diagnosing individual queries.
+type Trace struct {
+	// Nodes is how many nodes the search visited.
+	Nodes int
+	// LockWait is how long the search waited for the read lock.
+	LockWait time.Duration
+	// Traversal is how long finding the prefix and collecting its words took.
+	Traversal time.Duration
+}
+
+// SearchTraced is SearchWithLimit recording its work in tr, if not nil.
+func (t *Trie) SearchTraced(prefix string, n int, tr *Trace) []string {
+	var start time.Time
+	if tr != nil {
+		start = time.Now()
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if tr != nil {
+		locked := time.Now()
+		tr.LockWait = locked.Sub(start)
+		defer func() { tr.Traversal = time.Since(locked) }()
+	}
+	// Finding the prefix walks the root and one node per character but its
+	// last, which collecting counts.
+	visited := utf8.RuneCountInString(prefix)
+	defer func() {
+		if tr != nil {
+			tr.Nodes = visited
+		}
+	}()
+
+	node := t.find(prefix)
+	if node == nil {
+		return nil
+	}
+	if t.parallel(prefix, node) {
+		return t.collectParallel(node, prefix, n, &visited)
+	}
+	var results []string
+	t.collect(node, prefix, n, &results, &visited)
+	return results
+}
+
+// CollectWords collects all words in the Trie starting from the given node,
+// labelled by prefix, in alphabetical order if the Trie keeps sorted
+// children. Unlike Search it does not lock the Trie; the caller must.
 func (t *Trie) CollectWords(node *Node, prefix string) []string {
 	var results []string
-	if node.IsWord {
-		results = append(results, prefix)
+	var visited int
+	t.collect(node, prefix, 0, &results, &visited)
+	return results
+}
+
+// collect appends the words under node to results until it holds n words,
+// reporting false once it does; n <= 0 means no limit. The empty word is
+// never a result. Every node walked is counted in visited.
+func (t *Trie) collect(node *Node, prefix string, n int, results *[]string, visited *int) bool {
+	*visited++
+	if node.IsWord && prefix != "" {
+		*results = append(*results, t.intern(prefix))
+		if n > 0 && len(*results) >= n {
+			return false
+		}
+	}
+	if t.sorted {
+		for _, char := range node.Keys {
+			if !t.collect(node.Children[char], prefix+string(char), n, results, visited) {
+				return false
+			}
+		}
+		return true
 	}
 	for char, child := range node.Children {
-		results = append(results, t.CollectWords(child, prefix+string(char))...)
+		if !t.collect(child, prefix+string(char), n, results, visited) {
+			return false
+		}
 	}
-	return results
+	return true
+}
+
+func (t *Trie) intern(s string) string {
+	if t.strings == nil {
+		return s
+	}
+	return t.strings.String(s)
+}
+
+// InternStats returns the statistics of the Trie's string pool, which are
+// zero if interning is disabled.
+func (t *Trie) InternStats() intern.Stats {
+	t.mu.RLock()
+	p := t.strings
+	t.mu.RUnlock()
+	if p == nil {
+		return intern.Stats{}
+	}
+	return p.Stats()
 }
 
 // CountWords counts the total number of words in the Trie starting from the given node.
@@ -103,3 +685,83 @@ func (t *Trie) CountWords(node *Node) int {
 	}
 	return count
 }
+
+// Entry is a word with its metadata, as exported from or loaded into a Trie.
+type Entry struct {
+	Word     string   `json:"word"`
+	Weight   float64  `json:"weight,omitempty"`
+	Contexts []string `json:"contexts,omitempty"`
+	Display  string   `json:"display,omitempty"`
+	Snippet  *Snippet `json:"snippet,omitempty"`
+}
+
+// Entries returns every word in the Trie with its metadata, sorted by word.
+func (t *Trie) Entries() []Entry {
+	records := t.records()
+	entries := make([]Entry, len(records))
+	for i, r := range records {
+		entries[i] = r.Entry
+	}
+	return entries
+}
+
+// FromEntries builds a new Trie holding the given entries.
+func FromEntries(entries []Entry) *Trie {
+	t := NewTrie()
+	if t.filtered && len(entries) > 0 {
+		t.mu.Lock()
+		t.sizePrefixes(len(entries))
+		t.mu.Unlock()
+	}
+	fill(t, entries)
+	return t
+}
+
+// ScratchFromEntries is FromEntries for a Trie without prefix Bloom filters,
+// as NewScratchTrie returns.
+func ScratchFromEntries(entries []Entry) *Trie {
+	t := NewScratchTrie()
+	fill(t, entries)
+	return t
+}
+
+// fill inserts entries into t with their metadata.
+func fill(t *Trie, entries []Entry) {
+	for _, e := range entries {
+		t.Insert(e.Word)
+		t.Boost(e.Word, e.Weight)
+		t.Tag(e.Word, e.Contexts...)
+		if e.Display != "" {
+			t.SetDisplay(e.Word, e.Display, false)
+		}
+		if e.Snippet != nil {
+			t.SetSnippet(e.Word, *e.Snippet)
+		}
+	}
+}
+
+// Diff compares two entry lists sorted by word, as returned by Entries, and
+// returns the words only in to (added) and only in from (removed).
+func Diff(from, to []Entry) (added, removed []string) {
+	i, j := 0, 0
+	for i < len(from) && j < len(to) {
+		switch {
+		case from[i].Word == to[j].Word:
+			i++
+			j++
+		case from[i].Word < to[j].Word:
+			removed = append(removed, from[i].Word)
+			i++
+		default:
+			added = append(added, to[j].Word)
+			j++
+		}
+	}
+	for ; i < len(from); i++ {
+		removed = append(removed, from[i].Word)
+	}
+	for ; j < len(to); j++ {
+		added = append(added, to[j].Word)
+	}
+	return added, removed
+}
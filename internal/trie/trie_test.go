@@ -0,0 +1,146 @@
+package trie
+
+import (
+	"strconv"
+	"testing"
+)
+
+func contains(slice []string, item string) bool {
+	for _, v := range slice {
+		if v == item {
+			return true
+		}
+	}
+	return false
+}
+
+func TestInsertAndSearch(t *testing.T) {
+	trie := NewTrie()
+
+	// Test inserting an empty string and searching for it
+	trie.Insert("")
+	results := trie.Search("")
+	if len(results) > 0 {
+		t.Fatal("Invalid results for empty prefix")
+	}
+
+	// Insert some strings
+	trie.Insert("magic")
+	trie.Insert("magnet")
+	trie.Insert("maggie")
+	trie.Insert("maggot")
+	trie.Insert("ma")
+	trie.Insert("megan")
+	trie.Insert("mama")
+	trie.Insert("mam")
+
+	// Search valid prefix
+	results = trie.Search("mag")
+	expectedResults := []string{"magic", "magnet", "maggie", "maggot"}
+	for _, expected := range expectedResults {
+		if !contains(results, expected) {
+			t.Fatalf("Expected result '%s' not found for prefix 'mag'", expected)
+		}
+	}
+
+	// Ensure no extra results are included
+	if len(results) != len(expectedResults) {
+		t.Fatalf("Unexpected results for prefix 'mag': %v", results)
+	}
+
+	// Search invalid prefix
+	results = trie.Search("a")
+	if len(results) > 0 {
+		t.Fatal("Results should be empty for un-inserted search")
+	}
+
+	// Search valid prefix with single character
+	results = trie.Search("ma")
+	expectedResults = []string{"magic", "magnet", "maggie", "maggot", "ma", "mama", "mam"}
+	for _, expected := range expectedResults {
+		if !contains(results, expected) {
+			t.Fatalf("Expected result '%s' not found for prefix 'ma'", expected)
+		}
+	}
+
+	// Ensure no extra results are included
+	if len(results) != len(expectedResults) {
+		t.Fatalf("Unexpected results for prefix 'ma': %v", results)
+	}
+}
+
+func TestSearchWithLimit(t *testing.T) {
+	trie := NewTrie()
+	trie.Insert("magic")
+	trie.Insert("magnet")
+	trie.Insert("maggie")
+	trie.Insert("megan")
+
+	// A limit caps the results
+	results := trie.SearchWithLimit("mag", 2)
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results for prefix 'mag', got %v", results)
+	}
+	for _, result := range results {
+		if result != "magic" && result != "magnet" && result != "maggie" {
+			t.Fatalf("Unexpected result '%s' for prefix 'mag'", result)
+		}
+	}
+
+	// No limit returns every match
+	if results = trie.SearchWithLimit("mag", 0); len(results) != 3 {
+		t.Fatalf("Expected 3 results for prefix 'mag', got %v", results)
+	}
+}
+
+func TestSearchTraced(t *testing.T) {
+	trie := NewTrie()
+	trie.Insert("cat")
+	trie.Insert("car")
+
+	// The root, c, a and the two leaves are visited
+	var tr Trace
+	if results := trie.SearchTraced("ca", 0, &tr); len(results) != 2 {
+		t.Fatalf("Expected 2 results for prefix 'ca', got %v", results)
+	}
+	if tr.Nodes != 5 {
+		t.Fatalf("Expected 5 visited nodes, got %d", tr.Nodes)
+	}
+}
+
+func TestLongestPrefixInvalidUTF8(t *testing.T) {
+	trie := NewTrie()
+	trie.Insert("\uFFFD")
+
+	// The invalid byte matches the replacement character but is one byte long
+	if word, found := trie.LongestPrefix("\xffab"); !found || word != "\xff" {
+		t.Fatalf("Expected %q, got %q, %v", "\xff", word, found)
+	}
+}
+
+func TestPrefixFiltersGrow(t *testing.T) {
+	trie := NewTrie()
+	if trie.prefixes.Load() != nil {
+		t.Fatal("Expected no prefix filters before the first word")
+	}
+
+	// Filters are rebuilt as they fill up and keep every earlier word
+	for i := 0; i < 3*minBloomWords; i++ {
+		trie.Insert("w" + strconv.Itoa(i))
+	}
+	if trie.prefixWords < 3*minBloomWords {
+		t.Fatalf("Expected filters sized for %d words, got %d", 3*minBloomWords, trie.prefixWords)
+	}
+	for _, prefix := range []string{"w0", "w1023", "w3071"} {
+		if !trie.MayHavePrefix(prefix) {
+			t.Fatalf("Expected prefix %q to be reported", prefix)
+		}
+	}
+	if trie.MayHavePrefix("x") {
+		t.Fatal("Expected prefix \"x\" to be rejected")
+	}
+
+	if ScratchFromEntries(trie.Entries()).prefixes.Load() != nil {
+		t.Fatal("Expected no prefix filters in a scratch Trie")
+	}
+}
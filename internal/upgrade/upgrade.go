@@ -0,0 +1,191 @@
+// Package upgrade hands the server's listeners to a newly started copy of the
+// binary so it can be replaced without refusing connections.
+//
+// On Upgrade the running process starts its executable again, passing every
+// listener as an inherited file descriptor and a pipe the child writes to once
+// it has loaded its dictionaries and is serving. Only then does the parent stop
+// accepting and drain in-flight requests; if the child fails to become ready
+// the parent keeps serving.
+package upgrade
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cg011235/autocomplete/internal/listen"
+)
+
+const (
+	// listenersEnv maps addresses to inherited descriptors, e.g. ":8080=3,127.0.0.1:9090=4".
+	listenersEnv = "AUTOCOMPLETE_UPGRADE_LISTENERS"
+	// readyEnv is the descriptor the child writes to once it is ready.
+	readyEnv = "AUTOCOMPLETE_UPGRADE_READY_FD"
+)
+
+// Upgrader opens listeners, inheriting them from the parent after an upgrade,
+// and starts replacement processes.
+type Upgrader struct {
+	// ReadyTimeout bounds how long Upgrade waits for the new process.
+	ReadyTimeout time.Duration
+
+	mu        sync.Mutex
+	inherited map[string]*os.File
+	files     map[string]*os.File
+	upgrading bool
+}
+
+// New returns an Upgrader, picking up any listeners passed by a parent process.
+func New() (*Upgrader, error) {
+	u := &Upgrader{
+		ReadyTimeout: time.Minute,
+		inherited:    make(map[string]*os.File),
+		files:        make(map[string]*os.File),
+	}
+	for _, item := range strings.Split(os.Getenv(listenersEnv), ",") {
+		if item == "" {
+			continue
+		}
+		i := strings.LastIndex(item, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("%s: malformed entry %q", listenersEnv, item)
+		}
+		fd, err := strconv.Atoi(item[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("%s: malformed entry %q", listenersEnv, item)
+		}
+		u.inherited[item[:i]] = os.NewFile(uintptr(fd), item[:i])
+	}
+	os.Unsetenv(listenersEnv)
+	return u, nil
+}
+
+// Listen returns a listener for addr, reusing the parent's listener when one
+// was inherited for the same address.
+func (u *Upgrader) Listen(addr string) (net.Listener, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	var l net.Listener
+	var err error
+	if f, ok := u.inherited[addr]; ok {
+		delete(u.inherited, addr)
+		l, err = net.FileListener(f)
+		f.Close()
+	} else {
+		l, err = listen.Listen(addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Keep our own descriptor so the socket can be handed on even after the
+	// server has closed its listener.
+	filer, ok := l.(interface{ File() (*os.File, error) })
+	if !ok {
+		l.Close()
+		return nil, fmt.Errorf("listener for %s cannot be handed off", addr)
+	}
+	f, err := filer.File()
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+	if ul, ok := l.(*net.UnixListener); ok {
+		// The socket file must outlive this process for the child to keep serving.
+		ul.SetUnlinkOnClose(false)
+	}
+	u.files[addr] = f
+	return l, nil
+}
+
+// Ready tells the parent process, if any, that this process is serving.
+func (u *Upgrader) Ready() error {
+	fd, err := strconv.Atoi(os.Getenv(readyEnv))
+	if err != nil {
+		return nil
+	}
+	os.Unsetenv(readyEnv)
+	f := os.NewFile(uintptr(fd), "upgrade-ready")
+	defer f.Close()
+	_, err = f.Write([]byte{1})
+	return err
+}
+
+// Upgrade starts a new copy of the executable with the current listeners and
+// waits until it reports ready. On success the caller should stop accepting,
+// drain and exit; on error the new process has been killed and the caller
+// keeps serving.
+func (u *Upgrader) Upgrade() error {
+	u.mu.Lock()
+	if u.upgrading {
+		u.mu.Unlock()
+		return errors.New("upgrade already in progress")
+	}
+	u.upgrading = true
+	u.mu.Unlock()
+	defer func() {
+		u.mu.Lock()
+		u.upgrading = false
+		u.mu.Unlock()
+	}()
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	readR, readyW, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer readR.Close()
+
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	var entries []string
+	u.mu.Lock()
+	for addr, f := range u.files {
+		entries = append(entries, addr+"="+strconv.Itoa(3+len(cmd.ExtraFiles)))
+		cmd.ExtraFiles = append(cmd.ExtraFiles, f)
+	}
+	u.mu.Unlock()
+	cmd.Env = append(os.Environ(),
+		listenersEnv+"="+strings.Join(entries, ","),
+		readyEnv+"="+strconv.Itoa(3+len(cmd.ExtraFiles)),
+	)
+	cmd.ExtraFiles = append(cmd.ExtraFiles, readyW)
+
+	err = cmd.Start()
+	readyW.Close()
+	if err != nil {
+		return fmt.Errorf("starting new process: %w", err)
+	}
+
+	ready := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 1)
+		if _, err := readR.Read(buf); err != nil {
+			ready <- errors.New("new process exited before becoming ready")
+			return
+		}
+		ready <- nil
+	}()
+	select {
+	case err = <-ready:
+	case <-time.After(u.ReadyTimeout):
+		err = fmt.Errorf("new process not ready after %s", u.ReadyTimeout)
+	}
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return err
+	}
+	// The new process outlives us; reap it only if we are still around.
+	go cmd.Wait()
+	return nil
+}
@@ -0,0 +1,126 @@
+// Package validate checks query prefixes and inserted words before they reach
+// the Trie and cache keys.
+package validate
+
+import (
+	"fmt"
+	"net/url"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/cg011235/autocomplete/internal/grapheme"
+)
+
+// Character classes that may be allowed in words.
+var classes = map[string]*unicode.RangeTable{
+	"letter": unicode.Letter,
+	"digit":  unicode.Digit,
+	"mark":   unicode.Mark,
+	"punct":  unicode.Punct,
+	"symbol": unicode.Symbol,
+	"space":  unicode.White_Space,
+}
+
+// Rules configures what a valid word or prefix looks like. Invalid UTF-8 and
+// control characters are always rejected.
+type Rules struct {
+	// MaxLength is the maximum length in characters; zero means unlimited.
+	MaxLength int
+	// Graphemes counts MaxLength in grapheme clusters rather than code points.
+	Graphemes bool
+	// Allowed are the character classes words may contain: letter, digit,
+	// mark, punct, symbol and space. Empty allows every printable character.
+	Allowed []string
+	// MaxDescription and MaxIconURL cap the bytes of a word's snippet
+	// description and icon URL; zero means unlimited.
+	MaxDescription int
+	MaxIconURL     int
+}
+
+var (
+	mu             sync.RWMutex
+	maxLen         int
+	graphemes      bool
+	allowed        []*unicode.RangeTable
+	maxDescription int
+	maxIconURL     int
+)
+
+// SetRules installs the validation rules, rejecting unknown character classes.
+func SetRules(r Rules) error {
+	tables := make([]*unicode.RangeTable, 0, len(r.Allowed))
+	for _, name := range r.Allowed {
+		t, ok := classes[name]
+		if !ok {
+			return fmt.Errorf("unknown character class %q", name)
+		}
+		tables = append(tables, t)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	maxLen = r.MaxLength
+	graphemes = r.Graphemes
+	allowed = tables
+	maxDescription = r.MaxDescription
+	maxIconURL = r.MaxIconURL
+	return nil
+}
+
+// Word returns why s is not a valid word or prefix, or "" if it is.
+func Word(s string) string {
+	if !utf8.ValidString(s) {
+		return "not valid UTF-8"
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	if maxLen > 0 && length(s) > maxLen {
+		return fmt.Sprintf("longer than %d characters", maxLen)
+	}
+	for i, c := range s {
+		if unicode.IsControl(c) {
+			return fmt.Sprintf("control character at byte %d", i)
+		}
+		if len(allowed) > 0 && !unicode.IsOneOf(allowed, c) {
+			return fmt.Sprintf("character %q at byte %d is not allowed", c, i)
+		}
+	}
+	return ""
+}
+
+// Snippet returns the field of a word's snippet that is invalid, and why,
+// or two empty strings if both are valid. The icon must be an absolute
+// http or https URL.
+func Snippet(description, icon string) (field, reason string) {
+	mu.RLock()
+	defer mu.RUnlock()
+	if !utf8.ValidString(description) {
+		return "description", "not valid UTF-8"
+	}
+	if maxDescription > 0 && len(description) > maxDescription {
+		return "description", fmt.Sprintf("longer than %d bytes", maxDescription)
+	}
+	for i, c := range description {
+		if unicode.IsControl(c) {
+			return "description", fmt.Sprintf("control character at byte %d", i)
+		}
+	}
+	if icon == "" {
+		return "", ""
+	}
+	if maxIconURL > 0 && len(icon) > maxIconURL {
+		return "icon", fmt.Sprintf("longer than %d bytes", maxIconURL)
+	}
+	if u, err := url.Parse(icon); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "icon", "not an absolute http or https URL"
+	}
+	return "", ""
+}
+
+// length returns the length of s in characters. The caller must hold mu.
+func length(s string) int {
+	if graphemes {
+		return grapheme.Count(s)
+	}
+	return utf8.RuneCountInString(s)
+}
@@ -0,0 +1,153 @@
+// Package webhook delivers dictionary mutation events to HTTP endpoints.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cg011235/autocomplete/internal/events"
+)
+
+// SignatureHeader carries the hex HMAC-SHA256 of the timestamp, a dot and
+// the request body, so a captured delivery cannot be replayed later with a
+// fresh timestamp. TimestampHeader carries the timestamp in Unix seconds.
+const (
+	SignatureHeader = "X-Autocomplete-Signature"
+	TimestampHeader = "X-Autocomplete-Timestamp"
+)
+
+const queueSize = 1024
+
+// Notifier posts signed JSON events to a set of webhook targets. Each target
+// has its own queue and worker, so a slow target does not delay the others.
+type Notifier struct {
+	secret     []byte
+	maxRetries int
+	backoff    time.Duration
+	client     *http.Client
+	targets    []chan events.Event
+	// ctx is cancelled by Close, stopping the workers.
+	ctx     context.Context
+	cancel  context.CancelFunc
+	workers sync.WaitGroup
+}
+
+// NewNotifier starts one delivery worker per URL. Failed deliveries are
+// retried up to maxRetries times with exponential backoff starting at backoff.
+func NewNotifier(urls []string, secret []byte, maxRetries int, backoff time.Duration) *Notifier {
+	n := &Notifier{
+		secret:     secret,
+		maxRetries: maxRetries,
+		backoff:    backoff,
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}
+	n.ctx, n.cancel = context.WithCancel(context.Background())
+	for _, url := range urls {
+		queue := make(chan events.Event, queueSize)
+		n.targets = append(n.targets, queue)
+		n.workers.Add(1)
+		go n.run(url, queue)
+	}
+	return n
+}
+
+// Publish queues the event for every target, dropping it for targets whose
+// queue is full or once the Notifier is closed.
+func (n *Notifier) Publish(e events.Event) {
+	if n.ctx.Err() != nil {
+		return
+	}
+	for _, queue := range n.targets {
+		select {
+		case queue <- e:
+		default:
+			log.Printf("webhook: queue full, dropping %s event", e.Type)
+		}
+	}
+}
+
+// Close stops the workers, abandoning queued events and cancelling the
+// deliveries in progress, and waits for them to return.
+func (n *Notifier) Close() {
+	n.cancel()
+	n.workers.Wait()
+}
+
+func (n *Notifier) run(url string, queue <-chan events.Event) {
+	defer n.workers.Done()
+	for {
+		var e events.Event
+		select {
+		case <-n.ctx.Done():
+			return
+		case e = <-queue:
+		}
+		body, err := json.Marshal(e)
+		if err != nil {
+			log.Printf("webhook: encoding event: %v", err)
+			continue
+		}
+		delay := n.backoff
+		for attempt := 0; ; attempt++ {
+			err = n.deliver(url, body)
+			if err == nil {
+				break
+			}
+			if n.ctx.Err() != nil {
+				return
+			}
+			if attempt >= n.maxRetries {
+				log.Printf("webhook: giving up on %s after %d attempts: %v", url, attempt+1, err)
+				break
+			}
+			select {
+			case <-n.ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+			delay *= 2
+		}
+	}
+}
+
+func (n *Notifier) deliver(url string, body []byte) error {
+	req, err := http.NewRequestWithContext(n.ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, "sha256="+Sign(n.secret, timestamp, body))
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// Sign returns the hex-encoded HMAC-SHA256 of timestamp, a dot and body, as
+// sent in SignatureHeader. Receivers should also reject timestamps too far
+// from their clock.
+func Sign(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte{'.'})
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,734 @@
+// Package models defines the request and response payloads of the autocomplete API.
+package models
+
+// Credentials represents the login request body.
+type Credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// AddWordsRequest represents the request body for adding words.
+type AddWordsRequest struct {
+	Words []string `json:"words"`
+	// Contexts optionally tags every word in the request.
+	Contexts []string `json:"contexts,omitempty"`
+	// Snippets optionally stores rendering metadata with words, keyed by
+	// the word as given in Words. It replaces a word's existing snippet.
+	Snippets map[string]Snippet `json:"snippets,omitempty"`
+}
+
+// Snippet is a short description and icon URL returned with a suggestion,
+// so rich dropdowns can render it without a secondary lookup.
+type Snippet struct {
+	Description string `json:"description,omitempty"`
+	Icon        string `json:"icon,omitempty"`
+}
+
+// AddWordsResponse represents the response after adding words: the outcome
+// of each word and how many were inserted, already present or rejected.
+type AddWordsResponse struct {
+	Status     string          `json:"status"`
+	Message    string          `json:"message"`
+	Inserted   int             `json:"inserted"`
+	Duplicates int             `json:"duplicates"`
+	Rejected   int             `json:"rejected"`
+	Results    []AddWordResult `json:"results"`
+}
+
+// AddWordResult is the outcome of one word of an add request: inserted,
+// duplicate or rejected with a reason. Index is the position of the word in
+// the request; a word split by the tokenizer has a result per token, with
+// the token as normalized.
+type AddWordResult struct {
+	Index  int    `json:"index"`
+	Word   string `json:"word"`
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// ListWordsResponse represents the response for listing words.
+type ListWordsResponse struct {
+	Status string   `json:"status"`
+	Count  int      `json:"count"`
+	Data   []string `json:"data"`
+	// Complete reports whether the prefix is itself a word.
+	Complete bool `json:"complete"`
+	// NextChars lists the characters that can follow the prefix in some
+	// word, so clients can disable impossible keys.
+	NextChars []string `json:"next_chars"`
+	// Explain breaks down the score of each result when requested.
+	Explain []ScoreExplanation `json:"explain,omitempty"`
+	// Truncated reports that results were left out to stay within the
+	// response size budget; Cursor requests the ones that follow.
+	Truncated bool   `json:"truncated,omitempty"`
+	Cursor    string `json:"cursor,omitempty"`
+	// Version is the stored version of the dictionary that answered an
+	// asOf query.
+	Version int `json:"version,omitempty"`
+}
+
+// SelectedWordsResponse is the suggest response when the client selects
+// the fields of each result, e.g. fields=word,score: each result holds only
+// the selected fields of its ScoreExplanation.
+type SelectedWordsResponse struct {
+	Status    string           `json:"status"`
+	Count     int              `json:"count"`
+	Results   []map[string]any `json:"results"`
+	Truncated bool             `json:"truncated,omitempty"`
+	Cursor    string           `json:"cursor,omitempty"`
+}
+
+// ScoreExplanation lists the components of a suggestion's score. Score is
+// the sum of the boosts and the weight; fuzzy matches are ordered by
+// FuzzyDistance before score. Tie reports that a result scored, and for
+// fuzzy matches was as distant, as the one before it, so the two were
+// ordered by word.
+type ScoreExplanation struct {
+	Word            string  `json:"word"`
+	Display         string  `json:"display,omitempty"`
+	Description     string  `json:"description,omitempty"`
+	Icon            string  `json:"icon,omitempty"`
+	Score           float64 `json:"score"`
+	Weight          float64 `json:"weight"`
+	ContextBoost    float64 `json:"context_boost"`
+	RecencyBoost    float64 `json:"recency_boost"`
+	PersonalBoost   float64 `json:"personal_boost"`
+	Dict            string  `json:"dict,omitempty"`
+	DictionaryBoost float64 `json:"dictionary_boost,omitempty"`
+	FuzzyDistance   float64 `json:"fuzzy_distance,omitempty"`
+	Tie             bool    `json:"tie,omitempty"`
+}
+
+// DeleteWordsRequest represents the request body for deleting words.
+type DeleteWordsRequest struct {
+	Word string `json:"word"`
+}
+
+// DeleteWordsResponse represents the response after deleting words.
+type DeleteWordsResponse struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// CheckWordExistsResponse represents the response for checking word existence.
+type CheckWordExistsResponse struct {
+	Status string `json:"status"`
+	Exists bool   `json:"exists"`
+}
+
+// BatchExistsRequest represents the request body for checking several words.
+type BatchExistsRequest struct {
+	Words []string `json:"words"`
+}
+
+// BatchExistsResponse represents the response for checking several words,
+// mapping each word to whether it exists.
+type BatchExistsResponse struct {
+	Status string          `json:"status"`
+	Exists map[string]bool `json:"exists"`
+}
+
+// LongestPrefixResponse represents the response for a longest prefix match.
+// Length is the byte length of Word, i.e. where the rest of the text starts.
+type LongestPrefixResponse struct {
+	Status string `json:"status"`
+	Found  bool   `json:"found"`
+	Word   string `json:"word"`
+	// Length is the number of characters, not bytes, of Word.
+	Length int `json:"length"`
+}
+
+// SelectWordRequest represents the request body for recording a selected suggestion.
+type SelectWordRequest struct {
+	Word string `json:"word"`
+}
+
+// SelectWordResponse represents the response after recording a selection.
+type SelectWordResponse struct {
+	Status string  `json:"status"`
+	Weight float64 `json:"weight"`
+}
+
+// MeResponse describes the authenticated principal and its token.
+type MeResponse struct {
+	Status    string `json:"status"`
+	Username  string `json:"username"`
+	Role      string `json:"role"`
+	Tier      string `json:"tier"`
+	Issuer    string `json:"issuer,omitempty"`
+	Subject   string `json:"subject,omitempty"`
+	IssuedAt  string `json:"issued_at,omitempty"`
+	ExpiresAt string `json:"expires_at,omitempty"`
+	// ExpiresIn is the number of seconds until the token expires.
+	ExpiresIn int64 `json:"expires_in,omitempty"`
+}
+
+// EntityRequest represents the request body for creating or replacing an
+// entity. The name and every field are searchable.
+type EntityRequest struct {
+	Name     string            `json:"name"`
+	Fields   []string          `json:"fields,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// Entity is an entity as stored.
+type Entity struct {
+	ID       string            `json:"id"`
+	Name     string            `json:"name"`
+	Fields   []string          `json:"fields,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// EntityResponse represents the response after storing an entity.
+type EntityResponse struct {
+	Status string `json:"status"`
+	Entity Entity `json:"entity"`
+}
+
+// EntitySuggestion is a suggested entity with the term that matched the prefix.
+type EntitySuggestion struct {
+	ID       string            `json:"id"`
+	Name     string            `json:"name"`
+	Matched  string            `json:"matched"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// EntitySuggestionsResponse represents the response for suggesting entities.
+type EntitySuggestionsResponse struct {
+	Status string             `json:"status"`
+	Count  int                `json:"count"`
+	Data   []EntitySuggestion `json:"data"`
+}
+
+// EntityGroup is the top suggestions sharing one value of the grouping
+// metadata field.
+type EntityGroup struct {
+	// Value is the metadata value, empty for entities without the field.
+	Value string `json:"value"`
+	// Total is how many suggestions had the value before the per-group cap.
+	Total int                `json:"total"`
+	Data  []EntitySuggestion `json:"data"`
+}
+
+// GroupedEntitySuggestionsResponse represents entity suggestions grouped by
+// a metadata field.
+type GroupedEntitySuggestionsResponse struct {
+	Status  string        `json:"status"`
+	Count   int           `json:"count"`
+	GroupBy string        `json:"group_by"`
+	Groups  []EntityGroup `json:"groups"`
+}
+
+// ClearHistoryResponse represents the response after clearing personal history.
+type ClearHistoryResponse struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// Change represents a single dictionary mutation in the change log.
+type Change struct {
+	Seq  uint64 `json:"seq"`
+	Dict string `json:"dict"`
+	Type string `json:"type"`
+	Word string `json:"word,omitempty"`
+	Time string `json:"time"`
+}
+
+// ChangesResponse represents the response for polling the change log.
+type ChangesResponse struct {
+	Status string `json:"status"`
+	// Epoch must be passed back with since; it changes when the service
+	// restarts and sequence numbers start over.
+	Epoch   string   `json:"epoch"`
+	LastSeq uint64   `json:"last_seq"`
+	Changes []Change `json:"changes"`
+}
+
+// ModeRequest represents the request body for switching the server mode.
+type ModeRequest struct {
+	Mode string `json:"mode"`
+	// RetryAfter is the number of seconds clients are told to wait when rejected.
+	RetryAfter int `json:"retry_after,omitempty"`
+}
+
+// ModeResponse represents the current server mode.
+type ModeResponse struct {
+	Status     string `json:"status"`
+	Mode       string `json:"mode"`
+	RetryAfter int    `json:"retry_after"`
+}
+
+// ErrorResponse is the standard envelope of every error response.
+type ErrorResponse struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	// Errors details which input fields were rejected, for validation errors.
+	Errors []FieldError `json:"errors,omitempty"`
+	// Reason says why a request was throttled (429) or refused (503):
+	// rate_limited, locked_out, overloaded, maintenance or read_only.
+	// RetryAfter repeats the Retry-After header in seconds.
+	Reason     string `json:"reason,omitempty"`
+	RetryAfter int    `json:"retry_after,omitempty"`
+}
+
+// FieldError describes why an input field was rejected.
+type FieldError struct {
+	Field  string `json:"field"`
+	Value  string `json:"value"`
+	Reason string `json:"reason"`
+}
+
+// Tier represents a rate limit tier: Rate requests per second with bursts of up to Burst.
+type Tier struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+// TiersResponse lists the rate limit tiers and per-user tier assignments.
+type TiersResponse struct {
+	Status      string            `json:"status"`
+	Tiers       map[string]Tier   `json:"tiers"`
+	Assignments map[string]string `json:"assignments"`
+}
+
+// AssignTierRequest represents the request body for assigning a user's tier.
+// An empty tier reverts the user to their role's default tier.
+type AssignTierRequest struct {
+	Tier string `json:"tier"`
+}
+
+// ConsumerRequest represents the request body for creating or updating an
+// API consumer.
+type ConsumerRequest struct {
+	Role         string   `json:"role"`
+	Tier         string   `json:"tier,omitempty"`
+	Dictionaries []string `json:"dictionaries,omitempty"`
+}
+
+// APIKeyInfo describes an issued API key without revealing it.
+type APIKeyInfo struct {
+	ID      string `json:"id"`
+	Created string `json:"created"`
+}
+
+// Consumer describes an API consumer that authenticates with API keys.
+type Consumer struct {
+	Name         string       `json:"name"`
+	Role         string       `json:"role"`
+	Tier         string       `json:"tier"`
+	Dictionaries []string     `json:"dictionaries,omitempty"`
+	Keys         []APIKeyInfo `json:"keys"`
+}
+
+// ConsumerResponse represents the response for a single API consumer.
+type ConsumerResponse struct {
+	Status   string   `json:"status"`
+	Consumer Consumer `json:"consumer"`
+}
+
+// ConsumersResponse lists the API consumers.
+type ConsumersResponse struct {
+	Status    string     `json:"status"`
+	Consumers []Consumer `json:"consumers"`
+}
+
+// APIKeyResponse returns a newly issued API key. The key is shown only once.
+type APIKeyResponse struct {
+	Status   string `json:"status"`
+	Consumer string `json:"consumer"`
+	ID       string `json:"id"`
+	Key      string `json:"key"`
+}
+
+// QuotaRequest represents the request body for setting a dictionary's quota.
+// Zero values mean unlimited.
+type QuotaRequest struct {
+	MaxWords         int `json:"max_words"`
+	MaxMetadataBytes int `json:"max_metadata_bytes"`
+}
+
+// DictionaryQuota reports a dictionary's quota and current usage.
+type DictionaryQuota struct {
+	Dict             string `json:"dict"`
+	MaxWords         int    `json:"max_words"`
+	MaxMetadataBytes int    `json:"max_metadata_bytes"`
+	Words            int    `json:"words"`
+	MetadataBytes    int    `json:"metadata_bytes"`
+}
+
+// QuotasResponse lists dictionary quotas and usage.
+type QuotasResponse struct {
+	Status string            `json:"status"`
+	Quotas []DictionaryQuota `json:"quotas"`
+}
+
+// SettingsRequest represents the request body for setting a dictionary's
+// settings. Omitted or zero values use the server defaults.
+type SettingsRequest struct {
+	Normalizers     []string `json:"normalizers,omitempty"`
+	Tokenizer       string   `json:"tokenizer,omitempty"`
+	CaseSensitive   *bool    `json:"case_sensitive,omitempty"`
+	MinPrefixLength int      `json:"min_prefix_length,omitempty"`
+	MaxResults      int      `json:"max_results,omitempty"`
+	Fuzzy           int      `json:"fuzzy,omitempty"`
+	Ranker          string   `json:"ranker,omitempty"`
+}
+
+// DictionarySettings reports the settings a dictionary overrides.
+type DictionarySettings struct {
+	Dict            string   `json:"dict"`
+	Normalizers     []string `json:"normalizers,omitempty"`
+	Tokenizer       string   `json:"tokenizer,omitempty"`
+	CaseSensitive   *bool    `json:"case_sensitive,omitempty"`
+	MinPrefixLength int      `json:"min_prefix_length,omitempty"`
+	MaxResults      int      `json:"max_results,omitempty"`
+	Fuzzy           int      `json:"fuzzy,omitempty"`
+	Ranker          string   `json:"ranker,omitempty"`
+}
+
+// SettingsResponse lists dictionary settings.
+type SettingsResponse struct {
+	Status   string               `json:"status"`
+	Settings []DictionarySettings `json:"settings"`
+}
+
+// WordEntry is a word with its ranking metadata.
+type WordEntry struct {
+	Word     string   `json:"word"`
+	Weight   float64  `json:"weight,omitempty"`
+	Contexts []string `json:"contexts,omitempty"`
+	Snippet  *Snippet `json:"snippet,omitempty"`
+}
+
+// ImportRequest is the body of an import: plain Words tagged with Contexts,
+// and Entries carrying their own weight and contexts.
+type ImportRequest struct {
+	Words    []string    `json:"words"`
+	Contexts []string    `json:"contexts,omitempty"`
+	Entries  []WordEntry `json:"entries,omitempty"`
+}
+
+// ImportConflict reports how an imported word that already existed was resolved.
+type ImportConflict struct {
+	Word   string `json:"word"`
+	Action string `json:"action"`
+}
+
+// ImportResponse summarizes an import.
+type ImportResponse struct {
+	Status    string           `json:"status"`
+	Dict      string           `json:"dict"`
+	Version   int              `json:"version"`
+	Words     int              `json:"words"`
+	Added     int              `json:"added"`
+	Conflicts []ImportConflict `json:"conflicts"`
+	Valid     bool             `json:"valid"`
+	// The fields below are only set by a dry run. Version is then the
+	// version currently served and Words the size after the import.
+	DryRun  bool         `json:"dry_run,omitempty"`
+	Invalid []FieldError `json:"invalid,omitempty"`
+	Quota   *ImportQuota `json:"quota,omitempty"`
+}
+
+// ImportQuota reports the size of a dictionary before and after a dry-run
+// import against its quota, and the quota error the import would fail with.
+type ImportQuota struct {
+	Words            int    `json:"words"`
+	MetadataBytes    int    `json:"metadata_bytes"`
+	NewWords         int    `json:"new_words"`
+	NewMetadataBytes int    `json:"new_metadata_bytes"`
+	MaxWords         int    `json:"max_words"`
+	MaxMetadataBytes int    `json:"max_metadata_bytes"`
+	Error            string `json:"error,omitempty"`
+}
+
+// DictionaryVersionResponse reports the version a dictionary now serves
+// after an import or rollback.
+type DictionaryVersionResponse struct {
+	Status  string `json:"status"`
+	Dict    string `json:"dict"`
+	Version int    `json:"version"`
+	Words   int    `json:"words"`
+	// RestoredFrom is the version a rollback restored; Version is the new
+	// version its words were stored as.
+	RestoredFrom int `json:"restored_from,omitempty"`
+}
+
+// DictionaryJobRequest represents the request body for copying or renaming
+// a dictionary. Overwrite allows replacing a target that already has words.
+type DictionaryJobRequest struct {
+	To        string `json:"to"`
+	Overwrite bool   `json:"overwrite,omitempty"`
+}
+
+// Job describes a background admin operation. State is pending, running,
+// succeeded or failed; Version and Words describe the target once it
+// succeeded, and Verification the findings of a verify job. Times are RFC 3339.
+type Job struct {
+	ID           string              `json:"id"`
+	Type         string              `json:"type"`
+	Dict         string              `json:"dict"`
+	Target       string              `json:"target"`
+	State        string              `json:"state"`
+	Version      int                 `json:"version,omitempty"`
+	Words        int                 `json:"words,omitempty"`
+	Verification *VerificationReport `json:"verification,omitempty"`
+	Error        string              `json:"error,omitempty"`
+	Created      string              `json:"created"`
+	Finished     string              `json:"finished,omitempty"`
+}
+
+// VerificationReport summarizes a cache consistency check: how many cached
+// entries were recomputed from the Trie, how many were skipped because they
+// can no longer be served, and those whose results diverged.
+type VerificationReport struct {
+	Sampled     int               `json:"sampled"`
+	Skipped     int               `json:"skipped"`
+	Divergent   int               `json:"divergent"`
+	Purged      int               `json:"purged"`
+	Divergences []CacheDivergence `json:"divergences"`
+}
+
+// CacheDivergence is a cached entry whose results differ from those
+// recomputed from the Trie. Kind is positive, negative or hot; result
+// lists are truncated.
+type CacheDivergence struct {
+	Kind     string   `json:"kind"`
+	Dict     string   `json:"dict"`
+	Prefix   string   `json:"prefix"`
+	Context  string   `json:"context,omitempty"`
+	Fuzzy    int      `json:"fuzzy,omitempty"`
+	Cached   []string `json:"cached"`
+	Expected []string `json:"expected"`
+}
+
+// JobResponse reports a single job.
+type JobResponse struct {
+	Status string `json:"status"`
+	Job    Job    `json:"job"`
+}
+
+// JobsResponse lists the recent jobs, newest first.
+type JobsResponse struct {
+	Status string `json:"status"`
+	Jobs   []Job  `json:"jobs"`
+}
+
+// VersionInfo describes a stored dictionary version.
+type VersionInfo struct {
+	Version int    `json:"version"`
+	Created string `json:"created"`
+	Bytes   int64  `json:"bytes"`
+	// Compaction marks a snapshot taken to truncate the write-ahead log
+	// rather than a version created by an import or rollback.
+	Compaction bool `json:"compaction,omitempty"`
+}
+
+// VersionsResponse lists the stored versions of a dictionary.
+type VersionsResponse struct {
+	Status   string        `json:"status"`
+	Dict     string        `json:"dict"`
+	Current  int           `json:"current"`
+	Versions []VersionInfo `json:"versions"`
+}
+
+// DiffResponse lists the words added and removed between two dictionary versions.
+type DiffResponse struct {
+	Status  string   `json:"status"`
+	Dict    string   `json:"dict"`
+	From    string   `json:"from"`
+	To      string   `json:"to"`
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+}
+
+// CacheEntry describes a cached suggest result.
+type CacheEntry struct {
+	Dict string `json:"dict"`
+	// Generation is the dictionary generation the result was computed at.
+	Generation uint64 `json:"generation,omitempty"`
+	// Options fingerprints the normalization and ranking settings in effect.
+	Options  string `json:"options,omitempty"`
+	Prefix   string `json:"prefix"`
+	Context  string `json:"context,omitempty"`
+	Fuzzy    int    `json:"fuzzy,omitempty"`
+	Limit    int    `json:"limit,omitempty"`
+	Negative bool   `json:"negative"`
+	Results  int    `json:"results"`
+	Bytes    int    `json:"bytes"`
+	// AgeSeconds is how long ago the entry was cached.
+	AgeSeconds float64 `json:"age_seconds"`
+}
+
+// CacheResponse lists the entries of the suggest cache.
+type CacheResponse struct {
+	Status  string       `json:"status"`
+	Count   int          `json:"count"`
+	Entries []CacheEntry `json:"entries"`
+}
+
+// CachePurgeResponse reports how many cache entries were purged.
+type CachePurgeResponse struct {
+	Status string `json:"status"`
+	Purged int    `json:"purged"`
+}
+
+// RouteLatency reports a route's latency percentiles in milliseconds over its
+// most recent requests.
+type RouteLatency struct {
+	Route string  `json:"route"`
+	Count uint64  `json:"count"`
+	Slow  uint64  `json:"slow"`
+	P50   float64 `json:"p50_ms"`
+	P90   float64 `json:"p90_ms"`
+	P99   float64 `json:"p99_ms"`
+	Max   float64 `json:"max_ms"`
+}
+
+// LabeledRouteLatency reports a route's latency percentiles in milliseconds
+// for one listener, API version and dictionary. Version and Dict are empty
+// for requests without one; Dict is "(other)" for requests counted once too
+// many distinct series were tracked.
+type LabeledRouteLatency struct {
+	Listener string  `json:"listener"`
+	Version  string  `json:"api_version,omitempty"`
+	Dict     string  `json:"dict,omitempty"`
+	Route    string  `json:"route"`
+	Count    uint64  `json:"count"`
+	Slow     uint64  `json:"slow"`
+	P50      float64 `json:"p50_ms"`
+	P90      float64 `json:"p90_ms"`
+	P99      float64 `json:"p99_ms"`
+	Max      float64 `json:"max_ms"`
+}
+
+// DictionaryStats reports the size of a dictionary.
+type DictionaryStats struct {
+	Dict          string         `json:"dict"`
+	Version       int            `json:"version"`
+	Words         int            `json:"words"`
+	MetadataBytes int            `json:"metadata_bytes"`
+	Allocator     AllocatorStats `json:"allocator"`
+	Interning     InterningStats `json:"interning"`
+}
+
+// InterningStats reports the strings a dictionary shares instead of
+// duplicating; SavedBytes is the memory saved so far.
+type InterningStats struct {
+	Strings    int   `json:"strings"`
+	Bytes      int   `json:"bytes"`
+	Hits       int64 `json:"hits"`
+	SavedBytes int64 `json:"saved_bytes"`
+}
+
+// AllocatorStats reports how a dictionary's trie nodes are allocated.
+// Nodes counts removed nodes too until the trie is cleared or rebuilt.
+type AllocatorStats struct {
+	Slabs     int `json:"slabs"`
+	Nodes     int `json:"nodes"`
+	LiveNodes int `json:"live_nodes"`
+	Bytes     int `json:"bytes"`
+}
+
+// HistogramResponse reports a dictionary's word length and first character
+// distributions, each sorted by key.
+type HistogramResponse struct {
+	Status     string         `json:"status"`
+	Dict       string         `json:"dict"`
+	Words      int            `json:"words"`
+	Lengths    []LengthBucket `json:"lengths"`
+	FirstChars []CharBucket   `json:"first_chars"`
+}
+
+// LengthBucket is the number of words of a length in characters.
+type LengthBucket struct {
+	Length int `json:"length"`
+	Words  int `json:"words"`
+}
+
+// CharBucket is the number of words starting with a character.
+type CharBucket struct {
+	Char  string `json:"char"`
+	Words int    `json:"words"`
+}
+
+// StatsResponse reports request latencies and dictionary sizes.
+type StatsResponse struct {
+	Status       string                `json:"status"`
+	Routes       []RouteLatency        `json:"routes"`
+	Labeled      []LabeledRouteLatency `json:"labeled_routes"`
+	Dictionaries []DictionaryStats     `json:"dictionaries"`
+	Cache        CacheStats            `json:"cache"`
+}
+
+// CacheStats reports suggest cache usage and the cost of invalidations:
+// how many entries each drops and how long the misses within a second
+// after one take, next to the latency of all misses. Latencies are in
+// milliseconds.
+type CacheStats struct {
+	Entries              int     `json:"entries"`
+	Flushes              int64   `json:"flushes"`
+	EntriesLost          int64   `json:"entries_lost"`
+	AvgEntriesLost       float64 `json:"avg_entries_lost"`
+	Hits                 int64   `json:"hits"`
+	Misses               int64   `json:"misses"`
+	MissLatency          float64 `json:"miss_latency_ms"`
+	PostFlushMisses      int64   `json:"post_flush_misses"`
+	PostFlushMissLatency float64 `json:"post_flush_miss_latency_ms"`
+}
+
+// Compaction states.
+const (
+	CompactionRunning = "running"
+	CompactionDone    = "done"
+)
+
+// Compaction describes a rebuild of a dictionary's trie. Node counts include
+// nodes left behind by deletes, which the rebuild reclaims.
+type Compaction struct {
+	Dict           string `json:"dict"`
+	State          string `json:"state"`
+	StartedAt      string `json:"started_at"`
+	FinishedAt     string `json:"finished_at,omitempty"`
+	NodesBefore    int    `json:"nodes_before,omitempty"`
+	NodesAfter     int    `json:"nodes_after,omitempty"`
+	ReclaimedNodes int    `json:"reclaimed_nodes,omitempty"`
+	ReclaimedBytes int    `json:"reclaimed_bytes,omitempty"`
+}
+
+// CompactResponse represents the response for starting or polling a compaction.
+type CompactResponse struct {
+	Status     string     `json:"status"`
+	Compaction Compaction `json:"compaction"`
+}
+
+// AliasRequest sets the canonical prefix an alias resolves to.
+type AliasRequest struct {
+	Target string `json:"target"`
+}
+
+// AliasesResponse lists a dictionary's prefix aliases.
+type AliasesResponse struct {
+	Status  string            `json:"status"`
+	Dict    string            `json:"dict"`
+	Aliases map[string]string `json:"aliases"`
+}
+
+// Shard is one server of a sharded deployment.
+type Shard struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+}
+
+// ShardsResponse describes how words are placed on the shards: each word is
+// owned by the shard of the first of Points ring points per shard at or
+// after the Hash of its first KeyLength characters.
+type ShardsResponse struct {
+	Status string `json:"status"`
+	// Self is the shard that served the response.
+	Self      string  `json:"self,omitempty"`
+	Hash      string  `json:"hash"`
+	KeyLength int     `json:"key_length"`
+	Points    int     `json:"points"`
+	Shards    []Shard `json:"shards"`
+}
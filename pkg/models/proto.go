@@ -0,0 +1,151 @@
+package models
+
+import (
+	"math"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// MarshalProto encodes the response as the ListWordsResponse message in
+// api/proto/autocomplete.proto.
+func (r ListWordsResponse) MarshalProto() []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendString(b, r.Status)
+	b = protowire.AppendTag(b, 2, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(r.Count))
+	for _, word := range r.Data {
+		b = protowire.AppendTag(b, 3, protowire.BytesType)
+		b = protowire.AppendString(b, word)
+	}
+	b = protowire.AppendTag(b, 4, protowire.VarintType)
+	b = protowire.AppendVarint(b, protowire.EncodeBool(r.Complete))
+	for _, char := range r.NextChars {
+		b = protowire.AppendTag(b, 5, protowire.BytesType)
+		b = protowire.AppendString(b, char)
+	}
+	if r.Truncated {
+		b = protowire.AppendTag(b, 6, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeBool(true))
+		b = protowire.AppendTag(b, 7, protowire.BytesType)
+		b = protowire.AppendString(b, r.Cursor)
+	}
+	return b
+}
+
+// ImportBatch is one message of an Importer.Import stream. Dict, Mode and
+// Conflict are read from the first message of the stream only.
+type ImportBatch struct {
+	Dict     string
+	Mode     string
+	Conflict string
+	ImportRequest
+}
+
+// UnmarshalProto decodes the ImportBatch message in
+// api/proto/autocomplete.proto.
+func (b *ImportBatch) UnmarshalProto(data []byte) error {
+	*b = ImportBatch{}
+	return consumeFields(data, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			b.Dict = string(v)
+		case num == 2 && typ == protowire.BytesType:
+			b.Mode = string(v)
+		case num == 3 && typ == protowire.BytesType:
+			b.Conflict = string(v)
+		case num == 4 && typ == protowire.BytesType:
+			b.Words = append(b.Words, string(v))
+		case num == 5 && typ == protowire.BytesType:
+			b.Contexts = append(b.Contexts, string(v))
+		case num == 6 && typ == protowire.BytesType:
+			var e WordEntry
+			if err := e.UnmarshalProto(v); err != nil {
+				return err
+			}
+			b.Entries = append(b.Entries, e)
+		}
+		return nil
+	})
+}
+
+// snippet returns the entry's snippet, adding an empty one if it has none.
+func (e *WordEntry) snippet() *Snippet {
+	if e.Snippet == nil {
+		e.Snippet = &Snippet{}
+	}
+	return e.Snippet
+}
+
+// UnmarshalProto decodes the WordEntry message in
+// api/proto/autocomplete.proto.
+func (e *WordEntry) UnmarshalProto(data []byte) error {
+	*e = WordEntry{}
+	return consumeFields(data, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			e.Word = string(v)
+		case num == 2 && typ == protowire.Fixed64Type:
+			bits, _ := protowire.ConsumeFixed64(v)
+			e.Weight = math.Float64frombits(bits)
+		case num == 3 && typ == protowire.BytesType:
+			e.Contexts = append(e.Contexts, string(v))
+		case num == 4 && typ == protowire.BytesType:
+			e.snippet().Description = string(v)
+		case num == 5 && typ == protowire.BytesType:
+			e.snippet().Icon = string(v)
+		}
+		return nil
+	})
+}
+
+// ImportSummary is the result of an Importer.Import stream.
+type ImportSummary struct {
+	Dict      string
+	Version   int
+	Words     int
+	Added     int
+	Conflicts int
+	// Batches and Received count the messages and words streamed.
+	Batches  int
+	Received int
+}
+
+// MarshalProto encodes the summary as the ImportSummary message in
+// api/proto/autocomplete.proto.
+func (s ImportSummary) MarshalProto() []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendString(b, s.Dict)
+	for i, n := range []int{s.Version, s.Words, s.Added, s.Conflicts, s.Batches, s.Received} {
+		b = protowire.AppendTag(b, protowire.Number(i+2), protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(n))
+	}
+	return b
+}
+
+// consumeFields calls fn with each field of a protobuf message. Varint and
+// fixed-width values are passed undecoded with their wire type; length
+// delimited values are passed without their length prefix.
+func consumeFields(data []byte, fn func(num protowire.Number, typ protowire.Type, v []byte) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		m := protowire.ConsumeFieldValue(num, typ, data)
+		if m < 0 {
+			return protowire.ParseError(m)
+		}
+		v := data[:m]
+		if typ == protowire.BytesType {
+			v, _ = protowire.ConsumeBytes(v)
+		}
+		if err := fn(num, typ, v); err != nil {
+			return err
+		}
+		data = data[m:]
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	_ "net/http/pprof"
+	"strings"
+
+	"github.com/cg011235/autocomplete/internal/handlers"
+	"github.com/cg011235/autocomplete/internal/middleware"
+	"github.com/cg011235/autocomplete/internal/oidc"
+	"github.com/gorilla/mux"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// routes builds the handlers served on each configured address.
+func routes(ctx context.Context, cfg *Config) (map[string]http.Handler, error) {
+	r := mux.NewRouter()
+
+	r.Use(middleware.LoggingMiddleware)
+	r.Use(middleware.LatencyMiddleware)
+	r.Use(middleware.IPFilterMiddleware)
+	r.Use(middleware.ConcurrencyMiddleware)
+	r.Use(middleware.ModeMiddleware)
+	r.Use(middleware.TimeoutMiddleware)
+
+	// Login routes do not require JWT middleware and are rate limited per client IP
+	if cfg.OIDC.Issuer != "" {
+		provider, err := oidc.NewProvider(ctx, cfg.OIDC)
+		if err != nil {
+			return nil, fmt.Errorf("configuring OIDC: %w", err)
+		}
+		handlers.SetOIDCProvider(provider)
+		r.Handle("/api/login", middleware.RateLimitMiddleware(http.HandlerFunc(handlers.OIDCLoginHandler))).Methods("GET")
+		r.Handle("/api/login/callback", middleware.RateLimitMiddleware(http.HandlerFunc(handlers.OIDCCallbackHandler))).Methods("GET")
+	} else {
+		handlers.SetOIDCProvider(nil)
+		r.Handle("/api/login", middleware.RateLimitMiddleware(http.HandlerFunc(handlers.LoginHandler))).Methods("POST")
+	}
+
+	// Widget routes are public, read-only and callable from the configured origins
+	if len(cfg.WidgetDictionaries) > 0 {
+		handlers.SetWidget(cfg.WidgetDictionaries, cfg.WidgetLimit, cfg.WidgetMaxLimit)
+		widget := r.PathPrefix("/widget").Subrouter()
+		widget.Use(middleware.CORS(cfg.WidgetOrigins, cfg.WidgetPreflightMaxAge))
+		widget.Use(middleware.ClientRateLimit(middleware.TierWidget))
+		widget.HandleFunc("/suggest", handlers.WidgetSuggestHandler).Methods("GET", "OPTIONS")
+	}
+
+	// Version 1 routes
+	v1 := r.PathPrefix("/api/v1").Subrouter()
+	v1.Use(middleware.APIVersion(middleware.Lifecycle{
+		Version:    "v1",
+		Deprecated: cfg.V1DeprecatedAt,
+		Sunset:     cfg.V1SunsetAt,
+		Successor:  cfg.V1Successor,
+		Disabled:   cfg.V1Disabled,
+	}))
+	v1.Use(middleware.JwtMiddleware)
+	v1.Use(middleware.RateLimitMiddleware)
+	v1.Use(handlers.KnownDictionaryMiddleware)
+	v1.HandleFunc("/", handlers.RootHandler).Methods("GET")
+	v1.HandleFunc("/words", handlers.AddWordsHandlerV1).Methods("POST")
+	v1.HandleFunc("/words", handlers.ListWordsHandlerV1).Methods("GET")
+	v1.HandleFunc("/words", handlers.DeleteWordsHandlerV1).Methods("DELETE")
+	v1.HandleFunc("/words/exists", handlers.WordsExistsHandlerV1).Methods("GET")
+	v1.HandleFunc("/words/exists", handlers.BatchExistsHandlerV1).Methods("POST")
+	v1.HandleFunc("/words/longest-prefix", handlers.LongestPrefixHandlerV1).Methods("GET")
+	v1.HandleFunc("/words/select", handlers.SelectWordHandlerV1).Methods("POST")
+	v1.HandleFunc("/entities", handlers.SuggestEntitiesHandlerV1).Methods("GET")
+	v1.HandleFunc("/entities/{id}", handlers.PutEntityHandlerV1).Methods("PUT")
+	v1.HandleFunc("/entities/{id}", handlers.DeleteEntityHandlerV1).Methods("DELETE")
+	v1.HandleFunc("/me", handlers.MeHandlerV1).Methods("GET")
+	v1.HandleFunc("/me/history", handlers.ClearHistoryHandlerV1).Methods("DELETE")
+	v1.HandleFunc("/changes", handlers.ChangesHandlerV1).Methods("GET")
+	v1.HandleFunc("/cluster/shards", handlers.ShardsHandler).Methods("GET")
+
+	// Admin routes are served on their own listener unless ADMIN_ADDR is empty
+	servers := map[string]http.Handler{cfg.ListenAddr: r}
+	if cfg.AdminAddr == "" {
+		adminRoutes(v1.PathPrefix("/admin").Subrouter())
+	} else {
+		ar := mux.NewRouter()
+		ar.Use(middleware.LoggingMiddleware)
+		ar.Use(middleware.LatencyMiddleware)
+		ar.Use(middleware.IPFilterMiddleware)
+		ar.Use(middleware.TimeoutMiddleware)
+		ar.PathPrefix("/debug/pprof/").Handler(http.DefaultServeMux)
+		admin := ar.PathPrefix("/api/v1/admin").Subrouter()
+		admin.Use(middleware.JwtMiddleware)
+		adminRoutes(admin)
+		servers[cfg.AdminAddr] = ar
+	}
+	if cfg.GRPCImport {
+		addr := cfg.AdminAddr
+		if addr == "" {
+			addr = cfg.ListenAddr
+		}
+		grpcServer := handlers.NewGRPCServer(cfg.GRPCMaxMessageBytes, cfg.GRPCMaxImportBytes)
+		// The importer checks the dictionary of the stream's first message
+		servers[addr] = withGRPC(servers[addr], middleware.IPFilterMiddleware(middleware.ModeMiddleware(
+			middleware.DictionariesCheckedByHandler(middleware.JwtMiddleware(middleware.RateLimitMiddleware(
+				middleware.RequireRole(middleware.RoleAdmin)(grpcServer)))))))
+	}
+	return servers, nil
+}
+
+// adminRoutes registers the admin routes on admin, which must already
+// authenticate the caller.
+func adminRoutes(admin *mux.Router) {
+	admin.Use(middleware.RequireRole(middleware.RoleAdmin))
+	admin.HandleFunc("/mode", handlers.GetModeHandler).Methods("GET")
+	admin.HandleFunc("/mode", handlers.SetModeHandler).Methods("POST")
+	admin.HandleFunc("/tiers", handlers.ListTiersHandler).Methods("GET")
+	admin.HandleFunc("/tiers/{name}", handlers.SetTierHandler).Methods("PUT")
+	admin.HandleFunc("/tiers/{name}", handlers.DeleteTierHandler).Methods("DELETE")
+	admin.HandleFunc("/consumers", handlers.ListConsumersHandler).Methods("GET")
+	admin.HandleFunc("/consumers/{name}", handlers.GetConsumerHandler).Methods("GET")
+	admin.HandleFunc("/consumers/{name}", handlers.SetConsumerHandler).Methods("PUT")
+	admin.HandleFunc("/consumers/{name}", handlers.DeleteConsumerHandler).Methods("DELETE")
+	admin.HandleFunc("/consumers/{name}/keys", handlers.IssueKeyHandler).Methods("POST")
+	admin.HandleFunc("/consumers/{name}/keys/{id}", handlers.RevokeKeyHandler).Methods("DELETE")
+	admin.HandleFunc("/users/{username}/tier", handlers.AssignTierHandler).Methods("PUT")
+	admin.HandleFunc("/quotas", handlers.ListQuotasHandler).Methods("GET")
+	admin.HandleFunc("/quotas/{dict}", handlers.SetQuotaHandler).Methods("PUT")
+	admin.HandleFunc("/settings", handlers.ListSettingsHandler).Methods("GET")
+	admin.HandleFunc("/settings/{dict}", handlers.SetSettingsHandler).Methods("PUT")
+	admin.HandleFunc("/import", handlers.ImportHandler).Methods("POST")
+	admin.HandleFunc("/dicts/{name}/copy", handlers.CopyDictionaryHandler).Methods("POST")
+	admin.HandleFunc("/dicts/{name}/rename", handlers.RenameDictionaryHandler).Methods("POST")
+	admin.HandleFunc("/jobs", handlers.ListJobsHandler).Methods("GET")
+	admin.HandleFunc("/jobs/{id}", handlers.GetJobHandler).Methods("GET")
+	admin.HandleFunc("/versions", handlers.ListVersionsHandler).Methods("GET")
+	admin.HandleFunc("/rollback", handlers.RollbackHandler).Methods("POST")
+	admin.HandleFunc("/diff", handlers.DiffHandler).Methods("GET", "POST")
+	admin.HandleFunc("/export", handlers.ExportHandler).Methods("GET")
+	admin.HandleFunc("/cache", handlers.ListCacheHandler).Methods("GET")
+	admin.HandleFunc("/cache", handlers.PurgeCacheHandler).Methods("DELETE")
+	admin.HandleFunc("/verify", handlers.VerifyCacheHandler).Methods("POST")
+	admin.HandleFunc("/stats", handlers.StatsHandler).Methods("GET")
+	admin.HandleFunc("/histogram", handlers.HistogramHandler).Methods("GET")
+	admin.HandleFunc("/compact", handlers.CompactionHandler).Methods("GET")
+	admin.HandleFunc("/compact", handlers.CompactHandler).Methods("POST")
+	admin.HandleFunc("/aliases", handlers.ListAliasesHandler).Methods("GET")
+	admin.HandleFunc("/aliases/{alias}", handlers.SetAliasHandler).Methods("PUT")
+	admin.HandleFunc("/aliases/{alias}", handlers.DeleteAliasHandler).Methods("DELETE")
+}
+
+// newHTTPServer returns a server for h with the configured connection
+// handling. HTTP/2 is offered over cleartext since TLS is terminated in front
+// of the service; interactive clients multiplex their keystroke requests over
+// it.
+func newHTTPServer(cfg *Config, h http.Handler) *http.Server {
+	if cfg.HTTP2 {
+		h = h2c.NewHandler(h, &http2.Server{
+			MaxConcurrentStreams: uint32(cfg.HTTP2MaxConcurrentStreams),
+			IdleTimeout:          cfg.IdleTimeout,
+		})
+	}
+	srv := &http.Server{
+		Handler:           h,
+		IdleTimeout:       cfg.IdleTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+	}
+	srv.SetKeepAlivesEnabled(cfg.KeepAlive)
+	return srv
+}
+
+// withGRPC sends gRPC requests to g and every other request to h.
+func withGRPC(h, g http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			g.ServeHTTP(w, r)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// setIPRules installs the trusted proxies and the global and admin client
+// address rules.
+func setIPRules(cfg *Config) error {
+	proxies, err := middleware.ParseCIDRs(cfg.TrustedProxies)
+	if err != nil {
+		return fmt.Errorf("TRUSTED_PROXIES: %w", err)
+	}
+	middleware.SetTrustedProxies(proxies)
+	allow, err := middleware.ParseCIDRs(cfg.IPAllow)
+	if err != nil {
+		return fmt.Errorf("IP_ALLOW: %w", err)
+	}
+	deny, err := middleware.ParseCIDRs(cfg.IPDeny)
+	if err != nil {
+		return fmt.Errorf("IP_DENY: %w", err)
+	}
+	adminAllow, err := middleware.ParseCIDRs(cfg.AdminIPAllow)
+	if err != nil {
+		return fmt.Errorf("ADMIN_IP_ALLOW: %w", err)
+	}
+	middleware.SetIPRules([]middleware.IPRule{
+		{PathPrefix: "/", Allow: allow, Deny: deny},
+		{PathPrefix: "/api/v1/admin/", Allow: adminAllow},
+	})
+	return nil
+}
@@ -0,0 +1,531 @@
+// Package server assembles the autocomplete service: its routes, middleware,
+// background jobs and listeners. The cmd/server binary is a thin wrapper
+// around it, and a larger Go program can embed the whole service by calling
+// New and Start instead of running a separate process.
+//
+// The service keeps its dictionaries, caches and settings in process-wide
+// state, so only one Server may be live in a process at a time. New resets
+// that state and Shutdown detaches what the Server opened, so another Server
+// may be created once the previous one is shut down.
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cg011235/autocomplete/internal/analytics"
+	"github.com/cg011235/autocomplete/internal/bus"
+	"github.com/cg011235/autocomplete/internal/changelog"
+	"github.com/cg011235/autocomplete/internal/config"
+	"github.com/cg011235/autocomplete/internal/dictionary"
+	"github.com/cg011235/autocomplete/internal/handlers"
+	"github.com/cg011235/autocomplete/internal/jwks"
+	"github.com/cg011235/autocomplete/internal/keyboard"
+	"github.com/cg011235/autocomplete/internal/listen"
+	"github.com/cg011235/autocomplete/internal/lockout"
+	"github.com/cg011235/autocomplete/internal/middleware"
+	"github.com/cg011235/autocomplete/internal/normalize"
+	"github.com/cg011235/autocomplete/internal/personal"
+	"github.com/cg011235/autocomplete/internal/querylog"
+	"github.com/cg011235/autocomplete/internal/ranking"
+	"github.com/cg011235/autocomplete/internal/redislimit"
+	"github.com/cg011235/autocomplete/internal/refresh"
+	"github.com/cg011235/autocomplete/internal/rotate"
+	"github.com/cg011235/autocomplete/internal/store"
+	"github.com/cg011235/autocomplete/internal/trie"
+	"github.com/cg011235/autocomplete/internal/validate"
+	"github.com/cg011235/autocomplete/internal/webhook"
+	"github.com/cg011235/autocomplete/pkg/shard"
+)
+
+// Config is the configuration of the service.
+type Config = config.Config
+
+// LoadConfig reads the configuration from environment variables, with the
+// same defaults as the standalone server.
+func LoadConfig() (*Config, error) {
+	return config.Load()
+}
+
+// ErrLive is returned by New while another Server in the process has not
+// been shut down.
+var ErrLive = errors.New("server: another Server is live in this process")
+
+// live is set from New until Shutdown.
+var live atomic.Bool
+
+// Server is the autocomplete service, configured and ready to serve.
+type Server struct {
+	// Listen opens the listener for an address in the forms of
+	// Config.ListenAddr. It defaults to TCP, Unix domain sockets and systemd
+	// socket activation; set it before Start to hand over listeners, e.g.
+	// inherited across an upgrade.
+	Listen func(addr string) (net.Listener, error)
+
+	cfg *Config
+	// handlers maps each address to the routes served on it.
+	handlers map[string]http.Handler
+	popular  *analytics.Popular
+	// closers release the sinks and clients opened by New, in reverse order.
+	closers []func()
+	ctx     context.Context
+	cancel  context.CancelFunc
+
+	mu      sync.Mutex
+	running []*http.Server
+	errs    chan error
+	closed  bool
+	// handedOff is set while a replacement process continues the event
+	// sequence, see Handoff.
+	handedOff bool
+}
+
+// New configures the service from cfg: it loads the stored dictionaries,
+// starts the background jobs and builds the routes, but does not listen
+// until Start.
+func New(cfg *Config) (*Server, error) {
+	if !live.CompareAndSwap(false, true) {
+		return nil, ErrLive
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Server{cfg: cfg, ctx: ctx, cancel: cancel, errs: make(chan error, 2)}
+	if err := s.init(); err != nil {
+		s.release()
+		return nil, err
+	}
+	return s, nil
+}
+
+// init loads the stored state, starts the background jobs and builds the
+// routes.
+func (s *Server) init() error {
+	cfg := s.cfg
+	if err := configure(s.ctx, cfg); err != nil {
+		return err
+	}
+	if cfg.DataDir != "" {
+		if err := handlers.LoadAccess(); err != nil {
+			return fmt.Errorf("loading consumers: %w", err)
+		}
+		if cfg.WAL {
+			handlers.SetWriteAheadLog(cfg.WALSync)
+		}
+		if err := handlers.LoadLatestVersions(cfg.Repair); err != nil {
+			return fmt.Errorf("loading dictionaries: %w", err)
+		}
+		go handlers.RunCompactor(s.ctx, cfg.SnapshotInterval, int64(cfg.SnapshotLogBytes))
+	}
+	if err := s.startServices(); err != nil {
+		return err
+	}
+	var err error
+	s.handlers, err = routes(s.ctx, cfg)
+	return err
+}
+
+// BuildSnapshot stores the words of files, "-" for standard input, in the
+// given format as a new version of the named dictionary in cfg.DataDir,
+// without serving. It returns the version and the number of words stored.
+func BuildSnapshot(cfg *Config, dict string, files []string, format string) (version, words int, err error) {
+	if cfg.DataDir == "" {
+		return 0, 0, errors.New("building a snapshot requires DATA_DIR")
+	}
+	if !live.CompareAndSwap(false, true) {
+		return 0, 0, ErrLive
+	}
+	defer live.Store(false)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := configure(ctx, cfg); err != nil {
+		return 0, 0, err
+	}
+	defer handlers.SetVersionStore(nil)
+	return handlers.BuildSnapshot(dict, files, format)
+}
+
+// Handler returns the routes served on cfg.ListenAddr, including the admin
+// routes if cfg.AdminAddr is empty. An embedding program may mount it on its
+// own server instead of calling Start.
+func (s *Server) Handler() http.Handler {
+	return s.handlers[s.cfg.ListenAddr]
+}
+
+// AdminHandler returns the admin and debug routes served on cfg.AdminAddr,
+// or nil if they are served by Handler.
+func (s *Server) AdminHandler() http.Handler {
+	if s.cfg.AdminAddr == "" {
+		return nil
+	}
+	return s.handlers[s.cfg.AdminAddr]
+}
+
+// Start listens on the configured addresses and serves in the background.
+// Errors of a listener failing while serving are reported on Errors.
+func (s *Server) Start() error {
+	open := s.Listen
+	if open == nil {
+		open = listen.Listen
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return http.ErrServerClosed
+	}
+	for addr, h := range s.handlers {
+		l, err := open(addr)
+		if err != nil {
+			for _, srv := range s.running {
+				srv.Close()
+			}
+			s.running = nil
+			return fmt.Errorf("listening on %s: %w", addr, err)
+		}
+		srv := newHTTPServer(s.cfg, h)
+		s.running = append(s.running, srv)
+		log.Printf("Serving on %s", addr)
+		go func() {
+			if err := srv.Serve(l); !errors.Is(err, http.ErrServerClosed) {
+				s.errs <- err
+			}
+		}()
+	}
+	return nil
+}
+
+// Errors reports listeners failing while serving.
+func (s *Server) Errors() <-chan error {
+	return s.errs
+}
+
+// Shutdown stops accepting connections and drains in-flight requests until
+// ctx is done, then stops the background jobs, saves the popular queries,
+// closes the write-ahead logs and releases the process-wide state for
+// another Server.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	var err error
+	for _, srv := range s.running {
+		if e := srv.Shutdown(ctx); e != nil && err == nil {
+			err = fmt.Errorf("draining: %w", e)
+		}
+	}
+	if s.popular != nil && s.cfg.DataDir != "" {
+		if err := s.popular.Save(filepath.Join(s.cfg.DataDir, "analytics", "popular.json")); err != nil {
+			log.Printf("saving popular queries: %v", err)
+		}
+	}
+	if s.cfg.DataDir != "" && s.cfg.WAL && !s.handedOff {
+		if err := handlers.SaveEventSequence(); err != nil {
+			log.Printf("saving event sequence: %v", err)
+		}
+	}
+	s.release()
+	return err
+}
+
+// Handoff prepares for a replacement process to take over the same data
+// directory: it switches to read-only mode, unless already more restrictive,
+// closes the write-ahead logs so only the replacement appends to them and
+// stores the event sequence for the replacement to continue. Call it before
+// starting the replacement; if that fails, resume reopens the logs and
+// restores the previous mode, staying read-only if the logs cannot be
+// reopened.
+func (s *Server) Handoff() (resume func() error) {
+	m, after := middleware.Mode()
+	if m == middleware.ModeNormal {
+		middleware.SetMode(middleware.ModeReadOnly, after)
+	}
+	handlers.CloseWriteAheadLogs()
+	durable := s.cfg.DataDir != "" && s.cfg.WAL
+	if durable {
+		if err := handlers.SaveEventSequence(); err != nil {
+			log.Printf("saving event sequence: %v", err)
+		}
+		s.mu.Lock()
+		s.handedOff = true
+		s.mu.Unlock()
+	}
+	return func() error {
+		if durable {
+			if err := handlers.DiscardEventSequence(); err != nil {
+				log.Printf("discarding event sequence: %v", err)
+			}
+			s.mu.Lock()
+			s.handedOff = false
+			s.mu.Unlock()
+			if err := handlers.ReopenWriteAheadLogs(); err != nil {
+				return err
+			}
+		}
+		middleware.SetMode(m, after)
+		return nil
+	}
+}
+
+// release stops the background jobs, detaches the sinks and clients New
+// opened from the handlers and middleware, and closes them.
+func (s *Server) release() {
+	s.cancel()
+	handlers.CloseWriteAheadLogs()
+	handlers.SetVersionStore(nil)
+	handlers.ResetEventSinks()
+	handlers.SetQueryLog(nil)
+	handlers.SetQueryAnalytics(nil)
+	handlers.SetChangeLog(nil)
+	middleware.SetKeySet(nil, middleware.ExternalClaims{})
+	middleware.SetLimiter(middleware.LocalLimiter{})
+	middleware.SetAccessLog(nil, "")
+	for i := len(s.closers) - 1; i >= 0; i-- {
+		s.closers[i]()
+	}
+	live.Store(false)
+}
+
+// configure resets the process-wide state, applies the settings shared by
+// serving and building snapshots, and opens the version store. Background
+// work it starts stops when ctx is done.
+func configure(ctx context.Context, cfg *Config) error {
+	handlers.ResetDictionaries()
+	middleware.ResetAccess()
+	middleware.ResetMode()
+	middleware.SetSecretKey([]byte(cfg.SecretKey))
+	if len(cfg.JWTKeys) > 0 {
+		keys := make(map[string][]byte, len(cfg.JWTKeys))
+		for _, k := range cfg.JWTKeys {
+			keys[k.ID] = []byte(k.Secret)
+		}
+		middleware.SetVerificationKeys(keys, cfg.JWTUnkeyedUntil)
+		handlers.SetSigningKey(cfg.JWTKeys[0].ID, []byte(cfg.JWTKeys[0].Secret))
+	} else {
+		middleware.SetVerificationKeys(nil, time.Time{})
+		handlers.SetSigningKey("", []byte(cfg.SecretKey))
+	}
+	middleware.SetClaimsValidation(cfg.JWTIssuers, cfg.JWTAudiences, cfg.JWTClockSkew)
+	var issuer, audience string
+	if len(cfg.JWTIssuers) > 0 {
+		issuer = cfg.JWTIssuers[0]
+	}
+	if len(cfg.JWTAudiences) > 0 {
+		audience = cfg.JWTAudiences[0]
+	}
+	handlers.SetTokenClaims(issuer, audience)
+	handlers.SetAdminUsers(cfg.AdminUsers)
+	if cfg.LoginMaxFailures > 0 {
+		handlers.SetLoginLockout(lockout.New(cfg.LoginMaxFailures, cfg.LoginLockout, cfg.LoginMaxLockout, cfg.LoginFailureWindow))
+	} else {
+		handlers.SetLoginLockout(nil)
+	}
+	if cfg.JWKSURL != "" {
+		middleware.SetKeySet(jwks.New(ctx, cfg.JWKSURL, cfg.JWKSRefresh), middleware.ExternalClaims{
+			Issuer:      cfg.JWKSIssuer,
+			Audience:    cfg.JWKSAudience,
+			RoleClaim:   cfg.JWKSRoleClaim,
+			AdminValues: cfg.JWKSAdminValues,
+		})
+	} else {
+		middleware.SetKeySet(nil, middleware.ExternalClaims{})
+	}
+	handlers.SetCachePolicy(handlers.CachePolicy{
+		TTL:         cfg.CacheTTL,
+		MaxAge:      cfg.CacheMaxAge,
+		Public:      cfg.CachePublic,
+		NegativeTTL: cfg.NegativeCacheTTL,
+	})
+	handlers.SetResponseBudget(cfg.MaxResponseBytes)
+
+	rules := validate.Rules{
+		MaxLength:      cfg.MaxWordLength,
+		Graphemes:      cfg.GraphemeMatching,
+		Allowed:        cfg.WordCharacters,
+		MaxDescription: cfg.SnippetMaxDescription,
+		MaxIconURL:     cfg.SnippetMaxIconURL,
+	}
+	if err := validate.SetRules(rules); err != nil {
+		return fmt.Errorf("WORD_CHARACTERS: %w", err)
+	}
+	handlers.SetGraphemeMatching(cfg.GraphemeMatching)
+	pipeline, err := normalize.Parse(cfg.Normalizers)
+	if err != nil {
+		return fmt.Errorf("NORMALIZERS: %w", err)
+	}
+	tokenizer, err := normalize.LookupTokenizer(cfg.Tokenizer)
+	if err != nil {
+		return fmt.Errorf("TOKENIZER: %w", err)
+	}
+	handlers.SetCanonicalization(pipeline, tokenizer, cfg.DisplayPolicy)
+	trie.BloomMaxLen, trie.BloomBits = cfg.BloomMaxLen, cfg.BloomBits
+	trie.SortedChildren = cfg.SortedChildren
+	trie.SlabSize = cfg.NodeSlabSize
+	trie.InternStrings = cfg.InternStrings
+	trie.ParallelWorkers, trie.ParallelMinWords = cfg.ParallelSearchWorkers, cfg.ParallelSearchMinWords
+	handlers.Dictionaries().SetDefaultQuota(dictionary.Quota{
+		MaxWords:         cfg.QuotaMaxWords,
+		MaxMetadataBytes: cfg.QuotaMaxMetadataBytes,
+	})
+	if cfg.DataDir != "" {
+		versions, err := store.NewVersionStore(filepath.Join(cfg.DataDir, "versions"), cfg.VersionsKeep)
+		if err != nil {
+			return fmt.Errorf("opening version store: %w", err)
+		}
+		if versions.Compression, err = store.ParseCompression(cfg.SnapshotCompression); err != nil {
+			return fmt.Errorf("SNAPSHOT_COMPRESSION: %w", err)
+		}
+		handlers.SetVersionStore(versions)
+	} else {
+		handlers.SetVersionStore(nil)
+	}
+	return nil
+}
+
+// startServices sets up sharding, ranking, analytics and event delivery and
+// starts their background jobs.
+func (s *Server) startServices() error {
+	cfg, ctx := s.cfg, s.ctx
+	handlers.SetDictionaryPolicy(cfg.DefaultDictionary, cfg.AutoCreateDictionaries)
+	if len(cfg.Shards) > 0 {
+		list, err := shard.Parse(cfg.Shards)
+		if err != nil {
+			return fmt.Errorf("SHARDS: %w", err)
+		}
+		m, err := shard.New(list, cfg.ShardKeyLength, cfg.ShardPoints)
+		if err != nil {
+			return fmt.Errorf("SHARDS: %w", err)
+		}
+		if cfg.ShardID != "" && !slices.ContainsFunc(list, func(s shard.Shard) bool { return s.ID == cfg.ShardID }) {
+			return fmt.Errorf("SHARD_ID: %q is not one of SHARDS", cfg.ShardID)
+		}
+		handlers.SetShardMap(m, cfg.ShardID)
+	} else {
+		handlers.SetShardMap(nil, "")
+	}
+	sources, err := refresh.ParseSources(cfg.RefreshSources)
+	if err != nil {
+		return fmt.Errorf("REFRESH_SOURCES: %w", err)
+	}
+	limits := handlers.RefreshLimits{MaxShrink: cfg.RefreshMaxShrink, MaxGrowth: cfg.RefreshMaxGrowth}
+	go handlers.RunRefresher(ctx, sources, cfg.RefreshInterval, limits)
+	if cfg.PopularQueriesMax > 0 {
+		s.popular = analytics.NewPopular(cfg.PopularQueriesMax)
+		if cfg.DataDir != "" {
+			path := filepath.Join(cfg.DataDir, "analytics", "popular.json")
+			if err := s.popular.Load(path); err != nil {
+				log.Printf("loading popular queries: %v", err)
+			}
+			go s.popular.RunSaver(ctx, path, time.Minute)
+		}
+		handlers.SetQueryAnalytics(s.popular)
+		handlers.WarmCache(cfg.CacheWarmTop)
+		go handlers.RunHotPrefixes(ctx, cfg.HotPrefixes, cfg.HotPrefixRefresh)
+	} else {
+		handlers.SetQueryAnalytics(nil)
+	}
+	if cfg.QueryLogSampleRate > 0 {
+		var sinks []querylog.Sink
+		if cfg.QueryLogDir != "" {
+			sink, err := querylog.NewFileSink(cfg.QueryLogDir, int64(cfg.QueryLogMaxBytes), cfg.QueryLogMaxFiles)
+			if err != nil {
+				return fmt.Errorf("opening query log: %w", err)
+			}
+			sinks = append(sinks, sink)
+		}
+		if cfg.QueryLogURL != "" {
+			sinks = append(sinks, querylog.NewHTTPSink(cfg.QueryLogURL))
+		}
+		queryLog := querylog.New(cfg.QueryLogSampleRate, []byte(cfg.QueryLogSalt), cfg.QueryLogBatch, cfg.QueryLogFlushInterval, sinks...)
+		s.closers = append(s.closers, queryLog.Close)
+		handlers.SetQueryLog(queryLog)
+	} else {
+		handlers.SetQueryLog(nil)
+	}
+	ranking.ContextBoost = cfg.ContextBoost
+	if err := handlers.SetShadowRanking(cfg.ShadowRanking, cfg.ShadowRankingPercent); err != nil {
+		return fmt.Errorf("SHADOW_RANKING: %w", err)
+	}
+	if cfg.KeyboardLayout != "" {
+		layout, err := keyboard.New(cfg.KeyboardLayout)
+		if err != nil {
+			return fmt.Errorf("KEYBOARD_LAYOUT: %w", err)
+		}
+		handlers.SetFuzzyMatching(cfg.FuzzyMaxEdits, layout.SubstitutionCost(cfg.AdjacentKeyCost))
+	} else {
+		handlers.SetFuzzyMatching(cfg.FuzzyMaxEdits, keyboard.UniformCost)
+	}
+	if cfg.Personalization {
+		handlers.SetPersonalization(personal.NewHistory(cfg.PersonalHistorySize), cfg.PersonalBoost)
+	} else {
+		handlers.SetPersonalization(nil, cfg.PersonalBoost)
+	}
+	handlers.ResetEventSinks()
+	if cfg.DataDir != "" && cfg.WAL {
+		if err := handlers.LoadEventSequence(); err != nil {
+			return fmt.Errorf("loading event sequence: %w", err)
+		}
+	}
+	if len(cfg.WebhookURLs) > 0 {
+		notifier := webhook.NewNotifier(cfg.WebhookURLs, []byte(cfg.WebhookSecret), cfg.WebhookMaxRetries, cfg.WebhookBackoff)
+		s.closers = append(s.closers, notifier.Close)
+		handlers.AddEventSink(notifier)
+	}
+	if cfg.EventBusURL != "" {
+		publisher, err := bus.NewNATSPublisher(cfg.EventBusURL, cfg.EventBusSubject)
+		if err != nil {
+			return fmt.Errorf("connecting to event bus: %w", err)
+		}
+		s.closers = append(s.closers, func() { publisher.Close() })
+		handlers.AddEventSink(publisher)
+	}
+	if cfg.ChangeLogSize > 0 {
+		handlers.SetChangeLog(changelog.NewRing(cfg.ChangeLogSize))
+	} else {
+		handlers.SetChangeLog(nil)
+	}
+	decayer := ranking.NewDecayer(handlers.Decay, cfg.DecayHalfLife, cfg.DecayInterval)
+	decayer.Decayed = handlers.InvalidateCaches
+	go decayer.Run(ctx)
+
+	if cfg.RateLimitRedisURL != "" {
+		limiter, err := redislimit.New(cfg.RateLimitRedisURL, cfg.RateLimitRedisPrefix, middleware.LocalLimiter{})
+		if err != nil {
+			return fmt.Errorf("connecting to rate limit store: %w", err)
+		}
+		s.closers = append(s.closers, func() { limiter.Close() })
+		middleware.SetLimiter(limiter)
+	} else {
+		middleware.SetLimiter(middleware.LocalLimiter{})
+	}
+
+	middleware.SetTimeouts(cfg.RequestTimeout, cfg.RouteTimeouts)
+	middleware.SetMaxInFlight(cfg.MaxInFlight, cfg.OverloadRetryAfter)
+	switch cfg.AccessLog {
+	case "":
+		middleware.SetAccessLog(nil, cfg.AccessLogFormat)
+	case "-":
+		middleware.SetAccessLog(os.Stdout, cfg.AccessLogFormat)
+	default:
+		accessLog, err := rotate.Open(cfg.AccessLog, int64(cfg.AccessLogMaxBytes), cfg.AccessLogMaxAge, cfg.AccessLogMaxFiles)
+		if err != nil {
+			return fmt.Errorf("opening access log: %w", err)
+		}
+		s.closers = append(s.closers, func() { accessLog.Close() })
+		middleware.SetAccessLog(accessLog, cfg.AccessLogFormat)
+	}
+	middleware.SetSlowRequests(cfg.SlowRequestThreshold, handlers.SlowRequestInfo)
+	handlers.SetDebugToken(cfg.DebugToken)
+	middleware.SetPublicAccess(cfg.PublicRoutes, cfg.PublicDictionaries)
+	return setIPRules(cfg)
+}
@@ -0,0 +1,516 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cg011235/autocomplete/internal/handlers"
+	"github.com/cg011235/autocomplete/internal/webhook"
+	"github.com/cg011235/autocomplete/pkg/server"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+// volatile are the response fields that change from run to run; their
+// values are masked before comparing with the golden files.
+var volatile = map[string]bool{
+	"token":    true,
+	"key":      true,
+	"id":       true,
+	"created":  true,
+	"finished": true,
+	"bytes":    true,
+	"epoch":    true,
+	"time":     true,
+}
+
+// step is one request of a flow and its recorded response.
+type step struct {
+	Name   string `json:"name"`
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Status int    `json:"status"`
+	Body   any    `json:"body"`
+}
+
+// harness runs the whole service in the test process, persisting to a
+// temporary data directory that survives restarts.
+type harness struct {
+	t    *testing.T
+	cfg  *server.Config
+	srv  *server.Server
+	http *httptest.Server
+	// token or apiKey authenticate requests, the key taking precedence.
+	token  string
+	apiKey string
+	steps  []step
+	// redacted maps values appearing in request paths to placeholders.
+	redacted map[string]string
+}
+
+func newHarness(t *testing.T, wal bool) *harness {
+	t.Setenv("SECRET_KEY", "integration-test-secret")
+	t.Setenv("ADMIN_USERS", "user1")
+	t.Setenv("DATA_DIR", t.TempDir())
+	t.Setenv("WAL", strconv.FormatBool(wal))
+	t.Setenv("ADMIN_ADDR", "")
+	cfg, err := server.LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &harness{t: t, cfg: cfg}
+	h.start()
+	t.Cleanup(h.stop)
+	return h
+}
+
+func (h *harness) start() {
+	srv, err := server.New(h.cfg)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	h.srv, h.http = srv, httptest.NewServer(srv.Handler())
+}
+
+func (h *harness) stop() {
+	if h.srv == nil {
+		return
+	}
+	h.http.Close()
+	if err := h.srv.Shutdown(context.Background()); err != nil {
+		h.t.Fatal(err)
+	}
+	h.srv = nil
+}
+
+// restart shuts the service down and starts it again on the same data.
+func (h *harness) restart() {
+	h.stop()
+	h.start()
+}
+
+// do sends a request, checks its status and records the response as the
+// named step of the flow.
+func (h *harness) do(name, method, path string, body any, status int) map[string]any {
+	h.t.Helper()
+	var payload io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			h.t.Fatal(err)
+		}
+		payload = bytes.NewReader(raw)
+	}
+	req, err := http.NewRequest(method, h.http.URL+path, payload)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if h.apiKey != "" {
+		req.Header.Set("X-API-Key", h.apiKey)
+	} else if h.token != "" {
+		req.Header.Set("Authorization", "Bearer "+h.token)
+	}
+	resp, err := h.http.Client().Do(req)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var decoded map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		h.t.Fatalf("%s: decoding response: %v", name, err)
+	}
+	if resp.StatusCode != status {
+		h.t.Fatalf("%s: got status %d, want %d: %v", name, resp.StatusCode, status, decoded)
+	}
+	for value, placeholder := range h.redacted {
+		path = strings.ReplaceAll(path, value, placeholder)
+	}
+	h.steps = append(h.steps, step{Name: name, Method: method, Path: path, Status: resp.StatusCode, Body: mask(decoded)})
+	return decoded
+}
+
+// redact records placeholder instead of value in the paths of later steps.
+func (h *harness) redact(value, placeholder string) {
+	if h.redacted == nil {
+		h.redacted = map[string]string{}
+	}
+	h.redacted[value] = placeholder
+}
+
+// mask returns a copy of v with the values of volatile fields replaced.
+func mask(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		masked := make(map[string]any, len(v))
+		for k, field := range v {
+			if volatile[k] {
+				masked[k] = "<" + k + ">"
+			} else {
+				masked[k] = mask(field)
+			}
+		}
+		return masked
+	case []any:
+		masked := make([]any, len(v))
+		for i := range v {
+			masked[i] = mask(v[i])
+		}
+		return masked
+	}
+	return v
+}
+
+// check compares the recorded flow with testdata/<name>.golden.json, or
+// rewrites it with -update.
+func (h *harness) check(name string) {
+	h.t.Helper()
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(h.steps); err != nil {
+		h.t.Fatal(err)
+	}
+	got := buf.Bytes()
+	path := filepath.Join("testdata", name+".golden.json")
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			h.t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		h.t.Fatalf("%v (run with -update to create it)", err)
+	}
+	if !bytes.Equal(got, want) {
+		h.t.Errorf("%s differs from the recorded flow; run with -update and review the diff\ngot:\n%s", path, got)
+	}
+}
+
+func TestDictionaryLifecycle(t *testing.T) {
+	h := newHarness(t, true)
+
+	login := h.do("login", "POST", "/api/login", map[string]string{"username": "user1", "password": "password123"}, http.StatusOK)
+	h.token, _ = login["token"].(string)
+	h.do("import", "POST", "/api/v1/admin/import?dict=fruit", map[string][]string{
+		"words": {"apple", "apricot", "avocado", "banana", "blueberry"},
+	}, http.StatusOK)
+	h.do("suggest", "GET", "/api/v1/words?dict=fruit&prefix=ap", nil, http.StatusOK)
+	h.do("delete", "DELETE", "/api/v1/words?dict=fruit", map[string]string{"word": "apricot"}, http.StatusOK)
+	h.do("suggest after delete", "GET", "/api/v1/words?dict=fruit&prefix=ap", nil, http.StatusOK)
+
+	h.restart()
+	h.do("suggest after restart", "GET", "/api/v1/words?dict=fruit&prefix=a", nil, http.StatusOK)
+	h.do("deleted word after restart", "GET", "/api/v1/words/exists?dict=fruit&word=apricot", nil, http.StatusOK)
+	h.do("versions after restart", "GET", "/api/v1/admin/versions?dict=fruit", nil, http.StatusOK)
+	h.check("lifecycle")
+}
+
+func TestRestartResetsRuntimeState(t *testing.T) {
+	h := newHarness(t, true)
+
+	login := h.do("login", "POST", "/api/login", map[string]string{"username": "user1", "password": "password123"}, http.StatusOK)
+	h.token, _ = login["token"].(string)
+	h.do("read-only mode", "POST", "/api/v1/admin/mode", map[string]string{"mode": "read-only"}, http.StatusOK)
+	h.do("add in read-only mode", "POST", "/api/v1/words?dict=fruit", map[string][]string{"words": {"apple"}}, http.StatusServiceUnavailable)
+	h.do("batch exists in read-only mode", "POST", "/api/v1/words/exists?dict=fruit", map[string][]string{"words": {"apple"}}, http.StatusOK)
+
+	h.restart()
+	h.do("mode after restart", "GET", "/api/v1/admin/mode", nil, http.StatusOK)
+	h.do("add after restart", "POST", "/api/v1/words?dict=fruit", map[string][]string{"words": {"apple"}}, http.StatusOK)
+	h.check("restart")
+}
+
+func TestHandoffResume(t *testing.T) {
+	h := newHarness(t, true)
+
+	login := h.do("login", "POST", "/api/login", map[string]string{"username": "user1", "password": "password123"}, http.StatusOK)
+	h.token, _ = login["token"].(string)
+	h.do("add", "POST", "/api/v1/words?dict=fruit", map[string][]string{"words": {"apple"}}, http.StatusOK)
+	resume := h.srv.Handoff()
+	h.do("add during handoff", "POST", "/api/v1/words?dict=fruit", map[string][]string{"words": {"banana"}}, http.StatusServiceUnavailable)
+	if err := resume(); err != nil {
+		t.Fatal(err)
+	}
+	h.do("add after resume", "POST", "/api/v1/words?dict=fruit", map[string][]string{"words": {"cherry"}}, http.StatusOK)
+
+	h.restart()
+	h.do("list after restart", "GET", "/api/v1/words?dict=fruit", nil, http.StatusOK)
+	h.check("handoff")
+}
+
+func TestChangesAcrossRestart(t *testing.T) {
+	h := newHarness(t, true)
+
+	login := h.do("login", "POST", "/api/login", map[string]string{"username": "user1", "password": "password123"}, http.StatusOK)
+	h.token, _ = login["token"].(string)
+	h.do("add", "POST", "/api/v1/words?dict=fruit", map[string][]string{"words": {"apple", "banana"}}, http.StatusOK)
+	changes := h.do("changes", "GET", "/api/v1/changes", nil, http.StatusOK)
+	epoch, _ := changes["epoch"].(string)
+	h.redact(epoch, "<epoch>")
+	h.do("changes since", "GET", "/api/v1/changes?since=1&epoch="+epoch, nil, http.StatusOK)
+	h.do("changes without epoch", "GET", "/api/v1/changes?since=1", nil, http.StatusBadRequest)
+
+	h.restart()
+	h.do("add after restart", "POST", "/api/v1/words?dict=fruit", map[string][]string{"words": {"cherry", "damson"}}, http.StatusOK)
+	h.do("changes since epoch before restart", "GET", "/api/v1/changes?since=1&epoch="+epoch, nil, http.StatusOK)
+
+	// A process resuming after a failed handoff numbers events in a new epoch.
+	resume := h.srv.Handoff()
+	if err := resume(); err != nil {
+		t.Fatal(err)
+	}
+	h.do("changes after failed handoff", "GET", "/api/v1/changes?since=4&epoch="+epoch, nil, http.StatusGone)
+	h.restart()
+	h.do("changes after restart", "GET", "/api/v1/changes?since=4&epoch="+epoch, nil, http.StatusGone)
+	h.check("changes")
+}
+
+func TestResponseBudgetCursor(t *testing.T) {
+	t.Setenv("MAX_RESPONSE_BYTES", "20")
+	h := newHarness(t, true)
+
+	login := h.do("login", "POST", "/api/login", map[string]string{"username": "user1", "password": "password123"}, http.StatusOK)
+	h.token, _ = login["token"].(string)
+	h.do("import", "POST", "/api/v1/admin/import?dict=fruit", map[string][]string{
+		"words": {"apple", "apricot", "avocado", "banana"},
+	}, http.StatusOK)
+	first := h.do("truncated", "GET", "/api/v1/words?dict=fruit&prefix=a", nil, http.StatusOK)
+	cursor, _ := first["cursor"].(string)
+	h.do("continued", "GET", "/api/v1/words?dict=fruit&prefix=a&cursor="+cursor, nil, http.StatusOK)
+
+	h.restart()
+	h.do("continued after restart", "GET", "/api/v1/words?dict=fruit&prefix=a&cursor="+cursor, nil, http.StatusOK)
+	h.do("add", "POST", "/api/v1/words?dict=fruit", map[string][]string{"words": {"acerola"}}, http.StatusOK)
+	h.do("continued after change", "GET", "/api/v1/words?dict=fruit&prefix=a&cursor="+cursor, nil, http.StatusGone)
+	h.check("cursor")
+}
+
+func TestEntitiesSurviveRestart(t *testing.T) {
+	h := newHarness(t, true)
+
+	login := h.do("login", "POST", "/api/login", map[string]string{"username": "user1", "password": "password123"}, http.StatusOK)
+	h.token, _ = login["token"].(string)
+	h.do("add word", "POST", "/api/v1/words?dict=shop", map[string][]string{"words": {"Galaxy"}}, http.StatusOK)
+	h.do("put entity", "PUT", "/api/v1/entities/e1?dict=shop", map[string]any{"name": "Galaxy", "fields": []string{"Samsung Phone"}}, http.StatusOK)
+	h.do("suggest folded", "GET", "/api/v1/entities?dict=shop&prefix=Sam", nil, http.StatusOK)
+
+	h.restart()
+	h.do("suggest after restart", "GET", "/api/v1/entities?dict=shop&prefix=GAL", nil, http.StatusOK)
+	h.do("delete entity", "DELETE", "/api/v1/entities/e1?dict=shop", nil, http.StatusOK)
+	h.do("words after delete", "GET", "/api/v1/words?dict=shop", nil, http.StatusOK)
+	h.check("entities")
+}
+
+func TestAliasesSurviveRestart(t *testing.T) {
+	h := newHarness(t, true)
+
+	login := h.do("login", "POST", "/api/login", map[string]string{"username": "user1", "password": "password123"}, http.StatusOK)
+	h.token, _ = login["token"].(string)
+	h.do("add words", "POST", "/api/v1/words?dict=paint", map[string][]string{"words": {"colorful", "colour"}}, http.StatusOK)
+	h.do("set alias", "PUT", "/api/v1/admin/aliases/Colour?dict=paint", map[string]string{"target": "COLOR"}, http.StatusOK)
+
+	h.restart()
+	h.do("aliases after restart", "GET", "/api/v1/admin/aliases?dict=paint", nil, http.StatusOK)
+	h.do("suggest through alias", "GET", "/api/v1/words?dict=paint&prefix=ColourF", nil, http.StatusOK)
+	h.do("delete alias", "DELETE", "/api/v1/admin/aliases/COLOUR?dict=paint", nil, http.StatusOK)
+	h.check("aliases")
+}
+
+func TestRollbackSurvivesRestart(t *testing.T) {
+	for _, wal := range []bool{false, true} {
+		t.Run("wal="+strconv.FormatBool(wal), func(t *testing.T) {
+			h := newHarness(t, wal)
+			login := h.do("login", "POST", "/api/login", map[string]string{"username": "user1", "password": "password123"}, http.StatusOK)
+			h.token, _ = login["token"].(string)
+			h.do("import", "POST", "/api/v1/admin/import?dict=fruit", map[string][]string{"words": {"apple", "apricot"}}, http.StatusOK)
+			h.do("bad import", "POST", "/api/v1/admin/import?dict=fruit", map[string][]string{"words": {"asparagus"}}, http.StatusOK)
+			h.do("rollback", "POST", "/api/v1/admin/rollback?dict=fruit&version=1", nil, http.StatusOK)
+			h.do("add after rollback", "POST", "/api/v1/words?dict=fruit", map[string][]string{"words": {"avocado"}}, http.StatusOK)
+
+			h.restart()
+			h.do("suggest after restart", "GET", "/api/v1/words?dict=fruit&prefix=a", nil, http.StatusOK)
+			h.do("versions after restart", "GET", "/api/v1/admin/versions?dict=fruit", nil, http.StatusOK)
+			h.check("rollback-wal-" + strconv.FormatBool(wal))
+		})
+	}
+}
+
+func TestAccessControl(t *testing.T) {
+	h := newHarness(t, true)
+
+	h.do("suggest without token", "GET", "/api/v1/words?prefix=a", nil, http.StatusUnauthorized)
+	h.do("bad password", "POST", "/api/login", map[string]string{"username": "user1", "password": "wrong"}, http.StatusUnauthorized)
+	login := h.do("login", "POST", "/api/login", map[string]string{"username": "user1", "password": "password123"}, http.StatusOK)
+	h.token, _ = login["token"].(string)
+	h.do("import", "POST", "/api/v1/admin/import?dict=fruit", map[string][]string{"words": {"apple", "banana"}}, http.StatusOK)
+	h.do("add consumer", "PUT", "/api/v1/admin/consumers/reader", map[string]any{"dictionaries": []string{"fruit"}}, http.StatusOK)
+	key := h.do("issue key", "POST", "/api/v1/admin/consumers/reader/keys", nil, http.StatusCreated)
+	id, _ := key["id"].(string)
+	h.redact(id, "<id>")
+
+	h.apiKey, _ = key["key"].(string)
+	h.do("suggest with key", "GET", "/api/v1/words?dict=fruit&prefix=b", nil, http.StatusOK)
+	h.do("other dictionary with key", "GET", "/api/v1/words?dict=veg&prefix=b", nil, http.StatusForbidden)
+	h.do("admin route with key", "GET", "/api/v1/admin/consumers?dict=fruit", nil, http.StatusForbidden)
+
+	h.apiKey = ""
+	h.do("add admin consumer", "PUT", "/api/v1/admin/consumers/ops", map[string]any{"role": "admin", "dictionaries": []string{"fruit"}}, http.StatusOK)
+	opsKey := h.do("issue admin key", "POST", "/api/v1/admin/consumers/ops/keys", nil, http.StatusCreated)
+	h.apiKey, _ = opsKey["key"].(string)
+	h.do("settings with admin key", "PUT", "/api/v1/admin/settings/fruit", map[string]any{"max_results": 5}, http.StatusOK)
+	h.do("other dictionary in path with admin key", "PUT", "/api/v1/admin/settings/veg?dict=fruit", map[string]any{"max_results": 5}, http.StatusForbidden)
+	h.do("copy with admin key", "POST", "/api/v1/admin/dicts/fruit/copy", map[string]string{"to": "veg"}, http.StatusForbidden)
+	h.do("consumer with admin key", "PUT", "/api/v1/admin/consumers/ops", map[string]any{"role": "admin"}, http.StatusForbidden)
+	h.do("versions with admin key", "GET", "/api/v1/admin/versions?dict=fruit", nil, http.StatusOK)
+	h.do("mode with admin key", "POST", "/api/v1/admin/mode?dict=fruit", map[string]string{"mode": "read-only"}, http.StatusForbidden)
+	h.do("stats with admin key", "GET", "/api/v1/admin/stats?dict=fruit", nil, http.StatusForbidden)
+
+	h.apiKey = ""
+	h.do("revoke key", "DELETE", "/api/v1/admin/consumers/reader/keys/"+id, nil, http.StatusOK)
+	h.apiKey, _ = key["key"].(string)
+	h.do("suggest with revoked key", "GET", "/api/v1/words?dict=fruit&prefix=b", nil, http.StatusUnauthorized)
+	h.check("access")
+}
+
+func TestETagAcrossRestart(t *testing.T) {
+	h := newHarness(t, true)
+
+	login := h.do("login", "POST", "/api/login", map[string]string{"username": "user1", "password": "password123"}, http.StatusOK)
+	h.token, _ = login["token"].(string)
+	h.do("add", "POST", "/api/v1/words?dict=fruit", map[string][]string{"words": {"apple"}}, http.StatusOK)
+	get := func(tag string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest("GET", h.http.URL+"/api/v1/words?dict=fruit&prefix=a", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+h.token)
+		if tag != "" {
+			req.Header.Set("If-None-Match", tag)
+		}
+		resp, err := h.http.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	tag := get("").Header.Get("ETag")
+
+	h.restart()
+	if resp := get(tag); resp.StatusCode != http.StatusNotModified {
+		t.Fatalf("after restart: got status %d, want 304", resp.StatusCode)
+	}
+	h.do("add after restart", "POST", "/api/v1/words?dict=fruit", map[string][]string{"words": {"apricot"}}, http.StatusOK)
+	if resp := get(tag); resp.StatusCode != http.StatusOK {
+		t.Fatalf("after add: got status %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestDecayAcrossRestart(t *testing.T) {
+	h := newHarness(t, true)
+
+	login := h.do("login", "POST", "/api/login", map[string]string{"username": "user1", "password": "password123"}, http.StatusOK)
+	h.token, _ = login["token"].(string)
+	h.do("add", "POST", "/api/v1/words?dict=fruit", map[string][]string{"words": {"apple"}}, http.StatusOK)
+	h.do("select", "POST", "/api/v1/words/select?dict=fruit", map[string]string{"word": "apple"}, http.StatusOK)
+	handlers.Decay(0.5)
+
+	h.restart()
+	h.do("explain after restart", "GET", "/api/v1/words?dict=fruit&prefix=a&explain=true", nil, http.StatusOK)
+	h.check("decay")
+}
+
+func TestExplainTies(t *testing.T) {
+	h := newHarness(t, false)
+
+	login := h.do("login", "POST", "/api/login", map[string]string{"username": "user1", "password": "password123"}, http.StatusOK)
+	h.token, _ = login["token"].(string)
+	h.do("add", "POST", "/api/v1/words?dict=fruit", map[string][]string{"words": {"apple", "apricot", "avocado"}}, http.StatusOK)
+	h.do("select", "POST", "/api/v1/words/select?dict=fruit", map[string]string{"word": "avocado"}, http.StatusOK)
+	h.do("explain", "GET", "/api/v1/words?dict=fruit&prefix=a&explain=true", nil, http.StatusOK)
+	h.check("explain")
+}
+
+func TestCompactionsKeepImportedVersions(t *testing.T) {
+	t.Setenv("VERSIONS_KEEP", "1")
+	t.Setenv("SNAPSHOT_INTERVAL", "5ms")
+	t.Setenv("SNAPSHOT_LOG_BYTES", "1")
+	h := newHarness(t, true)
+
+	login := h.do("login", "POST", "/api/login", map[string]string{"username": "user1", "password": "password123"}, http.StatusOK)
+	h.token, _ = login["token"].(string)
+	h.do("import", "POST", "/api/v1/admin/import?dict=fruit", map[string][]string{"words": {"apple"}}, http.StatusOK)
+	// current polls the version the dictionary is served from.
+	current := func() float64 {
+		t.Helper()
+		req, err := http.NewRequest("GET", h.http.URL+"/api/v1/admin/versions?dict=fruit", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+h.token)
+		resp, err := h.http.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var decoded struct{ Current float64 }
+		if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+			t.Fatal(err)
+		}
+		return decoded.Current
+	}
+	for i, word := range []string{"banana", "cherry", "damson"} {
+		h.do("add "+word, "POST", "/api/v1/words?dict=fruit", map[string][]string{"words": {word}}, http.StatusOK)
+		for deadline := time.Now().Add(5 * time.Second); current() != float64(i+2); {
+			if time.Now().After(deadline) {
+				t.Fatalf("%s was not compacted", word)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	h.do("versions", "GET", "/api/v1/admin/versions?dict=fruit", nil, http.StatusOK)
+	h.check("compactions")
+}
+
+func TestWebhookSignature(t *testing.T) {
+	deliveries := make(chan *http.Request, 10)
+	bodies := make(chan []byte, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		deliveries <- r
+		bodies <- body
+	}))
+	defer receiver.Close()
+	t.Setenv("WEBHOOK_URLS", receiver.URL)
+	t.Setenv("WEBHOOK_SECRET", "webhook-secret")
+	h := newHarness(t, false)
+
+	login := h.do("login", "POST", "/api/login", map[string]string{"username": "user1", "password": "password123"}, http.StatusOK)
+	h.token, _ = login["token"].(string)
+	h.do("add", "POST", "/api/v1/words?dict=fruit", map[string][]string{"words": {"apple"}}, http.StatusOK)
+	select {
+	case r := <-deliveries:
+		body := <-bodies
+		timestamp := r.Header.Get(webhook.TimestampHeader)
+		if want := "sha256=" + webhook.Sign([]byte("webhook-secret"), timestamp, body); r.Header.Get(webhook.SignatureHeader) != want {
+			t.Fatalf("got signature %q over timestamp %q, want %q", r.Header.Get(webhook.SignatureHeader), timestamp, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no webhook delivered")
+	}
+}
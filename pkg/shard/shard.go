@@ -0,0 +1,125 @@
+// Package shard maps words to the servers holding them, for dictionaries
+// split across several servers by consistent hashing. Servers advertise
+// their Map at GET /api/v1/cluster/shards; clients rebuild it with New and
+// send each request to the shards Route returns.
+package shard
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// Hash names the hash function placing keys and shards on the ring: 64-bit
+// xxHash (XXH64, seed 0) of the key, and of "<id>#<n>" for the n-th point of
+// a shard.
+const Hash = "xxh64"
+
+// Shard is one server holding part of every sharded dictionary.
+type Shard struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+}
+
+// Map is a consistent hash ring of shards. A word is owned by the shard of
+// the first ring point at or after the hash of its key, its first KeyLength
+// characters, so all words sharing a key live on one shard.
+type Map struct {
+	Shards []Shard
+	// KeyLength is how many leading characters of a word are hashed.
+	// Prefixes at least this long are served by a single shard.
+	KeyLength int
+	// Points is how many points each shard has on the ring; more points
+	// spread words more evenly.
+	Points int
+
+	ring []point
+}
+
+type point struct {
+	hash  uint64
+	shard int
+}
+
+// New builds the ring of shards.
+func New(shards []Shard, keyLength, points int) (*Map, error) {
+	if len(shards) == 0 {
+		return nil, errors.New("no shards")
+	}
+	if keyLength <= 0 || points <= 0 {
+		return nil, errors.New("key length and points must be positive")
+	}
+	m := &Map{Shards: shards, KeyLength: keyLength, Points: points}
+	seen := make(map[string]bool, len(shards))
+	for i, s := range shards {
+		if s.ID == "" || seen[s.ID] {
+			return nil, fmt.Errorf("missing or duplicate shard id %q", s.ID)
+		}
+		seen[s.ID] = true
+		for n := 0; n < points; n++ {
+			m.ring = append(m.ring, point{hash: hash(s.ID + "#" + strconv.Itoa(n)), shard: i})
+		}
+	}
+	sort.Slice(m.ring, func(i, j int) bool {
+		if m.ring[i].hash != m.ring[j].hash {
+			return m.ring[i].hash < m.ring[j].hash
+		}
+		return shards[m.ring[i].shard].ID < shards[m.ring[j].shard].ID
+	})
+	return m, nil
+}
+
+// Parse parses "id=url" items into shards.
+func Parse(items []string) ([]Shard, error) {
+	shards := make([]Shard, 0, len(items))
+	for _, item := range items {
+		id, url, ok := strings.Cut(item, "=")
+		if !ok || id == "" || url == "" {
+			return nil, fmt.Errorf("invalid shard %q, want id=url", item)
+		}
+		shards = append(shards, Shard{ID: id, URL: url})
+	}
+	return shards, nil
+}
+
+// Key returns the part of word hashed to place it, its first KeyLength
+// characters.
+func (m *Map) Key(word string) string {
+	n := 0
+	for i := range word {
+		if n == m.KeyLength {
+			return word[:i]
+		}
+		n++
+	}
+	return word
+}
+
+// Owner returns the shard holding word.
+func (m *Map) Owner(word string) Shard {
+	h := hash(m.Key(word))
+	i := sort.Search(len(m.ring), func(i int) bool { return m.ring[i].hash >= h })
+	if i == len(m.ring) {
+		i = 0
+	}
+	return m.Shards[m.ring[i].shard]
+}
+
+// Route returns the shards to query for words starting with prefix: the
+// owner of the prefix if it is at least KeyLength characters long, and
+// every shard otherwise, whose results the client merges.
+func (m *Map) Route(prefix string) []Shard {
+	if utf8.RuneCountInString(prefix) >= m.KeyLength {
+		return []Shard{m.Owner(prefix)}
+	}
+	return m.Shards
+}
+
+func hash(s string) uint64 {
+	return xxhash.Sum64String(s)
+}